@@ -0,0 +1,112 @@
+package acl
+
+import (
+	"net"
+	"net/netip"
+)
+
+// ACL matches addresses against CIDR allow and deny lists.
+// Deny entries take precedence over allow entries.
+// An empty allow list allows every address not denied.
+type ACL struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// New creates a *ACL from lists of CIDRs or single addresses
+func New(allow, deny []string) (*ACL, error) {
+	a := &ACL{}
+	var err error
+	if a.Allow, err = ParsePrefixes(allow); err != nil {
+		return nil, err
+	}
+
+	if a.Deny, err = ParsePrefixes(deny); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ParsePrefixes parses a list of CIDRs, a single address is treated as a host prefix
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return nil, err
+			}
+
+			addr = addr.Unmap()
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// Allowed reports whether addr is allowed by the ACL.
+// A nil *ACL allows everything.
+func (a *ACL) Allowed(addr netip.Addr) bool {
+	if a == nil {
+		return true
+	}
+
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return false
+	}
+
+	if contains(a.Deny, addr) {
+		return false
+	}
+
+	return len(a.Allow) == 0 || contains(a.Allow, addr)
+}
+
+// AllowedAddr reports whether the IP of a net.Addr is allowed by the ACL
+func (a *ACL) AllowedAddr(remote net.Addr) bool {
+	if a == nil {
+		return true
+	}
+
+	return a.Allowed(AddrOf(remote))
+}
+
+// AddrOf returns the IP address of a net.Addr.
+// The zero netip.Addr is returned if the address has no IP.
+func AddrOf(remote net.Addr) netip.Addr {
+	switch v := remote.(type) {
+	case *net.UDPAddr:
+		return v.AddrPort().Addr().Unmap()
+	case *net.TCPAddr:
+		return v.AddrPort().Addr().Unmap()
+	case *net.IPAddr:
+		addr, _ := netip.AddrFromSlice(v.IP)
+		return addr.Unmap()
+	case nil:
+		return netip.Addr{}
+	}
+
+	addrPort, err := netip.ParseAddrPort(remote.String())
+	if err != nil {
+		addr, _ := netip.ParseAddr(remote.String())
+		return addr.Unmap()
+	}
+
+	return addrPort.Addr().Unmap()
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
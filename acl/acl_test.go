@@ -0,0 +1,63 @@
+package acl
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	a, err := New([]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"10.0.0.1", true},
+		{"10.1.2.3", false},
+		{"::ffff:10.0.0.1", true},
+		{"192.0.2.1", true},
+		{"192.0.2.2", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	}
+
+	for _, test := range tests {
+		if got := a.Allowed(netip.MustParseAddr(test.addr)); got != test.allowed {
+			t.Errorf("%s: got %v expected %v", test.addr, got, test.allowed)
+		}
+	}
+
+	if a.Allowed(netip.Addr{}) {
+		t.Errorf("invalid address allowed")
+	}
+
+	var nilACL *ACL
+	if !nilACL.Allowed(netip.MustParseAddr("198.51.100.1")) {
+		t.Errorf("nil ACL should allow everything")
+	}
+}
+
+func TestDenyOnly(t *testing.T) {
+	a, err := New(nil, []string{"198.51.100.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.AllowedAddr(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 6343}) {
+		t.Errorf("192.0.2.1 should be allowed")
+	}
+
+	if a.AllowedAddr(&net.UDPAddr{IP: net.ParseIP("198.51.100.7"), Port: 6343}) {
+		t.Errorf("198.51.100.7 should be denied")
+	}
+}
+
+func TestParsePrefixesError(t *testing.T) {
+	if _, err := ParsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
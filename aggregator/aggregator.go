@@ -0,0 +1,371 @@
+package aggregator
+
+import (
+	"cmp"
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry the sampling corrected counters of a key over a window
+type Entry struct {
+	Key
+	Bytes   uint64
+	Packets uint64
+	// Flows the number of records counted
+	Flows uint64
+	// Error the largest number of Bytes that may belong to other keys, when keys were evicted
+	Error uint64
+}
+
+// Window the flows of a window of time, by key
+type Window struct {
+	Start time.Time
+	End   time.Time
+	// Entries the counters by key, the most bytes first
+	Entries []Entry
+	// Records the number of records counted
+	Records uint64
+	// Evicted the number of keys evicted to bound the memory
+	Evicted uint64
+}
+
+// WindowHandler handles the windows once they are complete.
+// The window is owned by the handler.
+type WindowHandler interface {
+	HandleWindow(w *Window)
+}
+
+// The WindowHandlerFunc type is an adapter to allow the use of
+// ordinary functions as Window handlers. If f is a function
+// with the appropriate signature, WindowHandlerFunc(w) is a
+// Handler that calls f.
+type WindowHandlerFunc func(w *Window)
+
+// HandleWindow calls f(w)
+func (f WindowHandlerFunc) HandleWindow(w *Window) {
+	f(w)
+}
+
+// Config the configuration of an Aggregator
+type Config struct {
+	// Fields the fields the flows are grouped by.
+	// Default : FiveTuple
+	Fields Field
+	// SrcMask the prefix lengths the source addresses are grouped by.
+	// Default : the full addresses
+	SrcMask Mask
+	// DstMask the prefix lengths the destination addresses are grouped by.
+	// Default : the full addresses
+	DstMask Mask
+	// Window the length of the windows.
+	// Default : 1 minute
+	Window time.Duration
+	// Slide the time between the start of two windows, a divisor of Window.
+	// Windows overlap when Slide is shorter than Window.
+	// Default : Window, the windows are tumbling
+	Slide time.Duration
+	// Delay how long a window waits for late records once its end is passed.
+	// Default : 0
+	Delay time.Duration
+	// MaxKeys the number of keys counted for each slide of a window, the keys with the fewest bytes
+	// are evicted past it. Bounds the memory when the number of keys explodes.
+	// Default : 0, no limit
+	MaxKeys int
+	// TopK the number of entries of a window handed to the handler, the ones with the most bytes.
+	// Default : 0, every entry
+	TopK int
+	// Handler handles the windows.
+	// Required.
+	Handler WindowHandler
+}
+
+var (
+	ErrNoHandler = errors.New("aggregator: no handler defined")
+	ErrSlide     = errors.New("aggregator: the slide must divide the window")
+)
+
+// Aggregator sums the sampling corrected bytes and packets of flow records by key over windows of time.
+// Records are placed in time by their end time, the windows are complete once a record
+// or Advance moves the time past their end and Delay.
+// The records only move the time up to the local clock plus Delay, so that an exporter whose clock is ahead
+// does not make the records of the others late.
+// It is safe for concurrent use, the handler is called with the lock held and must not call the Aggregator.
+type Aggregator struct {
+	config Config
+	lock   sync.Mutex
+	// panes the open panes by index, the index of a pane is its start divided by the slide
+	panes map[int64]*pane
+	// panesPerWindow the number of panes of a window
+	panesPerWindow int64
+	// next the index of the pane whose end completes the next window
+	next    int64
+	started bool
+	// watermark the latest time seen, bounded by the clock for the records
+	watermark time.Time
+	late      atomic.Uint64
+	records   []flowrecord.FlowRecord
+	clock     func() time.Time
+}
+
+// New create an *Aggregator
+func New(config Config) (*Aggregator, error) {
+	if config.Handler == nil {
+		return nil, ErrNoHandler
+	}
+
+	if config.Fields == 0 {
+		config.Fields = FiveTuple
+	}
+
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+
+	if config.Slide <= 0 {
+		config.Slide = config.Window
+	}
+
+	if config.Window%config.Slide != 0 {
+		return nil, ErrSlide
+	}
+
+	config.SrcMask.setDefaults()
+	config.DstMask.setDefaults()
+	return &Aggregator{
+		config:         config,
+		panes:          make(map[int64]*pane),
+		panesPerWindow: int64(config.Window / config.Slide),
+		clock:          time.Now,
+	}, nil
+}
+
+// Late returns the number of records dropped for belonging to a completed window
+func (a *Aggregator) Late() uint64 {
+	return a.late.Load()
+}
+
+// Add counts a record
+func (a *Aggregator) Add(r *flowrecord.FlowRecord) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.add(r)
+}
+
+// AddRecords counts records
+func (a *Aggregator) AddRecords(records []flowrecord.FlowRecord) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for i := range records {
+		a.add(&records[i])
+	}
+}
+
+// HandleNetFlow5 counts the flows of a NetFlow v5 packet received from remote,
+// the Aggregator is a flowcollector.NetFlow5Handler
+func (a *Aggregator) HandleNetFlow5(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.records = flowrecord.AppendNetFlow5(a.records[:0], acl.AddrOf(remote), header, flows)
+	for i := range a.records {
+		a.add(&a.records[i])
+	}
+}
+
+// HandleSFlow counts the flow samples of an sFlow datagram received from remote now,
+// the Aggregator is a flowcollector.SFlowHandler
+func (a *Aggregator) HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.records = flowrecord.AppendSFlow(a.records[:0], acl.AddrOf(remote), header, samples, a.clock())
+	for i := range a.records {
+		a.add(&a.records[i])
+	}
+}
+
+// timeOf the time a record is placed at
+func (a *Aggregator) timeOf(r *flowrecord.FlowRecord) time.Time {
+	switch {
+	case !r.End.IsZero():
+		return r.End
+	case !r.Start.IsZero():
+		return r.Start
+	}
+
+	return a.clock()
+}
+
+// indexOf the index of the pane holding t
+func (a *Aggregator) indexOf(t time.Time) int64 {
+	nanos := t.UnixNano()
+	slide := int64(a.config.Slide)
+	index := nanos / slide
+	if nanos < 0 && nanos%slide != 0 {
+		index--
+	}
+
+	return index
+}
+
+// endOf the end of the pane at index
+func (a *Aggregator) endOf(index int64) time.Time {
+	return time.Unix(0, (index+1)*int64(a.config.Slide))
+}
+
+// closed reports whether the pane at index is complete at the watermark
+func (a *Aggregator) closed(index int64) bool {
+	return !a.endOf(index).Add(a.config.Delay).After(a.watermark)
+}
+
+func (a *Aggregator) add(r *flowrecord.FlowRecord) {
+	t := a.timeOf(r)
+	index := a.indexOf(t)
+	// the time of the records comes from the clocks of the exporters, one ahead of ours must not
+	// complete the windows the others are still sending to
+	seen := t
+	if now := a.clock().Add(a.config.Delay); seen.After(now) {
+		seen = now
+	}
+
+	if !a.started {
+		a.started = true
+		a.next = a.indexOf(seen.Add(-a.config.Delay))
+		a.watermark = seen
+	}
+
+	if index < a.next {
+		a.late.Add(1)
+		return
+	}
+
+	p, found := a.panes[index]
+	if !found {
+		p = newPane(a.config.MaxKeys)
+		a.panes[index] = p
+	}
+
+	key := keyOf(r, a.config.Fields, &a.config.SrcMask, &a.config.DstMask)
+	p.add(key, r.ScaledBytes(), r.ScaledPackets())
+	a.advance(seen)
+}
+
+// Advance moves the time to now, handing the windows completed meanwhile.
+// Without records flowing windows are only completed by Advance.
+func (a *Aggregator) Advance(now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !a.started {
+		return
+	}
+
+	a.advance(now)
+}
+
+// Flush hands every window holding records, complete or not, and starts over
+func (a *Aggregator) Flush() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for len(a.panes) > 0 {
+		a.skipEmpty(math.MaxInt64)
+		a.emit()
+	}
+
+	a.started = false
+}
+
+func (a *Aggregator) advance(now time.Time) {
+	if now.After(a.watermark) {
+		a.watermark = now
+	}
+
+	for len(a.panes) > 0 {
+		// the windows still open may receive records
+		a.skipEmpty(a.indexOf(a.watermark.Add(-a.config.Delay)))
+		if !a.closed(a.next) {
+			return
+		}
+
+		a.emit()
+	}
+
+	// nothing is pending, the next window is the one of the watermark
+	if next := a.indexOf(a.watermark.Add(-a.config.Delay)); next > a.next {
+		a.next = next
+	}
+}
+
+// skipEmpty moves next past the windows without records, up to limit
+func (a *Aggregator) skipEmpty(limit int64) {
+	lowest := a.next + 1
+	for index := range a.panes {
+		if index <= a.next {
+			return
+		}
+
+		lowest = min(lowest, index)
+	}
+
+	// every pane is after next, the windows up to the lowest are empty
+	a.next = max(a.next, min(lowest, limit))
+}
+
+// emit hands the window ending with the pane at next and drops the pane no later window needs
+func (a *Aggregator) emit() {
+	first := a.next - a.panesPerWindow + 1
+	w := &Window{
+		Start: time.Unix(0, first*int64(a.config.Slide)),
+		End:   a.endOf(a.next),
+	}
+
+	merged := make(map[Key]*Entry)
+	for index := first; index <= a.next; index++ {
+		p := a.panes[index]
+		if p == nil {
+			continue
+		}
+
+		w.Records += p.records
+		w.Evicted += p.evicted
+		for key, e := range p.entries {
+			m, found := merged[key]
+			if !found {
+				m = &Entry{Key: key}
+				merged[key] = m
+			}
+
+			m.Bytes += e.Bytes
+			m.Packets += e.Packets
+			m.Flows += e.Flows
+			m.Error += e.Error
+		}
+	}
+
+	delete(a.panes, first)
+	a.next++
+	if w.Records == 0 {
+		return
+	}
+
+	w.Entries = make([]Entry, 0, len(merged))
+	for _, e := range merged {
+		w.Entries = append(w.Entries, *e)
+	}
+
+	slices.SortFunc(w.Entries, func(x, y Entry) int {
+		return cmp.Compare(y.Bytes, x.Bytes)
+	})
+
+	if a.config.TopK > 0 && len(w.Entries) > a.config.TopK {
+		w.Entries = w.Entries[:a.config.TopK]
+	}
+
+	a.config.Handler.HandleWindow(w)
+}
@@ -0,0 +1,230 @@
+package aggregator
+
+import (
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var (
+	_ flowcollector.NetFlow5Handler = (*Aggregator)(nil)
+	_ flowcollector.SFlowHandler    = (*Aggregator)(nil)
+)
+
+var epoch = time.Unix(1700000040, 0)
+
+func flow(src, dst string, dstPort uint16, bytes uint64, rate uint32, at time.Duration) flowrecord.FlowRecord {
+	return flowrecord.FlowRecord{
+		Exporter:     netip.MustParseAddr("192.0.2.1"),
+		SrcAddr:      netip.MustParseAddr(src),
+		DstAddr:      netip.MustParseAddr(dst),
+		SrcPort:      40000,
+		DstPort:      dstPort,
+		Proto:        6,
+		Bytes:        bytes,
+		Packets:      1,
+		SamplingRate: rate,
+		End:          epoch.Add(at),
+	}
+}
+
+func collect(t *testing.T, config Config) (*Aggregator, *[]*Window) {
+	var windows []*Window
+	config.Handler = WindowHandlerFunc(func(w *Window) {
+		windows = append(windows, w)
+	})
+
+	a, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a, &windows
+}
+
+func TestTumbling(t *testing.T) {
+	a, windows := collect(t, Config{Fields: SrcAddr | DstPort, SrcMask: Mask{IPv4: 24}})
+	records := []flowrecord.FlowRecord{
+		flow("10.0.0.1", "198.51.100.1", 443, 100, 10, 0),
+		flow("10.0.0.2", "198.51.100.2", 443, 50, 10, 10*time.Second),
+		flow("10.0.1.1", "198.51.100.1", 443, 10, 0, 20*time.Second),
+		flow("10.0.0.1", "198.51.100.1", 80, 10, 0, 30*time.Second),
+		// the next minute completes the first window
+		flow("10.0.0.1", "198.51.100.1", 443, 7, 0, 70*time.Second),
+	}
+
+	a.AddRecords(records)
+	if len(*windows) != 1 {
+		t.Fatalf("%d windows, want 1", len(*windows))
+	}
+
+	w := (*windows)[0]
+	if !w.Start.Equal(epoch) || !w.End.Equal(epoch.Add(time.Minute)) || w.Records != 4 {
+		t.Errorf("window %v - %v with %d records", w.Start, w.End, w.Records)
+	}
+
+	expected := []Entry{
+		{Key: Key{SrcAddr: netip.MustParseAddr("10.0.0.0"), DstPort: 443}, Bytes: 1500, Packets: 20, Flows: 2},
+		{Key: Key{SrcAddr: netip.MustParseAddr("10.0.1.0"), DstPort: 443}, Bytes: 10, Packets: 1, Flows: 1},
+		{Key: Key{SrcAddr: netip.MustParseAddr("10.0.0.0"), DstPort: 80}, Bytes: 10, Packets: 1, Flows: 1},
+	}
+
+	if len(w.Entries) != len(expected) || w.Entries[0] != expected[0] {
+		t.Fatalf("entries %+v, want %+v", w.Entries, expected)
+	}
+
+	a.Flush()
+	if len(*windows) != 2 || (*windows)[1].Entries[0].Bytes != 7 {
+		t.Errorf("flushed %+v", (*windows)[1:])
+	}
+}
+
+func TestSliding(t *testing.T) {
+	a, windows := collect(t, Config{Fields: Proto, Window: 3 * time.Minute, Slide: time.Minute})
+	for minute := 0; minute < 5; minute++ {
+		r := flow("10.0.0.1", "198.51.100.1", 443, uint64(1)<<minute, 0, time.Duration(minute)*time.Minute)
+		a.Add(&r)
+	}
+
+	a.Advance(epoch.Add(5 * time.Minute))
+	// every window ending at the end of a minute, holding up to the last 3 minutes
+	sums := []uint64{1, 3, 7, 14, 28}
+	if len(*windows) != len(sums) {
+		t.Fatalf("%d windows, want %d", len(*windows), len(sums))
+	}
+
+	for i, w := range *windows {
+		if w.Entries[0].Bytes != sums[i] || w.End.Sub(w.Start) != 3*time.Minute || !w.End.Equal(epoch.Add(time.Duration(i+1)*time.Minute)) {
+			t.Errorf("window %d : %v - %v %d bytes, want %d", i, w.Start, w.End, w.Entries[0].Bytes, sums[i])
+		}
+	}
+
+	a.Flush()
+	if len(*windows) != 7 || (*windows)[6].Entries[0].Bytes != 16 {
+		t.Errorf("flushed %d windows", len(*windows))
+	}
+}
+
+func TestDelay(t *testing.T) {
+	a, windows := collect(t, Config{Delay: 30 * time.Second})
+	records := []flowrecord.FlowRecord{
+		flow("10.0.0.1", "198.51.100.1", 443, 1, 0, 50*time.Second),
+		flow("10.0.0.1", "198.51.100.1", 443, 2, 0, 80*time.Second),
+		// late within the delay
+		flow("10.0.0.1", "198.51.100.1", 443, 4, 0, 10*time.Second),
+		flow("10.0.0.1", "198.51.100.1", 443, 8, 0, 95*time.Second),
+		// too late
+		flow("10.0.0.1", "198.51.100.1", 443, 16, 0, 20*time.Second),
+	}
+
+	a.AddRecords(records)
+	if len(*windows) != 1 || (*windows)[0].Entries[0].Bytes != 5 {
+		t.Fatalf("windows %+v", *windows)
+	}
+
+	if a.Late() != 1 {
+		t.Errorf("Late() = %d, want 1", a.Late())
+	}
+
+	// an idle aggregator completes its windows by advancing
+	a.Advance(epoch.Add(150 * time.Second))
+	if len(*windows) != 2 || (*windows)[1].Entries[0].Bytes != 10 {
+		t.Errorf("windows %+v", *windows)
+	}
+
+	// a gap leaves no empty windows
+	r := flow("10.0.0.1", "198.51.100.1", 443, 32, 0, time.Hour)
+	a.Add(&r)
+	a.Advance(epoch.Add(2 * time.Hour))
+	if len(*windows) != 3 || !(*windows)[2].Start.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("windows %+v", *windows)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	a, windows := collect(t, Config{Delay: 5 * time.Second})
+	now := epoch.Add(30 * time.Second)
+	a.clock = func() time.Time { return now }
+
+	// the clock of the first exporter is 10 minutes ahead
+	ahead := flow("10.0.0.1", "198.51.100.1", 443, 1000, 0, 30*time.Second+10*time.Minute)
+	ahead.Exporter = netip.MustParseAddr("192.0.2.2")
+	a.Add(&ahead)
+	for i := 0; i < 100; i++ {
+		r := flow("10.0.0.2", "198.51.100.1", 443, 1, 0, 30*time.Second+time.Duration(i)*100*time.Millisecond)
+		now = r.End
+		a.Add(&r)
+	}
+
+	if a.Late() != 0 || len(*windows) != 0 {
+		t.Fatalf("%d late records and %d windows", a.Late(), len(*windows))
+	}
+
+	// the window of the exporter on time completes once the clock passes its end
+	now = epoch.Add(time.Minute + 10*time.Second)
+	a.Advance(now)
+	if len(*windows) != 1 || (*windows)[0].Records != 100 || (*windows)[0].Entries[0].Bytes != 100 {
+		t.Fatalf("windows %+v", *windows)
+	}
+
+	// the record ahead waits for its window
+	a.Advance(epoch.Add(11*time.Minute + 10*time.Second))
+	if len(*windows) != 2 || (*windows)[1].Entries[0].Bytes != 1000 {
+		t.Errorf("windows %+v", *windows)
+	}
+}
+
+func TestSpaceSaving(t *testing.T) {
+	a, windows := collect(t, Config{Fields: SrcAddr, MaxKeys: 20, TopK: 3})
+	heavy := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	for i := 0; i < 2000; i++ {
+		var r flowrecord.FlowRecord
+		if i%4 == 0 {
+			r = flow(heavy[(i/4)%3], "198.51.100.1", 443, 1000, 0, 0)
+		} else {
+			src := netip.AddrFrom4([4]byte{172, 16, byte(i >> 8), byte(i)})
+			r = flow(src.String(), "198.51.100.1", 443, 10, 0, 0)
+		}
+		a.Add(&r)
+	}
+
+	a.Flush()
+	w := (*windows)[0]
+	if w.Evicted == 0 || w.Records != 2000 || len(w.Entries) != 3 {
+		t.Fatalf("window evicted %d records %d entries %d", w.Evicted, w.Records, len(w.Entries))
+	}
+
+	// the heavy hitters are kept, overcounted by at most their error
+	for _, e := range w.Entries {
+		// 500 records spread over the 3 heavy hitters
+		exact := uint64(167 * 1000)
+		if e.SrcAddr == netip.MustParseAddr("10.0.0.3") {
+			exact = 166 * 1000
+		}
+
+		if e.Bytes < exact || e.Bytes-e.Error > exact {
+			t.Errorf("%v : %d bytes error %d, exact %d", e.SrcAddr, e.Bytes, e.Error, exact)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("5tuple, ToS,inif")
+	if err != nil || fields != FiveTuple|ToS|InIf {
+		t.Errorf("ParseFields = %v, %v", fields, err)
+	}
+
+	if fields.String() != "srcaddr,dstaddr,srcport,dstport,proto,tos,inif" {
+		t.Errorf("String() = %q", fields.String())
+	}
+
+	if _, err := ParseFields("port"); err == nil {
+		t.Error("unknown field accepted")
+	}
+
+	if _, err := New(Config{Window: time.Minute, Slide: 7 * time.Second, Handler: WindowHandlerFunc(func(*Window) {})}); err != ErrSlide {
+		t.Errorf("err = %v, want %v", err, ErrSlide)
+	}
+}
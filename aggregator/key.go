@@ -0,0 +1,194 @@
+package aggregator
+
+import (
+	"fmt"
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"strings"
+)
+
+// Field a field of the flow records the flows are grouped by
+type Field uint16
+
+const (
+	Exporter Field = 1 << iota
+	SrcAddr
+	DstAddr
+	SrcPort
+	DstPort
+	Proto
+	ToS
+	SrcAS
+	DstAS
+	InIf
+	OutIf
+)
+
+// FiveTuple the addresses, ports and protocol of a flow
+const FiveTuple = SrcAddr | DstAddr | SrcPort | DstPort | Proto
+
+var fieldNames = []struct {
+	field Field
+	name  string
+}{
+	{Exporter, "exporter"},
+	{SrcAddr, "srcaddr"},
+	{DstAddr, "dstaddr"},
+	{SrcPort, "srcport"},
+	{DstPort, "dstport"},
+	{Proto, "proto"},
+	{ToS, "tos"},
+	{SrcAS, "srcas"},
+	{DstAS, "dstas"},
+	{InIf, "inif"},
+	{OutIf, "outif"},
+}
+
+// ParseFields parses a comma separated list of field names like "srcaddr,dstport", "5tuple" stands for FiveTuple
+func ParseFields(s string) (Field, error) {
+	var fields Field
+LOOP:
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "5tuple" {
+			fields |= FiveTuple
+			continue
+		}
+
+		for _, f := range fieldNames {
+			if f.name == name {
+				fields |= f.field
+				continue LOOP
+			}
+		}
+
+		return 0, fmt.Errorf("aggregator: unknown field %q", name)
+	}
+
+	return fields, nil
+}
+
+// String the comma separated names of the fields
+func (f Field) String() string {
+	var names []string
+	for _, field := range fieldNames {
+		if f&field.field != 0 {
+			names = append(names, field.name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// Mask the prefix lengths the addresses are truncated to
+type Mask struct {
+	// IPv4 the prefix length of the IPv4 addresses.
+	// Default : 32
+	IPv4 uint8
+	// IPv6 the prefix length of the IPv6 addresses.
+	// Default : 128
+	IPv6 uint8
+}
+
+func (m *Mask) setDefaults() {
+	if m.IPv4 == 0 || m.IPv4 > 32 {
+		m.IPv4 = 32
+	}
+
+	if m.IPv6 == 0 || m.IPv6 > 128 {
+		m.IPv6 = 128
+	}
+}
+
+// apply truncates addr to the prefix length of its family
+func (m *Mask) apply(addr netip.Addr) netip.Addr {
+	bits := int(m.IPv6)
+	if addr.Is4() {
+		bits = int(m.IPv4)
+	}
+
+	if bits == addr.BitLen() {
+		return addr
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr
+	}
+
+	return prefix.Addr()
+}
+
+// Key the values of the grouped fields of a flow, the other fields are zero
+type Key struct {
+	Exporter netip.Addr
+	// SrcAddr the source address truncated to the source mask
+	SrcAddr netip.Addr
+	// DstAddr the destination address truncated to the destination mask
+	DstAddr netip.Addr
+	SrcPort uint16
+	DstPort uint16
+	Proto   uint8
+	ToS     uint8
+	SrcAS   uint32
+	DstAS   uint32
+	InIf    uint32
+	OutIf   uint32
+}
+
+// KeyOf the key of a record grouped by fields, the addresses truncated to the masks
+func KeyOf(r *flowrecord.FlowRecord, fields Field, srcMask, dstMask Mask) Key {
+	srcMask.setDefaults()
+	dstMask.setDefaults()
+	return keyOf(r, fields, &srcMask, &dstMask)
+}
+
+// keyOf the key of a record, the masks are set
+func keyOf(r *flowrecord.FlowRecord, fields Field, srcMask, dstMask *Mask) Key {
+	var k Key
+	if fields&Exporter != 0 {
+		k.Exporter = r.Exporter
+	}
+
+	if fields&SrcAddr != 0 {
+		k.SrcAddr = srcMask.apply(r.SrcAddr)
+	}
+
+	if fields&DstAddr != 0 {
+		k.DstAddr = dstMask.apply(r.DstAddr)
+	}
+
+	if fields&SrcPort != 0 {
+		k.SrcPort = r.SrcPort
+	}
+
+	if fields&DstPort != 0 {
+		k.DstPort = r.DstPort
+	}
+
+	if fields&Proto != 0 {
+		k.Proto = r.Proto
+	}
+
+	if fields&ToS != 0 {
+		k.ToS = r.ToS
+	}
+
+	if fields&SrcAS != 0 {
+		k.SrcAS = r.SrcAS
+	}
+
+	if fields&DstAS != 0 {
+		k.DstAS = r.DstAS
+	}
+
+	if fields&InIf != 0 {
+		k.InIf = r.InIf
+	}
+
+	if fields&OutIf != 0 {
+		k.OutIf = r.OutIf
+	}
+
+	return k
+}
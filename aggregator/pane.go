@@ -0,0 +1,85 @@
+package aggregator
+
+import (
+	"container/heap"
+)
+
+// entry a counted key of a pane, its index in the heap of the pane
+type entry struct {
+	Entry
+	index int
+}
+
+// pane the counters of the flows of one slide of time.
+// When bounded the keys are counted with the space-saving algorithm:
+// a new key replaces the key with the fewest bytes, inheriting its counters as error.
+type pane struct {
+	entries map[Key]*entry
+	// heap a min heap by bytes, maintained when bounded
+	heap    entryHeap
+	max     int
+	evicted uint64
+	records uint64
+}
+
+func newPane(max int) *pane {
+	return &pane{entries: make(map[Key]*entry), max: max}
+}
+
+// add counts a flow
+func (p *pane) add(key Key, bytes, packets uint64) {
+	p.records++
+	if e, found := p.entries[key]; found {
+		e.Bytes += bytes
+		e.Packets += packets
+		e.Flows++
+		if p.max > 0 {
+			heap.Fix(&p.heap, e.index)
+		}
+		return
+	}
+
+	if p.max > 0 && len(p.entries) >= p.max {
+		// replace the smallest key, its counts become the error of the new key
+		e := p.heap[0]
+		delete(p.entries, e.Key)
+		p.evicted++
+		e.Error = e.Bytes
+		e.Key = key
+		e.Bytes += bytes
+		e.Packets += packets
+		e.Flows++
+		p.entries[key] = e
+		heap.Fix(&p.heap, 0)
+		return
+	}
+
+	e := &entry{Entry: Entry{Key: key, Bytes: bytes, Packets: packets, Flows: 1}}
+	p.entries[key] = e
+	if p.max > 0 {
+		heap.Push(&p.heap, e)
+	}
+}
+
+type entryHeap []*entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].Bytes < h[j].Bytes }
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -71,8 +71,9 @@ func (p *ByteArrayPool) getFromSyncPool() []byte {
 }
 
 // Put put a []byte in the pool must no longer be referenced
+// The []byte can be a reslice of one returned by Get, it is restored to its full size.
 func (p *ByteArrayPool) Put(b []byte) {
-	b = b[:]
+	b = b[:cap(b)]
 	select {
 	case p.chanPool <- b:
 	default:
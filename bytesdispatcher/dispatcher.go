@@ -2,6 +2,8 @@ package bytesdispatcher
 
 import (
 	"github.com/wwicak/go-utils/bytearraypool"
+	"hash/fnv"
+	"net"
 	"sync"
 )
 
@@ -21,40 +23,81 @@ func (f BytesHandlerFunc) HandleBytes(bytes []byte) {
 	f(bytes)
 }
 
+// PacketHandler an interface for handling bytes received from a remote address
+type PacketHandler interface {
+	HandlePacket(bytes []byte, remote net.Addr)
+}
+
+// The PacketHandlerFunc type is an adapter to allow the use of
+// ordinary functions as packet handlers. If f is a function
+// with the appropriate signature, PacketHandlerFunc(bytes, remote) is a
+// Handler that calls f.
+type PacketHandlerFunc func(bytes []byte, remote net.Addr)
+
+// HandlePacket calls f(bytes, remote)
+func (f PacketHandlerFunc) HandlePacket(bytes []byte, remote net.Addr) {
+	f(bytes, remote)
+}
+
+// bytesPacketHandler adapts a BytesHandler into a PacketHandler
+type bytesPacketHandler struct {
+	BytesHandler
+}
+
+func (h bytesPacketHandler) HandlePacket(bytes []byte, _ net.Addr) {
+	h.HandleBytes(bytes)
+}
+
+type job struct {
+	bytes  []byte
+	remote net.Addr
+}
+
 type worker struct {
-	workerPool    chan<- chan []byte
-	jobChannel    chan []byte
-	bytesHandler  BytesHandler
+	workerPool    chan<- chan job
+	jobChannel    chan job
+	keyedChannel  chan job
+	packetHandler PacketHandler
 	byteArrayPool *bytearraypool.ByteArrayPool
 	stopChannel   chan struct{}
 	waitGroup     *sync.WaitGroup
 }
 
-func initWorker(w *worker, workerPool chan<- chan []byte, bytesHandler BytesHandler, byteArrayPool *bytearraypool.ByteArrayPool, waitGroup *sync.WaitGroup) {
+func initWorker(w *worker, workerPool chan<- chan job, keyedQueueSize int, packetHandler PacketHandler, byteArrayPool *bytearraypool.ByteArrayPool, waitGroup *sync.WaitGroup) {
 	w.workerPool = workerPool
-	w.bytesHandler = bytesHandler
+	w.packetHandler = packetHandler
 	w.byteArrayPool = byteArrayPool
-	w.jobChannel = make(chan []byte)
+	w.jobChannel = make(chan job)
+	w.keyedChannel = make(chan job, keyedQueueSize)
 	w.stopChannel = make(chan struct{})
 	w.waitGroup = waitGroup
 }
 
-func (w *worker) handleBytes(bytes []byte) {
-	defer w.byteArrayPool.Put(bytes)
-	w.bytesHandler.HandleBytes(bytes)
+func (w *worker) handleJob(j job) {
+	defer w.byteArrayPool.Put(j.bytes)
+	w.packetHandler.HandlePacket(j.bytes, j.remote)
 }
 
 func (w *worker) start() {
 	go func() {
 		defer w.waitGroup.Done()
+		registered := false
 	LOOP:
 		for {
 			// register the current worker into the worker queue.
-			w.workerPool <- w.jobChannel
+			// A worker that just handled a keyed job is still registered.
+			if !registered {
+				w.workerPool <- w.jobChannel
+				registered = true
+			}
 
 			select {
-			case job := <-w.jobChannel:
-				w.handleBytes(job)
+			case j := <-w.jobChannel:
+				registered = false
+				w.handleJob(j)
+
+			case j := <-w.keyedChannel:
+				w.handleJob(j)
 
 			case <-w.stopChannel:
 				// we have received a signal to stop
@@ -64,10 +107,18 @@ func (w *worker) start() {
 
 		// Handle any leftover jobs
 		select {
-		case job := <-w.jobChannel:
-			w.handleBytes(job)
+		case j := <-w.jobChannel:
+			w.handleJob(j)
 		default:
-			return
+		}
+
+		for {
+			select {
+			case j := <-w.keyedChannel:
+				w.handleJob(j)
+			default:
+				return
+			}
 		}
 	}()
 }
@@ -82,28 +133,66 @@ func (w *worker) stop() {
 type Dispatcher struct {
 	// A pool of workers channels that are registered with the dispatcher
 	maxWorkers    int
+	jobQueueSize  int
 	byteArrayPool *bytearraypool.ByteArrayPool
-	bytesHandler  BytesHandler
-	jobQueue      chan []byte
-	workerPool    chan chan []byte
+	packetHandler PacketHandler
+	jobQueue      chan job
+	workerPool    chan chan job
 	workers       []worker
 	waitGroup     sync.WaitGroup
+	dispatched    chan struct{}
+	stopOnce      sync.Once
 }
 
 // NewDispatcher create a new Dispatcher
 func NewDispatcher(maxWorkers, jobQueueSize int, bytesHandler BytesHandler, byteArrayPool *bytearraypool.ByteArrayPool) *Dispatcher {
+	return NewPacketDispatcher(maxWorkers, jobQueueSize, bytesPacketHandler{bytesHandler}, byteArrayPool)
+}
+
+// NewPacketDispatcher create a new Dispatcher whose handler also receives the remote address of the bytes
+func NewPacketDispatcher(maxWorkers, jobQueueSize int, packetHandler PacketHandler, byteArrayPool *bytearraypool.ByteArrayPool) *Dispatcher {
 	return &Dispatcher{
 		maxWorkers:    maxWorkers,
-		bytesHandler:  bytesHandler,
+		jobQueueSize:  jobQueueSize,
+		packetHandler: packetHandler,
 		byteArrayPool: byteArrayPool,
-		jobQueue:      make(chan []byte, jobQueueSize),
-		workerPool:    make(chan chan []byte, maxWorkers),
+		jobQueue:      make(chan job, jobQueueSize),
+		workerPool:    make(chan chan job, maxWorkers),
+		dispatched:    make(chan struct{}),
 	}
 }
 
 // SubmitJob submit a byte array to be processed
-func (d *Dispatcher) SubmitJob(job []byte) {
-	d.jobQueue <- job
+func (d *Dispatcher) SubmitJob(bytes []byte) {
+	d.SubmitPacket(bytes, nil)
+}
+
+// SubmitPacket submit a byte array received from remote to be processed
+func (d *Dispatcher) SubmitPacket(bytes []byte, remote net.Addr) {
+	d.jobQueue <- job{bytes: bytes, remote: remote}
+}
+
+// SubmitKeyed submit a byte array to the worker owning key.
+// Jobs submitted with the same key are handled in order and never concurrently,
+// jobs with different keys are spread across the workers.
+// Ordering is not guaranteed between SubmitKeyed and SubmitJob.
+// Run must be called before SubmitKeyed.
+func (d *Dispatcher) SubmitKeyed(key uint64, bytes []byte) {
+	d.SubmitKeyedPacket(key, bytes, nil)
+}
+
+// SubmitKeyedPacket submit a byte array received from remote to the worker owning key.
+// See SubmitKeyed.
+func (d *Dispatcher) SubmitKeyedPacket(key uint64, bytes []byte, remote net.Addr) {
+	d.workers[key%uint64(len(d.workers))].keyedChannel <- job{bytes: bytes, remote: remote}
+}
+
+// HashKey returns a key suitable for SubmitKeyed from arbitrary bytes
+// like the IP address of an exporter.
+func HashKey(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
 }
 
 // Run the dispatcher
@@ -112,18 +201,28 @@ func (d *Dispatcher) Run() {
 	d.workers = make([]worker, d.maxWorkers)
 	d.waitGroup.Add(d.maxWorkers)
 	for i := 0; i < d.maxWorkers; i++ {
-		initWorker(&d.workers[i], d.workerPool, d.bytesHandler, d.byteArrayPool, &d.waitGroup)
+		initWorker(&d.workers[i], d.workerPool, d.jobQueueSize, d.packetHandler, d.byteArrayPool, &d.waitGroup)
 		d.workers[i].start()
 	}
 
 	go d.dispatch(d.jobQueue, d.workerPool)
 }
 
-// Stop the dispatcher
+// Stop the dispatcher once every submitted job is handled.
+// Stop must not be called concurrently with the Submit methods.
 func (d *Dispatcher) Stop() {
-	for i := range d.workers {
-		d.workers[i].stop()
-	}
+	d.stopOnce.Do(func() {
+		close(d.jobQueue)
+		if d.workers == nil {
+			// never run
+			return
+		}
+
+		<-d.dispatched
+		for i := range d.workers {
+			d.workers[i].stop()
+		}
+	})
 
 	d.Wait()
 }
@@ -133,13 +232,19 @@ func (d *Dispatcher) Wait() {
 	d.waitGroup.Wait()
 }
 
-func (d *Dispatcher) dispatch(jobQueue <-chan []byte, workerPool <-chan chan []byte) {
+func (d *Dispatcher) dispatch(jobQueue <-chan job, workerPool <-chan chan job) {
 	for {
-        // Find a worker
-        jobChannel := <-workerPool
-        //Get a Job
-        job := <-jobQueue
-        // Send it to the worker queue
-        jobChannel <- job
+		// Find a worker
+		jobChannel := <-workerPool
+		//Get a Job
+		j, ok := <-jobQueue
+		if !ok {
+			// every queued job was dispatched
+			close(d.dispatched)
+			return
+		}
+
+		// Send it to the worker queue
+		jobChannel <- j
 	}
 }
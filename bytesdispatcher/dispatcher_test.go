@@ -0,0 +1,92 @@
+package bytesdispatcher
+
+import (
+	"encoding/binary"
+	"github.com/wwicak/go-utils/bytearraypool"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestSubmitKeyed(t *testing.T) {
+	const keys = 8
+	const jobsPerKey = 1000
+	pool := bytearraypool.NewByteArrayPool(100, 16)
+	var lock sync.Mutex
+	seen := make(map[uint64][]uint64)
+	d := NewDispatcher(4, 10, BytesHandlerFunc(func(b []byte) {
+		key := binary.BigEndian.Uint64(b[0:8])
+		seq := binary.BigEndian.Uint64(b[8:16])
+		lock.Lock()
+		seen[key] = append(seen[key], seq)
+		lock.Unlock()
+	}), pool)
+	d.Run()
+	for i := uint64(0); i < jobsPerKey; i++ {
+		for key := uint64(0); key < keys; key++ {
+			b := pool.Get()
+			binary.BigEndian.PutUint64(b[0:8], key)
+			binary.BigEndian.PutUint64(b[8:16], i)
+			d.SubmitKeyed(HashKey(b[0:8]), b)
+		}
+	}
+	d.Stop()
+
+	for key := uint64(0); key < keys; key++ {
+		seqs := seen[key]
+		if len(seqs) != jobsPerKey {
+			t.Fatalf("key %d: got %d jobs expected %d", key, len(seqs), jobsPerKey)
+		}
+		for i, seq := range seqs {
+			if seq != uint64(i) {
+				t.Fatalf("key %d: job %d handled out of order (%d)", key, i, seq)
+			}
+		}
+	}
+}
+
+func TestStopHandlesQueuedJobs(t *testing.T) {
+	pool := bytearraypool.NewByteArrayPool(100, 16)
+	var lock sync.Mutex
+	handled := 0
+	d := NewDispatcher(2, 100, BytesHandlerFunc(func(b []byte) {
+		lock.Lock()
+		handled++
+		lock.Unlock()
+	}), pool)
+	d.Run()
+	for i := 0; i < 100; i++ {
+		d.SubmitJob(pool.Get())
+	}
+
+	d.Stop()
+	if handled != 100 {
+		t.Errorf("expected 100 handled jobs got %d", handled)
+	}
+}
+
+func TestSubmitKeyedPacket(t *testing.T) {
+	pool := bytearraypool.NewByteArrayPool(100, 16)
+	var lock sync.Mutex
+	handled := 0
+	d := NewPacketDispatcher(4, 10, PacketHandlerFunc(func(b []byte, remote net.Addr) {
+		lock.Lock()
+		defer lock.Unlock()
+		handled++
+		if want := net.IPv4(192, 0, 2, b[0]); !remote.(*net.UDPAddr).IP.Equal(want) {
+			t.Errorf("got %s expected %s", remote, want)
+		}
+	}), pool)
+	d.Run()
+	for i := 0; i < 100; i++ {
+		remote := &net.UDPAddr{IP: net.IPv4(192, 0, 2, byte(i%4)), Port: 2055}
+		b := pool.Get()
+		b[0] = byte(i % 4)
+		d.SubmitKeyedPacket(HashKey(remote.IP), b, remote)
+	}
+	d.Stop()
+
+	if handled != 100 {
+		t.Errorf("expected 100 handled jobs got %d", handled)
+	}
+}
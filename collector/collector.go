@@ -0,0 +1,298 @@
+package collector
+
+import (
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/bytearraypool"
+	"github.com/wwicak/go-utils/bytesdispatcher"
+	"github.com/wwicak/go-utils/packetsource"
+	"github.com/wwicak/go-utils/pcap"
+	"github.com/wwicak/go-utils/relay"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultPacketSize the size of the packet buffers when Config.PacketSize is not set
+const DefaultPacketSize = 2048
+
+// Decoder decodes a datagram received from remote.
+// The packet is only valid during the call, the value must not refer to it
+// unless the Sink is done with the value before returning.
+type Decoder[T any] interface {
+	Decode(remote net.Addr, packet []byte) (T, error)
+}
+
+// The DecoderFunc type is an adapter to allow the use of
+// ordinary functions as Decoders.
+type DecoderFunc[T any] func(remote net.Addr, packet []byte) (T, error)
+
+// Decode calls f(remote, packet)
+func (f DecoderFunc[T]) Decode(remote net.Addr, packet []byte) (T, error) {
+	return f(remote, packet)
+}
+
+// Sink handles the decoded datagrams, it owns the value it is handed
+type Sink[T any] interface {
+	Handle(remote net.Addr, value T)
+}
+
+// The SinkFunc type is an adapter to allow the use of
+// ordinary functions as Sinks.
+type SinkFunc[T any] func(remote net.Addr, value T)
+
+// Handle calls f(remote, value)
+func (f SinkFunc[T]) Handle(remote net.Addr, value T) {
+	f(remote, value)
+}
+
+// Config the configuration shared by every collector
+type Config struct {
+	// Address the UDP address listened at when neither Conn nor Source is set.
+	// Default : 127.0.0.1:2055
+	Address string
+	// Conn a net.PacketConn.
+	// Default : UDPConn listining at Address.
+	Conn net.PacketConn
+	// Source where the packets are read from, taking precedence over Conn.
+	// A pcap.Reader replays a capture, Start returns once it is exhausted.
+	// Default : Conn
+	Source packetsource.PacketSource
+	// Workers the number of worker to work on the queue
+	// Default : The number of runtime.GOMAXPROCS
+	Workers int
+	// Backlog how many packets are can be queued before being processed
+	// Defaults : 100
+	Backlog int
+	// PacketSize size of packet going to be received
+	// Default : DefaultPacketSize
+	PacketSize int
+	// ByteArrayPoolSize the number byte arrays to have avialable in the pool.
+	// Default : The same size of the backlog
+	ByteArrayPoolSize int
+	// Affinity when true packets from the same exporter are always handled by the same worker
+	// preserving their order.
+	// Default : false
+	Affinity bool
+	// AffinityKey computes the key used to select the worker when Affinity is set.
+	// Default : a hash of the remote IP address
+	AffinityKey func(remote net.Addr, packet []byte) uint64
+	// ACL the access list the remote address of the exporter is checked against.
+	// Default : nil, every exporter is accepted
+	ACL *acl.ACL
+	// Accept an additional check of the packets accepted by the ACL, like their in-band agent.
+	// Default : nil, every packet is accepted
+	Accept func(remote net.Addr, packet []byte) bool
+	// Observe is called with every accepted packet in the receiving goroutine, in the order they are received.
+	// It must not keep the packet.
+	// Default : nil
+	Observe func(remote net.Addr, packet []byte)
+	// Relay forwards every accepted packet unchanged to downstream collectors.
+	// Default : nil, no forwarding
+	Relay *relay.Relay
+	// Recorder records every accepted packet to pcap files.
+	// Default : nil, no recording
+	Recorder *pcap.Recorder
+}
+
+// Collector reads datagrams from a source, filters them and decodes them
+// on a pool of workers handing the values to a sink.
+type Collector[T any] struct {
+	Config
+	// Decoder decodes the accepted datagrams.
+	// Required unless Sink is nil.
+	Decoder Decoder[T]
+	// Sink handles the decoded datagrams.
+	// Required unless Relay or Recorder is set.
+	Sink          Sink[T]
+	rejected      atomic.Uint64
+	errors        atomic.Uint64
+	stopped       atomic.Bool
+	byteArrayPool *bytearraypool.ByteArrayPool
+	// lock guards source and dispatcher, set by Start and read by Stop from other goroutines
+	lock       sync.Mutex
+	source     packetsource.PacketSource
+	dispatcher *bytesdispatcher.Dispatcher
+}
+
+func (c *Collector[T]) setDefaults() {
+	if c.Sink == nil && c.Relay == nil && c.Recorder == nil {
+		panic(errors.New("No handler defined"))
+	}
+
+	if c.Sink != nil && c.Decoder == nil {
+		panic(errors.New("No decoder defined"))
+	}
+
+	if c.Address == "" {
+		c.Address = "127.0.0.1:2055"
+	}
+
+	if c.Workers <= 0 {
+		c.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	if c.PacketSize <= 0 {
+		c.PacketSize = DefaultPacketSize
+	}
+
+	if c.Backlog <= 0 {
+		c.Backlog = 100
+	}
+
+	if c.ByteArrayPoolSize <= 0 {
+		c.ByteArrayPoolSize = c.Backlog
+	}
+
+	c.byteArrayPool = bytearraypool.NewByteArrayPool(c.ByteArrayPoolSize, c.PacketSize)
+
+	if c.Source == nil && c.Conn == nil {
+		conn, err := net.ListenPacket("udp", c.Address)
+		if err != nil {
+			panic(err)
+		}
+
+		c.Conn = conn
+	}
+
+	if c.Source == nil {
+		c.Source = c.Conn
+	}
+
+	if c.AffinityKey == nil {
+		c.AffinityKey = RemoteKey
+	}
+
+	c.dispatcher = bytesdispatcher.NewPacketDispatcher(c.Workers, c.Backlog, bytesdispatcher.PacketHandlerFunc(c.handle), c.byteArrayPool)
+}
+
+// handle decodes a dispatched packet and hands it to the sink
+func (c *Collector[T]) handle(packet []byte, remote net.Addr) {
+	value, err := c.Decoder.Decode(remote, packet)
+	if err != nil {
+		c.errors.Add(1)
+		return
+	}
+
+	c.Sink.Handle(remote, value)
+}
+
+// RemoteKey hashes the IP address of the remote exporter, the default AffinityKey
+func RemoteKey(remote net.Addr, _ []byte) uint64 {
+	if udpAddr, ok := remote.(*net.UDPAddr); ok {
+		return bytesdispatcher.HashKey(udpAddr.IP.To16())
+	}
+
+	return bytesdispatcher.HashKey([]byte(remote.String()))
+}
+
+// Rejected returns the number of packets dropped by the access lists
+func (c *Collector[T]) Rejected() uint64 {
+	return c.rejected.Load()
+}
+
+// Errors returns the number of packets that failed to decode
+func (c *Collector[T]) Errors() uint64 {
+	return c.errors.Load()
+}
+
+// Stop stops the collector, the packets already received are still handled.
+// It may be called from any goroutine, before Start returns or even before it is called.
+func (c *Collector[T]) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stopped.Swap(true) {
+		return
+	}
+
+	if c.source != nil {
+		c.source.Close()
+	}
+}
+
+// StopAndWait stops the collector and wait for the dispatcher to cleanup
+func (c *Collector[T]) StopAndWait() {
+	c.Stop()
+	c.lock.Lock()
+	dispatcher := c.dispatcher
+	c.lock.Unlock()
+	if dispatcher != nil {
+		dispatcher.Wait()
+	}
+}
+
+// submit filters, relays and dispatches a received packet
+func (c *Collector[T]) submit(remote net.Addr, buffer []byte, rlen int) {
+	packet := buffer[:rlen]
+	if !c.ACL.AllowedAddr(remote) || (c.Accept != nil && !c.Accept(remote, packet)) {
+		c.rejected.Add(1)
+		c.byteArrayPool.Put(buffer)
+		return
+	}
+
+	if c.Observe != nil {
+		c.Observe(remote, packet)
+	}
+
+	if c.Recorder != nil {
+		c.Recorder.Record(remote, packet)
+	}
+
+	if c.Relay != nil {
+		c.Relay.Forward(remote, packet)
+	}
+
+	if c.Sink == nil {
+		c.byteArrayPool.Put(buffer)
+		return
+	}
+
+	if c.Affinity {
+		c.dispatcher.SubmitKeyedPacket(c.AffinityKey(remote, packet), packet, remote)
+	} else {
+		c.dispatcher.SubmitPacket(packet, remote)
+	}
+}
+
+// open sets the defaults and publishes the source and the dispatcher to Stop.
+// Nothing is opened and it returns false when the collector was stopped before.
+func (c *Collector[T]) open() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stopped.Load() {
+		return false
+	}
+
+	c.setDefaults()
+	c.source = c.Source
+	return true
+}
+
+// Start starts the collector, it returns once the collector is stopped or its source exhausted
+// and every packet received is handled.
+func (c *Collector[T]) Start() {
+	if !c.open() {
+		return
+	}
+
+	source, dispatcher := c.source, c.dispatcher
+	dispatcher.Run()
+	defer dispatcher.Stop()
+
+	for !c.stopped.Load() {
+		buffer := c.byteArrayPool.Get()
+		rlen, remote, err := source.ReadFrom(buffer)
+		if err != nil {
+			c.byteArrayPool.Put(buffer)
+			if err == io.EOF || c.stopped.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			panic(err)
+		}
+
+		c.submit(remote, buffer, rlen)
+	}
+}
@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/packetsource"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errOdd = errors.New("odd")
+
+// decodeEven decodes the big endian sequence number of a packet, odd numbers fail
+func decodeEven(_ net.Addr, packet []byte) (uint32, error) {
+	seq := binary.BigEndian.Uint32(packet)
+	if seq%2 != 0 {
+		return 0, errOdd
+	}
+
+	return seq, nil
+}
+
+func feedOf(t *testing.T, packets int, remotes ...net.Addr) *packetsource.Feed {
+	feed := packetsource.NewFeed(packets * len(remotes))
+	for seq := 0; seq < packets; seq++ {
+		for _, remote := range remotes {
+			if err := feed.Send(remote, binary.BigEndian.AppendUint32(nil, uint32(seq))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	feed.End()
+	return feed
+}
+
+func TestCollector(t *testing.T) {
+	exporter := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	denied := &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 50000}
+	allowed, err := acl.New(nil, []string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	var handled []uint32
+	observed := 0
+	c := &Collector[uint32]{
+		Config: Config{
+			Source:  feedOf(t, 100, exporter, denied),
+			Workers: 4,
+			ACL:     allowed,
+			Accept: func(_ net.Addr, packet []byte) bool {
+				return binary.BigEndian.Uint32(packet) < 90
+			},
+			Observe: func(_ net.Addr, packet []byte) {
+				if int(binary.BigEndian.Uint32(packet)) != observed {
+					t.Errorf("observed %d, want %d", binary.BigEndian.Uint32(packet), observed)
+				}
+				observed++
+			},
+			Affinity: true,
+		},
+		Decoder: DecoderFunc[uint32](decodeEven),
+		Sink: SinkFunc[uint32](func(remote net.Addr, seq uint32) {
+			if remote.String() != exporter.String() {
+				t.Errorf("remote %v, want %v", remote, exporter)
+			}
+
+			lock.Lock()
+			handled = append(handled, seq)
+			lock.Unlock()
+		}),
+	}
+
+	// Start returns once the feed is exhausted and every packet handled
+	c.Start()
+	if len(handled) != 45 {
+		t.Errorf("%d packets handled, want 45", len(handled))
+	}
+
+	// a single exporter is handled in order with affinity
+	for i, seq := range handled {
+		if seq != uint32(i*2) {
+			t.Fatalf("packet %d is %d, want %d", i, seq, i*2)
+		}
+	}
+
+	if c.Rejected() != 110 {
+		t.Errorf("Rejected() = %d, want 110", c.Rejected())
+	}
+
+	if c.Errors() != 45 {
+		t.Errorf("Errors() = %d, want 45", c.Errors())
+	}
+
+	if observed != 90 {
+		t.Errorf("observed %d packets, want 90", observed)
+	}
+}
+
+func TestCollectorStop(t *testing.T) {
+	feed := packetsource.NewFeed(1)
+	handled := make(chan uint32, 1)
+	c := &Collector[uint32]{
+		Config:  Config{Source: feed},
+		Decoder: DecoderFunc[uint32](decodeEven),
+		Sink: SinkFunc[uint32](func(_ net.Addr, seq uint32) {
+			handled <- seq
+		}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Start()
+		close(done)
+	}()
+
+	feed.Send(&net.UDPAddr{IP: net.ParseIP("192.0.2.1")}, binary.BigEndian.AppendUint32(nil, 42))
+	if seq := <-handled; seq != 42 {
+		t.Errorf("handled %d, want 42", seq)
+	}
+
+	c.StopAndWait()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return once stopped")
+	}
+
+	if err := feed.Send(nil, nil); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Send after Stop returned %v, want net.ErrClosed", err)
+	}
+}
+
+func TestCollectorStopBeforeStart(t *testing.T) {
+	c := &Collector[uint32]{
+		Config:  Config{Source: packetsource.NewFeed(1)},
+		Decoder: DecoderFunc[uint32](decodeEven),
+		Sink:    SinkFunc[uint32](func(net.Addr, uint32) {}),
+	}
+
+	c.Stop()
+	c.Start()
+}
+
+func TestCollectorStopRacingStart(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		c := &Collector[uint32]{
+			Config:  Config{Address: "127.0.0.1:0"},
+			Decoder: DecoderFunc[uint32](decodeEven),
+			Sink:    SinkFunc[uint32](func(net.Addr, uint32) {}),
+		}
+
+		done := make(chan struct{})
+		go func() {
+			c.Start()
+			close(done)
+		}()
+
+		c.Stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Start did not return once stopped")
+		}
+
+		// the socket is either not opened or closed by Stop
+		if c.Conn != nil {
+			if err := c.Conn.SetDeadline(time.Now()); !errors.Is(err, net.ErrClosed) {
+				t.Fatalf("the socket opened by Start is still open: %v", err)
+			}
+		}
+	}
+}
+
+func TestCollectorUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan uint32, 1)
+	c := &Collector[uint32]{
+		Config:  Config{Conn: conn},
+		Decoder: DecoderFunc[uint32](decodeEven),
+		Sink: SinkFunc[uint32](func(_ net.Addr, seq uint32) {
+			handled <- seq
+		}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Start()
+		close(done)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for seq := uint32(2); ; seq += 2 {
+		client.Write(binary.BigEndian.AppendUint32(nil, seq))
+		select {
+		case <-handled:
+		case <-time.After(100 * time.Millisecond):
+			continue
+		}
+
+		break
+	}
+
+	c.Stop()
+	<-done
+}
+
+func TestCollectorNoHandler(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a collector without a sink must panic")
+		}
+	}()
+
+	c := &Collector[uint32]{Config: Config{Source: packetsource.NewFeed(1)}}
+	c.Start()
+}
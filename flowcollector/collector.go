@@ -0,0 +1,250 @@
+package flowcollector
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/collector"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/packetsource"
+	"github.com/wwicak/go-utils/pcap"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"sync/atomic"
+)
+
+// Protocol the family of a flow export protocol
+type Protocol uint8
+
+const (
+	// NetFlow NetFlow and IPFIX, versioned by the first 16 bits of the datagram
+	NetFlow Protocol = iota + 1
+	// SFlow sFlow, versioned by the first 32 bits of the datagram
+	SFlow
+)
+
+// Version identifies the protocol and version of a datagram
+type Version struct {
+	Protocol Protocol
+	Number   uint32
+}
+
+var (
+	NetFlowV1 = Version{NetFlow, 1}
+	NetFlowV5 = Version{NetFlow, 5}
+	NetFlowV7 = Version{NetFlow, 7}
+	NetFlowV9 = Version{NetFlow, 9}
+	IPFIX     = Version{NetFlow, 10}
+	SFlowV5   = Version{SFlow, 5}
+)
+
+var ErrTooShort = errors.New("flowcollector: datagram is too short")
+
+// Peek returns the protocol and version of a datagram without decoding it.
+// NetFlow and IPFIX start with a non zero 16 bits version, sFlow with a 32 bits version whose first 16 bits are zero.
+func Peek(packet []byte) (Version, error) {
+	if len(packet) < 4 {
+		return Version{}, ErrTooShort
+	}
+
+	if version := binary.BigEndian.Uint16(packet[0:2]); version != 0 {
+		return Version{NetFlow, uint32(version)}, nil
+	}
+
+	return Version{SFlow, binary.BigEndian.Uint32(packet[0:4])}, nil
+}
+
+// Decoder decodes the datagrams of a protocol version and hands them to a handler
+type Decoder interface {
+	Decode(remote net.Addr, packet []byte) error
+}
+
+// The DecoderFunc type is an adapter to allow the use of
+// ordinary functions as Decoders.
+type DecoderFunc func(remote net.Addr, packet []byte) error
+
+// Decode calls f(remote, packet)
+func (f DecoderFunc) Decode(remote net.Addr, packet []byte) error {
+	return f(remote, packet)
+}
+
+// Collector receives the datagrams of every flow protocol on one connection and routes them by version
+type Collector struct {
+	// Conn a net.PacketConn.
+	// Default : UDPConn listining at 127.0.0.1:2055.
+	Conn net.PacketConn
+	// Source where the packets are read from, taking precedence over Conn.
+	// A pcap.Reader replays a capture, Start returns once it is exhausted.
+	// Default : Conn
+	Source packetsource.PacketSource
+	// SFlowHandler handles the sFlow v5 datagrams.
+	// Default : nil, sFlow v5 is only handled by a Decoder
+	SFlowHandler SFlowHandler
+	// NetFlow5Handler handles the NetFlow v1, v5 and v7 datagrams.
+	// Default : nil, NetFlow v1, v5 and v7 are only handled by a Decoder
+	NetFlow5Handler NetFlow5Handler
+	// Decoders the decoders by version, taking precedence over the handlers.
+	// Datagrams of a version without a decoder are dropped.
+	// Default : empty
+	Decoders map[Version]Decoder
+	// Workers the number of worker to work on the queue
+	// Default : The number of runtime.GOMAXPROCS
+	Workers int
+	// Backlog how many packets are can be queued before being processed
+	// Defaults : 100
+	Backlog int
+	// PacketSize size of packet going to be received
+	// Default : 9216
+	PacketSize int
+	// ByteArrayPoolSize the number byte arrays to have avialable in the pool.
+	// Default : The same size of the backlog
+	ByteArrayPoolSize int
+	// Affinity when true packets from the same exporter are always handled by the same worker
+	// preserving their order.
+	// Default : false
+	Affinity bool
+	// ACL the access list the remote address of the exporter is checked against.
+	// Default : nil, every exporter is accepted
+	ACL *acl.ACL
+	// Recorder records every accepted packet to pcap files.
+	// Default : nil, no recording
+	Recorder *pcap.Recorder
+	// Filter drops the sFlow samples and NetFlow v1, v5 and v7 flows not matching
+	// before SFlowHandler and NetFlow5Handler run, the datagrams left empty are not handled.
+	// The Decoders are not filtered.
+	// Default : nil, every flow is handled
+	Filter    *flowfilter.Filter
+	decoders  map[Version]Decoder
+	filtered  atomic.Uint64
+	unknown   atomic.Uint64
+	collector collector.Collector[struct{}]
+}
+
+func (c *Collector) setDefaults() {
+	c.decoders = make(map[Version]Decoder)
+	if c.SFlowHandler != nil {
+		c.decoders[SFlowV5] = SFlowDecoder(c.filterSFlow(c.SFlowHandler))
+	}
+
+	if c.NetFlow5Handler != nil {
+		decoder := NetFlow5Decoder(c.filterNetFlow5(c.NetFlow5Handler))
+		c.decoders[NetFlowV1] = decoder
+		c.decoders[NetFlowV5] = decoder
+		c.decoders[NetFlowV7] = decoder
+	}
+
+	for version, decoder := range c.Decoders {
+		c.decoders[version] = decoder
+	}
+
+	if len(c.decoders) == 0 {
+		panic(errors.New("No handler defined"))
+	}
+
+	c.collector.Config = collector.Config{
+		Address:           "127.0.0.1:2055",
+		Conn:              c.Conn,
+		Source:            c.Source,
+		Workers:           c.Workers,
+		Backlog:           c.Backlog,
+		PacketSize:        c.PacketSize,
+		ByteArrayPoolSize: c.ByteArrayPoolSize,
+		Affinity:          c.Affinity,
+		ACL:               c.ACL,
+		Recorder:          c.Recorder,
+	}
+
+	if c.PacketSize <= 0 {
+		c.collector.PacketSize = 9216
+	}
+
+	// the datagrams are handled by the decoder of their version, nothing is left to the sink
+	c.collector.Decoder = collector.DecoderFunc[struct{}](c.route)
+	c.collector.Sink = collector.SinkFunc[struct{}](func(net.Addr, struct{}) {})
+}
+
+// filterSFlow drops the samples not matching the filter before h runs
+func (c *Collector) filterSFlow(h SFlowHandler) SFlowHandler {
+	if c.Filter == nil {
+		return h
+	}
+
+	return SFlowHandlerFunc(func(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+		n := len(samples)
+		samples = c.Filter.FilterSFlow(acl.AddrOf(remote), header, samples)
+		c.filtered.Add(uint64(n - len(samples)))
+		if len(samples) > 0 {
+			h.HandleSFlow(remote, header, samples)
+		}
+	})
+}
+
+// filterNetFlow5 drops the flows not matching the filter before h runs
+func (c *Collector) filterNetFlow5(h NetFlow5Handler) NetFlow5Handler {
+	if c.Filter == nil {
+		return h
+	}
+
+	return NetFlow5HandlerFunc(func(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+		n := len(flows)
+		flows = c.Filter.FilterNetFlow5(acl.AddrOf(remote), header, flows)
+		c.filtered.Add(uint64(n - len(flows)))
+		if len(flows) > 0 {
+			header.SetLength(uint16(len(flows)))
+			h.HandleNetFlow5(remote, header, flows)
+		}
+	})
+}
+
+// route hands a datagram to the decoder of its version
+func (c *Collector) route(remote net.Addr, packet []byte) (struct{}, error) {
+	version, err := Peek(packet)
+	if err != nil {
+		return struct{}{}, err
+	}
+
+	decoder, found := c.decoders[version]
+	if !found {
+		c.unknown.Add(1)
+		return struct{}{}, nil
+	}
+
+	return struct{}{}, decoder.Decode(remote, packet)
+}
+
+// Rejected returns the number of packets dropped by the access list
+func (c *Collector) Rejected() uint64 {
+	return c.collector.Rejected()
+}
+
+// Filtered returns the number of sFlow samples and NetFlow flows dropped by the filter
+func (c *Collector) Filtered() uint64 {
+	return c.filtered.Load()
+}
+
+// Unknown returns the number of packets dropped for having a version without a decoder
+func (c *Collector) Unknown() uint64 {
+	return c.unknown.Load()
+}
+
+// Errors returns the number of packets that failed to decode
+func (c *Collector) Errors() uint64 {
+	return c.collector.Errors()
+}
+
+// Stop stops the collector.
+func (c *Collector) Stop() {
+	c.collector.Stop()
+}
+
+// StopAndWait stops the collector and wait for the dispatcher to cleanup
+func (c *Collector) StopAndWait() {
+	c.collector.StopAndWait()
+}
+
+// Start starts the collector.
+func (c *Collector) Start() {
+	c.setDefaults()
+	c.collector.Start()
+}
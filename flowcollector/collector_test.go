@@ -0,0 +1,119 @@
+package flowcollector
+
+import (
+	"encoding/binary"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeek(t *testing.T) {
+	tests := []struct {
+		packet  []byte
+		version Version
+		err     error
+	}{
+		{[]byte{0, 5, 0, 1}, NetFlowV5, nil},
+		{[]byte{0, 10, 0, 40}, IPFIX, nil},
+		{[]byte{0, 0, 0, 5}, SFlowV5, nil},
+		{[]byte{0, 0, 0, 4}, Version{SFlow, 4}, nil},
+		{[]byte{0, 5}, Version{}, ErrTooShort},
+	}
+
+	for i, test := range tests {
+		version, err := Peek(test.packet)
+		if version != test.version || err != test.err {
+			t.Errorf("Test %d) expected %v %v got %v %v", i, test.version, test.err, version, err)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sflows := make(chan *sflow.Header, 1)
+	netflows := make(chan int, 1)
+	v9 := make(chan int, 1)
+	collector := &Collector{
+		Conn: conn,
+		SFlowHandler: SFlowHandlerFunc(func(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+			sflows <- header
+		}),
+		NetFlow5Handler: NetFlow5HandlerFunc(func(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+			netflows <- len(flows)
+		}),
+		Decoders: map[Version]Decoder{
+			NetFlowV9: DecoderFunc(func(remote net.Addr, packet []byte) error {
+				v9 <- len(packet)
+				return nil
+			}),
+		},
+		Workers: 1,
+	}
+
+	go collector.Start()
+	defer collector.StopAndWait()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	nf5 := netflow5.NetFlow5{}
+	nf5.Header.SetVersion(5)
+	nf5.Header.SetLength(2)
+	packet, _ := nf5.MarshalBinary()
+
+	sflowPacket := make([]byte, 28)
+	binary.BigEndian.PutUint32(sflowPacket[0:4], 5)
+	binary.BigEndian.PutUint32(sflowPacket[4:8], 1)
+	copy(sflowPacket[8:12], []byte{192, 0, 2, 1})
+
+	for _, p := range [][]byte{packet, sflowPacket, {0, 9, 0, 0, 1, 2}, {0, 10, 0, 16}, {0, 5, 0, 1}} {
+		if _, err := client.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case n := <-netflows:
+		if n != 2 {
+			t.Errorf("expected 2 flows got %d", n)
+		}
+	case <-timeout:
+		t.Fatal("NetFlow v5 not handled")
+	}
+
+	select {
+	case header := <-sflows:
+		if header.AgentAddress != [4]byte{192, 0, 2, 1} {
+			t.Errorf("unexpected agent %v", header.AgentAddress)
+		}
+	case <-timeout:
+		t.Fatal("sFlow not handled")
+	}
+
+	select {
+	case n := <-v9:
+		if n != 6 {
+			t.Errorf("expected 6 bytes got %d", n)
+		}
+	case <-timeout:
+		t.Fatal("NetFlow v9 not handled")
+	}
+
+	for collector.Unknown() != 1 || collector.Errors() != 1 {
+		select {
+		case <-timeout:
+			t.Fatalf("expected 1 unknown and 1 error got %d and %d", collector.Unknown(), collector.Errors())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package flowcollector
+
+import (
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/ipfix"
+	ipfixprocessor "github.com/wwicak/go-utils/ipfix/processor"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/netflow9"
+	netflow9processor "github.com/wwicak/go-utils/netflow9/processor"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"sync"
+)
+
+// SFlowHandler the handler for sFlow v5 datagrams
+type SFlowHandler interface {
+	HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample)
+}
+
+// The SFlowHandlerFunc type is an adapter to allow the use of
+// ordinary functions as SFlowHandlers.
+type SFlowHandlerFunc func(remote net.Addr, header *sflow.Header, samples []sflow.Sample)
+
+// HandleSFlow calls f(remote, header, samples)
+func (f SFlowHandlerFunc) HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	f(remote, header, samples)
+}
+
+// NetFlow5Handler the handler for NetFlow v1, v5 and v7 datagrams.
+// header.Version() tells the versions apart.
+type NetFlow5Handler interface {
+	HandleNetFlow5(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow)
+}
+
+// The NetFlow5HandlerFunc type is an adapter to allow the use of
+// ordinary functions as NetFlow5Handlers.
+type NetFlow5HandlerFunc func(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow)
+
+// HandleNetFlow5 calls f(remote, header, flows)
+func (f NetFlow5HandlerFunc) HandleNetFlow5(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+	f(remote, header, flows)
+}
+
+// SFlowDecoder decodes sFlow v5 datagrams for the handler
+func SFlowDecoder(h SFlowHandler) Decoder {
+	return DecoderFunc(func(remote net.Addr, packet []byte) error {
+		head := sflow.Header{}
+		next, err := head.Parse(packet)
+		if err != nil {
+			return err
+		}
+
+		samples, err := head.ParseSamples(next)
+		if err != nil {
+			return err
+		}
+
+		h.HandleSFlow(remote, &head, samples)
+		return nil
+	})
+}
+
+var netFlow5Pool = sync.Pool{
+	New: func() any { return &netflow5.NetFlow5{} },
+}
+
+var netFlow7Pool = sync.Pool{
+	New: func() any { return &netflow5.NetFlow7{} },
+}
+
+// NetFlow5Decoder decodes NetFlow v1, v5 and v7 datagrams for the handler
+func NetFlow5Decoder(h NetFlow5Handler) Decoder {
+	return DecoderFunc(func(remote net.Addr, packet []byte) error {
+		version, err := netflow5.Version(packet)
+		if err != nil {
+			return err
+		}
+
+		if version == 7 {
+			data := netFlow7Pool.Get().(*netflow5.NetFlow7)
+			defer netFlow7Pool.Put(data)
+			if err := data.Decode(packet); err != nil {
+				return err
+			}
+
+			h.HandleNetFlow5(remote, &data.Header, data.FlowArray())
+			return nil
+		}
+
+		data := netFlow5Pool.Get().(*netflow5.NetFlow5)
+		defer netFlow5Pool.Put(data)
+		if version == 1 {
+			err = data.DecodeV1(packet)
+		} else {
+			err = data.Decode(packet)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		h.HandleNetFlow5(remote, &data.Header, data.FlowArray())
+		return nil
+	})
+}
+
+// NetFlow9Decoder decodes NetFlow v9 datagrams with the decoder for the handler.
+// Default : a new netflow9.Decoder when decoder is nil
+func NetFlow9Decoder(decoder *netflow9.Decoder, h netflow9processor.PacketHandler) Decoder {
+	if decoder == nil {
+		decoder = netflow9.NewDecoder()
+	}
+
+	return DecoderFunc(func(remote net.Addr, packet []byte) error {
+		data, err := decoder.Decode(acl.AddrOf(remote), packet)
+		if err != nil {
+			return err
+		}
+
+		h.HandlePacket(remote, data)
+		return nil
+	})
+}
+
+// IPFIXDecoder decodes IPFIX datagrams with the decoder for the handler.
+// Default : a new ipfix.Decoder when decoder is nil
+func IPFIXDecoder(decoder *ipfix.Decoder, h ipfixprocessor.MessageHandler) Decoder {
+	if decoder == nil {
+		decoder = ipfix.NewDecoder()
+	}
+
+	return DecoderFunc(func(remote net.Addr, packet []byte) error {
+		message, err := decoder.Decode(ipfix.SessionOf(remote), packet)
+		if err != nil {
+			return err
+		}
+
+		h.HandleMessage(remote, message)
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package flowcollector_test
+
+import (
+	"fmt"
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/ipfix"
+	ipfixprocessor "github.com/wwicak/go-utils/ipfix/processor"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+)
+
+func HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	fmt.Printf("%s sFlow agent %v : %d samples\n", remote, net.IP(header.AgentAddress[:]), len(samples))
+}
+
+func HandleNetFlow5(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+	for i, flow := range flows {
+		fmt.Printf("%s NetFlow v%d %02d) src : %s dst : %s\n", remote, header.Version(), i, flow.SrcIP(), flow.DstIP())
+	}
+}
+
+func HandleIPFIX(exporter net.Addr, message *ipfix.Message) {
+	fmt.Printf("%s IPFIX : %d records\n", exporter, len(message.Records))
+}
+
+func ExampleCollector_Start() {
+	conn, err := net.ListenPacket("udp", ":2055")
+	if err != nil {
+		panic(err)
+	}
+
+	collector := flowcollector.Collector{
+		Conn:            conn,
+		SFlowHandler:    flowcollector.SFlowHandlerFunc(HandleSFlow),
+		NetFlow5Handler: flowcollector.NetFlow5HandlerFunc(HandleNetFlow5),
+		Decoders: map[flowcollector.Version]flowcollector.Decoder{
+			flowcollector.IPFIX: flowcollector.IPFIXDecoder(nil, ipfixprocessor.MessageHandlerFunc(HandleIPFIX)),
+		},
+		Affinity: true,
+	}
+
+	collector.Start()
+}
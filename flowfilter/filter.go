@@ -0,0 +1,143 @@
+// Package flowfilter compiles filter expressions matching flow records, like
+//
+//	proto tcp and dst port 443 and src net 10.0.0.0/8 and not agent 192.0.2.1
+//
+// Primitives are combined with and, or, not (or &&, ||, !) and parentheses, and binds tighter than or.
+//
+//	[src|dst] host ADDR        the source or destination address, either when no direction is given
+//	[src|dst] net CIDR         the address is in the prefix
+//	[src|dst] ADDR|CIDR        shorthand for host and net
+//	[src|dst] port NUMBER      the transport port, ICMP type and code for ICMP
+//	[src|dst] as NUMBER        the autonomous system
+//	[in|out] if NUMBER         the SNMP index of the input or output interface
+//	agent ADDR|CIDR            the exporter of the flow, exporter is a synonym
+//	nexthop ADDR|CIDR          the next hop address
+//	proto NAME|NUMBER          the IP protocol, like tcp, udp, icmp or 47
+//	tos NUMBER                 the IP type of service
+//	vlan NUMBER                the 802.1Q VLAN id
+//	flags LETTERS              every TCP flag given among UAPRSFEC is set
+//	bytes NUMBER               the bytes corrected for the sampling
+//	packets NUMBER             the packets corrected for the sampling
+//	ip4, ip6                   the address family of the flow
+//	any                        every flow
+//
+// A NUMBER is a value, a range like 1024-65535, or a value preceded by a comparison
+// operator among =, ==, !=, <, <=, > and >=.
+package flowfilter
+
+import (
+	"fmt"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// SyntaxError an error in a filter expression
+type SyntaxError struct {
+	// Expr the expression parsed
+	Expr string
+	// Offset the offset in bytes of the token in error
+	Offset int
+	// Msg what went wrong
+	Msg string
+}
+
+// Error the message and the column, counted from 1, of the token in error
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("flowfilter: %s at column %d", e.Msg, e.Offset+1)
+}
+
+// Caret returns the expression with a caret on the next line pointing at the token in error
+func (e *SyntaxError) Caret() string {
+	return e.Expr + "\n" + strings.Repeat(" ", e.Offset) + "^"
+}
+
+// matcher a compiled primitive or combination of primitives
+type matcher func(r *flowrecord.FlowRecord) bool
+
+// Filter a compiled filter expression, safe for concurrent use
+type Filter struct {
+	expr  string
+	match matcher
+}
+
+// Parse compiles a filter expression, an empty expression matches every flow.
+// The error is a *SyntaxError pointing at the offending token.
+func Parse(expr string) (*Filter, error) {
+	p := &parser{lexer: lexer{expr: expr}}
+	match, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{expr: expr, match: match}, nil
+}
+
+// MustParse is like Parse but panics if the expression cannot be parsed
+func MustParse(expr string) *Filter {
+	f, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}
+
+// String the expression the filter was compiled from
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether a record matches the filter
+func (f *Filter) Match(r *flowrecord.FlowRecord) bool {
+	return f.match(r)
+}
+
+// MatchNetFlow5 reports whether a NetFlow v1, v5 or v7 flow exported by exporter matches the filter
+func (f *Filter) MatchNetFlow5(exporter netip.Addr, header *netflow5.Header, flow *netflow5.Flow) bool {
+	r := flowrecord.FromNetFlow5(exporter, header, flow)
+	return f.match(&r)
+}
+
+// MatchSFlow reports whether a sample of a sFlow datagram received from remote matches the filter.
+// The packet of a flow sample is taken from its sampled header or its sampled IPv4 or IPv6 record.
+// Samples other than flow samples, like the counter samples, always match.
+func (f *Filter) MatchSFlow(remote netip.Addr, header *sflow.Header, sample sflow.Sample) bool {
+	s, ok := flowrecord.NewSFlowSample(remote, header, sample, time.Time{})
+	if !ok {
+		return true
+	}
+
+	r, _ := flowrecord.FromSFlowSample(s, sample)
+	return f.match(&r)
+}
+
+// FilterNetFlow5 moves the flows matching the filter to the front of flows and returns them
+func (f *Filter) FilterNetFlow5(exporter netip.Addr, header *netflow5.Header, flows []netflow5.Flow) []netflow5.Flow {
+	n := 0
+	for i := range flows {
+		if f.MatchNetFlow5(exporter, header, &flows[i]) {
+			flows[n] = flows[i]
+			n++
+		}
+	}
+
+	return flows[:n]
+}
+
+// FilterSFlow moves the samples matching the filter to the front of samples and returns them
+func (f *Filter) FilterSFlow(remote netip.Addr, header *sflow.Header, samples []sflow.Sample) []sflow.Sample {
+	n := 0
+	for _, sample := range samples {
+		if f.MatchSFlow(remote, header, sample) {
+			samples[n] = sample
+			n++
+		}
+	}
+
+	clear(samples[n:])
+	return samples[:n]
+}
@@ -0,0 +1,198 @@
+package flowfilter
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func testRecord() *flowrecord.FlowRecord {
+	return &flowrecord.FlowRecord{
+		Exporter:     netip.MustParseAddr("192.0.2.1"),
+		SrcAddr:      netip.MustParseAddr("10.1.2.3"),
+		DstAddr:      netip.MustParseAddr("198.51.100.7"),
+		NextHop:      netip.MustParseAddr("192.0.2.254"),
+		SrcPort:      51000,
+		DstPort:      443,
+		Proto:        6,
+		TCPFlags:     0x12,
+		ToS:          32,
+		Bytes:        1500,
+		Packets:      3,
+		SamplingRate: 10,
+		InIf:         4,
+		OutIf:        7,
+		SrcAS:        64500,
+		DstAS:        15169,
+		VLAN:         100,
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"any", true},
+		{"proto tcp and dst port 443 and src net 10.0.0.0/8 and not agent 192.0.2.1", false},
+		{"proto tcp and dst port 443 and src net 10.0.0.0/8 and not agent 192.0.2.2", true},
+		{"PROTO TCP && DST PORT 443", true},
+		{"proto udp or port 443", true},
+		{"proto udp or port 80", false},
+		{"proto 6", true},
+		{"proto > 17", false},
+		{"src port 443", false},
+		{"port 443", true},
+		{"dst port 1-1023", true},
+		{"src port >= 1024", true},
+		{"src port != 51000", false},
+		{"host 198.51.100.7", true},
+		{"src host 198.51.100.7", false},
+		{"dst 198.51.100.0/24", true},
+		{"src 10.1.2.3", true},
+		{"net 10.1.0.0/16", true},
+		{"src net 10.1.2.3/8", true},
+		{"host ::ffff:10.1.2.3", true},
+		{"agent 192.0.2.0/24", true},
+		{"exporter 192.0.2.2", false},
+		{"nexthop 192.0.2.254", true},
+		{"in if 4 and out if 7", true},
+		{"in if 7", false},
+		{"if 7", true},
+		{"src as 64500 and dst as 15169", true},
+		{"as 1-100", false},
+		{"tos 32", true},
+		{"vlan 100", true},
+		{"flags SA", true},
+		{"flags s", true},
+		{"flags F", false},
+		{"bytes > 10000", true},
+		{"packets 30", true},
+		{"ip4 and not ip6", true},
+		{"not not proto tcp", true},
+		{"!(proto udp || port 80) && (src net 10.0.0.0/8 or src net 172.16.0.0/12)", true},
+		{"proto udp or proto tcp and port 80", false},
+		{"(proto udp or proto tcp) and port 443", true},
+	}
+
+	r := testRecord()
+	for _, test := range tests {
+		f, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%q : %v", test.expr, err)
+			continue
+		}
+
+		if f.Match(r) != test.match {
+			t.Errorf("%q : expected %v", test.expr, test.match)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		expr   string
+		offset int
+	}{
+		{"proto tcp and dst port x", 23},
+		{"proto tcp and", 13},
+		{"proto tcp dst port 443", 10},
+		{"proto foo", 6},
+		{"src net 10.0.0.0/33", 8},
+		{"host 10.0.0.0/8", 5},
+		{"(proto tcp", 10},
+		{"proto tcp)", 9},
+		{"port 70000", 5},
+		{"port 20-10", 5},
+		{"flags SX", 7},
+		{"in port 4", 3},
+		{"proto tcp & port 80", 10},
+		{"dst", 3},
+		{"bogus", 0},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.expr)
+		var syntaxError *SyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("%q : expected a syntax error, got %v", test.expr, err)
+			continue
+		}
+
+		if syntaxError.Offset != test.offset {
+			t.Errorf("%q : expected offset %d, got %d (%v)", test.expr, test.offset, syntaxError.Offset, err)
+		}
+	}
+
+	_, err := Parse("proto tcp and dst port x")
+	if err.Error() != `flowfilter: expected a number, found "x" at column 24` {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	if caret := err.(*SyntaxError).Caret(); caret != "proto tcp and dst port x\n                       ^" {
+		t.Errorf("unexpected caret\n%s", caret)
+	}
+}
+
+func TestMatchNetFlow5(t *testing.T) {
+	data := netflow5.NetFlow5{}
+	data.Header.SetVersion(5)
+	data.Header.SetLength(3)
+	for i := range 3 {
+		data.Flows[i].SetSrcIP(net.IPv4(10, 0, 0, byte(i)))
+		data.Flows[i].SetDstPort(uint16(442 + i))
+		data.Flows[i].Proto = 6
+	}
+
+	f := MustParse("proto tcp and dst port >= 443 and not src host 10.0.0.2")
+	flows := f.FilterNetFlow5(netip.MustParseAddr("192.0.2.1"), &data.Header, data.FlowArray())
+	if len(flows) != 1 || flows[0].DstPort() != 443 {
+		t.Errorf("unexpected flows %+v", flows)
+	}
+}
+
+func TestMatchSFlow(t *testing.T) {
+	// a datagram of agent 10.0.0.253 holding a counter sample and a flow sample of a TCP packet
+	// from 10.0.0.150:80 to 10.0.0.152:52369
+	data, _ := hex.DecodeString("00000005000000010a0000fd000000000020036611a086300000000200000002000000a8000219a1000000070000000200000001000000580000000700000006000000003b9aca0000000001000000030000000014809050002359ac0000064a00005dd6000000000000000000000000000000012e67a1890024e2e700341d4f01d6a75600000000000000000000000000000002000000340000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001000000840007ab6800000002000007d058b4258000000e7d000000020000000300000001000000010000005c000000010000004e000000040000004c8ee6cef957743e5b354b3a7208004500003c000040004006258f0a0000960a0000980050cc91323bdb526c0698c3a01216a0c6200000020405b40402080a3ed981073ed9780e010303070000")
+	header := sflow.Header{}
+	next, err := header.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr    string
+		samples int
+	}{
+		{"src host 10.0.0.150 and src port 80 and agent 10.0.0.253", 2},
+		{"proto udp", 1},
+		{"not agent 10.0.0.253", 1},
+	}
+
+	for _, test := range tests {
+		samples, err := header.ParseSamples(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		samples = MustParse(test.expr).FilterSFlow(netip.MustParseAddr("10.0.0.253"), &header, samples)
+		if len(samples) != test.samples {
+			t.Errorf("%q : expected %d samples, got %d", test.expr, test.samples, len(samples))
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	f := MustParse("proto tcp and dst port 443 and src net 10.0.0.0/8 and not agent 192.0.2.1")
+	r := testRecord()
+	for b.Loop() {
+		f.Match(r)
+	}
+}
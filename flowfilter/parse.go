@@ -0,0 +1,573 @@
+package flowfilter
+
+import (
+	"fmt"
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+type tokenKind uint8
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenLeft
+	tokenRight
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenCompare
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+// describe the token as quoted in the error messages
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+
+	return strconv.Quote(t.text)
+}
+
+// lexer splits an expression into tokens
+type lexer struct {
+	expr   string
+	offset int
+}
+
+// isSeparator reports whether c ends a word
+func isSeparator(c byte) bool {
+	return strings.IndexByte(" \t\r\n()!<>=&|", c) >= 0
+}
+
+func (l *lexer) next() (token, error) {
+	for l.offset < len(l.expr) && strings.IndexByte(" \t\r\n", l.expr[l.offset]) >= 0 {
+		l.offset++
+	}
+
+	start := l.offset
+	if start == len(l.expr) {
+		return token{kind: tokenEOF, offset: start}, nil
+	}
+
+	emit := func(kind tokenKind, length int) (token, error) {
+		l.offset += length
+		return token{kind: kind, text: l.expr[start:l.offset], offset: start}, nil
+	}
+
+	rest := l.expr[start:]
+	switch {
+	case rest[0] == '(':
+		return emit(tokenLeft, 1)
+	case rest[0] == ')':
+		return emit(tokenRight, 1)
+	case strings.HasPrefix(rest, "&&"):
+		return emit(tokenAnd, 2)
+	case strings.HasPrefix(rest, "||"):
+		return emit(tokenOr, 2)
+	case strings.HasPrefix(rest, "!="), strings.HasPrefix(rest, "<="), strings.HasPrefix(rest, ">="), strings.HasPrefix(rest, "=="):
+		return emit(tokenCompare, 2)
+	case rest[0] == '!':
+		return emit(tokenNot, 1)
+	case rest[0] == '<', rest[0] == '>', rest[0] == '=':
+		return emit(tokenCompare, 1)
+	case rest[0] == '&', rest[0] == '|':
+		return token{}, &SyntaxError{Expr: l.expr, Offset: start, Msg: fmt.Sprintf("unexpected %q", rest[0])}
+	}
+
+	for l.offset < len(l.expr) && !isSeparator(l.expr[l.offset]) {
+		l.offset++
+	}
+
+	t := token{kind: tokenWord, text: l.expr[start:l.offset], offset: start}
+	switch strings.ToLower(t.text) {
+	case "and":
+		t.kind = tokenAnd
+	case "or":
+		t.kind = tokenOr
+	case "not":
+		t.kind = tokenNot
+	}
+
+	return t, nil
+}
+
+// parser a recursive descent parser compiling the expression as it goes
+type parser struct {
+	lexer lexer
+	token token
+}
+
+// advance reads the next token
+func (p *parser) advance() error {
+	t, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+
+	p.token = t
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Expr: p.lexer.expr, Offset: t.offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// word returns the current token lower cased when it is a word, "" otherwise
+func (p *parser) word() string {
+	if p.token.kind != tokenWord {
+		return ""
+	}
+
+	return strings.ToLower(p.token.text)
+}
+
+func (p *parser) parse() (matcher, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == tokenEOF {
+		return func(*flowrecord.FlowRecord) bool { return true }, nil
+	}
+
+	m, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.token.kind != tokenEOF {
+		return nil, p.errorf(p.token, "expected and, or or end of expression, found %s", p.token.describe())
+	}
+
+	return m, nil
+}
+
+func (p *parser) or() (matcher, error) {
+	m, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.token.kind == tokenOr {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		left := m
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		m = func(r *flowrecord.FlowRecord) bool { return left(r) || right(r) }
+	}
+
+	return m, nil
+}
+
+func (p *parser) and() (matcher, error) {
+	m, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.token.kind == tokenAnd {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		left := m
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		m = func(r *flowrecord.FlowRecord) bool { return left(r) && right(r) }
+	}
+
+	return m, nil
+}
+
+func (p *parser) not() (matcher, error) {
+	if p.token.kind != tokenNot {
+		return p.primary()
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	m, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *flowrecord.FlowRecord) bool { return !m(r) }, nil
+}
+
+func (p *parser) primary() (matcher, error) {
+	switch p.token.kind {
+	case tokenLeft:
+		left := p.token
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		m, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.token.kind != tokenRight {
+			return nil, p.errorf(p.token, "expected ) closing the ( at column %d, found %s", left.offset+1, p.token.describe())
+		}
+
+		return m, p.advance()
+	case tokenWord:
+	default:
+		return nil, p.errorf(p.token, "expected a primitive, found %s", p.token.describe())
+	}
+
+	keyword := p.token
+	switch p.word() {
+	case "any", "all":
+		return func(*flowrecord.FlowRecord) bool { return true }, p.advance()
+	case "ip4", "ipv4", "inet":
+		return func(r *flowrecord.FlowRecord) bool { return !r.IsIPv6() }, p.advance()
+	case "ip6", "ipv6", "inet6":
+		return func(r *flowrecord.FlowRecord) bool { return r.IsIPv6() }, p.advance()
+	case "src", "dst":
+		return p.directed(p.word())
+	case "host", "net", "port", "as":
+		return p.directed("")
+	case "in", "out", "if":
+		return p.iface()
+	case "agent", "exporter":
+		return p.address(keyword, func(r *flowrecord.FlowRecord) netip.Addr { return r.Exporter })
+	case "nexthop":
+		return p.address(keyword, func(r *flowrecord.FlowRecord) netip.Addr { return r.NextHop })
+	case "proto":
+		return p.proto()
+	case "tos":
+		return p.number(8, func(r *flowrecord.FlowRecord) uint64 { return uint64(r.ToS) })
+	case "vlan":
+		return p.number(12, func(r *flowrecord.FlowRecord) uint64 { return uint64(r.VLAN) })
+	case "bytes":
+		return p.number(64, func(r *flowrecord.FlowRecord) uint64 { return r.ScaledBytes() })
+	case "packets":
+		return p.number(64, func(r *flowrecord.FlowRecord) uint64 { return r.ScaledPackets() })
+	case "flags":
+		return p.flags()
+	}
+
+	return nil, p.errorf(keyword, "unknown primitive %s", keyword.describe())
+}
+
+// either matches when the source or destination matches, or only one of them for a direction
+func either[T any](direction string, src, dst func(r *flowrecord.FlowRecord) T, match func(v T) bool) matcher {
+	switch direction {
+	case "src":
+		return func(r *flowrecord.FlowRecord) bool { return match(src(r)) }
+	case "dst":
+		return func(r *flowrecord.FlowRecord) bool { return match(dst(r)) }
+	}
+
+	return func(r *flowrecord.FlowRecord) bool { return match(src(r)) || match(dst(r)) }
+}
+
+// directed parses the primitives taking a src or dst direction, the current token is the direction or the primitive
+func (p *parser) directed(direction string) (matcher, error) {
+	if direction != "" {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	keyword := p.token
+	switch p.word() {
+	case "host", "net":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		match, err := p.prefix(strings.ToLower(keyword.text))
+		if err != nil {
+			return nil, err
+		}
+
+		return either(direction, srcAddr, dstAddr, match), nil
+	case "port":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		match, err := p.compare(16)
+		if err != nil {
+			return nil, err
+		}
+
+		return either(direction, srcPort, dstPort, match), nil
+	case "as":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		match, err := p.compare(32)
+		if err != nil {
+			return nil, err
+		}
+
+		return either(direction, srcAS, dstAS, match), nil
+	}
+
+	// the address or prefix right after the direction
+	if direction != "" && p.token.kind == tokenWord {
+		if match, err := p.prefix("net"); err == nil {
+			return either(direction, srcAddr, dstAddr, match), nil
+		}
+	}
+
+	return nil, p.errorf(p.token, "expected host, net, port, as or an address after %s, found %s", direction, p.token.describe())
+}
+
+func srcAddr(r *flowrecord.FlowRecord) netip.Addr { return r.SrcAddr }
+func dstAddr(r *flowrecord.FlowRecord) netip.Addr { return r.DstAddr }
+func srcPort(r *flowrecord.FlowRecord) uint64     { return uint64(r.SrcPort) }
+func dstPort(r *flowrecord.FlowRecord) uint64     { return uint64(r.DstPort) }
+func srcAS(r *flowrecord.FlowRecord) uint64       { return uint64(r.SrcAS) }
+func dstAS(r *flowrecord.FlowRecord) uint64       { return uint64(r.DstAS) }
+func inIf(r *flowrecord.FlowRecord) uint64        { return uint64(r.InIf) }
+func outIf(r *flowrecord.FlowRecord) uint64       { return uint64(r.OutIf) }
+
+// prefix parses the address of host or the address or prefix of net
+func (p *parser) prefix(keyword string) (func(addr netip.Addr) bool, error) {
+	t := p.token
+	if t.kind != tokenWord {
+		return nil, p.errorf(t, "expected an address after %s, found %s", keyword, t.describe())
+	}
+
+	if addr, err := netip.ParseAddr(t.text); err == nil {
+		addr = addr.Unmap()
+		return func(a netip.Addr) bool { return a.Unmap() == addr }, p.advance()
+	}
+
+	if keyword == "host" {
+		return nil, p.errorf(t, "invalid address %s", t.describe())
+	}
+
+	prefix, err := netip.ParsePrefix(t.text)
+	if err != nil {
+		return nil, p.errorf(t, "invalid address or prefix %s", t.describe())
+	}
+
+	prefix = prefix.Masked()
+	return func(a netip.Addr) bool { return prefix.Contains(a.Unmap()) }, p.advance()
+}
+
+// address parses the address or prefix following keyword
+func (p *parser) address(keyword token, field func(r *flowrecord.FlowRecord) netip.Addr) (matcher, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	match, err := p.prefix(strings.ToLower(keyword.text))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *flowrecord.FlowRecord) bool { return match(field(r)) }, nil
+}
+
+// iface parses [in|out] if NUMBER
+func (p *parser) iface() (matcher, error) {
+	direction := ""
+	if p.word() != "if" {
+		direction = p.word()
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		if p.word() != "if" {
+			return nil, p.errorf(p.token, "expected if after %s, found %s", direction, p.token.describe())
+		}
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	match, err := p.compare(32)
+	if err != nil {
+		return nil, err
+	}
+
+	switch direction {
+	case "in":
+		direction = "src"
+	case "out":
+		direction = "dst"
+	}
+
+	return either(direction, inIf, outIf, match), nil
+}
+
+// number parses the NUMBER following a keyword
+func (p *parser) number(bits int, field func(r *flowrecord.FlowRecord) uint64) (matcher, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	match, err := p.compare(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *flowrecord.FlowRecord) bool { return match(field(r)) }, nil
+}
+
+// value parses an unsigned number of at most bits bits
+func (p *parser) value(t token, text string, bits int) (uint64, error) {
+	v, err := strconv.ParseUint(text, 10, bits)
+	if err != nil {
+		if numError, ok := err.(*strconv.NumError); ok && numError.Err == strconv.ErrRange {
+			return 0, p.errorf(t, "%q is out of range, at most %d", text, uint64(1)<<bits-1)
+		}
+
+		return 0, p.errorf(t, "expected a number, found %s", t.describe())
+	}
+
+	return v, nil
+}
+
+// compare parses a value, a range or an operator and a value
+func (p *parser) compare(bits int) (func(v uint64) bool, error) {
+	operator := "="
+	if p.token.kind == tokenCompare {
+		operator = p.token.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	t := p.token
+	if t.kind != tokenWord {
+		return nil, p.errorf(t, "expected a number, found %s", t.describe())
+	}
+
+	if low, high, found := strings.Cut(t.text, "-"); found && operator == "=" {
+		from, err := p.value(t, low, bits)
+		if err != nil {
+			return nil, err
+		}
+
+		to, err := p.value(t, high, bits)
+		if err != nil {
+			return nil, err
+		}
+
+		if from > to {
+			return nil, p.errorf(t, "empty range %s", t.describe())
+		}
+
+		return func(v uint64) bool { return v >= from && v <= to }, p.advance()
+	}
+
+	x, err := p.value(t, t.text, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	var match func(v uint64) bool
+	switch operator {
+	case "=", "==":
+		match = func(v uint64) bool { return v == x }
+	case "!=":
+		match = func(v uint64) bool { return v != x }
+	case "<":
+		match = func(v uint64) bool { return v < x }
+	case "<=":
+		match = func(v uint64) bool { return v <= x }
+	case ">":
+		match = func(v uint64) bool { return v > x }
+	case ">=":
+		match = func(v uint64) bool { return v >= x }
+	}
+
+	return match, p.advance()
+}
+
+// protocols the IP protocols known by name
+var protocols = map[string]uint8{
+	"icmp":      1,
+	"igmp":      2,
+	"tcp":       6,
+	"udp":       17,
+	"gre":       47,
+	"esp":       50,
+	"ah":        51,
+	"icmp6":     58,
+	"ipv6-icmp": 58,
+	"ospf":      89,
+	"pim":       103,
+	"sctp":      132,
+}
+
+func (p *parser) proto() (matcher, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if proto, found := protocols[p.word()]; found {
+		return func(r *flowrecord.FlowRecord) bool { return r.Proto == proto }, p.advance()
+	}
+
+	if p.token.kind != tokenWord && p.token.kind != tokenCompare {
+		return nil, p.errorf(p.token, "expected a protocol, found %s", p.token.describe())
+	}
+
+	match, err := p.compare(8)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *flowrecord.FlowRecord) bool { return match(uint64(r.Proto)) }, nil
+}
+
+// tcpFlags the TCP flags by letter
+var tcpFlags = map[byte]uint8{'F': 0x01, 'S': 0x02, 'R': 0x04, 'P': 0x08, 'A': 0x10, 'U': 0x20, 'E': 0x40, 'C': 0x80}
+
+func (p *parser) flags() (matcher, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	t := p.token
+	if t.kind != tokenWord {
+		return nil, p.errorf(t, "expected TCP flags like SA, found %s", t.describe())
+	}
+
+	var mask uint8
+	for i := 0; i < len(t.text); i++ {
+		c := t.text[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+
+		flag, found := tcpFlags[c]
+		if !found {
+			return nil, p.errorf(token{offset: t.offset + i}, "unknown TCP flag %q, expected one of UAPRSFEC", t.text[i])
+		}
+
+		mask |= flag
+	}
+
+	return func(r *flowrecord.FlowRecord) bool { return r.TCPFlags&mask == mask }, p.advance()
+}
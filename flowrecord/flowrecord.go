@@ -0,0 +1,102 @@
+package flowrecord
+
+import (
+	"net/netip"
+	"time"
+)
+
+// FlowRecord a protocol neutral flow.
+// Bytes and Packets are the values as exported, before correcting for the sampling.
+type FlowRecord struct {
+	// Exporter the address of the device that exported the flow
+	Exporter netip.Addr
+	SrcAddr  netip.Addr
+	DstAddr  netip.Addr
+	NextHop  netip.Addr
+	SrcPort  uint16
+	DstPort  uint16
+	// Proto IP protocol type (for example, TCP = 6; UDP = 17)
+	Proto uint8
+	// TCPFlags cumulative OR of TCP flags
+	TCPFlags uint8
+	// ToS IP type of service
+	ToS     uint8
+	SrcMask uint8
+	DstMask uint8
+	// Bytes the length of the IP packets, without the lower layer headers
+	Bytes   uint64
+	Packets uint64
+	// SamplingRate one packet out of SamplingRate was sampled, 0 or 1 when not sampled
+	SamplingRate uint32
+	// InIf SNMP index of the input interface
+	InIf uint32
+	// OutIf SNMP index of the output interface
+	OutIf uint32
+	SrcAS uint32
+	DstAS uint32
+	// VLAN the 802.1Q VLAN id, 0 when untagged
+	VLAN  uint16
+	Start time.Time
+	End   time.Time
+	// Annotations the attributes set by the enrichers, nil when none was set
+	Annotations *Annotations
+}
+
+// Annotations the attributes of a record set by the enrichers of the lpm, mmdb and ifinventory packages.
+// They are kept out of the FlowRecord so that the records which are not enriched stay small.
+type Annotations struct {
+	Src Endpoint
+	Dst Endpoint
+	In  Interface
+	Out Interface
+}
+
+// Endpoint the attributes of the source or of the destination of a flow
+type Endpoint struct {
+	// Country the ISO 3166-1 code of the country
+	Country string
+	City    string
+	// ASOrg the organization owning the AS number
+	ASOrg string
+	// Attributes the attributes of the prefix containing the address, its site or its customer for instance.
+	// Shared with the lpm.Table, it must not be modified.
+	Attributes map[string]string
+}
+
+// Interface the attributes of the input or of the output interface of a flow
+type Interface struct {
+	Name        string
+	Description string
+	// Role what the interface connects to, transit or customer for instance
+	Role string
+}
+
+// Annotate returns the Annotations of r, allocated when r has none
+func (r *FlowRecord) Annotate() *Annotations {
+	if r.Annotations == nil {
+		r.Annotations = new(Annotations)
+	}
+
+	return r.Annotations
+}
+
+// Rate the sampling rate, 1 when not sampled
+func (r *FlowRecord) Rate() uint64 {
+	if r.SamplingRate == 0 {
+		return 1
+	}
+
+	return uint64(r.SamplingRate)
+}
+
+// ScaledBytes the number of bytes corrected for the sampling
+func (r *FlowRecord) ScaledBytes() uint64 { return r.Bytes * r.Rate() }
+
+// ScaledPackets the number of packets corrected for the sampling
+func (r *FlowRecord) ScaledPackets() uint64 { return r.Packets * r.Rate() }
+
+// Duration the time between the first and the last packet of the flow
+func (r *FlowRecord) Duration() time.Duration { return r.End.Sub(r.Start) }
+
+// IsIPv6 reports whether the flow is between IPv6 addresses
+func (r *FlowRecord) IsIPv6() bool { return r.SrcAddr.Is6() && !r.SrcAddr.Is4In6() }
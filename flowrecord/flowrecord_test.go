@@ -0,0 +1,197 @@
+package flowrecord
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+const sflowPacket = "00000005000000010a0000fd000000000020036611a086300000000800000002000000a8000219a1000000070000000200000001000000580000000700000006000000003b9aca0000000001000000030000000014809050002359ac0000064a00005dd6000000000000000000000000000000012e67a1890024e2e700341d4f01d6a75600000000000000000000000000000002000000340000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001000000840007ab6800000002000007d058b4258000000e7d000000020000000300000001000000010000005c000000010000004e000000040000004c8ee6cef957743e5b354b3a7208004500003c000040004006258f0a0000960a0000980050cc91323bdb526c0698c3a01216a0c6200000020405b40402080a3ed981073ed9780e01030307000000000002000000a8000219fe0000001800000002000000010000005800000018000000060000000005f5e10000000001000000030000001b4a3a4bbf0b7154bc0021d7730020a9f80000000000000001000000000000001be8ed06a30b95b84e0002552700000042000000000000000000000000000000020000003400000000000000010000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000010000008c0007ab6900000002000007d058b42e1400000e7e000000020000000100000001000000010000006400000001000000580000000400000054f229017058253e5b354b3a72080045000046fa7c400040062b090a0000960a000097c1ec2bcb12ca960a47a6705e8018002e187300000101080a3ed981e93ed971d36765742073657373696f6e2e74696d650d0a000000010000008c0001e99100000001000007d014ac2e7a000004e5000000020000000100000001000000010000006400000001000000580000000400000054f229017058253e5b354b3a72080045000046fa7c400040062b090a0000960a000097c1ec2bcb12ca960a47a6705e8018002e187300000101080a3ed981e93ed971d36765742073657373696f6e2e74696d650d0a00000001000000b80006693200000014000003e81a265962000001760000001600000014000000010000000100000090000000010000041400000004000000800040101840190026bb527a5e0800450004025b120000401104910a0000460a0103023b5cacbc03eeeaacdae81d9001bf87f0a2ddda96f01ff701fa157785f459cc82c96f226297b2a63a60e3ebe40f271acffc3961cbb919960c2af6804a2696abe8ae9f47ba043c684a3a7738c6ce567b3fb293aa3c745e013073a0ef5835e900000001000000b80001420300000003000007d00babed440000064d0000000200000003000000010000000100000090000000010000015e00000004000000808ee6cef957743e5b354b3a7208004500014cf73e400040062d400a0000960a0000980050cd086c7076fe9f850c28801800361d5200000101080a3ed981e93ed978ca485454502f312e3120323030204f4b0d0a446174653a204672692c203235204a616e20323031332032323a32343a303720474d540d0a5365727665723a2000000001000000b800058b5300000018000003e8174be44a0000016a0000001700000018000000010000000100000090000000010000045a00000004000000800013c4559181004010184019080045000448c0cc0000ff119771d177232240af2a1e01f401f404340000000000000000000074103d54000c75e2a8277d1c099628cfa2df7d4e6627dd4229c75e539ad1055f15a580660589a47a7b3eee5afce4a8978d46509eda6956359a25ad62c53ed8b0b780c31c25bdca403add0e2cc5d9"
+
+func TestAppendSFlow(t *testing.T) {
+	data, err := hex.DecodeString(sflowPacket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := sflow.Header{}
+	next, err := h.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := h.ParseSamples(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := time.Unix(1700000000, 0)
+	records := AppendSFlow(nil, netip.MustParseAddr("192.0.2.1"), &h, samples, received)
+	if len(records) != 6 {
+		t.Fatalf("expected 6 records got %d", len(records))
+	}
+
+	expected := FlowRecord{
+		Exporter:     netip.MustParseAddr("10.0.0.253"),
+		SrcAddr:      netip.MustParseAddr("10.0.0.150"),
+		DstAddr:      netip.MustParseAddr("10.0.0.152"),
+		SrcPort:      80,
+		DstPort:      52369,
+		Proto:        6,
+		TCPFlags:     0x12,
+		Bytes:        60,
+		Packets:      1,
+		SamplingRate: 2000,
+		InIf:         2,
+		OutIf:        3,
+		Start:        received,
+		End:          received,
+	}
+
+	if records[0] != expected {
+		t.Errorf("expected %+v got %+v", expected, records[0])
+	}
+
+	if records[0].ScaledBytes() != 120000 || records[0].ScaledPackets() != 2000 {
+		t.Errorf("unexpected scaled values %d %d", records[0].ScaledBytes(), records[0].ScaledPackets())
+	}
+
+	last := records[len(records)-1]
+	if last.SrcAddr != netip.MustParseAddr("209.119.35.34") || last.Proto != 17 || last.SrcPort != 500 || last.DstPort != 500 {
+		t.Errorf("unexpected record %+v", last)
+	}
+}
+
+func TestFromSampledHeaderVLAN(t *testing.T) {
+	frame := make([]byte, 14+4+20+8)
+	binary.BigEndian.PutUint16(frame[12:14], 0x8100)
+	binary.BigEndian.PutUint16(frame[14:16], 0x2064)
+	binary.BigEndian.PutUint16(frame[16:18], 0x0800)
+	ip := frame[18:]
+	ip[0] = 0x45
+	ip[1] = 0x10
+	ip[9] = 17
+	copy(ip[12:16], []byte{10, 0, 0, 1})
+	copy(ip[16:20], []byte{10, 0, 0, 2})
+	binary.BigEndian.PutUint16(ip[20:22], 53)
+	binary.BigEndian.PutUint16(ip[22:24], 5353)
+	r, ok := FromSampledHeader(SFlowSample{}, &sflow.SampledHeader{Protocol: HeaderProtocolEthernet, FrameLength: 64, Header: frame})
+	if !ok {
+		t.Fatal("tagged frame not decoded")
+	}
+
+	if r.VLAN != 100 || r.ToS != 0x10 || r.Proto != 17 || r.SrcPort != 53 || r.DstPort != 5353 || r.Bytes != 64-18-4 {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestFromSampledHeaderIPv6(t *testing.T) {
+	packet := make([]byte, 40+8+20)
+	packet[0] = 0x6b
+	packet[1] = 0x80
+	packet[6] = 0
+	copy(packet[8:24], net.ParseIP("2001:db8::1"))
+	copy(packet[24:40], net.ParseIP("2001:db8::2"))
+	// hop-by-hop options then TCP
+	packet[40] = 6
+	binary.BigEndian.PutUint16(packet[48:50], 443)
+	binary.BigEndian.PutUint16(packet[50:52], 51000)
+	packet[61] = 0x02
+	r, ok := FromSampledHeader(SFlowSample{SamplingRate: 10}, &sflow.SampledHeader{Protocol: HeaderProtocolIPv6, FrameLength: 90, Header: packet})
+	if !ok {
+		t.Fatal("IPv6 header not decoded")
+	}
+
+	if r.SrcAddr != netip.MustParseAddr("2001:db8::1") || r.DstAddr != netip.MustParseAddr("2001:db8::2") || !r.IsIPv6() {
+		t.Errorf("unexpected addresses %s %s", r.SrcAddr, r.DstAddr)
+	}
+
+	if r.Proto != 6 || r.SrcPort != 443 || r.DstPort != 51000 || r.TCPFlags != 0x02 || r.ToS != 0xb8 {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestFromSampledIPV6(t *testing.T) {
+	data := make([]byte, 56)
+	binary.BigEndian.PutUint32(data[0:4], 1500)
+	binary.BigEndian.PutUint32(data[4:8], 17)
+	copy(data[8:24], net.ParseIP("2001:db8::1"))
+	copy(data[24:40], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint32(data[40:44], 53)
+	binary.BigEndian.PutUint32(data[44:48], 5353)
+	si := sflow.SampledIPV6{}
+	if err := si.Parse(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if si.FlowType() != sflow.SampledIPV6Type {
+		t.Errorf("unexpected flow type %d", si.FlowType())
+	}
+
+	r := FromSampledIPV6(SFlowSample{}, &si)
+	if r.SrcAddr != netip.MustParseAddr("2001:db8::1") || r.DstAddr != netip.MustParseAddr("2001:db8::2") {
+		t.Errorf("unexpected addresses %s %s", r.SrcAddr, r.DstAddr)
+	}
+
+	if r.Bytes != 1500 || r.Proto != 17 || r.SrcPort != 53 || r.DstPort != 5353 || r.Rate() != 1 {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestFromNetFlow5(t *testing.T) {
+	h := netflow5.Header{}
+	h.SetVersion(5)
+	h.SetSysUptime(360000)
+	h.SetUnixSecs(1700000000)
+	h.SetSamplingInterval(0x4064)
+	flow := netflow5.Flow{Proto: 6, TCPFlags: 0x1b, Tos: 0x20, SrcMask: 24, DstMask: 16}
+	flow.SetSrcIP(net.IPv4(10, 0, 0, 1))
+	flow.SetDstIP(net.IPv4(192, 0, 2, 1))
+	flow.SetNextIP(net.IPv4(198, 51, 100, 1))
+	flow.SetSrcPort(51000)
+	flow.SetDstPort(443)
+	flow.SetDPkts(10)
+	flow.SetDOctets(1500)
+	flow.SetFirst(350000)
+	flow.SetLast(359000)
+	flow.SetInput(3)
+	flow.SetOutput(4)
+	flow.SetSrcAs(64500)
+	flow.SetDstAs(64501)
+	records := AppendNetFlow5(nil, netip.MustParseAddr("::ffff:203.0.113.1"), &h, []netflow5.Flow{flow})
+	expected := FlowRecord{
+		Exporter:     netip.MustParseAddr("203.0.113.1"),
+		SrcAddr:      netip.MustParseAddr("10.0.0.1"),
+		DstAddr:      netip.MustParseAddr("192.0.2.1"),
+		NextHop:      netip.MustParseAddr("198.51.100.1"),
+		SrcPort:      51000,
+		DstPort:      443,
+		Proto:        6,
+		TCPFlags:     0x1b,
+		ToS:          0x20,
+		SrcMask:      24,
+		DstMask:      16,
+		Bytes:        1500,
+		Packets:      10,
+		SamplingRate: 100,
+		InIf:         3,
+		OutIf:        4,
+		SrcAS:        64500,
+		DstAS:        64501,
+		Start:        time.Unix(1700000000-10, 0),
+		End:          time.Unix(1700000000-1, 0),
+	}
+
+	if len(records) != 1 || records[0] != expected {
+		t.Errorf("expected %+v got %+v", expected, records)
+	}
+
+	if records[0].Duration() != 9*time.Second || records[0].ScaledBytes() != 150000 {
+		t.Errorf("unexpected duration %s or scaled bytes %d", records[0].Duration(), records[0].ScaledBytes())
+	}
+}
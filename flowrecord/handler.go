@@ -0,0 +1,118 @@
+package flowrecord
+
+import (
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// RecordsHandler handles decoded flows, the aggregator.Aggregator and the flowsink.Sink are RecordsHandlers.
+// The records must not be retained after AddRecords returns.
+type RecordsHandler interface {
+	AddRecords(records []FlowRecord)
+}
+
+// The RecordsHandlerFunc type is an adapter to allow the use of
+// ordinary functions as RecordsHandlers.
+type RecordsHandlerFunc func(records []FlowRecord)
+
+// AddRecords calls f(records)
+func (f RecordsHandlerFunc) AddRecords(records []FlowRecord) {
+	f(records)
+}
+
+// Enricher decodes the datagrams handed to it into records, sets their fields with Enrich and hands them to Handler.
+// It implements the handlers of the flowcollector and of the sFlow and NetFlow v5 processors,
+// the enrichers such as the lpm.Enricher are plugged into the collectors with it.
+// The records are decoded into buffers reused between datagrams, it is safe for concurrent use when Enrich is.
+//
+//	handler := &flowrecord.Enricher{Enrich: asn.Enrich, Handler: sink}
+type Enricher struct {
+	// Enrich sets the fields of a record in place.
+	// Required.
+	Enrich func(r *FlowRecord)
+	// Samples is called with the samples of every sFlow datagram before they are decoded, and the address
+	// of the agent that sent them, to learn from the counter samples for instance.
+	// Default : nil
+	Samples func(agent netip.Addr, samples []sflow.Sample)
+	// Handler receives the enriched records, another Enricher, a flowsink.Sink or an aggregator.Aggregator for instance.
+	// Required.
+	Handler RecordsHandler
+
+	pool sync.Pool
+}
+
+// AddRecords enriches records in place and hands them to the Handler, the Enricher is a RecordsHandler
+func (e *Enricher) AddRecords(records []FlowRecord) {
+	for i := range records {
+		e.Enrich(&records[i])
+	}
+
+	e.Handler.AddRecords(records)
+}
+
+// HandleSFlow enriches the flow samples of a sFlow datagram received from remote now.
+// The agent handed to Samples is the agent address of the datagram when it is IPv4, remote otherwise.
+func (e *Enricher) HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	if e.Samples != nil {
+		agent := acl.AddrOf(remote)
+		if header.AddressType == 1 {
+			agent = netip.AddrFrom4(header.AgentAddress)
+		}
+
+		e.Samples(agent, samples)
+	}
+
+	buffer := e.buffer()
+	*buffer = AppendSFlow((*buffer)[:0], acl.AddrOf(remote), header, samples, time.Now())
+	e.forward(buffer)
+}
+
+// HandleNetFlow5 enriches the flows of a NetFlow v1, v5 or v7 datagram received from remote
+func (e *Enricher) HandleNetFlow5(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+	buffer := e.buffer()
+	*buffer = AppendNetFlow5((*buffer)[:0], acl.AddrOf(remote), header, flows)
+	e.forward(buffer)
+}
+
+// HandleSamples enriches the flow samples of a sFlow datagram as a processor SamplesHandler.
+// Without the remote address the exporter is the agent address of the datagram,
+// the records of the datagrams whose agent address is not IPv4 have none and their samples are not handed to Samples.
+func (e *Enricher) HandleSamples(header *sflow.Header, samples []sflow.Sample) {
+	if e.Samples != nil && header.AddressType == 1 {
+		e.Samples(netip.AddrFrom4(header.AgentAddress), samples)
+	}
+
+	buffer := e.buffer()
+	*buffer = AppendSFlow((*buffer)[:0], netip.Addr{}, header, samples, time.Now())
+	e.forward(buffer)
+}
+
+// HandleFlows enriches the flows of a NetFlow v1, v5 or v7 datagram as a processor FlowsHandler.
+// The processor does not pass the exporter, the records are decoded without one.
+func (e *Enricher) HandleFlows(header *netflow5.Header, flows []netflow5.Flow) {
+	buffer := e.buffer()
+	*buffer = AppendNetFlow5((*buffer)[:0], netip.Addr{}, header, flows)
+	e.forward(buffer)
+}
+
+// buffer returns a slice of records to decode a datagram into, reused between datagrams
+func (e *Enricher) buffer() *[]FlowRecord {
+	if buffer, ok := e.pool.Get().(*[]FlowRecord); ok {
+		return buffer
+	}
+
+	return new([]FlowRecord)
+}
+
+func (e *Enricher) forward(buffer *[]FlowRecord) {
+	if len(*buffer) > 0 {
+		e.AddRecords(*buffer)
+	}
+
+	e.pool.Put(buffer)
+}
@@ -0,0 +1,99 @@
+package flowrecord_test
+
+import (
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	netflow5processor "github.com/wwicak/go-utils/netflow5/processor"
+	"github.com/wwicak/go-utils/sflow"
+	sflowprocessor "github.com/wwicak/go-utils/sflow/processor"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+)
+
+var (
+	_ flowcollector.SFlowHandler     = (*flowrecord.Enricher)(nil)
+	_ flowcollector.NetFlow5Handler  = (*flowrecord.Enricher)(nil)
+	_ sflowprocessor.SamplesHandler  = (*flowrecord.Enricher)(nil)
+	_ netflow5processor.FlowsHandler = (*flowrecord.Enricher)(nil)
+	_ flowrecord.RecordsHandler      = (*flowrecord.Enricher)(nil)
+)
+
+func TestEnricher(t *testing.T) {
+	var lock sync.Mutex
+	var got []flowrecord.FlowRecord
+	var agents []netip.Addr
+	enricher := &flowrecord.Enricher{
+		Enrich:  func(r *flowrecord.FlowRecord) { r.SrcAS = 64500 + r.InIf },
+		Samples: func(agent netip.Addr, samples []sflow.Sample) { agents = append(agents, agent) },
+		Handler: flowrecord.RecordsHandlerFunc(func(records []flowrecord.FlowRecord) {
+			lock.Lock()
+			defer lock.Unlock()
+			got = append(got, records...)
+		}),
+	}
+
+	data := &netflow5.NetFlow5{}
+	data.Header.SetVersion(5)
+	data.Header.SetLength(2)
+	data.Flows[0].SetInput(1)
+	data.Flows[1].SetInput(2)
+	remote := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2055}
+	enricher.HandleNetFlow5(remote, &data.Header, data.FlowArray())
+	enricher.HandleFlows(&data.Header, data.FlowArray()[:1])
+
+	header := &sflow.Header{AddressType: 1, AgentAddress: [4]byte{198, 51, 100, 1}}
+	samples := []sflow.Sample{
+		&sflow.FlowSample{SamplingRate: 100, Input: 3, Records: []sflow.Flow{&sflow.SampledIPV4{Length: 1500, Protocol: 6}}},
+		&sflow.CounterSamples{},
+	}
+	enricher.HandleSFlow(remote, header, samples)
+	enricher.HandleSamples(&sflow.Header{AddressType: 2}, samples)
+	// a datagram without flows is not handed over
+	enricher.HandleSamples(header, samples[1:])
+	if len(got) != 5 {
+		t.Fatalf("%d records, want 5", len(got))
+	}
+
+	// the datagram without an IPv4 agent address has no agent
+	if want := []netip.Addr{netip.MustParseAddr("198.51.100.1"), netip.MustParseAddr("198.51.100.1")}; !slices.Equal(agents, want) {
+		t.Errorf("agents %v, want %v", agents, want)
+	}
+
+	for i, want := range []struct {
+		exporter string
+		as       uint32
+	}{
+		{"192.0.2.1", 64501},
+		{"192.0.2.1", 64502},
+		{"", 64501},
+		{"198.51.100.1", 64503},
+		{"", 64503},
+	} {
+		r := got[i]
+		if (want.exporter == "" && r.Exporter.IsValid()) || (want.exporter != "" && r.Exporter != netip.MustParseAddr(want.exporter)) ||
+			r.SrcAS != want.as {
+			t.Errorf("record %d: exporter %s AS%d, want %s AS%d", i, r.Exporter, r.SrcAS, want.exporter, want.as)
+		}
+	}
+
+	// the buffers are reused by the workers
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				enricher.HandleNetFlow5(remote, &data.Header, data.FlowArray())
+			}
+		}()
+	}
+
+	wg.Wait()
+	if len(got) != 5+8*100*2 {
+		t.Errorf("%d records, want %d", len(got), 5+8*100*2)
+	}
+}
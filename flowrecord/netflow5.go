@@ -0,0 +1,41 @@
+package flowrecord
+
+import (
+	"github.com/wwicak/go-utils/netflow5"
+	"net/netip"
+)
+
+// FromNetFlow5 converts a NetFlow v1, v5 or v7 flow
+func FromNetFlow5(exporter netip.Addr, h *netflow5.Header, flow *netflow5.Flow) FlowRecord {
+	return FlowRecord{
+		Exporter:     exporter.Unmap(),
+		SrcAddr:      netip.AddrFrom4(flow.SrcAddr),
+		DstAddr:      netip.AddrFrom4(flow.DstAddr),
+		NextHop:      netip.AddrFrom4(flow.NextAddr),
+		SrcPort:      flow.SrcPort(),
+		DstPort:      flow.DstPort(),
+		Proto:        flow.Proto,
+		TCPFlags:     flow.TCPFlags,
+		ToS:          flow.Tos,
+		SrcMask:      flow.SrcMask,
+		DstMask:      flow.DstMask,
+		Bytes:        uint64(flow.DOctets()),
+		Packets:      uint64(flow.DPkts()),
+		SamplingRate: uint32(h.SamplingRate()),
+		InIf:         uint32(flow.Input()),
+		OutIf:        uint32(flow.Output()),
+		SrcAS:        uint32(flow.SrcAs()),
+		DstAS:        uint32(flow.DstAs()),
+		Start:        flow.StartTime(h),
+		End:          flow.EndTime(h),
+	}
+}
+
+// AppendNetFlow5 appends the converted flows of a packet to records
+func AppendNetFlow5(records []FlowRecord, exporter netip.Addr, h *netflow5.Header, flows []netflow5.Flow) []FlowRecord {
+	for i := range flows {
+		records = append(records, FromNetFlow5(exporter, h, &flows[i]))
+	}
+
+	return records
+}
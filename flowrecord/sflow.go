@@ -0,0 +1,289 @@
+package flowrecord
+
+import (
+	"encoding/binary"
+	"github.com/wwicak/go-utils/sflow"
+	"net/netip"
+	"time"
+)
+
+// SFlowSample the context a sFlow flow sample gives to its flow records
+type SFlowSample struct {
+	Exporter     netip.Addr
+	SamplingRate uint32
+	InIf         uint32
+	OutIf        uint32
+	Time         time.Time
+}
+
+// Header protocols of a sampled header
+const (
+	HeaderProtocolEthernet = 1
+	HeaderProtocolIPv4     = 11
+	HeaderProtocolIPv6     = 12
+)
+
+// NewSFlowSample returns the context of a flow sample.
+// The exporter is the agent address of the datagram when it is IPv4, remote otherwise.
+// The sFlow datagram carries no timestamps so received is used as the time of the flows.
+func NewSFlowSample(remote netip.Addr, header *sflow.Header, sample sflow.Sample, received time.Time) (SFlowSample, bool) {
+	s := SFlowSample{Exporter: remote.Unmap(), Time: received}
+	if header.AddressType == 1 {
+		s.Exporter = netip.AddrFrom4(header.AgentAddress)
+	}
+
+	switch v := sample.(type) {
+	case *sflow.FlowSample:
+		s.SamplingRate = v.SamplingRate
+		// the first two bits hold the format, 0 for an ifIndex
+		if v.Input>>30 == 0 {
+			s.InIf = v.Input
+		}
+		if v.Output>>30 == 0 {
+			s.OutIf = v.Output
+		}
+	case *sflow.FlowSampleExpanded:
+		s.SamplingRate = v.SamplingRate
+		if v.Input.Format == 0 {
+			s.InIf = v.Input.Value
+		}
+		if v.Output.Format == 0 {
+			s.OutIf = v.Output.Value
+		}
+	default:
+		return s, false
+	}
+
+	return s, true
+}
+
+func (s *SFlowSample) record() FlowRecord {
+	return FlowRecord{
+		Exporter:     s.Exporter,
+		SamplingRate: s.SamplingRate,
+		InIf:         s.InIf,
+		OutIf:        s.OutIf,
+		Packets:      1,
+		Start:        s.Time,
+		End:          s.Time,
+	}
+}
+
+// FromSampledIPV4 converts a sampled IPv4 record
+func FromSampledIPV4(s SFlowSample, si *sflow.SampledIPV4) FlowRecord {
+	r := s.record()
+	r.SrcAddr = netip.AddrFrom4(si.SrcIP)
+	r.DstAddr = netip.AddrFrom4(si.DstIP)
+	r.SrcPort = uint16(si.SrcPort)
+	r.DstPort = uint16(si.DstPort)
+	r.Proto = uint8(si.Protocol)
+	r.TCPFlags = uint8(si.TCPFlags)
+	r.ToS = uint8(si.ToS)
+	r.Bytes = uint64(si.Length)
+	return r
+}
+
+// FromSampledIPV6 converts a sampled IPv6 record
+func FromSampledIPV6(s SFlowSample, si *sflow.SampledIPV6) FlowRecord {
+	r := s.record()
+	r.SrcAddr = netip.AddrFrom16(si.SrcIP)
+	r.DstAddr = netip.AddrFrom16(si.DstIP)
+	r.SrcPort = uint16(si.SrcPort)
+	r.DstPort = uint16(si.DstPort)
+	r.Proto = uint8(si.Protocol)
+	r.TCPFlags = uint8(si.TCPFlags)
+	r.ToS = uint8(si.ToS)
+	r.Bytes = uint64(si.Length)
+	return r
+}
+
+// FromSampledHeader converts the IP packet inside a sampled header.
+// Ethernet frames, with up to two VLAN tags, and raw IPv4 or IPv6 packets are decoded.
+// Bytes is the length of the IP packet, the length of the frame without its Ethernet header and FCS,
+// as for the sampled IPv4 and IPv6 records.
+// Returns false when the header holds no IP packet.
+func FromSampledHeader(s SFlowSample, sh *sflow.SampledHeader) (FlowRecord, bool) {
+	r := s.record()
+	r.Bytes = uint64(sh.FrameLength)
+	data := sh.Header
+	protocol := sh.Protocol
+	if protocol == HeaderProtocolEthernet {
+		if len(data) < 14 {
+			return r, false
+		}
+
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(data) < 4 {
+				return r, false
+			}
+
+			if r.VLAN == 0 {
+				r.VLAN = binary.BigEndian.Uint16(data[0:2]) & 0x0FFF
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+
+		switch etherType {
+		case 0x0800:
+			protocol = HeaderProtocolIPv4
+		case 0x86dd:
+			protocol = HeaderProtocolIPv6
+		default:
+			return r, false
+		}
+
+		// the frame length includes the 4 bytes of the FCS
+		if l2 := uint64(len(sh.Header)-len(data)) + 4; r.Bytes > l2 {
+			r.Bytes -= l2
+		}
+	}
+
+	switch protocol {
+	case HeaderProtocolIPv4:
+		return r, parseIPv4(&r, data)
+	case HeaderProtocolIPv6:
+		return r, parseIPv6(&r, data)
+	}
+
+	return r, false
+}
+
+func parseIPv4(r *FlowRecord, data []byte) bool {
+	if len(data) < 20 || data[0]>>4 != 4 {
+		return false
+	}
+
+	ihl := int(data[0]&0xF) * 4
+	if ihl < 20 || len(data) < ihl {
+		return false
+	}
+
+	r.ToS = data[1]
+	r.Proto = data[9]
+	r.SrcAddr = netip.AddrFrom4([4]byte(data[12:16]))
+	r.DstAddr = netip.AddrFrom4([4]byte(data[16:20]))
+	// only the first fragment holds the transport header
+	if binary.BigEndian.Uint16(data[6:8])&0x1FFF == 0 {
+		parseTransport(r, data[ihl:])
+	}
+
+	return true
+}
+
+func parseIPv6(r *FlowRecord, data []byte) bool {
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return false
+	}
+
+	r.ToS = uint8(binary.BigEndian.Uint16(data[0:2]) >> 4)
+	r.SrcAddr = netip.AddrFrom16([16]byte(data[8:24]))
+	r.DstAddr = netip.AddrFrom16([16]byte(data[24:40]))
+	next := data[6]
+	data = data[40:]
+	for {
+		switch next {
+		case 0, 43, 60:
+			// hop-by-hop, routing and destination options
+			if len(data) < 8 {
+				r.Proto = next
+				return true
+			}
+			length := (int(data[1]) + 1) * 8
+			if len(data) < length {
+				r.Proto = next
+				return true
+			}
+			next, data = data[0], data[length:]
+		case 44:
+			// fragment
+			if len(data) < 8 {
+				r.Proto = next
+				return true
+			}
+			first := binary.BigEndian.Uint16(data[2:4])&0xFFF8 == 0
+			next, data = data[0], data[8:]
+			if !first {
+				r.Proto = next
+				return true
+			}
+		default:
+			r.Proto = next
+			parseTransport(r, data)
+			return true
+		}
+	}
+}
+
+func parseTransport(r *FlowRecord, data []byte) {
+	switch r.Proto {
+	case 6:
+		if len(data) >= 14 {
+			r.TCPFlags = data[13]
+		}
+		fallthrough
+	case 17, 132:
+		if len(data) >= 4 {
+			r.SrcPort = binary.BigEndian.Uint16(data[0:2])
+			r.DstPort = binary.BigEndian.Uint16(data[2:4])
+		}
+	case 1, 58:
+		// ICMP type and code in the destination port like NetFlow
+		if len(data) >= 2 {
+			r.DstPort = uint16(data[0])<<8 | uint16(data[1])
+		}
+	}
+}
+
+// FromSFlowSample converts the flow sample of a context.
+// A sampled header is preferred over the sampled IPv4 and IPv6 records describing the same packet.
+// Returns false when the sample holds no IP packet.
+func FromSFlowSample(s SFlowSample, sample sflow.Sample) (FlowRecord, bool) {
+	var flows []sflow.Flow
+	switch v := sample.(type) {
+	case *sflow.FlowSample:
+		flows = v.Records
+	case *sflow.FlowSampleExpanded:
+		flows = v.Records
+	}
+
+	record := s.record()
+	found := false
+	for _, flow := range flows {
+		switch v := flow.(type) {
+		case *sflow.SampledHeader:
+			if r, ok := FromSampledHeader(s, v); ok {
+				record, found = r, true
+			}
+		case *sflow.SampledIPV4:
+			if !found {
+				record, found = FromSampledIPV4(s, v), true
+			}
+		case *sflow.SampledIPV6:
+			if !found {
+				record, found = FromSampledIPV6(s, v), true
+			}
+		}
+	}
+
+	return record, found
+}
+
+// AppendSFlow appends a flow record for every flow sample of a datagram to records.
+// A sampled header is preferred over the sampled IPv4 and IPv6 records describing the same packet.
+func AppendSFlow(records []FlowRecord, remote netip.Addr, header *sflow.Header, samples []sflow.Sample, received time.Time) []FlowRecord {
+	for _, sample := range samples {
+		s, ok := NewSFlowSample(remote, header, sample, received)
+		if !ok {
+			continue
+		}
+
+		if record, ok := FromSFlowSample(s, sample); ok {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
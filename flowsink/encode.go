@@ -0,0 +1,189 @@
+package flowsink
+
+import (
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format the encoding of the records in the files
+type Format uint8
+
+const (
+	// NDJSON a JSON object per line, keyed by the Columns
+	NDJSON Format = iota
+	// CSV a header row of the Columns followed by a row per record
+	CSV
+)
+
+// extension the file name extension of the format
+func (f Format) extension() string {
+	if f == CSV {
+		return ".csv"
+	}
+
+	return ".ndjson"
+}
+
+// Columns the schema of the files, in order.
+// Columns are only ever appended so the files written by older versions stay readable.
+// The bytes and packets are the values exported, before correcting for the sampling rate,
+// the times are UTC RFC 3339 with nanoseconds, the addresses unknown to the protocol are empty
+// and so are the annotations of the records which were not enriched.
+var Columns = []string{
+	"start", "end", "exporter", "src_addr", "dst_addr", "next_hop", "src_port", "dst_port", "proto",
+	"tcp_flags", "tos", "src_mask", "dst_mask", "bytes", "packets", "sampling_rate",
+	"in_if", "out_if", "src_as", "dst_as", "vlan",
+	"src_country", "dst_country", "src_city", "dst_city", "src_as_org", "dst_as_org",
+	"in_if_name", "out_if_name", "in_if_description", "out_if_description", "in_if_role", "out_if_role",
+}
+
+// csvHeader the header row of the CSV files
+var csvHeader = strings.Join(Columns, ",") + "\n"
+
+// encoder appends the columns of records to a buffer
+type encoder struct {
+	b      []byte
+	format Format
+	column int
+}
+
+// key starts the next column
+func (e *encoder) key() {
+	if e.column > 0 {
+		e.b = append(e.b, ',')
+	}
+
+	if e.format == NDJSON {
+		e.b = append(e.b, '"')
+		e.b = append(e.b, Columns[e.column]...)
+		e.b = append(e.b, '"', ':')
+	}
+
+	e.column++
+}
+
+func (e *encoder) uint(v uint64) {
+	e.key()
+	e.b = strconv.AppendUint(e.b, v, 10)
+}
+
+// quoted appends a value that is a string in JSON, appended by f
+func (e *encoder) quoted(f func(b []byte) []byte) {
+	e.key()
+	if e.format == NDJSON {
+		e.b = append(e.b, '"')
+	}
+
+	e.b = f(e.b)
+	if e.format == NDJSON {
+		e.b = append(e.b, '"')
+	}
+}
+
+func (e *encoder) addr(addr netip.Addr) {
+	e.quoted(func(b []byte) []byte {
+		if !addr.IsValid() {
+			return b
+		}
+
+		return addr.AppendTo(b)
+	})
+}
+
+// string appends s, escaped for JSON or quoted for CSV when it holds a separator or a quote,
+// the invalid UTF-8 sequences replaced with U+FFFD
+func (e *encoder) string(s string) {
+	e.key()
+	s = strings.ToValidUTF8(s, "\uFFFD")
+
+	if e.format == CSV {
+		if !strings.ContainsAny(s, ",\"\r\n") {
+			e.b = append(e.b, s...)
+			return
+		}
+
+		e.b = append(e.b, '"')
+		e.b = append(e.b, strings.ReplaceAll(s, `"`, `""`)...)
+		e.b = append(e.b, '"')
+		return
+	}
+
+	e.b = append(e.b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			e.b = append(e.b, '\\', c)
+		case c < 0x20:
+			e.b = append(e.b, `\u00`...)
+			e.b = append(e.b, hex[c>>4], hex[c&0xF])
+		default:
+			e.b = append(e.b, c)
+		}
+	}
+
+	e.b = append(e.b, '"')
+}
+
+const hex = "0123456789abcdef"
+
+func (e *encoder) time(t time.Time) {
+	e.quoted(func(b []byte) []byte { return t.UTC().AppendFormat(b, time.RFC3339Nano) })
+}
+
+// noAnnotations the empty columns of the records that were not enriched
+var noAnnotations flowrecord.Annotations
+
+// appendRecord appends the encoded record and a new line to b
+func appendRecord(b []byte, format Format, r *flowrecord.FlowRecord) []byte {
+	e := encoder{b: b, format: format}
+	if format == NDJSON {
+		e.b = append(e.b, '{')
+	}
+
+	e.time(r.Start)
+	e.time(r.End)
+	e.addr(r.Exporter)
+	e.addr(r.SrcAddr)
+	e.addr(r.DstAddr)
+	e.addr(r.NextHop)
+	e.uint(uint64(r.SrcPort))
+	e.uint(uint64(r.DstPort))
+	e.uint(uint64(r.Proto))
+	e.uint(uint64(r.TCPFlags))
+	e.uint(uint64(r.ToS))
+	e.uint(uint64(r.SrcMask))
+	e.uint(uint64(r.DstMask))
+	e.uint(r.Bytes)
+	e.uint(r.Packets)
+	e.uint(uint64(r.SamplingRate))
+	e.uint(uint64(r.InIf))
+	e.uint(uint64(r.OutIf))
+	e.uint(uint64(r.SrcAS))
+	e.uint(uint64(r.DstAS))
+	e.uint(uint64(r.VLAN))
+	a := r.Annotations
+	if a == nil {
+		a = &noAnnotations
+	}
+
+	e.string(a.Src.Country)
+	e.string(a.Dst.Country)
+	e.string(a.Src.City)
+	e.string(a.Dst.City)
+	e.string(a.Src.ASOrg)
+	e.string(a.Dst.ASOrg)
+	e.string(a.In.Name)
+	e.string(a.Out.Name)
+	e.string(a.In.Description)
+	e.string(a.Out.Description)
+	e.string(a.In.Role)
+	e.string(a.Out.Role)
+	if format == NDJSON {
+		e.b = append(e.b, '}')
+	}
+
+	return append(e.b, '\n')
+}
@@ -0,0 +1,376 @@
+// Package flowsink writes decoded flows to rotating newline delimited JSON or CSV files.
+//
+// Files are written under a hidden temporary name and renamed once complete,
+// a reader of the directory only ever sees whole files.
+package flowsink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/sflow"
+	"io"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Compression compresses the files as they are written
+type Compression struct {
+	// Extension appended to the file names, like .gz
+	Extension string
+	// NewWriter returns a writer compressing to w.
+	// Closing it must flush the compressed stream without closing w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// Gzip compresses the files with gzip
+var Gzip = &Compression{
+	Extension: ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+}
+
+// Zstd compresses the files with zstd
+var Zstd = &Compression{
+	Extension: ".zst",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+}
+
+// Config the configuration of a Sink
+type Config struct {
+	// Dir the directory the files are written to, created when missing.
+	// Required.
+	Dir string
+	// Prefix the prefix of the file names, followed by the UTC time the file was opened.
+	// Default : flows
+	Prefix string
+	// Format the encoding of the records.
+	// Default : NDJSON
+	Format Format
+	// Compression compresses the files.
+	// Default : nil, no compression
+	Compression *Compression
+	// MaxSize the size of the encoded records, before compression, a file is rotated at.
+	// Default : 64MiB
+	MaxSize int64
+	// MaxAge the age a file is rotated at, even when no record arrives.
+	// Default : 0, files are only rotated by size
+	MaxAge time.Duration
+	// Backlog how many datagrams can wait to be written before the handlers block.
+	// Default : 1024
+	Backlog int
+	// OnCommit is called with the path of every file once it is complete, from the writing goroutine.
+	// Default : nil
+	OnCommit func(path string)
+}
+
+// Sink writes the flows handed to its handlers to rotating files.
+// The handlers block when the writer falls behind, no record is dropped before Stop.
+// It is safe for concurrent use and implements the handlers of the flowcollector
+// and of the sFlow and NetFlow v5 processors, the latter without knowing the exporter.
+type Sink struct {
+	config   Config
+	batches  chan []flowrecord.FlowRecord
+	mutex    sync.RWMutex
+	stopped  bool
+	stopOnce sync.Once
+	done     chan struct{}
+	written  atomic.Uint64
+	dropped  atomic.Uint64
+	errors   atomic.Uint64
+	files    atomic.Uint64
+	// err the first error, read once done is closed
+	err        error
+	file       *os.File
+	temp       string
+	path       string
+	bw         *bufio.Writer
+	compressor io.WriteCloser
+	out        io.Writer
+	size       int64
+	pending    uint64
+	expiry     <-chan time.Time
+	buffer     []byte
+	clock      func() time.Time
+}
+
+var ErrNoDir = errors.New("flowsink: no directory to write to")
+
+// New creates a *Sink writing to config.Dir
+func New(config Config) (*Sink, error) {
+	if config.Dir == "" {
+		return nil, ErrNoDir
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if config.Prefix == "" {
+		config.Prefix = "flows"
+	}
+
+	if config.MaxSize <= 0 {
+		config.MaxSize = 64 << 20
+	}
+
+	if config.Backlog <= 0 {
+		config.Backlog = 1024
+	}
+
+	s := &Sink{
+		config:  config,
+		batches: make(chan []flowrecord.FlowRecord, config.Backlog),
+		done:    make(chan struct{}),
+		clock:   time.Now,
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// enqueue hands records owned by the sink to the writer
+func (s *Sink) enqueue(records []flowrecord.FlowRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.stopped {
+		s.dropped.Add(uint64(len(records)))
+		return
+	}
+
+	s.batches <- records
+}
+
+// AddRecords queues a copy of records to be written
+func (s *Sink) AddRecords(records []flowrecord.FlowRecord) {
+	s.enqueue(append([]flowrecord.FlowRecord(nil), records...))
+}
+
+// HandleSFlow queues the flow samples of a sFlow datagram received from remote, timed with the current time
+func (s *Sink) HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	s.enqueue(flowrecord.AppendSFlow(nil, acl.AddrOf(remote), header, samples, s.clock()))
+}
+
+// HandleNetFlow5 queues the flows of a NetFlow v1, v5 or v7 datagram received from remote
+func (s *Sink) HandleNetFlow5(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+	s.enqueue(flowrecord.AppendNetFlow5(make([]flowrecord.FlowRecord, 0, len(flows)), acl.AddrOf(remote), header, flows))
+}
+
+// HandleSamples queues the flow samples of a sFlow datagram as a processor SamplesHandler.
+// The exporter is the agent address of the datagram, empty when it is not IPv4.
+func (s *Sink) HandleSamples(header *sflow.Header, samples []sflow.Sample) {
+	s.enqueue(flowrecord.AppendSFlow(nil, netip.Addr{}, header, samples, s.clock()))
+}
+
+// HandleFlows queues the flows of a NetFlow v1, v5 or v7 datagram as a processor FlowsHandler.
+// The exporter is unknown to the handler, it is left empty.
+func (s *Sink) HandleFlows(header *netflow5.Header, flows []netflow5.Flow) {
+	s.enqueue(flowrecord.AppendNetFlow5(make([]flowrecord.FlowRecord, 0, len(flows)), netip.Addr{}, header, flows))
+}
+
+// Written returns the number of records in the files completed so far
+func (s *Sink) Written() uint64 {
+	return s.written.Load()
+}
+
+// Dropped returns the number of records handed to the sink after Stop
+func (s *Sink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Errors returns the number of records lost to write errors
+func (s *Sink) Errors() uint64 {
+	return s.errors.Load()
+}
+
+// Files returns the number of files completed so far
+func (s *Sink) Files() uint64 {
+	return s.files.Load()
+}
+
+// Stop writes the queued records, completes the current file and returns the first write error.
+// When it returns nil every record handed to the sink before Stop is in a completed file.
+// The records handed to the sink after Stop are dropped.
+func (s *Sink) Stop() error {
+	s.stopOnce.Do(func() {
+		s.mutex.Lock()
+		s.stopped = true
+		close(s.batches)
+		s.mutex.Unlock()
+	})
+
+	<-s.done
+	return s.err
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	for {
+		select {
+		case batch, ok := <-s.batches:
+			if !ok {
+				s.commit()
+				return
+			}
+
+			for i := range batch {
+				s.write(&batch[i])
+			}
+		case <-s.expiry:
+			s.commit()
+		}
+	}
+}
+
+// write encodes a record to the current file, rotating it when due
+func (s *Sink) write(r *flowrecord.FlowRecord) {
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			s.fail(err, 1)
+			return
+		}
+	}
+
+	s.buffer = appendRecord(s.buffer[:0], s.config.Format, r)
+	s.pending++
+	if _, err := s.out.Write(s.buffer); err != nil {
+		s.discard(err)
+		return
+	}
+
+	s.size += int64(len(s.buffer))
+	if s.size >= s.config.MaxSize {
+		s.commit()
+	}
+}
+
+// fail records an error losing records
+func (s *Sink) fail(err error, records uint64) {
+	s.errors.Add(records)
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *Sink) open() error {
+	now := s.clock()
+	name := fmt.Sprintf("%s-%s", s.config.Prefix, now.UTC().Format("20060102T150405.000000000"))
+	extension := s.config.Format.extension()
+	if s.config.Compression != nil {
+		extension += s.config.Compression.Extension
+	}
+
+	path := filepath.Join(s.config.Dir, name+extension)
+	// files opened within the resolution of the clock are numbered
+	for i := 1; i < 1000; i++ {
+		if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+
+		path = filepath.Join(s.config.Dir, fmt.Sprintf("%s-%d%s", name, i, extension))
+	}
+
+	temp := filepath.Join(s.config.Dir, "."+filepath.Base(path)+".tmp")
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.file, s.temp, s.path = file, temp, path
+	s.bw = bufio.NewWriterSize(file, 1<<16)
+	s.out = s.bw
+	if s.config.Compression != nil {
+		if s.compressor, err = s.config.Compression.NewWriter(s.bw); err != nil {
+			s.close()
+			os.Remove(temp)
+			return err
+		}
+
+		s.out = s.compressor
+	}
+
+	s.size, s.pending = 0, 0
+	if s.config.Format == CSV {
+		if _, err := io.WriteString(s.out, csvHeader); err != nil {
+			s.close()
+			os.Remove(temp)
+			return err
+		}
+
+		s.size = int64(len(csvHeader))
+	}
+
+	if s.config.MaxAge > 0 {
+		s.expiry = time.After(s.config.MaxAge)
+	}
+
+	return nil
+}
+
+// close closes the current file
+func (s *Sink) close() {
+	s.file.Close()
+	s.file, s.bw, s.compressor, s.out, s.expiry = nil, nil, nil, nil, nil
+}
+
+// discard removes the current file, losing its records
+func (s *Sink) discard(err error) {
+	s.fail(err, s.pending)
+	s.close()
+	os.Remove(s.temp)
+}
+
+// commit completes the current file and renames it to its final name
+func (s *Sink) commit() {
+	if s.file == nil {
+		return
+	}
+
+	if s.compressor != nil {
+		if err := s.compressor.Close(); err != nil {
+			s.discard(err)
+			return
+		}
+	}
+
+	if err := s.bw.Flush(); err != nil {
+		s.discard(err)
+		return
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.discard(err)
+		return
+	}
+
+	if err := s.file.Close(); err != nil {
+		s.discard(err)
+		return
+	}
+
+	if err := os.Rename(s.temp, s.path); err != nil {
+		s.discard(err)
+		return
+	}
+
+	s.file, s.bw, s.compressor, s.out, s.expiry = nil, nil, nil, nil, nil
+	s.written.Add(s.pending)
+	s.files.Add(1)
+	if s.config.OnCommit != nil {
+		s.config.OnCommit(s.path)
+	}
+}
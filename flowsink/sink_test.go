@@ -0,0 +1,274 @@
+package flowsink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	netflow5processor "github.com/wwicak/go-utils/netflow5/processor"
+	sflowprocessor "github.com/wwicak/go-utils/sflow/processor"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	_ flowcollector.SFlowHandler     = (*Sink)(nil)
+	_ flowcollector.NetFlow5Handler  = (*Sink)(nil)
+	_ sflowprocessor.SamplesHandler  = (*Sink)(nil)
+	_ netflow5processor.FlowsHandler = (*Sink)(nil)
+)
+
+func testPacket(n int) (*netflow5.NetFlow5, []netflow5.Flow) {
+	data := &netflow5.NetFlow5{}
+	data.Header.SetVersion(5)
+	data.Header.SetLength(uint16(n))
+	data.Header.SetUnixSecs(1700000000)
+	data.Header.SetSamplingInterval(10)
+	for i := 0; i < n; i++ {
+		data.Flows[i].SetSrcIP(net.IPv4(10, 0, 0, byte(i)))
+		data.Flows[i].SetDstIP(net.IPv4(198, 51, 100, 1))
+		data.Flows[i].SetDstPort(443)
+		data.Flows[i].SetDOctets(uint32(100 * i))
+		data.Flows[i].Proto = 6
+	}
+
+	return data, data.FlowArray()
+}
+
+// readFiles returns the lines of the files of dir, decompressed, and checks no temporary file is left
+func readFiles(t *testing.T, dir string) (files int, lines []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Errorf("temporary file %s left", entry.Name())
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = file
+		switch filepath.Ext(entry.Name()) {
+		case ".gz":
+			if r, err = gzip.NewReader(file); err != nil {
+				t.Fatal(err)
+			}
+		case ".zst":
+			decoder, err := zstd.NewReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer decoder.Close()
+
+			r = decoder
+		}
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+
+		file.Close()
+		files++
+	}
+
+	return files, lines
+}
+
+func TestZstd(t *testing.T) {
+	dir := t.TempDir()
+	var committed []string
+	s, err := New(Config{
+		Dir:         dir,
+		Format:      CSV,
+		Compression: Zstd,
+		MaxSize:     1000,
+		OnCommit:    func(path string) { committed = append(committed, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2055}
+	for range 10 {
+		data, flows := testPacket(5)
+		s.HandleNetFlow5(remote, &data.Header, flows)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, lines := readFiles(t, dir)
+	// every file starts with its header
+	if len(lines) != 50+files || files < 2 || len(committed) != files || !strings.HasSuffix(committed[0], ".csv.zst") {
+		t.Fatalf("%d lines in %d files, committed %v", len(lines), files, committed)
+	}
+
+	if lines[0] != strings.Join(Columns, ",") || !strings.Contains(lines[1], ",192.0.2.1,10.0.0.0,198.51.100.1,") {
+		t.Errorf("unexpected lines %q", lines[:2])
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	dir := t.TempDir()
+	var committed []string
+	s, err := New(Config{
+		Dir:         dir,
+		Compression: Gzip,
+		MaxSize:     2000,
+		OnCommit:    func(path string) { committed = append(committed, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2055}
+	for range 10 {
+		data, flows := testPacket(5)
+		s.HandleNetFlow5(remote, &data.Header, flows)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, lines := readFiles(t, dir)
+	if len(lines) != 50 || s.Written() != 50 || files < 2 || uint64(files) != s.Files() || len(committed) != files {
+		t.Fatalf("%d lines in %d files, %d written in %d files, %d committed", len(lines), files, s.Written(), s.Files(), len(committed))
+	}
+
+	if !strings.HasSuffix(committed[0], ".ndjson.gz") {
+		t.Errorf("unexpected file name %s", committed[0])
+	}
+
+	object := map[string]any{}
+	if err := json.Unmarshal([]byte(lines[0]), &object); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	columns := slices.Sorted(slices.Values(Columns))
+	if !slices.Equal(keys, columns) {
+		t.Errorf("keys %v, want %v", keys, columns)
+	}
+
+	if object["exporter"] != "192.0.2.1" || object["dst_port"] != 443.0 || object["sampling_rate"] != 10.0 || object["start"] == "" {
+		t.Errorf("unexpected record %s", lines[0])
+	}
+
+	s.AddRecords([]flowrecord.FlowRecord{{}})
+	if s.Dropped() != 1 {
+		t.Errorf("%d dropped after Stop, want 1", s.Dropped())
+	}
+
+	city := "Kraków \"Old Town\"\\\n\x01"
+	line := appendRecord(nil, NDJSON, &flowrecord.FlowRecord{Annotations: &flowrecord.Annotations{Dst: flowrecord.Endpoint{City: city}}})
+	object = map[string]any{}
+	if err := json.Unmarshal(line, &object); err != nil || object["dst_city"] != city {
+		t.Errorf("unexpected record %s %v", line, err)
+	}
+
+	// an interface name learned from an exporter is not always valid UTF-8
+	line = appendRecord(nil, NDJSON, &flowrecord.FlowRecord{Annotations: &flowrecord.Annotations{In: flowrecord.Interface{Name: "eth\xff0"}}})
+	object = map[string]any{}
+	if err := json.Unmarshal(line, &object); err != nil || object["in_if_name"] != "eth\uFFFD0" || !utf8.Valid(line) {
+		t.Errorf("unexpected record %q %v", line, err)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Config{Dir: dir, Format: CSV, Prefix: "nf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, flows := testPacket(3)
+	s.HandleFlows(&data.Header, flows)
+	s.AddRecords([]flowrecord.FlowRecord{{
+		SrcAddr:     netip.MustParseAddr("2001:db8::1"),
+		Bytes:       42,
+		Annotations: &flowrecord.Annotations{Src: flowrecord.Endpoint{City: `São Paulo, "SP"`}, Dst: flowrecord.Endpoint{Country: "BR"}},
+	}})
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, lines := readFiles(t, dir)
+	if files != 1 || len(lines) != 5 {
+		t.Fatalf("%d lines in %d files, want 5 in 1", len(lines), files)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(strings.Join(lines, "\n"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(rows[0], Columns) {
+		t.Errorf("header %v, want %v", rows[0], Columns)
+	}
+
+	if rows[2][slices.Index(Columns, "src_addr")] != "10.0.0.1" || rows[2][slices.Index(Columns, "exporter")] != "" ||
+		rows[4][slices.Index(Columns, "src_addr")] != "2001:db8::1" || rows[4][slices.Index(Columns, "bytes")] != "42" ||
+		rows[4][slices.Index(Columns, "src_city")] != `São Paulo, "SP"` || rows[4][slices.Index(Columns, "dst_country")] != "BR" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	committed := make(chan string, 1)
+	s, err := New(Config{
+		Dir:      dir,
+		MaxAge:   20 * time.Millisecond,
+		OnCommit: func(path string) { committed <- path },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	s.AddRecords([]flowrecord.FlowRecord{{Packets: 1}})
+	select {
+	case path := <-committed:
+		if !strings.HasPrefix(filepath.Base(path), "flows-") {
+			t.Errorf("unexpected file %s", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file not rotated by age")
+	}
+
+	if s.Written() != 1 {
+		t.Errorf("%d written, want 1", s.Written())
+	}
+}
+
+func TestNoDir(t *testing.T) {
+	if _, err := New(Config{}); err != ErrNoDir {
+		t.Errorf("expected ErrNoDir got %v", err)
+	}
+}
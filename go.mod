@@ -5,10 +5,12 @@ go 1.25.0
 require (
 	github.com/go-test/deep v1.0.7
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/kr/pretty v0.3.1
 	go.uber.org/zap v1.27.1
 	golang.org/x/net v0.24.0
 	gopkg.in/alexcesaro/statsd.v2 v2.0.0-20160320182110-7fea3f0d2fab
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,50 @@
+package ifinventory
+
+import "github.com/wwicak/go-utils/flowrecord"
+
+// Enricher sets the names, the descriptions and the roles of the input and output interfaces of flows
+// from an Inventory. Plugged into a flowrecord.Enricher the sFlow datagrams also teach the Inventory
+// the names of their interfaces.
+//
+//	inventory := &ifinventory.Inventory{}
+//	interfaces := &ifinventory.Enricher{Inventory: inventory}
+//	handler := &flowrecord.Enricher{Enrich: interfaces.Enrich, Samples: inventory.Update, Handler: sink}
+type Enricher struct {
+	// Inventory the interfaces of the exporters.
+	// Required.
+	Inventory *Inventory
+	// Overwrite replaces the fields set by an earlier stage.
+	// Default : false, only the empty fields are set
+	Overwrite bool
+}
+
+// Enrich sets the In and Out Annotations of r from the input and output interfaces of its exporter
+func (e *Enricher) Enrich(r *flowrecord.FlowRecord) {
+	set := func(field *string, value string) {
+		if value != "" && (*field == "" || e.Overwrite) {
+			*field = value
+		}
+	}
+
+	for _, side := range [...]struct {
+		index      uint32
+		annotation func(a *flowrecord.Annotations) *flowrecord.Interface
+	}{
+		{r.InIf, func(a *flowrecord.Annotations) *flowrecord.Interface { return &a.In }},
+		{r.OutIf, func(a *flowrecord.Annotations) *flowrecord.Interface { return &a.Out }},
+	} {
+		if side.index == 0 {
+			continue
+		}
+
+		i, found := e.Inventory.Lookup(r.Exporter, side.index)
+		if !found || (i.Name == "" && i.Description == "" && i.Role == "") {
+			continue
+		}
+
+		annotation := side.annotation(r.Annotate())
+		set(&annotation.Name, i.Name)
+		set(&annotation.Description, i.Description)
+		set(&annotation.Role, i.Role)
+	}
+}
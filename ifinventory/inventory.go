@@ -0,0 +1,272 @@
+// Package ifinventory names the interfaces of the exporters, which flows and counters only identify by ifIndex.
+//
+// The interfaces are loaded from YAML or JSON files mapping the exporter addresses to their ifIndexes,
+//
+//	172.21.35.17:
+//	  1036:
+//	    name: xe-0/0/1
+//	    description: "Transit: ACME"
+//	    speed: 10000000000
+//	    role: transit
+//
+// and learned from the port name and the interface counters of the sFlow agents.
+// The interfaces of the files take precedence over the ones learned.
+package ifinventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/sflow"
+	"gopkg.in/yaml.v3"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Interface the description of an interface of an exporter
+type Interface struct {
+	// Name the ifName, xe-0/0/1 for instance
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Description the ifAlias, set by the operators
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Speed in bits per second
+	Speed uint64 `json:"speed,omitempty" yaml:"speed,omitempty"`
+	// Role what the interface connects to, transit, peering, customer or core for instance
+	Role string `json:"role,omitempty" yaml:"role,omitempty"`
+}
+
+// merge returns i with its empty fields set from other
+func (i Interface) merge(other Interface) Interface {
+	if i.Name == "" {
+		i.Name = other.Name
+	}
+
+	if i.Description == "" {
+		i.Description = other.Description
+	}
+
+	if i.Speed == 0 {
+		i.Speed = other.Speed
+	}
+
+	if i.Role == "" {
+		i.Role = other.Role
+	}
+
+	return i
+}
+
+// Key identifies an interface by the address of its exporter and its ifIndex
+type Key struct {
+	Exporter netip.Addr
+	Index    uint32
+}
+
+// Inventory the interfaces of the exporters.
+// It is safe for concurrent use, the zero value is an empty Inventory.
+type Inventory struct {
+	lock    sync.RWMutex
+	static  map[Key]Interface
+	learned map[Key]Interface
+}
+
+// Lookup returns the interface index of exporter
+func (inv *Inventory) Lookup(exporter netip.Addr, index uint32) (Interface, bool) {
+	key := Key{exporter.Unmap(), index}
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+	static, foundStatic := inv.static[key]
+	learned, foundLearned := inv.learned[key]
+	return static.merge(learned), foundStatic || foundLearned
+}
+
+// Interfaces returns a copy of the interfaces of the inventory
+func (inv *Inventory) Interfaces() map[Key]Interface {
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+	interfaces := maps.Clone(inv.learned)
+	if interfaces == nil {
+		interfaces = make(map[Key]Interface, len(inv.static))
+	}
+
+	for key, static := range inv.static {
+		interfaces[key] = static.merge(interfaces[key])
+	}
+
+	return interfaces
+}
+
+// Store replaces the interfaces loaded from files with interfaces, the ones learned are kept
+func (inv *Inventory) Store(interfaces map[Key]Interface) {
+	static := make(map[Key]Interface, len(interfaces))
+	for key, i := range interfaces {
+		static[Key{key.Exporter.Unmap(), key.Index}] = i
+	}
+
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+	inv.static = static
+}
+
+// LoadFile reads the interfaces of a YAML or JSON file, recognized by its extension, and replaces the ones
+// loaded before with them.
+// The interfaces are kept when the file cannot be read.
+func (inv *Inventory) LoadFile(path string) error {
+	interfaces, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	inv.Store(interfaces)
+	return nil
+}
+
+// Learn sets the non empty fields of i as the ones learned for the interface index of exporter
+func (inv *Inventory) Learn(exporter netip.Addr, index uint32, i Interface) {
+	key := Key{exporter.Unmap(), index}
+	inv.lock.RLock()
+	learned := inv.learned[key]
+	inv.lock.RUnlock()
+	if merged := i.merge(learned); merged != learned {
+		inv.lock.Lock()
+		defer inv.lock.Unlock()
+		if inv.learned == nil {
+			inv.learned = make(map[Key]Interface)
+		}
+
+		inv.learned[key] = i.merge(inv.learned[key])
+	}
+}
+
+// HandleSFlow learns the interfaces of the counter samples of a sFlow datagram received from remote.
+// The agent is the agent address of the datagram when it is IPv4, remote otherwise.
+func (inv *Inventory) HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	agent := acl.AddrOf(remote)
+	if header.AddressType == 1 {
+		agent = netip.AddrFrom4(header.AgentAddress)
+	}
+
+	inv.Update(agent, samples)
+}
+
+// HandleSamples learns the interfaces of the counter samples of a sFlow datagram as a processor SamplesHandler.
+// The datagrams without an IPv4 agent address are ignored.
+func (inv *Inventory) HandleSamples(header *sflow.Header, samples []sflow.Sample) {
+	if header.AddressType != 1 {
+		return
+	}
+
+	inv.Update(netip.AddrFrom4(header.AgentAddress), samples)
+}
+
+// Update learns the names and the speeds of the interfaces of agent from the port name and interface counters
+// of its counter samples, the other samples are ignored
+func (inv *Inventory) Update(agent netip.Addr, samples []sflow.Sample) {
+	for _, sample := range samples {
+		var index uint32
+		var records []sflow.Counter
+		switch v := sample.(type) {
+		case *sflow.CounterSamples:
+			// the first byte holds the data source type, 0 for an ifIndex
+			if v.SourceId>>24 != 0 {
+				continue
+			}
+
+			index, records = v.SourceId, v.Records
+		case *sflow.CountersSampleExpanded:
+			if v.SourceId.Type != 0 {
+				continue
+			}
+
+			index, records = v.SourceId.Index, v.Records
+		default:
+			continue
+		}
+
+		var i Interface
+		for _, record := range records {
+			switch v := record.(type) {
+			case *sflow.PortName:
+				i.Name = v.Name
+			case *sflow.IfCounter:
+				i.Speed = v.Speed
+			}
+		}
+
+		if i != (Interface{}) {
+			inv.Learn(agent, index, i)
+		}
+	}
+}
+
+var ErrUnknownFormat = errors.New("ifinventory: unknown file format, expected .yaml, .yml or .json")
+
+// ReadFile reads the interfaces of a YAML file, named .yaml or .yml, or of a JSON file, named .json
+func ReadFile(path string) (map[Key]Interface, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ReadYAML(file)
+	case ".json":
+		return ReadJSON(file)
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// document the interfaces of a file by exporter address and ifIndex
+type document map[string]map[string]Interface
+
+// ReadYAML reads the interfaces of a YAML document mapping the exporter addresses to their ifIndexes
+func ReadYAML(r io.Reader) (map[Key]Interface, error) {
+	var d document
+	if err := yaml.NewDecoder(r).Decode(&d); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("ifinventory: %w", err)
+	}
+
+	return d.interfaces()
+}
+
+// ReadJSON reads the interfaces of a JSON object mapping the exporter addresses to their ifIndexes
+func ReadJSON(r io.Reader) (map[Key]Interface, error) {
+	var d document
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, fmt.Errorf("ifinventory: %w", err)
+	}
+
+	return d.interfaces()
+}
+
+func (d document) interfaces() (map[Key]Interface, error) {
+	interfaces := make(map[Key]Interface)
+	for exporter, indexes := range d {
+		addr, err := netip.ParseAddr(exporter)
+		if err != nil {
+			return nil, fmt.Errorf("ifinventory: invalid exporter address %q", exporter)
+		}
+
+		for index, i := range indexes {
+			n, err := strconv.ParseUint(index, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("ifinventory: invalid ifIndex %q of %s", index, exporter)
+			}
+
+			interfaces[Key{addr.Unmap(), uint32(n)}] = i
+		}
+	}
+
+	return interfaces, nil
+}
@@ -0,0 +1,205 @@
+package ifinventory
+
+import (
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/sflow"
+	sflowprocessor "github.com/wwicak/go-utils/sflow/processor"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	_ flowcollector.SFlowHandler    = (*Inventory)(nil)
+	_ sflowprocessor.SamplesHandler = (*Inventory)(nil)
+)
+
+const testYAML = `# core routers
+172.21.35.17:
+  1036:
+    name: xe-0/0/1
+    description: "Transit: ACME"
+    speed: 10000000000
+    role: transit
+  1037: {name: xe-0/0/2, role: peering}
+"2001:db8::1":
+  7: {description: customer globex}
+`
+
+const testJSON = `{
+  "172.21.35.17": {"1036": {"name": "xe-0/0/1", "description": "Transit: ACME", "speed": 10000000000, "role": "transit"},
+                   "1037": {"name": "xe-0/0/2", "role": "peering"}},
+  "2001:db8::1": {"7": {"description": "customer globex"}}
+}`
+
+var testInterfaces = map[Key]Interface{
+	{netip.MustParseAddr("172.21.35.17"), 1036}: {Name: "xe-0/0/1", Description: "Transit: ACME", Speed: 10000000000, Role: "transit"},
+	{netip.MustParseAddr("172.21.35.17"), 1037}: {Name: "xe-0/0/2", Role: "peering"},
+	{netip.MustParseAddr("2001:db8::1"), 7}:     {Description: "customer globex"},
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"interfaces.yaml": testYAML, "interfaces.json": testJSON} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		interfaces, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if len(interfaces) != len(testInterfaces) {
+			t.Errorf("%s: %d interfaces, want %d", name, len(interfaces), len(testInterfaces))
+		}
+
+		for key, want := range testInterfaces {
+			if got := interfaces[key]; got != want {
+				t.Errorf("%s: %v got %+v want %+v", name, key, got, want)
+			}
+		}
+	}
+
+	if _, err := ReadFile(filepath.Join(dir, "interfaces.csv")); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "interfaces.txt"), nil, 0o644)
+	if _, err := ReadFile(filepath.Join(dir, "interfaces.txt")); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat got %v", err)
+	}
+
+	for input, want := range map[string]string{
+		"router1:\n  1: {name: a}\n":       `invalid exporter address "router1"`,
+		"192.0.2.1:\n  eth0: {name: a}\n":  `invalid ifIndex "eth0" of 192.0.2.1`,
+		"192.0.2.1:\n  1: {speed: fast}\n": "cannot unmarshal",
+		"192.0.2.1: [1, 2]\n":              "cannot unmarshal",
+		"192.0.2.1:\n  4294967296: {}\n":   `invalid ifIndex "4294967296"`,
+		"192.0.2.1:\n  1: {name: a}\n  b":  "ifinventory: yaml",
+	} {
+		if _, err := ReadYAML(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v want %s", input, err, want)
+		}
+	}
+
+	if interfaces, err := ReadYAML(strings.NewReader("")); err != nil || len(interfaces) != 0 {
+		t.Errorf("empty file: got %v %v", interfaces, err)
+	}
+}
+
+// testSamples the counter samples of an agent with the port name of ifIndex 1036 and 1038
+func testSamples() []sflow.Sample {
+	return []sflow.Sample{
+		&sflow.CounterSamples{
+			SourceId: 1036,
+			Records:  []sflow.Counter{&sflow.IfCounter{Index: 1036, Speed: 1e9}, &sflow.PortName{Name: "learned-1036"}},
+		},
+		&sflow.CountersSampleExpanded{
+			SourceId: sflow.DataSourceExpanded{Type: 0, Index: 1038},
+			Records:  []sflow.Counter{&sflow.PortName{Name: "xe-0/0/3"}},
+		},
+		// not an interface
+		&sflow.CounterSamples{SourceId: 2<<24 | 1, Records: []sflow.Counter{&sflow.PortName{Name: "cpu"}}},
+		&sflow.FlowSample{Input: 1036, Output: 1038},
+	}
+}
+
+func TestInventory(t *testing.T) {
+	inventory := &Inventory{}
+	router := netip.MustParseAddr("172.21.35.17")
+	if _, found := inventory.Lookup(router, 1036); found {
+		t.Error("found in an empty inventory")
+	}
+
+	path := filepath.Join(t.TempDir(), "interfaces.yml")
+	os.WriteFile(path, []byte(testYAML), 0o644)
+	if err := inventory.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	header := &sflow.Header{AddressType: 1, AgentAddress: router.As4()}
+	inventory.HandleSFlow(&net.UDPAddr{IP: net.ParseIP("198.51.100.1")}, header, testSamples())
+	for index, want := range map[uint32]Interface{
+		// the file takes precedence, the speed learned is ignored
+		1036: {Name: "xe-0/0/1", Description: "Transit: ACME", Speed: 10000000000, Role: "transit"},
+		1037: {Name: "xe-0/0/2", Role: "peering"},
+		1038: {Name: "xe-0/0/3"},
+	} {
+		if got, found := inventory.Lookup(netip.AddrFrom16(router.As16()), index); !found || got != want {
+			t.Errorf("ifIndex %d: got %v %+v want %+v", index, found, got, want)
+		}
+	}
+
+	if _, found := inventory.Lookup(router, 1<<25|1); found {
+		t.Error("learned a data source that is not an interface")
+	}
+
+	// the interfaces learned survive a reload, and fill the fields missing from the file
+	inventory.Store(nil)
+	if got, _ := inventory.Lookup(router, 1036); got != (Interface{Name: "learned-1036", Speed: 1e9}) {
+		t.Errorf("got %+v after the file was removed", got)
+	}
+
+	inventory.Learn(router, 1036, Interface{Name: "renamed"})
+	if got, _ := inventory.Lookup(router, 1036); got != (Interface{Name: "renamed", Speed: 1e9}) {
+		t.Errorf("got %+v after it was renamed", got)
+	}
+
+	if interfaces := inventory.Interfaces(); len(interfaces) != 2 {
+		t.Errorf("unexpected interfaces %v", interfaces)
+	}
+
+	if err := inventory.LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	inventory := &Inventory{}
+	inventory.Store(testInterfaces)
+	router := netip.MustParseAddr("172.21.35.17")
+	records := []flowrecord.FlowRecord{
+		{Exporter: router, InIf: 1036, OutIf: 1037},
+		{Exporter: router, InIf: 1037, OutIf: 9},
+		{Exporter: router, InIf: 1037, OutIf: 1036, Annotations: &flowrecord.Annotations{
+			In:  flowrecord.Interface{Role: "customer"},
+			Out: flowrecord.Interface{Name: "kept"},
+		}},
+		{Exporter: netip.MustParseAddr("192.0.2.1"), InIf: 1036},
+	}
+
+	enricher := &Enricher{Inventory: inventory}
+	for i := range records {
+		enricher.Enrich(&records[i])
+	}
+
+	if a := records[0].Annotations; a.In != (flowrecord.Interface{Name: "xe-0/0/1", Description: "Transit: ACME", Role: "transit"}) ||
+		a.Out.Name != "xe-0/0/2" || a.Out.Role != "peering" {
+		t.Errorf("unexpected annotations %+v", a)
+	}
+
+	if a := records[1].Annotations; a.In.Name != "xe-0/0/2" || a.Out != (flowrecord.Interface{}) {
+		t.Errorf("unexpected annotations %+v", a)
+	}
+
+	if a := records[2].Annotations; a.In.Name != "xe-0/0/2" || a.In.Role != "customer" || a.Out.Name != "kept" || a.Out.Role != "transit" {
+		t.Errorf("unexpected annotations %+v", a)
+	}
+
+	// the interfaces of an unknown exporter are not annotated
+	if a := records[3].Annotations; a != nil {
+		t.Errorf("unexpected annotations %+v", a)
+	}
+
+	enricher.Overwrite = true
+	enricher.Enrich(&records[2])
+	if a := records[2].Annotations; a.In.Role != "peering" || a.Out.Name != "xe-0/0/1" {
+		t.Errorf("unexpected annotations %+v", a)
+	}
+}
@@ -0,0 +1,240 @@
+package infoelement
+
+// IANA a subset of the IPFIX information elements assigned by IANA,
+// the element ids below 128 are also the NetFlow v9 field types.
+// It covers the ids 1-64, 70-96, 98-104, 128-246, 252-257, 281-282, 291-293 and 322-325;
+// the other elements can be added to a *Registry with Register.
+var IANA = []Element{
+	{ID: 1, Name: "octetDeltaCount", Type: Unsigned64},
+	{ID: 2, Name: "packetDeltaCount", Type: Unsigned64},
+	{ID: 3, Name: "deltaFlowCount", Type: Unsigned64},
+	{ID: 4, Name: "protocolIdentifier", Type: Unsigned8},
+	{ID: 5, Name: "ipClassOfService", Type: Unsigned8},
+	{ID: 6, Name: "tcpControlBits", Type: Unsigned16},
+	{ID: 7, Name: "sourceTransportPort", Type: Unsigned16},
+	{ID: 8, Name: "sourceIPv4Address", Type: IPv4Address},
+	{ID: 9, Name: "sourceIPv4PrefixLength", Type: Unsigned8},
+	{ID: 10, Name: "ingressInterface", Type: Unsigned32},
+	{ID: 11, Name: "destinationTransportPort", Type: Unsigned16},
+	{ID: 12, Name: "destinationIPv4Address", Type: IPv4Address},
+	{ID: 13, Name: "destinationIPv4PrefixLength", Type: Unsigned8},
+	{ID: 14, Name: "egressInterface", Type: Unsigned32},
+	{ID: 15, Name: "ipNextHopIPv4Address", Type: IPv4Address},
+	{ID: 16, Name: "bgpSourceAsNumber", Type: Unsigned32},
+	{ID: 17, Name: "bgpDestinationAsNumber", Type: Unsigned32},
+	{ID: 18, Name: "bgpNextHopIPv4Address", Type: IPv4Address},
+	{ID: 19, Name: "postMCastPacketDeltaCount", Type: Unsigned64},
+	{ID: 20, Name: "postMCastOctetDeltaCount", Type: Unsigned64},
+	{ID: 21, Name: "flowEndSysUpTime", Type: Unsigned32},
+	{ID: 22, Name: "flowStartSysUpTime", Type: Unsigned32},
+	{ID: 23, Name: "postOctetDeltaCount", Type: Unsigned64},
+	{ID: 24, Name: "postPacketDeltaCount", Type: Unsigned64},
+	{ID: 25, Name: "minimumIpTotalLength", Type: Unsigned64},
+	{ID: 26, Name: "maximumIpTotalLength", Type: Unsigned64},
+	{ID: 27, Name: "sourceIPv6Address", Type: IPv6Address},
+	{ID: 28, Name: "destinationIPv6Address", Type: IPv6Address},
+	{ID: 29, Name: "sourceIPv6PrefixLength", Type: Unsigned8},
+	{ID: 30, Name: "destinationIPv6PrefixLength", Type: Unsigned8},
+	{ID: 31, Name: "flowLabelIPv6", Type: Unsigned32},
+	{ID: 32, Name: "icmpTypeCodeIPv4", Type: Unsigned16},
+	{ID: 33, Name: "igmpType", Type: Unsigned8},
+	{ID: 34, Name: "samplingInterval", Type: Unsigned32},
+	{ID: 35, Name: "samplingAlgorithm", Type: Unsigned8},
+	{ID: 36, Name: "flowActiveTimeout", Type: Unsigned16},
+	{ID: 37, Name: "flowIdleTimeout", Type: Unsigned16},
+	{ID: 38, Name: "engineType", Type: Unsigned8},
+	{ID: 39, Name: "engineId", Type: Unsigned8},
+	{ID: 40, Name: "exportedOctetTotalCount", Type: Unsigned64},
+	{ID: 41, Name: "exportedMessageTotalCount", Type: Unsigned64},
+	{ID: 42, Name: "exportedFlowRecordTotalCount", Type: Unsigned64},
+	{ID: 43, Name: "ipv4RouterSc", Type: IPv4Address},
+	{ID: 44, Name: "sourceIPv4Prefix", Type: IPv4Address},
+	{ID: 45, Name: "destinationIPv4Prefix", Type: IPv4Address},
+	{ID: 46, Name: "mplsTopLabelType", Type: Unsigned8},
+	{ID: 47, Name: "mplsTopLabelIPv4Address", Type: IPv4Address},
+	{ID: 48, Name: "samplerId", Type: Unsigned8},
+	{ID: 49, Name: "samplerMode", Type: Unsigned8},
+	{ID: 50, Name: "samplerRandomInterval", Type: Unsigned32},
+	{ID: 51, Name: "classId", Type: Unsigned8},
+	{ID: 52, Name: "minimumTTL", Type: Unsigned8},
+	{ID: 53, Name: "maximumTTL", Type: Unsigned8},
+	{ID: 54, Name: "fragmentIdentification", Type: Unsigned32},
+	{ID: 55, Name: "postIpClassOfService", Type: Unsigned8},
+	{ID: 56, Name: "sourceMacAddress", Type: MacAddress},
+	{ID: 57, Name: "postDestinationMacAddress", Type: MacAddress},
+	{ID: 58, Name: "vlanId", Type: Unsigned16},
+	{ID: 59, Name: "postVlanId", Type: Unsigned16},
+	{ID: 60, Name: "ipVersion", Type: Unsigned8},
+	{ID: 61, Name: "flowDirection", Type: Unsigned8},
+	{ID: 62, Name: "ipNextHopIPv6Address", Type: IPv6Address},
+	{ID: 63, Name: "bgpNextHopIPv6Address", Type: IPv6Address},
+	{ID: 64, Name: "ipv6ExtensionHeaders", Type: Unsigned32},
+	{ID: 70, Name: "mplsTopLabelStackSection", Type: OctetArray},
+	{ID: 71, Name: "mplsLabelStackSection2", Type: OctetArray},
+	{ID: 72, Name: "mplsLabelStackSection3", Type: OctetArray},
+	{ID: 73, Name: "mplsLabelStackSection4", Type: OctetArray},
+	{ID: 74, Name: "mplsLabelStackSection5", Type: OctetArray},
+	{ID: 75, Name: "mplsLabelStackSection6", Type: OctetArray},
+	{ID: 76, Name: "mplsLabelStackSection7", Type: OctetArray},
+	{ID: 77, Name: "mplsLabelStackSection8", Type: OctetArray},
+	{ID: 78, Name: "mplsLabelStackSection9", Type: OctetArray},
+	{ID: 79, Name: "mplsLabelStackSection10", Type: OctetArray},
+	{ID: 80, Name: "destinationMacAddress", Type: MacAddress},
+	{ID: 81, Name: "postSourceMacAddress", Type: MacAddress},
+	{ID: 82, Name: "interfaceName", Type: String},
+	{ID: 83, Name: "interfaceDescription", Type: String},
+	{ID: 84, Name: "samplerName", Type: String},
+	{ID: 85, Name: "octetTotalCount", Type: Unsigned64},
+	{ID: 86, Name: "packetTotalCount", Type: Unsigned64},
+	{ID: 87, Name: "flagsAndSamplerId", Type: Unsigned32},
+	{ID: 88, Name: "fragmentOffset", Type: Unsigned16},
+	{ID: 89, Name: "forwardingStatus", Type: Unsigned32},
+	{ID: 90, Name: "mplsVpnRouteDistinguisher", Type: OctetArray},
+	{ID: 91, Name: "mplsTopLabelPrefixLength", Type: Unsigned8},
+	{ID: 92, Name: "srcTrafficIndex", Type: Unsigned32},
+	{ID: 93, Name: "dstTrafficIndex", Type: Unsigned32},
+	{ID: 94, Name: "applicationDescription", Type: String},
+	{ID: 95, Name: "applicationId", Type: OctetArray},
+	{ID: 96, Name: "applicationName", Type: String},
+	{ID: 98, Name: "postIpDiffServCodePoint", Type: Unsigned8},
+	{ID: 99, Name: "multicastReplicationFactor", Type: Unsigned32},
+	{ID: 100, Name: "className", Type: String},
+	{ID: 101, Name: "classificationEngineId", Type: Unsigned8},
+	{ID: 102, Name: "layer2packetSectionOffset", Type: Unsigned16},
+	{ID: 103, Name: "layer2packetSectionSize", Type: Unsigned16},
+	{ID: 104, Name: "layer2packetSectionData", Type: OctetArray},
+	{ID: 128, Name: "bgpNextAdjacentAsNumber", Type: Unsigned32},
+	{ID: 129, Name: "bgpPrevAdjacentAsNumber", Type: Unsigned32},
+	{ID: 130, Name: "exporterIPv4Address", Type: IPv4Address},
+	{ID: 131, Name: "exporterIPv6Address", Type: IPv6Address},
+	{ID: 132, Name: "droppedOctetDeltaCount", Type: Unsigned64},
+	{ID: 133, Name: "droppedPacketDeltaCount", Type: Unsigned64},
+	{ID: 134, Name: "droppedOctetTotalCount", Type: Unsigned64},
+	{ID: 135, Name: "droppedPacketTotalCount", Type: Unsigned64},
+	{ID: 136, Name: "flowEndReason", Type: Unsigned8},
+	{ID: 137, Name: "commonPropertiesId", Type: Unsigned64},
+	{ID: 138, Name: "observationPointId", Type: Unsigned64},
+	{ID: 139, Name: "icmpTypeCodeIPv6", Type: Unsigned16},
+	{ID: 140, Name: "mplsTopLabelIPv6Address", Type: IPv6Address},
+	{ID: 141, Name: "lineCardId", Type: Unsigned32},
+	{ID: 142, Name: "portId", Type: Unsigned32},
+	{ID: 143, Name: "meteringProcessId", Type: Unsigned32},
+	{ID: 144, Name: "exportingProcessId", Type: Unsigned32},
+	{ID: 145, Name: "templateId", Type: Unsigned16},
+	{ID: 146, Name: "wlanChannelId", Type: Unsigned8},
+	{ID: 147, Name: "wlanSSID", Type: String},
+	{ID: 148, Name: "flowId", Type: Unsigned64},
+	{ID: 149, Name: "observationDomainId", Type: Unsigned32},
+	{ID: 150, Name: "flowStartSeconds", Type: DateTimeSeconds},
+	{ID: 151, Name: "flowEndSeconds", Type: DateTimeSeconds},
+	{ID: 152, Name: "flowStartMilliseconds", Type: DateTimeMilliseconds},
+	{ID: 153, Name: "flowEndMilliseconds", Type: DateTimeMilliseconds},
+	{ID: 154, Name: "flowStartMicroseconds", Type: DateTimeMicroseconds},
+	{ID: 155, Name: "flowEndMicroseconds", Type: DateTimeMicroseconds},
+	{ID: 156, Name: "flowStartNanoseconds", Type: DateTimeNanoseconds},
+	{ID: 157, Name: "flowEndNanoseconds", Type: DateTimeNanoseconds},
+	{ID: 158, Name: "flowStartDeltaMicroseconds", Type: Unsigned32},
+	{ID: 159, Name: "flowEndDeltaMicroseconds", Type: Unsigned32},
+	{ID: 160, Name: "systemInitTimeMilliseconds", Type: DateTimeMilliseconds},
+	{ID: 161, Name: "flowDurationMilliseconds", Type: Unsigned32},
+	{ID: 162, Name: "flowDurationMicroseconds", Type: Unsigned32},
+	{ID: 163, Name: "observedFlowTotalCount", Type: Unsigned64},
+	{ID: 164, Name: "ignoredPacketTotalCount", Type: Unsigned64},
+	{ID: 165, Name: "ignoredOctetTotalCount", Type: Unsigned64},
+	{ID: 166, Name: "notSentFlowTotalCount", Type: Unsigned64},
+	{ID: 167, Name: "notSentPacketTotalCount", Type: Unsigned64},
+	{ID: 168, Name: "notSentOctetTotalCount", Type: Unsigned64},
+	{ID: 169, Name: "destinationIPv6Prefix", Type: IPv6Address},
+	{ID: 170, Name: "sourceIPv6Prefix", Type: IPv6Address},
+	{ID: 171, Name: "postOctetTotalCount", Type: Unsigned64},
+	{ID: 172, Name: "postPacketTotalCount", Type: Unsigned64},
+	{ID: 173, Name: "flowKeyIndicator", Type: Unsigned64},
+	{ID: 174, Name: "postMCastPacketTotalCount", Type: Unsigned64},
+	{ID: 175, Name: "postMCastOctetTotalCount", Type: Unsigned64},
+	{ID: 176, Name: "icmpTypeIPv4", Type: Unsigned8},
+	{ID: 177, Name: "icmpCodeIPv4", Type: Unsigned8},
+	{ID: 178, Name: "icmpTypeIPv6", Type: Unsigned8},
+	{ID: 179, Name: "icmpCodeIPv6", Type: Unsigned8},
+	{ID: 180, Name: "udpSourcePort", Type: Unsigned16},
+	{ID: 181, Name: "udpDestinationPort", Type: Unsigned16},
+	{ID: 182, Name: "tcpSourcePort", Type: Unsigned16},
+	{ID: 183, Name: "tcpDestinationPort", Type: Unsigned16},
+	{ID: 184, Name: "tcpSequenceNumber", Type: Unsigned32},
+	{ID: 185, Name: "tcpAcknowledgementNumber", Type: Unsigned32},
+	{ID: 186, Name: "tcpWindowSize", Type: Unsigned16},
+	{ID: 187, Name: "tcpUrgentPointer", Type: Unsigned16},
+	{ID: 188, Name: "tcpHeaderLength", Type: Unsigned8},
+	{ID: 189, Name: "ipHeaderLength", Type: Unsigned8},
+	{ID: 190, Name: "totalLengthIPv4", Type: Unsigned16},
+	{ID: 191, Name: "payloadLengthIPv6", Type: Unsigned16},
+	{ID: 192, Name: "ipTTL", Type: Unsigned8},
+	{ID: 193, Name: "nextHeaderIPv6", Type: Unsigned8},
+	{ID: 194, Name: "mplsPayloadLength", Type: Unsigned32},
+	{ID: 195, Name: "ipDiffServCodePoint", Type: Unsigned8},
+	{ID: 196, Name: "ipPrecedence", Type: Unsigned8},
+	{ID: 197, Name: "fragmentFlags", Type: Unsigned8},
+	{ID: 198, Name: "octetDeltaSumOfSquares", Type: Unsigned64},
+	{ID: 199, Name: "octetTotalSumOfSquares", Type: Unsigned64},
+	{ID: 200, Name: "mplsTopLabelTTL", Type: Unsigned8},
+	{ID: 201, Name: "mplsLabelStackLength", Type: Unsigned32},
+	{ID: 202, Name: "mplsLabelStackDepth", Type: Unsigned32},
+	{ID: 203, Name: "mplsTopLabelExp", Type: Unsigned8},
+	{ID: 204, Name: "ipPayloadLength", Type: Unsigned32},
+	{ID: 205, Name: "udpMessageLength", Type: Unsigned16},
+	{ID: 206, Name: "isMulticast", Type: Unsigned8},
+	{ID: 207, Name: "ipv4IHL", Type: Unsigned8},
+	{ID: 208, Name: "ipv4Options", Type: Unsigned32},
+	{ID: 209, Name: "tcpOptions", Type: Unsigned64},
+	{ID: 210, Name: "paddingOctets", Type: OctetArray},
+	{ID: 211, Name: "collectorIPv4Address", Type: IPv4Address},
+	{ID: 212, Name: "collectorIPv6Address", Type: IPv6Address},
+	{ID: 213, Name: "exportInterface", Type: Unsigned32},
+	{ID: 214, Name: "exportProtocolVersion", Type: Unsigned8},
+	{ID: 215, Name: "exportTransportProtocol", Type: Unsigned8},
+	{ID: 216, Name: "collectorTransportPort", Type: Unsigned16},
+	{ID: 217, Name: "exporterTransportPort", Type: Unsigned16},
+	{ID: 218, Name: "tcpSynTotalCount", Type: Unsigned64},
+	{ID: 219, Name: "tcpFinTotalCount", Type: Unsigned64},
+	{ID: 220, Name: "tcpRstTotalCount", Type: Unsigned64},
+	{ID: 221, Name: "tcpPshTotalCount", Type: Unsigned64},
+	{ID: 222, Name: "tcpAckTotalCount", Type: Unsigned64},
+	{ID: 223, Name: "tcpUrgTotalCount", Type: Unsigned64},
+	{ID: 224, Name: "ipTotalLength", Type: Unsigned64},
+	{ID: 225, Name: "postNATSourceIPv4Address", Type: IPv4Address},
+	{ID: 226, Name: "postNATDestinationIPv4Address", Type: IPv4Address},
+	{ID: 227, Name: "postNAPTSourceTransportPort", Type: Unsigned16},
+	{ID: 228, Name: "postNAPTDestinationTransportPort", Type: Unsigned16},
+	{ID: 229, Name: "natOriginatingAddressRealm", Type: Unsigned8},
+	{ID: 230, Name: "natEvent", Type: Unsigned8},
+	{ID: 231, Name: "initiatorOctets", Type: Unsigned64},
+	{ID: 232, Name: "responderOctets", Type: Unsigned64},
+	{ID: 233, Name: "firewallEvent", Type: Unsigned8},
+	{ID: 234, Name: "ingressVRFID", Type: Unsigned32},
+	{ID: 235, Name: "egressVRFID", Type: Unsigned32},
+	{ID: 236, Name: "VRFname", Type: String},
+	{ID: 237, Name: "postMplsTopLabelExp", Type: Unsigned8},
+	{ID: 238, Name: "tcpWindowScale", Type: Unsigned16},
+	{ID: 239, Name: "biflowDirection", Type: Unsigned8},
+	{ID: 240, Name: "ethernetHeaderLength", Type: Unsigned8},
+	{ID: 241, Name: "ethernetPayloadLength", Type: Unsigned16},
+	{ID: 242, Name: "ethernetTotalLength", Type: Unsigned16},
+	{ID: 243, Name: "dot1qVlanId", Type: Unsigned16},
+	{ID: 244, Name: "dot1qPriority", Type: Unsigned8},
+	{ID: 245, Name: "dot1qCustomerVlanId", Type: Unsigned16},
+	{ID: 246, Name: "dot1qCustomerPriority", Type: Unsigned8},
+	{ID: 252, Name: "ingressPhysicalInterface", Type: Unsigned32},
+	{ID: 253, Name: "egressPhysicalInterface", Type: Unsigned32},
+	{ID: 254, Name: "postDot1qVlanId", Type: Unsigned16},
+	{ID: 255, Name: "postDot1qCustomerVlanId", Type: Unsigned16},
+	{ID: 256, Name: "ethernetType", Type: Unsigned16},
+	{ID: 257, Name: "postIpPrecedence", Type: Unsigned8},
+	{ID: 281, Name: "postNATSourceIPv6Address", Type: IPv6Address},
+	{ID: 282, Name: "postNATDestinationIPv6Address", Type: IPv6Address},
+	{ID: 291, Name: "basicList", Type: BasicList},
+	{ID: 292, Name: "subTemplateList", Type: SubTemplateList},
+	{ID: 293, Name: "subTemplateMultiList", Type: SubTemplateMultiList},
+	{ID: 322, Name: "observationTimeSeconds", Type: DateTimeSeconds},
+	{ID: 323, Name: "observationTimeMilliseconds", Type: DateTimeMilliseconds},
+	{ID: 324, Name: "observationTimeMicroseconds", Type: DateTimeMicroseconds},
+	{ID: 325, Name: "observationTimeNanoseconds", Type: DateTimeNanoseconds},
+}
@@ -0,0 +1,247 @@
+package infoelement
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/wwicak/go-utils/mac"
+)
+
+// DataType the abstract data type of an information element (RFC 7012)
+type DataType uint8
+
+const (
+	OctetArray DataType = iota
+	Unsigned8
+	Unsigned16
+	Unsigned32
+	Unsigned64
+	Signed8
+	Signed16
+	Signed32
+	Signed64
+	Float32
+	Float64
+	Boolean
+	MacAddress
+	String
+	DateTimeSeconds
+	DateTimeMilliseconds
+	DateTimeMicroseconds
+	DateTimeNanoseconds
+	IPv4Address
+	IPv6Address
+	BasicList
+	SubTemplateList
+	SubTemplateMultiList
+)
+
+var dataTypeNames = [...]string{
+	OctetArray:           "octetArray",
+	Unsigned8:            "unsigned8",
+	Unsigned16:           "unsigned16",
+	Unsigned32:           "unsigned32",
+	Unsigned64:           "unsigned64",
+	Signed8:              "signed8",
+	Signed16:             "signed16",
+	Signed32:             "signed32",
+	Signed64:             "signed64",
+	Float32:              "float32",
+	Float64:              "float64",
+	Boolean:              "boolean",
+	MacAddress:           "macAddress",
+	String:               "string",
+	DateTimeSeconds:      "dateTimeSeconds",
+	DateTimeMilliseconds: "dateTimeMilliseconds",
+	DateTimeMicroseconds: "dateTimeMicroseconds",
+	DateTimeNanoseconds:  "dateTimeNanoseconds",
+	IPv4Address:          "ipv4Address",
+	IPv6Address:          "ipv6Address",
+	BasicList:            "basicList",
+	SubTemplateList:      "subTemplateList",
+	SubTemplateMultiList: "subTemplateMultiList",
+}
+
+func (t DataType) String() string {
+	if int(t) < len(dataTypeNames) {
+		return dataTypeNames[t]
+	}
+
+	return fmt.Sprintf("dataType(%d)", t)
+}
+
+// ntpEpochOffset seconds between the NTP epoch (1900) and the Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// Decode decodes a value of the data type.
+// Unsigned and signed integers are returned as uint64 and int64 and accept reduced size encoding,
+// addresses as netip.Addr, MAC addresses as mac.Mac, timestamps as time.Time,
+// and anything that cannot be decoded as a copy of the raw []byte.
+func (t DataType) Decode(b []byte) any {
+	switch t {
+	case Unsigned8, Unsigned16, Unsigned32, Unsigned64:
+		if len(b) <= 8 {
+			return decodeUnsigned(b)
+		}
+	case Signed8, Signed16, Signed32, Signed64:
+		if len(b) > 0 && len(b) <= 8 {
+			shift := 64 - 8*uint(len(b))
+			return int64(decodeUnsigned(b)<<shift) >> shift
+		}
+	case Float32:
+		if len(b) == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		}
+	case Float64:
+		if len(b) == 8 {
+			return math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+	case Boolean:
+		if len(b) == 1 {
+			return b[0] == 1
+		}
+	case MacAddress:
+		if len(b) == 6 {
+			return mac.Mac(b)
+		}
+	case String:
+		return string(b)
+	case DateTimeSeconds:
+		if len(b) == 4 {
+			return time.Unix(int64(binary.BigEndian.Uint32(b)), 0)
+		}
+	case DateTimeMilliseconds:
+		if len(b) == 8 {
+			return time.UnixMilli(int64(binary.BigEndian.Uint64(b)))
+		}
+	case DateTimeMicroseconds, DateTimeNanoseconds:
+		if len(b) == 8 {
+			seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+			fraction := uint64(binary.BigEndian.Uint32(b[4:8]))
+			if t == DateTimeMicroseconds {
+				// The 11 lower bits of the fraction are ignored
+				fraction &^= 0x7FF
+			}
+			return time.Unix(seconds, int64((fraction*1e9)>>32))
+		}
+	case IPv4Address, IPv6Address:
+		if addr, ok := netip.AddrFromSlice(b); ok {
+			return addr
+		}
+	}
+
+	return append([]byte(nil), b...)
+}
+
+func decodeUnsigned(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	return v
+}
+
+// Element an information element
+type Element struct {
+	// EnterpriseID the private enterprise number, 0 for IANA elements
+	EnterpriseID uint32
+	ID           uint16
+	Name         string
+	Type         DataType
+}
+
+// Field a decoded information element of a record
+type Field struct {
+	Element Element
+	// Value the decoded value see DataType.Decode
+	Value any
+}
+
+// Uint returns the value of an unsigned field
+func (f *Field) Uint() (uint64, bool) {
+	v, ok := f.Value.(uint64)
+	return v, ok
+}
+
+// Addr returns the value of an address field
+func (f *Field) Addr() (netip.Addr, bool) {
+	v, ok := f.Value.(netip.Addr)
+	return v, ok
+}
+
+type elementKey struct {
+	enterpriseID uint32
+	id           uint16
+}
+
+// Registry a set of information elements.
+// It is safe for concurrent use.
+type Registry struct {
+	lock     sync.RWMutex
+	elements map[elementKey]Element
+	names    map[string]Element
+}
+
+// NewRegistry create an empty *Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		elements: make(map[elementKey]Element),
+		names:    make(map[string]Element),
+	}
+}
+
+// NewIANARegistry create a *Registry holding the IANA information elements, see IANA
+func NewIANARegistry() *Registry {
+	r := NewRegistry()
+	r.Register(IANA...)
+	return r
+}
+
+// Default the registry used when none is configured
+var Default = NewIANARegistry()
+
+// Register adds or replaces elements
+func (r *Registry) Register(elements ...Element) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, e := range elements {
+		r.elements[elementKey{e.EnterpriseID, e.ID}] = e
+		r.names[e.Name] = e
+	}
+}
+
+// Lookup returns the element with the enterprise id and id
+func (r *Registry) Lookup(enterpriseID uint32, id uint16) (Element, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, ok := r.elements[elementKey{enterpriseID, id}]
+	return e, ok
+}
+
+// LookupName returns the element with the name
+func (r *Registry) LookupName(name string) (Element, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, ok := r.names[name]
+	return e, ok
+}
+
+// Get returns the element with the enterprise id and id,
+// an unknown element is returned as an octetArray with a synthesized name.
+func (r *Registry) Get(enterpriseID uint32, id uint16) Element {
+	if e, ok := r.Lookup(enterpriseID, id); ok {
+		return e
+	}
+
+	name := fmt.Sprintf("element%d", id)
+	if enterpriseID != 0 {
+		name = fmt.Sprintf("enterprise%d.element%d", enterpriseID, id)
+	}
+
+	return Element{EnterpriseID: enterpriseID, ID: id, Name: name, Type: OctetArray}
+}
@@ -0,0 +1,58 @@
+package infoelement
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/wwicak/go-utils/mac"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		dataType DataType
+		data     []byte
+		expected any
+	}{
+		{Unsigned64, []byte{0x01, 0x02}, uint64(0x0102)},
+		{Unsigned32, []byte{0, 0, 0x10, 0}, uint64(4096)},
+		{Signed16, []byte{0xff, 0xfe}, int64(-2)},
+		{Boolean, []byte{2}, false},
+		{IPv4Address, []byte{192, 0, 2, 1}, netip.MustParseAddr("192.0.2.1")},
+		{IPv6Address, netip.MustParseAddr("2001:db8::1").AsSlice(), netip.MustParseAddr("2001:db8::1")},
+		{MacAddress, []byte{1, 2, 3, 4, 5, 6}, mac.Mac{1, 2, 3, 4, 5, 6}},
+		{String, []byte("eth0"), "eth0"},
+		{DateTimeSeconds, []byte{0x65, 0x53, 0xf1, 0x00}, time.Unix(1700000000, 0)},
+		{DateTimeMilliseconds, []byte{0, 0, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00}, time.UnixMilli(1700000000000)},
+		{DateTimeNanoseconds, []byte{0xe8, 0xfe, 0x6f, 0x80, 0x80, 0, 0, 0}, time.Unix(1700000000, 500000000)},
+		{IPv4Address, []byte{1, 2, 3}, []byte{1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		if diff := deep.Equal(test.dataType.Decode(test.data), test.expected); diff != nil {
+			t.Errorf("%s: %v", test.dataType, diff)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewIANARegistry()
+	e, ok := r.Lookup(0, 8)
+	if !ok || e.Name != "sourceIPv4Address" || e.Type != IPv4Address {
+		t.Errorf("Got %+v", e)
+	}
+
+	if e, ok := r.LookupName("octetDeltaCount"); !ok || e.ID != 1 {
+		t.Errorf("Got %+v", e)
+	}
+
+	if e := r.Get(9, 100); e.Name != "enterprise9.element100" || e.Type != OctetArray {
+		t.Errorf("Got %+v", e)
+	}
+
+	r.Register(Element{EnterpriseID: 9, ID: 100, Name: "ciscoThing", Type: Unsigned32})
+	if e := r.Get(9, 100); e.Name != "ciscoThing" {
+		t.Errorf("Got %+v", e)
+	}
+}
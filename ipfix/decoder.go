@@ -0,0 +1,237 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/infoelement"
+)
+
+// Record a data record decoded with its template
+type Record struct {
+	TemplateID uint16
+	// Options true for a record of an options template
+	Options bool
+	// Scope the scope fields of an options record
+	Scope  []infoelement.Field
+	Fields []infoelement.Field
+}
+
+// Get returns the first field with the element name, scope fields included
+func (r *Record) Get(name string) (*infoelement.Field, bool) {
+	for _, fields := range [][]infoelement.Field{r.Scope, r.Fields} {
+		for i := range fields {
+			if fields[i].Element.Name == name {
+				return &fields[i], true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Message a decoded IPFIX message
+type Message struct {
+	Header Header
+	// Templates the templates received in the message
+	Templates []*Template
+	// Withdrawn the ids of the templates withdrawn by the message
+	Withdrawn []uint16
+	Records   []Record
+	// Unknown the number of data Sets dropped because their template is unknown
+	Unknown int
+}
+
+// Decoder decodes IPFIX messages keeping the templates of each transport session.
+// It is safe for concurrent use.
+type Decoder struct {
+	// Registry the information elements used to name and decode the fields.
+	// Default : infoelement.Default
+	Registry *infoelement.Registry
+	// Templates the template cache.
+	// Default : templates expiring after 30 minutes
+	Templates *TemplateCache
+	// Clock returns the current time.
+	// Default : time.Now
+	Clock       func() time.Time
+	lock        sync.Mutex
+	lastExpire  time.Time
+	unknown     atomic.Uint64
+	initialized sync.Once
+}
+
+// NewDecoder create a *Decoder with the defaults, suitable for UDP
+func NewDecoder() *Decoder {
+	d := &Decoder{}
+	d.initialized.Do(d.setDefaults)
+	return d
+}
+
+// NewStreamDecoder create a *Decoder whose templates never expire, suitable for TCP
+func NewStreamDecoder() *Decoder {
+	return &Decoder{Templates: NewTemplateCache(0)}
+}
+
+func (d *Decoder) setDefaults() {
+	if d.Registry == nil {
+		d.Registry = infoelement.Default
+	}
+
+	if d.Templates == nil {
+		d.Templates = NewTemplateCache(30 * time.Minute)
+	}
+
+	if d.Clock == nil {
+		d.Clock = time.Now
+	}
+}
+
+// Unknown returns the number of data Sets dropped because their template was unknown
+func (d *Decoder) Unknown() uint64 {
+	return d.unknown.Load()
+}
+
+// CloseSession removes the templates of a transport session
+func (d *Decoder) CloseSession(session netip.AddrPort) {
+	d.initialized.Do(d.setDefaults)
+	d.Templates.CloseSession(session)
+}
+
+// SessionOf returns the address and port identifying the transport session of the exporter at remote,
+// the port is 0 when remote is neither a *net.UDPAddr nor a *net.TCPAddr
+func SessionOf(remote net.Addr) netip.AddrPort {
+	switch v := remote.(type) {
+	case *net.UDPAddr:
+		return netip.AddrPortFrom(v.AddrPort().Addr().Unmap(), v.AddrPort().Port())
+	case *net.TCPAddr:
+		return netip.AddrPortFrom(v.AddrPort().Addr().Unmap(), v.AddrPort().Port())
+	}
+
+	return netip.AddrPortFrom(acl.AddrOf(remote), 0)
+}
+
+// Decode decodes a message received in the transport session
+func (d *Decoder) Decode(session netip.AddrPort, data []byte) (*Message, error) {
+	d.initialized.Do(d.setDefaults)
+	m := &Message{}
+	sets, err := m.Header.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.Clock()
+	d.expire(now)
+	key := TemplateKey{Session: session, ObservationDomainID: m.Header.ObservationDomainID}
+	// Anything shorter than a Set header is padding
+	for len(sets) >= 4 {
+		sh := SetHeader{}
+		var body []byte
+		body, sets, err = sh.Parse(sets)
+		if err != nil {
+			return nil, err
+		}
+
+		var templates []*Template
+		switch {
+		case sh.ID == TemplateSetID:
+			templates, err = ParseTemplates(body, false)
+		case sh.ID == OptionsTemplateSetID:
+			templates, err = ParseTemplates(body, true)
+		case sh.ID >= MinDataSetID:
+			key.TemplateID = sh.ID
+			t, ok := d.Templates.Get(key, now)
+			if !ok {
+				d.unknown.Add(1)
+				m.Unknown++
+				continue
+			}
+
+			m.Records, err = d.decodeRecords(m.Records, t, body)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range templates {
+			key.TemplateID = t.ID
+			if len(t.Fields) == 0 {
+				d.Templates.Withdraw(key)
+				m.Withdrawn = append(m.Withdrawn, t.ID)
+				continue
+			}
+
+			d.Templates.Set(key, t, now)
+			m.Templates = append(m.Templates, t)
+		}
+	}
+
+	return m, nil
+}
+
+// decodeRecords decodes the records of a data Set body
+func (d *Decoder) decodeRecords(records []Record, t *Template, data []byte) ([]Record, error) {
+	if t.MinRecordLength == 0 {
+		return records, nil
+	}
+
+	// Anything shorter than a record is padding
+	for len(data) >= t.MinRecordLength {
+		r := Record{TemplateID: t.ID, Options: t.Options}
+		fields := make([]infoelement.Field, len(t.Fields))
+		for i, spec := range t.Fields {
+			length := int(spec.Length)
+			if spec.Length == VariableLength {
+				if len(data) < 1 {
+					return nil, ErrTooShort
+				}
+
+				length = int(data[0])
+				data = data[1:]
+				if length == 255 {
+					if len(data) < 2 {
+						return nil, ErrTooShort
+					}
+
+					length = int(binary.BigEndian.Uint16(data[0:2]))
+					data = data[2:]
+				}
+			}
+
+			if len(data) < length {
+				return nil, ErrTooShort
+			}
+
+			e := d.Registry.Get(spec.EnterpriseID, spec.ID)
+			fields[i] = infoelement.Field{Element: e, Value: e.Type.Decode(data[:length])}
+			data = data[length:]
+		}
+
+		r.Scope = fields[:t.ScopeFieldCount]
+		r.Fields = fields[t.ScopeFieldCount:]
+		if !t.Options {
+			r.Scope = nil
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// expire drops the expired templates at most once a second
+func (d *Decoder) expire(now time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if now.Sub(d.lastExpire) < time.Second {
+		return
+	}
+
+	d.lastExpire = now
+	d.Templates.Expire(now)
+}
@@ -0,0 +1,255 @@
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/wwicak/go-utils/infoelement"
+)
+
+func message(domainID uint32, sets ...[]byte) []byte {
+	data := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint16(data[0:2], 10)
+	binary.BigEndian.PutUint32(data[4:8], 1700000000)
+	binary.BigEndian.PutUint32(data[8:12], 7)
+	binary.BigEndian.PutUint32(data[12:16], domainID)
+	for _, set := range sets {
+		data = append(data, set...)
+	}
+
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+	return data
+}
+
+func set(id uint16, body []byte) []byte {
+	data := binary.BigEndian.AppendUint16(nil, id)
+	data = binary.BigEndian.AppendUint16(data, uint16(4+len(body)))
+	return append(data, body...)
+}
+
+func u16s(values ...uint16) []byte {
+	var data []byte
+	for _, v := range values {
+		data = binary.BigEndian.AppendUint16(data, v)
+	}
+
+	return data
+}
+
+// template 256: sourceIPv6Address, octetDeltaCount(4), interfaceName(variable), enterprise 9 element 12(2)
+var templateSet = set(TemplateSetID, append(u16s(256, 4, 27, 16, 1, 4, 82, VariableLength, 0x8000|12, 2), 0, 0, 0, 9))
+
+func dataSet() []byte {
+	body := netip.MustParseAddr("2001:db8::1").AsSlice()
+	body = append(body, 0, 0, 0x05, 0xdc)
+	body = append(body, 4, 'e', 't', 'h', '0')
+	body = append(body, 0x12, 0x34)
+	return set(256, body)
+}
+
+var session = netip.MustParseAddrPort("192.0.2.10:4739")
+
+func TestDecode(t *testing.T) {
+	registry := infoelement.NewIANARegistry()
+	registry.Register(infoelement.Element{EnterpriseID: 9, ID: 12, Name: "ciscoCounter", Type: infoelement.Unsigned16})
+	d := &Decoder{Registry: registry}
+	m, err := d.Decode(session, message(1, templateSet, dataSet(), dataSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Templates) != 1 || m.Templates[0].MinRecordLength != 23 {
+		t.Fatalf("Got templates %+v", m.Templates)
+	}
+
+	if len(m.Records) != 2 {
+		t.Fatalf("Got %d records expected 2", len(m.Records))
+	}
+
+	r := m.Records[1]
+	tests := []struct {
+		name     string
+		expected any
+	}{
+		{"sourceIPv6Address", netip.MustParseAddr("2001:db8::1")},
+		{"octetDeltaCount", uint64(1500)},
+		{"interfaceName", "eth0"},
+		{"ciscoCounter", uint64(0x1234)},
+	}
+
+	for _, test := range tests {
+		field, ok := r.Get(test.name)
+		if !ok || field.Value != test.expected {
+			t.Errorf("%s: got %+v expected %v", test.name, field, test.expected)
+		}
+	}
+
+	// Another session does not share the templates
+	m, err = d.Decode(netip.MustParseAddrPort("192.0.2.10:4740"), message(1, dataSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Records) != 0 || m.Unknown != 1 {
+		t.Errorf("Got %d records %d unknown", len(m.Records), m.Unknown)
+	}
+}
+
+func TestWithdrawal(t *testing.T) {
+	d := NewDecoder()
+	if _, err := d.Decode(session, message(1, templateSet)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := d.Decode(session, message(1, set(TemplateSetID, u16s(256, 0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Withdrawn) != 1 || m.Withdrawn[0] != 256 || d.Templates.Len() != 0 {
+		t.Errorf("Got withdrawn %v with %d templates left", m.Withdrawn, d.Templates.Len())
+	}
+
+	m, err = d.Decode(session, message(1, dataSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Records) != 0 || m.Unknown != 1 {
+		t.Errorf("Got %d records %d unknown after withdrawal", len(m.Records), m.Unknown)
+	}
+
+	// Withdraw all the templates of the domain
+	if _, err := d.Decode(session, message(1, templateSet)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Decode(session, message(2, templateSet)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Decode(session, message(1, set(TemplateSetID, u16s(TemplateSetID, 0)))); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Templates.Len() != 1 {
+		t.Errorf("Got %d templates expected 1", d.Templates.Len())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	d := NewDecoder()
+	// options template 300: scope meteringProcessId(4), samplingInterval(4)
+	options := set(OptionsTemplateSetID, u16s(300, 2, 1, 143, 4, 34, 4, 0))
+	data := set(300, []byte{0, 0, 0, 1, 0, 0, 0x03, 0xe8})
+	m, err := d.Decode(session, message(1, options, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Records) != 1 {
+		t.Fatalf("Got %d records expected 1", len(m.Records))
+	}
+
+	r := m.Records[0]
+	if !r.Options || len(r.Scope) != 1 || r.Scope[0].Element.Name != "meteringProcessId" ||
+		len(r.Fields) != 1 || r.Fields[0].Value != uint64(1000) {
+		t.Errorf("Got record %+v", r)
+	}
+}
+
+func TestOptionsWithdrawal(t *testing.T) {
+	d := NewDecoder()
+	options := set(OptionsTemplateSetID, u16s(300, 2, 1, 143, 4, 34, 4, 0))
+	if _, err := d.Decode(session, message(1, options)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A withdrawal has no scope field count, it is 4 bytes long
+	m, err := d.Decode(session, message(1, set(OptionsTemplateSetID, u16s(300, 0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Withdrawn) != 1 || m.Withdrawn[0] != 300 || d.Templates.Len() != 0 {
+		t.Errorf("Got withdrawn %v with %d templates left", m.Withdrawn, d.Templates.Len())
+	}
+
+	// An options template cut before its scope field count
+	if _, err := d.Decode(session, message(1, set(OptionsTemplateSetID, u16s(300, 2)))); err != ErrTooShort {
+		t.Errorf("Got %v expected ErrTooShort", err)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	stream := bytes.NewReader(append(message(1, templateSet), message(1, dataSet())...))
+	buffer := make([]byte, MaxMessageSize)
+	d := NewStreamDecoder()
+	records := 0
+	for i := 0; i < 2; i++ {
+		data, err := ReadMessage(stream, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := d.Decode(session, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records += len(m.Records)
+	}
+
+	if records != 1 {
+		t.Errorf("Got %d records expected 1", records)
+	}
+
+	if _, err := ReadMessage(stream, buffer); err == nil {
+		t.Errorf("Expected an error at the end of the stream")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	d := NewDecoder()
+	truncated := message(1, templateSet)
+	binary.BigEndian.PutUint16(truncated[2:4], uint16(len(truncated)+10))
+	if _, err := d.Decode(session, truncated); err != ErrOutOfBounds {
+		t.Errorf("Got %v expected %v", err, ErrOutOfBounds)
+	}
+
+	if _, err := d.Decode(session, message(1)[:8]); err != ErrTooShort {
+		t.Errorf("Got %v expected %v", err, ErrTooShort)
+	}
+
+	// A variable length field running past the end of the Set
+	if _, err := d.Decode(session, message(1, templateSet)); err != nil {
+		t.Fatal(err)
+	}
+
+	body := netip.MustParseAddr("2001:db8::1").AsSlice()
+	body = append(body, 0, 0, 0x05, 0xdc, 200, 'e', 't', 'h', '0')
+	if _, err := d.Decode(session, message(1, set(256, body))); err != ErrTooShort {
+		t.Errorf("Got %v expected %v", err, ErrTooShort)
+	}
+}
+
+func TestSessionOf(t *testing.T) {
+	tests := []struct {
+		remote   net.Addr
+		expected netip.AddrPort
+	}{
+		{&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4739}, netip.MustParseAddrPort("192.0.2.1:4739")},
+		{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}, netip.MustParseAddrPort("192.0.2.1:50000")},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4739}, netip.MustParseAddrPort("[2001:db8::1]:4739")},
+		{&net.IPAddr{IP: net.IPv4(192, 0, 2, 1)}, netip.MustParseAddrPort("192.0.2.1:0")},
+	}
+
+	for _, test := range tests {
+		if session := SessionOf(test.remote); session != test.expected {
+			t.Errorf("Got %s expected %s", session, test.expected)
+		}
+	}
+}
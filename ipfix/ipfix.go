@@ -0,0 +1,89 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	// HeaderSize size in bytes of an IPFIX message header
+	HeaderSize = 16
+	// MaxMessageSize the largest IPFIX message
+	MaxMessageSize = 65535
+	// TemplateSetID the Set id of template Sets
+	TemplateSetID = 2
+	// OptionsTemplateSetID the Set id of options template Sets
+	OptionsTemplateSetID = 3
+	// MinDataSetID the lowest Set id of data Sets
+	MinDataSetID = 256
+	// VariableLength the field length announcing a variable length field
+	VariableLength = 0xFFFF
+)
+
+var (
+	ErrTooShort    = errors.New("ipfix: data is too short")
+	ErrVersion     = errors.New("ipfix: not a version 10 message")
+	ErrOutOfBounds = errors.New("ipfix: out of bounds")
+)
+
+// Header an IPFIX message header
+type Header struct {
+	Version uint16
+	// Length of the message in bytes, header included
+	Length uint16
+	// ExportTime seconds since 0000 UTC 1970 at which the message leaves the exporter
+	ExportTime     uint32
+	SequenceNumber uint32
+	// ObservationDomainID identifies the observation domain of the exporter
+	ObservationDomainID uint32
+}
+
+// Parse parses the header and returns the Sets of the message
+func (h *Header) Parse(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize {
+		return nil, ErrTooShort
+	}
+
+	h.Version = binary.BigEndian.Uint16(data[0:2])
+	if h.Version != 10 {
+		return nil, ErrVersion
+	}
+
+	h.Length = binary.BigEndian.Uint16(data[2:4])
+	h.ExportTime = binary.BigEndian.Uint32(data[4:8])
+	h.SequenceNumber = binary.BigEndian.Uint32(data[8:12])
+	h.ObservationDomainID = binary.BigEndian.Uint32(data[12:16])
+	if h.Length < HeaderSize || int(h.Length) > len(data) {
+		return nil, ErrOutOfBounds
+	}
+
+	return data[HeaderSize:h.Length], nil
+}
+
+// Time the export time of the message
+func (h *Header) Time() time.Time {
+	return time.Unix(int64(h.ExportTime), 0)
+}
+
+// SetHeader the header of a Set
+type SetHeader struct {
+	ID uint16
+	// Length of the Set in bytes, header and padding included
+	Length uint16
+}
+
+// Parse parses the Set header and returns its body and the data following the Set
+func (sh *SetHeader) Parse(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, ErrTooShort
+	}
+
+	sh.ID = binary.BigEndian.Uint16(data[0:2])
+	sh.Length = binary.BigEndian.Uint16(data[2:4])
+	if sh.Length < 4 || int(sh.Length) > len(data) {
+		return nil, nil, ErrOutOfBounds
+	}
+
+	return data[4:sh.Length], data[sh.Length:], nil
+}
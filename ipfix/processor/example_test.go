@@ -0,0 +1,56 @@
+package processor_test
+
+import (
+	"fmt"
+	"github.com/wwicak/go-utils/ipfix"
+	"github.com/wwicak/go-utils/ipfix/processor"
+	"net"
+	"os"
+	"os/signal"
+)
+
+func HandleIPFIX(exporter net.Addr, message *ipfix.Message) {
+	for i, record := range message.Records {
+		src, _ := record.Get("sourceIPv4Address")
+		dst, _ := record.Get("destinationIPv4Address")
+		if src != nil && dst != nil {
+			fmt.Printf("%s %02d) src : %v dst : %v\n", exporter, i, src.Value, dst.Value)
+		}
+	}
+}
+
+func ExampleProcessor_Start() {
+	processor := processor.Processor{
+		Handler: processor.MessageHandlerFunc(HandleIPFIX),
+	}
+
+	processor.Start()
+}
+
+func ExampleProcessor_Stop() {
+	processor := processor.Processor{
+		Handler: processor.MessageHandlerFunc(HandleIPFIX),
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		processor.Stop()
+	}()
+
+	processor.Start()
+}
+
+func ExampleTCPProcessor_Start() {
+	listener, err := net.Listen("tcp", "127.0.0.2:4739")
+	if err != nil {
+		panic(err)
+	}
+
+	processor := processor.TCPProcessor{
+		Handler:  processor.MessageHandlerFunc(HandleIPFIX),
+		Listener: listener,
+	}
+
+	processor.Start()
+}
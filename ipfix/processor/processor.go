@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/collector"
+	"github.com/wwicak/go-utils/ipfix"
+	"github.com/wwicak/go-utils/packetsource"
+	"github.com/wwicak/go-utils/pcap"
+	"github.com/wwicak/go-utils/relay"
+	"net"
+)
+
+// MessageHandler the handler for decoded IPFIX messages
+type MessageHandler interface {
+	HandleMessage(exporter net.Addr, message *ipfix.Message)
+}
+
+// The MessageHandlerFunc type is an adapter to allow the use of
+// ordinary functions as Message handlers. If f is a function
+// with the appropriate signature, MessageHandlerFunc(exporter, message) is a
+// Handler that calls f.
+type MessageHandlerFunc func(exporter net.Addr, message *ipfix.Message)
+
+// HandleMessage calls f(exporter, message)
+func (f MessageHandlerFunc) HandleMessage(exporter net.Addr, message *ipfix.Message) {
+	f(exporter, message)
+}
+
+// Processor the processor for IPFIX messages received over UDP
+type Processor struct {
+	// Conn a net.PacketConn.
+	// Default : UDPConn listining at 127.0.0.1:4739.
+	Conn net.PacketConn
+	// Source where the packets are read from, taking precedence over Conn.
+	// A pcap.Reader replays a capture, Start returns once it is exhausted.
+	// Default : Conn
+	Source packetsource.PacketSource
+	// Handler a MessageHandler to handle the decoded IPFIX messages
+	// Required unless Relay is set.
+	Handler MessageHandler
+	// Decoder the decoder holding the templates of the exporters.
+	// Default : ipfix.NewDecoder()
+	Decoder *ipfix.Decoder
+	// Workers the number of worker to work on the queue
+	// Default : The number of runtime.GOMAXPROCS
+	Workers int
+	// Backlog how many packets are can be queued before being processed
+	// Defaults : 100
+	Backlog int
+	// PacketSize size of packet going to be received
+	// Default : 9216
+	PacketSize int
+	// ByteArrayPoolSize the number byte arrays to have avialable in the pool.
+	// Default : The same size of the backlog
+	ByteArrayPoolSize int
+	// Affinity when true packets from the same exporter are always handled by the same worker
+	// preserving their order.
+	// Default : false
+	Affinity bool
+	// AffinityKey computes the key used to select the worker when Affinity is set.
+	// Default : a hash of the remote IP address
+	AffinityKey func(remote net.Addr, packet []byte) uint64
+	// ACL the access list the remote address of the exporter is checked against.
+	// Default : nil, every exporter is accepted
+	ACL *acl.ACL
+	// Relay forwards every accepted packet unchanged to downstream collectors.
+	// Default : nil, no forwarding
+	Relay *relay.Relay
+	// Recorder records every accepted packet to pcap files.
+	// Default : nil, no recording
+	Recorder  *pcap.Recorder
+	collector collector.Collector[*ipfix.Message]
+}
+
+func (p *Processor) setDefaults() {
+	if p.Handler == nil && p.Relay == nil {
+		panic(errors.New("No handler defined"))
+	}
+
+	p.collector.Config = collector.Config{
+		Address:           "127.0.0.1:4739",
+		Conn:              p.Conn,
+		Source:            p.Source,
+		Workers:           p.Workers,
+		Backlog:           p.Backlog,
+		PacketSize:        p.PacketSize,
+		ByteArrayPoolSize: p.ByteArrayPoolSize,
+		Affinity:          p.Affinity,
+		AffinityKey:       p.AffinityKey,
+		ACL:               p.ACL,
+		Relay:             p.Relay,
+		Recorder:          p.Recorder,
+	}
+
+	if p.PacketSize <= 0 {
+		p.collector.PacketSize = 9216
+	}
+
+	if p.Decoder == nil {
+		p.Decoder = ipfix.NewDecoder()
+	}
+
+	if p.Handler != nil {
+		decoder := p.Decoder
+		p.collector.Decoder = collector.DecoderFunc[*ipfix.Message](func(remote net.Addr, buffer []byte) (*ipfix.Message, error) {
+			return decoder.Decode(ipfix.SessionOf(remote), buffer)
+		})
+		p.collector.Sink = collector.SinkFunc[*ipfix.Message](p.Handler.HandleMessage)
+	}
+}
+
+// Rejected returns the number of packets dropped by the access lists
+func (p *Processor) Rejected() uint64 {
+	return p.collector.Rejected()
+}
+
+// Stop stops the processor.
+func (p *Processor) Stop() {
+	p.collector.Stop()
+}
+
+// StopAndWait stops the processor and wait for the dispatcher to cleanup
+func (p *Processor) StopAndWait() {
+	p.collector.StopAndWait()
+}
+
+// Start starts the processor.
+func (p *Processor) Start() {
+	p.setDefaults()
+	p.collector.Start()
+}
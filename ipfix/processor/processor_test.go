@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"github.com/wwicak/go-utils/ipfix"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessor(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	octets := []any{}
+	p := &Processor{
+		Conn:     conn,
+		Workers:  2,
+		Affinity: true,
+		Handler: MessageHandlerFunc(func(exporter net.Addr, message *ipfix.Message) {
+			lock.Lock()
+			defer lock.Unlock()
+			for _, r := range message.Records {
+				field, _ := r.Get("octetDeltaCount")
+				octets = append(octets, field.Value)
+			}
+		}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Start()
+		close(done)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// template 256: octetDeltaCount(4), then a data message the exporter session decodes with it
+	messages := [][]byte{testMessage([]byte{0, ipfix.TemplateSetID, 1, 0, 0, 1, 0, 1, 0, 4}), {0, 10, 0, 2}}
+	for i := 0; i < 10; i++ {
+		messages = append(messages, testMessage([]byte{1, 0, 0, 0, 0, byte(i)}))
+	}
+
+	for _, message := range messages {
+		if _, err := client.Write(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		n := len(octets)
+		lock.Unlock()
+		if n == 10 && p.collector.Errors() == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d records and %d errors", n, p.collector.Errors())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p.StopAndWait()
+	<-done
+	for i, v := range octets {
+		if v != uint64(i) {
+			t.Errorf("record %d: got %v, messages handled out of order", i, v)
+		}
+	}
+}
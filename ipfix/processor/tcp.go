@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/bytearraypool"
+	"github.com/wwicak/go-utils/bytesdispatcher"
+	"github.com/wwicak/go-utils/ipfix"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// TCPProcessor the processor for IPFIX messages received over TCP.
+// Each connection is a transport session, its messages are handled in order
+// and its templates are dropped when it is closed.
+type TCPProcessor struct {
+	// Listener a net.Listener.
+	// Default : TCP listener at 127.0.0.1:4739.
+	Listener net.Listener
+	// Handler a MessageHandler to handle the decoded IPFIX messages
+	// Required.
+	Handler MessageHandler
+	// Decoder the decoder holding the templates of the sessions.
+	// Default : ipfix.NewStreamDecoder()
+	Decoder *ipfix.Decoder
+	// Workers the number of worker to work on the queue
+	// Default : The number of runtime.GOMAXPROCS
+	Workers int
+	// Backlog how many messages are can be queued per worker before being processed
+	// Defaults : 100
+	Backlog int
+	// ByteArrayPoolSize the number byte arrays to have avialable in the pool.
+	// Default : The same size of the backlog
+	ByteArrayPoolSize int
+	// ACL the access list the remote address of the exporter is checked against.
+	// Default : nil, every exporter is accepted
+	ACL           *acl.ACL
+	rejected      atomic.Uint64
+	byteArrayPool *bytearraypool.ByteArrayPool
+	dispatcher    *bytesdispatcher.Dispatcher
+	// lock guards listener, conns and stopped, set by Start and read by Stop from other goroutines
+	lock          sync.Mutex
+	listener      net.Listener
+	conns         map[net.Conn]struct{}
+	stopped       bool
+	connWaitGroup sync.WaitGroup
+}
+
+func (p *TCPProcessor) setDefaults() {
+	if p.Handler == nil {
+		panic(errors.New("No handler defined"))
+	}
+
+	if p.Workers <= 0 {
+		p.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	if p.Backlog <= 0 {
+		p.Backlog = 100
+	}
+
+	if p.ByteArrayPoolSize <= 0 {
+		p.ByteArrayPoolSize = p.Backlog
+	}
+
+	p.byteArrayPool = bytearraypool.NewByteArrayPool(p.ByteArrayPoolSize, ipfix.MaxMessageSize)
+
+	if p.Listener == nil {
+		listener, err := net.Listen("tcp", "127.0.0.1:4739")
+		if err != nil {
+			panic(err)
+		}
+
+		p.Listener = listener
+	}
+
+	if p.Decoder == nil {
+		p.Decoder = ipfix.NewStreamDecoder()
+	}
+
+	p.conns = make(map[net.Conn]struct{})
+	p.dispatcher = bytesdispatcher.NewPacketDispatcher(p.Workers, p.Backlog, sessionHandler(p.Decoder, p.Handler), p.byteArrayPool)
+}
+
+// sessionHandler decodes the messages of a session, an empty message marks the end of the session
+func sessionHandler(decoder *ipfix.Decoder, h MessageHandler) bytesdispatcher.PacketHandler {
+	return bytesdispatcher.PacketHandlerFunc(
+		func(buffer []byte, remote net.Addr) {
+			if len(buffer) == 0 {
+				decoder.CloseSession(ipfix.SessionOf(remote))
+				return
+			}
+
+			message, err := decoder.Decode(ipfix.SessionOf(remote), buffer)
+			if err != nil {
+				return
+			}
+			h.HandleMessage(remote, message)
+		},
+	)
+}
+
+// Rejected returns the number of connections refused by the access list
+func (p *TCPProcessor) Rejected() uint64 {
+	return p.rejected.Load()
+}
+
+// Stop stops the processor and closes every session.
+// It may be called from any goroutine, before Start returns or even before it is called.
+func (p *TCPProcessor) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stopped = true
+	for conn := range p.conns {
+		conn.Close()
+	}
+
+	if p.listener != nil {
+		p.listener.Close()
+	}
+}
+
+// open sets the defaults and publishes the listener to Stop.
+// Nothing is opened and it returns false when the processor was stopped before.
+func (p *TCPProcessor) open() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped {
+		return false
+	}
+
+	p.setDefaults()
+	p.listener = p.Listener
+	return true
+}
+
+// Start starts the processor, it returns once the processor is stopped and its sessions are handled.
+func (p *TCPProcessor) Start() {
+	if !p.open() {
+		return
+	}
+
+	listener := p.listener
+	p.dispatcher.Run()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if p.isStopped() {
+				break
+			}
+
+			panic(err)
+		}
+
+		if !p.ACL.AllowedAddr(conn.RemoteAddr()) {
+			p.rejected.Add(1)
+			conn.Close()
+			continue
+		}
+
+		if !p.track(conn) {
+			conn.Close()
+			break
+		}
+
+		p.connWaitGroup.Add(1)
+		go p.serve(conn)
+	}
+
+	p.connWaitGroup.Wait()
+	p.dispatcher.Stop()
+}
+
+func (p *TCPProcessor) isStopped() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.stopped
+}
+
+func (p *TCPProcessor) track(conn net.Conn) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped {
+		return false
+	}
+
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+// serve reads the messages of a session and submits them to the worker owning the session
+func (p *TCPProcessor) serve(conn net.Conn) {
+	defer p.connWaitGroup.Done()
+	remote := conn.RemoteAddr()
+	key := bytesdispatcher.HashKey([]byte(remote.String()))
+	for {
+		buffer := p.byteArrayPool.Get()
+		message, err := ipfix.ReadMessage(conn, buffer)
+		if err != nil {
+			// The session is over, close it after its last message
+			p.dispatcher.SubmitKeyedPacket(key, buffer[:0], remote)
+			break
+		}
+
+		p.dispatcher.SubmitKeyedPacket(key, message, remote)
+	}
+
+	p.lock.Lock()
+	delete(p.conns, conn)
+	p.lock.Unlock()
+	conn.Close()
+}
@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"encoding/binary"
+	"github.com/wwicak/go-utils/ipfix"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testMessage(sets ...[]byte) []byte {
+	data := make([]byte, ipfix.HeaderSize)
+	binary.BigEndian.PutUint16(data[0:2], 10)
+	binary.BigEndian.PutUint32(data[12:16], 1)
+	for _, set := range sets {
+		data = binary.BigEndian.AppendUint16(data, binary.BigEndian.Uint16(set[0:2]))
+		data = binary.BigEndian.AppendUint16(data, uint16(len(set)+2))
+		data = append(data, set[2:]...)
+	}
+
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+	return data
+}
+
+func TestTCPProcessor(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	octets := []any{}
+	decoder := ipfix.NewStreamDecoder()
+	p := &TCPProcessor{
+		Listener: listener,
+		Decoder:  decoder,
+		Workers:  2,
+		Handler: MessageHandlerFunc(func(exporter net.Addr, message *ipfix.Message) {
+			lock.Lock()
+			defer lock.Unlock()
+			for _, r := range message.Records {
+				field, _ := r.Get("octetDeltaCount")
+				octets = append(octets, field.Value)
+			}
+		}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Start()
+		close(done)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// template 256: octetDeltaCount(4)
+	template := testMessage([]byte{0, ipfix.TemplateSetID, 1, 0, 0, 1, 0, 1, 0, 4})
+	for i := 0; i < 10; i++ {
+		template = append(template, testMessage([]byte{1, 0, 0, 0, 0, byte(i)})...)
+	}
+
+	// Write the messages in small chunks to exercise the stream framing
+	for len(template) > 0 {
+		n := min(7, len(template))
+		if _, err := conn.Write(template[:n]); err != nil {
+			t.Fatal(err)
+		}
+		template = template[n:]
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		n := len(octets)
+		lock.Unlock()
+		// The templates of the session are dropped once it is closed
+		if n == 10 && decoder.Templates.Len() == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d records and %d templates", n, decoder.Templates.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p.Stop()
+	<-done
+
+	if len(octets) != 10 {
+		t.Fatalf("Got %d records expected 10", len(octets))
+	}
+
+	for i, v := range octets {
+		if v != uint64(i) {
+			t.Errorf("record %d: got %v, messages handled out of order", i, v)
+		}
+	}
+}
+
+func TestTCPProcessorStop(t *testing.T) {
+	// a processor stopped before it is started does not start
+	(&TCPProcessor{}).Stop()
+	p := &TCPProcessor{Handler: MessageHandlerFunc(func(net.Addr, *ipfix.Message) {})}
+	p.Stop()
+	p.Start()
+	if p.Listener != nil {
+		t.Error("a stopped processor opened a listener")
+	}
+
+	for i := 0; i < 100; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := &TCPProcessor{Listener: listener, Handler: MessageHandlerFunc(func(net.Addr, *ipfix.Message) {})}
+		done := make(chan struct{})
+		go func() {
+			p.Start()
+			close(done)
+		}()
+
+		p.Stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Start did not return once stopped")
+		}
+
+		listener.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// ReadMessage reads one IPFIX message from a stream transport like TCP into buffer.
+// buffer must be able to hold MaxMessageSize bytes, the returned []byte aliases it.
+func ReadMessage(r io.Reader, buffer []byte) ([]byte, error) {
+	if len(buffer) < MaxMessageSize {
+		return nil, io.ErrShortBuffer
+	}
+
+	if _, err := io.ReadFull(r, buffer[:HeaderSize]); err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint16(buffer[0:2]) != 10 {
+		return nil, ErrVersion
+	}
+
+	length := int(binary.BigEndian.Uint16(buffer[2:4]))
+	if length < HeaderSize {
+		return nil, ErrOutOfBounds
+	}
+
+	if _, err := io.ReadFull(r, buffer[HeaderSize:length]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return buffer[:length], nil
+}
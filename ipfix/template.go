@@ -0,0 +1,204 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// FieldSpecifier the information element and length of a template field
+type FieldSpecifier struct {
+	ID uint16
+	// Length the length of the field or VariableLength
+	Length uint16
+	// EnterpriseID the private enterprise number, 0 for IANA elements
+	EnterpriseID uint32
+}
+
+// Template describes the layout of the data records of a template id
+type Template struct {
+	ID uint16
+	// Options true for an options template
+	Options bool
+	// ScopeFieldCount the number of leading fields that are scope fields
+	ScopeFieldCount int
+	Fields          []FieldSpecifier
+	// MinRecordLength the length of a record, counting variable length fields as one byte
+	MinRecordLength int
+}
+
+func parseFieldSpecifiers(data []byte, count int) ([]FieldSpecifier, []byte, int, error) {
+	fields := make([]FieldSpecifier, count)
+	length := 0
+	for i := range fields {
+		if len(data) < 4 {
+			return nil, nil, 0, ErrTooShort
+		}
+
+		id := binary.BigEndian.Uint16(data[0:2])
+		fields[i].ID = id & 0x7FFF
+		fields[i].Length = binary.BigEndian.Uint16(data[2:4])
+		data = data[4:]
+		if id&0x8000 != 0 {
+			if len(data) < 4 {
+				return nil, nil, 0, ErrTooShort
+			}
+
+			fields[i].EnterpriseID = binary.BigEndian.Uint32(data[0:4])
+			data = data[4:]
+		}
+
+		if fields[i].Length == VariableLength {
+			length++
+		} else {
+			length += int(fields[i].Length)
+		}
+	}
+
+	return fields, data, length, nil
+}
+
+// ParseTemplates parses the body of a template or options template Set.
+// A template without fields is a withdrawal, it is returned with no Fields.
+func ParseTemplates(data []byte, options bool) ([]*Template, error) {
+	templates := []*Template{}
+	// Anything shorter than a template header is padding,
+	// the scope field count of the options templates is only read when they are not withdrawn
+	for len(data) >= 4 {
+		t := &Template{ID: binary.BigEndian.Uint16(data[0:2]), Options: options}
+		count := int(binary.BigEndian.Uint16(data[2:4]))
+		if count == 0 {
+			// A withdrawal has no scope field count
+			templates = append(templates, t)
+			data = data[4:]
+			continue
+		}
+
+		headerSize := 4
+		if options {
+			if len(data) < 6 {
+				return nil, ErrTooShort
+			}
+
+			headerSize = 6
+			t.ScopeFieldCount = int(binary.BigEndian.Uint16(data[4:6]))
+			if t.ScopeFieldCount == 0 || t.ScopeFieldCount > count {
+				return nil, ErrOutOfBounds
+			}
+		}
+
+		var err error
+		t.Fields, data, t.MinRecordLength, err = parseFieldSpecifiers(data[headerSize:], count)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// TemplateKey identifies a template of a transport session
+type TemplateKey struct {
+	// Session the address and port of the exporter
+	Session             netip.AddrPort
+	ObservationDomainID uint32
+	TemplateID          uint16
+}
+
+type templateEntry struct {
+	template *Template
+	expires  time.Time
+}
+
+// TemplateCache caches templates per transport session and observation domain.
+// It is safe for concurrent use.
+type TemplateCache struct {
+	// TTL how long a template is kept after it was last received,
+	// templates never expire when TTL is 0 as required over TCP.
+	TTL       time.Duration
+	lock      sync.RWMutex
+	templates map[TemplateKey]templateEntry
+}
+
+// NewTemplateCache create a *TemplateCache
+func NewTemplateCache(ttl time.Duration) *TemplateCache {
+	return &TemplateCache{
+		TTL:       ttl,
+		templates: make(map[TemplateKey]templateEntry),
+	}
+}
+
+// Set adds or refreshes a template
+func (c *TemplateCache) Set(key TemplateKey, t *Template, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := templateEntry{template: t}
+	if c.TTL > 0 {
+		entry.expires = now.Add(c.TTL)
+	}
+
+	c.templates[key] = entry
+}
+
+// Get returns an unexpired template
+func (c *TemplateCache) Get(key TemplateKey, now time.Time) (*Template, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	entry, ok := c.templates[key]
+	if !ok || (!entry.expires.IsZero() && now.After(entry.expires)) {
+		return nil, false
+	}
+
+	return entry.template, true
+}
+
+// Withdraw removes a template.
+// The ids TemplateSetID and OptionsTemplateSetID withdraw all the templates or options templates
+// of the session and observation domain.
+func (c *TemplateCache) Withdraw(key TemplateKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if key.TemplateID >= MinDataSetID {
+		delete(c.templates, key)
+		return
+	}
+
+	options := key.TemplateID == OptionsTemplateSetID
+	for k, entry := range c.templates {
+		if k.Session == key.Session && k.ObservationDomainID == key.ObservationDomainID && entry.template.Options == options {
+			delete(c.templates, k)
+		}
+	}
+}
+
+// CloseSession removes every template of a transport session
+func (c *TemplateCache) CloseSession(session netip.AddrPort) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k := range c.templates {
+		if k.Session == session {
+			delete(c.templates, k)
+		}
+	}
+}
+
+// Expire removes the expired templates
+func (c *TemplateCache) Expire(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, entry := range c.templates {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(c.templates, key)
+		}
+	}
+}
+
+// Len returns the number of cached templates
+func (c *TemplateCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.templates)
+}
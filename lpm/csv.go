@@ -0,0 +1,117 @@
+package lpm
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var ErrNoPrefixColumn = errors.New("lpm: no prefix column in the CSV header")
+
+// ReadCSV reads a Trie from CSV rows with a header naming the columns, lines starting with # are ignored.
+// The prefix column holds a CIDR or a single address, the optional asn column the origin AS
+// as a number or prefixed with AS, and the other columns are kept in the Attributes of the Info.
+//
+//	prefix,asn,site,customer
+//	192.0.2.0/24,AS64500,par1,acme
+//	2001:db8::/32,64501,fra2,
+func ReadCSV(r io.Reader) (*Trie[Info], error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	prefixColumn, asnColumn := -1, -1
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		switch header[i] {
+		case "prefix":
+			prefixColumn = i
+		case "asn":
+			asnColumn = i
+		}
+	}
+
+	if prefixColumn < 0 {
+		return nil, ErrNoPrefixColumn
+	}
+
+	trie := &Trie[Info]{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return trie, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		prefix, err := parsePrefix(row[prefixColumn])
+		if err != nil {
+			return nil, fmt.Errorf("lpm: line %d: %w", line, err)
+		}
+
+		var info Info
+		for i, value := range row {
+			switch i {
+			case prefixColumn:
+			case asnColumn:
+				if info.ASN, err = parseASN(value); err != nil {
+					return nil, fmt.Errorf("lpm: line %d: %w", line, err)
+				}
+			default:
+				if info.Attributes == nil {
+					info.Attributes = make(map[string]string, len(row)-1)
+				}
+
+				info.Attributes[header[i]] = value
+			}
+		}
+
+		trie.Insert(prefix, info)
+	}
+}
+
+// parsePrefix parses a CIDR, a single address is a host prefix
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(s)
+		if addrErr != nil {
+			return netip.Prefix{}, err
+		}
+
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	return prefix.Masked(), nil
+}
+
+// parseASN parses an AS number, optionally prefixed with AS, empty is 0
+func parseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+
+	if s == "" {
+		return 0, nil
+	}
+
+	asn, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASN %q", s)
+	}
+
+	return uint32(asn), nil
+}
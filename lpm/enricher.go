@@ -0,0 +1,48 @@
+package lpm
+
+import "github.com/wwicak/go-utils/flowrecord"
+
+// Enricher annotates the source and destination of flows with the longest prefix of the Table containing them.
+// Enrich is safe for concurrent use, a flowrecord.Enricher hands it the flows of the collectors.
+type Enricher struct {
+	// Table the prefixes the addresses are looked up in.
+	// Required.
+	Table *Table
+	// Overwrite replaces the AS numbers and the masks set by the exporter, and the attributes set by an earlier stage.
+	// Default : false, only the zero AS numbers and masks and the missing attributes are set
+	Overwrite bool
+}
+
+// Enrich sets the AS numbers and the masks of r from the prefixes of its source and destination addresses,
+// and the Attributes of their Annotations from the Info of the prefixes
+func (e *Enricher) Enrich(r *flowrecord.FlowRecord) {
+	srcPrefix, src, srcFound := e.Table.Lookup(r.SrcAddr)
+	dstPrefix, dst, dstFound := e.Table.Lookup(r.DstAddr)
+	if srcFound {
+		if r.SrcAS == 0 || e.Overwrite {
+			r.SrcAS = src.ASN
+		}
+
+		if r.SrcMask == 0 || e.Overwrite {
+			r.SrcMask = uint8(srcPrefix.Bits())
+		}
+
+		if len(src.Attributes) > 0 && (r.Annotations == nil || r.Annotations.Src.Attributes == nil || e.Overwrite) {
+			r.Annotate().Src.Attributes = src.Attributes
+		}
+	}
+
+	if dstFound {
+		if r.DstAS == 0 || e.Overwrite {
+			r.DstAS = dst.ASN
+		}
+
+		if r.DstMask == 0 || e.Overwrite {
+			r.DstMask = uint8(dstPrefix.Bits())
+		}
+
+		if len(dst.Attributes) > 0 && (r.Annotations == nil || r.Annotations.Dst.Attributes == nil || e.Overwrite) {
+			r.Annotate().Dst.Attributes = dst.Attributes
+		}
+	}
+}
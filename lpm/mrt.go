@@ -0,0 +1,218 @@
+package lpm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// MRT types and TABLE_DUMP_V2 subtypes, RFC 6396 and RFC 8050
+const (
+	mrtTableDumpV2 = 13
+
+	ribIPv4Unicast          = 2
+	ribIPv4Multicast        = 3
+	ribIPv6Unicast          = 4
+	ribIPv6Multicast        = 5
+	ribIPv4UnicastAddPath   = 8
+	ribIPv4MulticastAddPath = 9
+	ribIPv6UnicastAddPath   = 10
+	ribIPv6MulticastAddPath = 11
+
+	attributeASPath    = 2
+	attributeExtended  = 0x10
+	segmentASSet       = 1
+	segmentASSequence  = 2
+	mrtHeaderLength    = 12
+	maxMRTRecordLength = 1 << 24
+)
+
+var ErrMRTTruncated = errors.New("lpm: truncated MRT record")
+
+// ReadMRT reads a Trie from a MRT TABLE_DUMP_V2 RIB dump, as published by RouteViews and RIPE RIS.
+// Every IPv4 and IPv6 RIB entry gives the origin AS of its prefix, taken from the AS_PATH of the first route
+// having one, the other records are skipped.
+func ReadMRT(r io.Reader) (*Trie[Info], error) {
+	trie := &Trie[Info]{}
+	header := make([]byte, mrtHeaderLength)
+	var body []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return trie, nil
+			}
+
+			if err == io.ErrUnexpectedEOF {
+				return nil, ErrMRTTruncated
+			}
+
+			return nil, err
+		}
+
+		kind := binary.BigEndian.Uint16(header[4:])
+		subtype := binary.BigEndian.Uint16(header[6:])
+		length := binary.BigEndian.Uint32(header[8:])
+		if length > maxMRTRecordLength {
+			return nil, fmt.Errorf("lpm: MRT record of %d bytes", length)
+		}
+
+		if cap(body) < int(length) {
+			body = make([]byte, length)
+		}
+
+		body = body[:length]
+		if _, err := io.ReadFull(r, body); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrMRTTruncated
+			}
+
+			return nil, err
+		}
+
+		if kind != mrtTableDumpV2 {
+			continue
+		}
+
+		var ipv6, addPath bool
+		switch subtype {
+		case ribIPv4Unicast, ribIPv4Multicast:
+		case ribIPv6Unicast, ribIPv6Multicast:
+			ipv6 = true
+		case ribIPv4UnicastAddPath, ribIPv4MulticastAddPath:
+			addPath = true
+		case ribIPv6UnicastAddPath, ribIPv6MulticastAddPath:
+			ipv6, addPath = true, true
+		default:
+			continue
+		}
+
+		prefix, asn, err := parseRIB(body, ipv6, addPath)
+		if err != nil {
+			return nil, err
+		}
+
+		trie.Insert(prefix, Info{ASN: asn})
+	}
+}
+
+// parseRIB returns the prefix and the origin AS of a RIB_IPV4 or RIB_IPV6 record
+func parseRIB(data []byte, ipv6, addPath bool) (netip.Prefix, uint32, error) {
+	// sequence number, prefix length
+	if len(data) < 5 {
+		return netip.Prefix{}, 0, ErrMRTTruncated
+	}
+
+	length := int(data[4])
+	size := (length + 7) / 8
+	data = data[5:]
+	if len(data) < size+2 {
+		return netip.Prefix{}, 0, ErrMRTTruncated
+	}
+
+	var prefix netip.Prefix
+	if ipv6 {
+		var a [16]byte
+		if length > 128 {
+			return netip.Prefix{}, 0, fmt.Errorf("lpm: invalid IPv6 prefix length %d", length)
+		}
+
+		copy(a[:], data[:size])
+		prefix = netip.PrefixFrom(netip.AddrFrom16(a), length)
+	} else {
+		var a [4]byte
+		if length > 32 {
+			return netip.Prefix{}, 0, fmt.Errorf("lpm: invalid IPv4 prefix length %d", length)
+		}
+
+		copy(a[:], data[:size])
+		prefix = netip.PrefixFrom(netip.AddrFrom4(a), length)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[size:]))
+	data = data[size+2:]
+	for range count {
+		// peer index, originated time, path identifier
+		skip := 6
+		if addPath {
+			skip += 4
+		}
+
+		if len(data) < skip+2 {
+			return netip.Prefix{}, 0, ErrMRTTruncated
+		}
+
+		attributesLength := int(binary.BigEndian.Uint16(data[skip:]))
+		data = data[skip+2:]
+		if len(data) < attributesLength {
+			return netip.Prefix{}, 0, ErrMRTTruncated
+		}
+
+		asn, err := originAS(data[:attributesLength])
+		if err != nil {
+			return netip.Prefix{}, 0, err
+		}
+
+		if asn != 0 {
+			return prefix.Masked(), asn, nil
+		}
+
+		data = data[attributesLength:]
+	}
+
+	return prefix.Masked(), 0, nil
+}
+
+// originAS returns the last AS of the AS_PATH of the BGP path attributes, 0 when there is none
+// or when the path ends with an AS_SET of several ASes.
+// The AS numbers of TABLE_DUMP_V2 are always 4 bytes long.
+func originAS(data []byte) (uint32, error) {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return 0, ErrMRTTruncated
+		}
+
+		flags, kind := data[0], data[1]
+		length, offset := int(data[2]), 3
+		if flags&attributeExtended != 0 {
+			if len(data) < 4 {
+				return 0, ErrMRTTruncated
+			}
+
+			length, offset = int(binary.BigEndian.Uint16(data[2:])), 4
+		}
+
+		if len(data) < offset+length {
+			return 0, ErrMRTTruncated
+		}
+
+		value := data[offset : offset+length]
+		data = data[offset+length:]
+		if kind != attributeASPath {
+			continue
+		}
+
+		var origin uint32
+		for len(value) > 0 {
+			if len(value) < 2 || len(value) < 2+4*int(value[1]) {
+				return 0, ErrMRTTruncated
+			}
+
+			segment, count := value[0], int(value[1])
+			ases := value[2 : 2+4*count]
+			value = value[2+4*count:]
+			switch {
+			case count == 0:
+			case segment == segmentASSequence || count == 1:
+				origin = binary.BigEndian.Uint32(ases[4*(count-1):])
+			case segment == segmentASSet:
+				origin = 0
+			}
+		}
+
+		return origin, nil
+	}
+
+	return 0, nil
+}
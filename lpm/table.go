@@ -0,0 +1,92 @@
+package lpm
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Info the metadata of a prefix
+type Info struct {
+	// ASN the autonomous system originating the prefix, 0 when unknown
+	ASN uint32
+	// Attributes the other columns of a CSV row by name, the site or the customer for instance
+	Attributes map[string]string
+}
+
+// Table the current Trie of the Info of the prefixes, replaced atomically.
+// Lookups never lock nor allocate and see either the previous or the new Trie.
+// The zero value is an empty Table.
+type Table struct {
+	trie atomic.Pointer[Trie[Info]]
+}
+
+// Lookup returns the longest prefix containing addr and its Info
+func (t *Table) Lookup(addr netip.Addr) (netip.Prefix, Info, bool) {
+	trie := t.trie.Load()
+	if trie == nil {
+		return netip.Prefix{}, Info{}, false
+	}
+
+	return trie.Lookup(addr)
+}
+
+// Load returns the current Trie, nil when none was stored.
+// It must not be modified.
+func (t *Table) Load() *Trie[Info] {
+	return t.trie.Load()
+}
+
+// Store replaces the current Trie with trie, it must not be modified afterwards
+func (t *Table) Store(trie *Trie[Info]) {
+	t.trie.Store(trie)
+}
+
+// LoadFile reads the Trie of a CSV file, when its name ends with .csv, or of a MRT TABLE_DUMP_V2 file otherwise,
+// and replaces the current Trie with it.
+// The files compressed with gzip or bzip2 are recognized by their .gz or .bz2 extension.
+// The current Trie is kept when the file cannot be read.
+func (t *Table) LoadFile(path string) error {
+	trie, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	t.Store(trie)
+	return nil
+}
+
+// ReadFile reads the Trie of a CSV or MRT TABLE_DUMP_V2 file as Table.LoadFile does
+func ReadFile(path string) (*Trie[Info], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = bufio.NewReaderSize(file, 1<<16)
+	name := path
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		r, name = gz, strings.TrimSuffix(name, ".gz")
+	case strings.HasSuffix(name, ".bz2"):
+		r, name = bzip2.NewReader(r), strings.TrimSuffix(name, ".bz2")
+	}
+
+	if strings.HasSuffix(name, ".csv") {
+		return ReadCSV(r)
+	}
+
+	return ReadMRT(r)
+}
@@ -0,0 +1,279 @@
+package lpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testCSV = `# prefixes of the customers
+Prefix,ASN,Site,Customer
+192.0.2.0/24,AS64500,par1,acme
+192.0.2.128/25,64501,par1,
+198.51.100.7,,fra2,globex
+2001:db8::/32,64502,fra2,initech
+`
+
+func TestReadCSV(t *testing.T) {
+	trie, err := ReadCSV(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trie.Len() != 4 {
+		t.Errorf("%d prefixes, want 4", trie.Len())
+	}
+
+	for addr, want := range map[string]Info{
+		"192.0.2.1":      {ASN: 64500, Attributes: map[string]string{"site": "par1", "customer": "acme"}},
+		"192.0.2.200":    {ASN: 64501, Attributes: map[string]string{"site": "par1", "customer": ""}},
+		"198.51.100.7":   {Attributes: map[string]string{"site": "fra2", "customer": "globex"}},
+		"2001:db8::cafe": {ASN: 64502, Attributes: map[string]string{"site": "fra2", "customer": "initech"}},
+	} {
+		_, info, found := trie.Lookup(netip.MustParseAddr(addr))
+		if !found || info.ASN != want.ASN || len(info.Attributes) != 2 ||
+			info.Attributes["site"] != want.Attributes["site"] || info.Attributes["customer"] != want.Attributes["customer"] {
+			t.Errorf("%s: got %v %+v want %+v", addr, found, info, want)
+		}
+	}
+
+	for input, want := range map[string]string{
+		"asn\n64500\n":                 "no prefix column",
+		"prefix\n192.0.2.0/33\n":       "line 2",
+		"prefix,asn\n192.0.2.0/24,x\n": `invalid ASN "x"`,
+	} {
+		if _, err := ReadCSV(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v want %s", input, err, want)
+		}
+	}
+}
+
+// mrtRecord returns a MRT record
+func mrtRecord(kind, subtype uint16, body []byte) []byte {
+	record := binary.BigEndian.AppendUint32(nil, 1700000000)
+	record = binary.BigEndian.AppendUint16(record, kind)
+	record = binary.BigEndian.AppendUint16(record, subtype)
+	record = binary.BigEndian.AppendUint32(record, uint32(len(body)))
+	return append(record, body...)
+}
+
+// ribRecord returns a TABLE_DUMP_V2 RIB record of prefix with a route per AS path, a path is a list of segments
+func ribRecord(prefix netip.Prefix, addPath bool, paths ...[][]uint32) []byte {
+	subtype := uint16(ribIPv4Unicast)
+	if prefix.Addr().Is6() {
+		subtype = ribIPv6Unicast
+	}
+
+	if addPath {
+		subtype += ribIPv4UnicastAddPath - ribIPv4Unicast
+	}
+
+	body := binary.BigEndian.AppendUint32(nil, 7)
+	body = append(body, byte(prefix.Bits()))
+	body = append(body, prefix.Addr().AsSlice()[:(prefix.Bits()+7)/8]...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(paths)))
+	for i, segments := range paths {
+		// the ORIGIN attribute, then the AS_PATH
+		attributes := []byte{0x40, 1, 1, 0}
+		var asPath []byte
+		for _, segment := range segments {
+			kind := byte(segmentASSequence)
+			if len(segment) > 0 && segment[0] == 0 {
+				kind, segment = segmentASSet, segment[1:]
+			}
+
+			asPath = append(asPath, kind, byte(len(segment)))
+			for _, asn := range segment {
+				asPath = binary.BigEndian.AppendUint32(asPath, asn)
+			}
+		}
+
+		attributes = append(attributes, 0x50, attributeASPath)
+		attributes = binary.BigEndian.AppendUint16(attributes, uint16(len(asPath)))
+		attributes = append(attributes, asPath...)
+
+		body = binary.BigEndian.AppendUint16(body, uint16(i))
+		body = binary.BigEndian.AppendUint32(body, 1700000000)
+		if addPath {
+			body = binary.BigEndian.AppendUint32(body, uint32(i+1))
+		}
+
+		body = binary.BigEndian.AppendUint16(body, uint16(len(attributes)))
+		body = append(body, attributes...)
+	}
+
+	return mrtRecord(mrtTableDumpV2, subtype, body)
+}
+
+func testMRT() []byte {
+	var dump []byte
+	// PEER_INDEX_TABLE and a BGP4MP record, skipped
+	dump = append(dump, mrtRecord(mrtTableDumpV2, 1, []byte{192, 0, 2, 254, 0, 0, 0, 0})...)
+	dump = append(dump, mrtRecord(16, 4, []byte{1, 2, 3})...)
+	dump = append(dump, ribRecord(netip.MustParsePrefix("192.0.2.0/24"), false, [][]uint32{{64496, 64500}})...)
+	// the first route has no AS_PATH segment
+	dump = append(dump, ribRecord(netip.MustParsePrefix("198.51.100.0/22"), false, [][]uint32{}, [][]uint32{{64496, 64510, 64511}})...)
+	// ends with an AS_SET
+	dump = append(dump, ribRecord(netip.MustParsePrefix("203.0.113.0/24"), false, [][]uint32{{64496}, {0, 64520, 64521}})...)
+	dump = append(dump, ribRecord(netip.MustParsePrefix("2001:db8::/33"), true, [][]uint32{{64496, 64530}})...)
+	return dump
+}
+
+func TestReadMRT(t *testing.T) {
+	trie, err := ReadMRT(bytes.NewReader(testMRT()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trie.Len() != 4 {
+		t.Errorf("%d prefixes, want 4", trie.Len())
+	}
+
+	for addr, want := range map[string]uint32{
+		"192.0.2.1":        64500,
+		"198.51.101.1":     64511,
+		"203.0.113.1":      0,
+		"2001:db8:7fff::1": 64530,
+	} {
+		_, info, found := trie.Lookup(netip.MustParseAddr(addr))
+		if !found || info.ASN != want {
+			t.Errorf("%s: got %v %d want %d", addr, found, info.ASN, want)
+		}
+	}
+
+	if _, _, found := trie.Lookup(netip.MustParseAddr("2001:db8:8000::1")); found {
+		t.Error("2001:db8:8000::1 found")
+	}
+
+	dump := testMRT()
+	if _, err := ReadMRT(bytes.NewReader(dump[:len(dump)-3])); err != ErrMRTTruncated {
+		t.Errorf("expected ErrMRTTruncated got %v", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(testCSV))
+	gz.Close()
+	csvPath := filepath.Join(dir, "prefixes.csv.gz")
+	mrtPath := filepath.Join(dir, "rib.20240101.0000")
+	invalidPath := filepath.Join(dir, "invalid.csv")
+	for path, data := range map[string][]byte{csvPath: compressed.Bytes(), mrtPath: testMRT(), invalidPath: []byte("asn\n1\n")} {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	table := &Table{}
+	addr := netip.MustParseAddr("192.0.2.200")
+	if _, _, found := table.Lookup(addr); found {
+		t.Error("found in an empty table")
+	}
+
+	if err := table.LoadFile(csvPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, info, _ := table.Lookup(addr); info.ASN != 64501 {
+		t.Errorf("got AS%d want AS64501", info.ASN)
+	}
+
+	if err := table.LoadFile(invalidPath); err != ErrNoPrefixColumn {
+		t.Errorf("expected ErrNoPrefixColumn got %v", err)
+	}
+
+	if _, info, _ := table.Lookup(addr); info.ASN != 64501 {
+		t.Errorf("got AS%d after a failed load, want AS64501", info.ASN)
+	}
+
+	// the lookups see one table or the other while it is reloaded
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 1000 {
+			if _, info, _ := table.Lookup(addr); info.ASN != 64500 && info.ASN != 64501 {
+				t.Errorf("got AS%d", info.ASN)
+				return
+			}
+		}
+	}()
+
+	for range 10 {
+		if err := table.LoadFile(mrtPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wg.Wait()
+	if _, info, _ := table.Lookup(addr); info.ASN != 64500 || table.Load().Len() != 4 {
+		t.Errorf("got AS%d want AS64500", info.ASN)
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	trie, err := ReadCSV(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := &Table{}
+	table.Store(trie)
+	enricher := &Enricher{Table: table}
+
+	records := []flowrecord.FlowRecord{
+		// the AS number of the exporter is kept
+		{SrcAddr: netip.MustParseAddr("192.0.2.1"), DstAddr: netip.MustParseAddr("198.51.100.7"), SrcAS: 65000},
+		// so is its mask, the source is not in the table
+		{SrcAddr: netip.MustParseAddr("203.0.113.1"), DstAddr: netip.MustParseAddr("192.0.2.129"), DstMask: 16},
+		{SrcAddr: netip.MustParseAddr("2001:db8::1"), DstAddr: netip.MustParseAddr("::ffff:192.0.2.1")},
+	}
+
+	for i := range records {
+		enricher.Enrich(&records[i])
+	}
+
+	if r := records[0]; r.SrcAS != 65000 || r.SrcMask != 24 || r.DstAS != 0 || r.DstMask != 32 {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	if r := records[1]; r.SrcAS != 0 || r.SrcMask != 0 || r.DstAS != 64501 || r.DstMask != 16 {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	if r := records[2]; r.SrcAS != 64502 || r.SrcMask != 32 || r.DstAS != 64500 || r.DstMask != 24 {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	var customers []string
+	for _, r := range records {
+		customers = append(customers, r.Annotations.Src.Attributes["customer"]+">"+r.Annotations.Dst.Attributes["customer"])
+	}
+
+	// the source of the second record has no prefix, its attributes are left nil
+	if strings.Join(customers, ",") != "acme>globex,>,initech>acme" || records[1].Annotations.Src.Attributes != nil {
+		t.Errorf("unexpected annotations %v", customers)
+	}
+
+	unknown := flowrecord.FlowRecord{SrcAddr: netip.MustParseAddr("203.0.113.1"), DstAddr: netip.MustParseAddr("203.0.113.2")}
+	enricher.Enrich(&unknown)
+	if unknown.Annotations != nil {
+		t.Errorf("annotations %+v set without a prefix", unknown.Annotations)
+	}
+
+	enricher.Overwrite = true
+	enricher.Enrich(&records[0])
+	enricher.Enrich(&records[1])
+	if records[0].SrcAS != 64500 || records[1].DstMask != 25 {
+		t.Errorf("unexpected records %+v", records[:2])
+	}
+}
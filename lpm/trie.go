@@ -0,0 +1,257 @@
+// Package lpm maps IPv4 and IPv6 prefixes to metadata and finds the longest prefix matching an address.
+//
+// A Trie is built once, then published in a Table which readers look addresses up in
+// without locking while a new Trie is loaded and swapped in.
+//
+//	table := &lpm.Table{}
+//	if err := table.LoadFile("prefixes.csv"); err != nil {
+//		return err
+//	}
+//	asn := &lpm.Enricher{Table: table}
+//	handler := &flowrecord.Enricher{Enrich: asn.Enrich, Handler: aggregator}
+//	collector := flowcollector.Collector{SFlowHandler: handler, NetFlow5Handler: handler}
+package lpm
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+)
+
+// key the bits of an address or a prefix, left aligned, an IPv4 address in the upper 32 bits of hi
+type key struct {
+	hi, lo uint64
+}
+
+func keyOf(addr netip.Addr) key {
+	if addr.Is4() {
+		a := addr.As4()
+		return key{hi: uint64(binary.BigEndian.Uint32(a[:])) << 32}
+	}
+
+	a := addr.As16()
+	return key{hi: binary.BigEndian.Uint64(a[:8]), lo: binary.BigEndian.Uint64(a[8:])}
+}
+
+// bit returns the bit at position i, 0 being the most significant
+func (k key) bit(i uint8) int {
+	if i < 64 {
+		return int(k.hi>>(63-i)) & 1
+	}
+
+	return int(k.lo>>(127-i)) & 1
+}
+
+// common returns the length of the prefix shared by k and o, at most max
+func (k key) common(o key, max uint8) uint8 {
+	n := uint8(bits.LeadingZeros64(k.hi ^ o.hi))
+	if n == 64 {
+		n += uint8(bits.LeadingZeros64(k.lo ^ o.lo))
+	}
+
+	return min(n, max)
+}
+
+// masked returns k with the bits after the first n cleared
+func (k key) masked(n uint8) key {
+	switch {
+	case n == 0:
+		return key{}
+	case n < 64:
+		return key{hi: k.hi &^ (1<<(64-n) - 1)}
+	case n < 128:
+		return key{hi: k.hi, lo: k.lo &^ (1<<(128-n) - 1)}
+	}
+
+	return k
+}
+
+// node a prefix of the trie, either holding a value or branching
+type node[V any] struct {
+	key      key
+	bits     uint8
+	set      bool
+	value    V
+	children [2]*node[V]
+}
+
+// Trie a path compressed binary trie of IPv4 and IPv6 prefixes.
+// An IPv4-mapped IPv6 address is looked up as IPv4.
+// A Trie is not safe for concurrent use while it is modified, Lookup is safe once it is not.
+type Trie[V any] struct {
+	roots [2]*node[V]
+	size  int
+}
+
+// root returns the root and the address length of the family of addr
+func (t *Trie[V]) root(addr netip.Addr) (**node[V], uint8) {
+	if addr.Is4() {
+		return &t.roots[0], 32
+	}
+
+	return &t.roots[1], 128
+}
+
+// normalize returns the address and the length of prefix, an IPv4-mapped IPv6 prefix as IPv4
+func normalize(prefix netip.Prefix) (netip.Addr, uint8, bool) {
+	if !prefix.IsValid() {
+		return netip.Addr{}, 0, false
+	}
+
+	addr, length := prefix.Addr(), uint8(prefix.Bits())
+	if addr.Is4In6() {
+		if length < 96 {
+			return netip.Addr{}, 0, false
+		}
+
+		addr, length = addr.Unmap(), length-96
+	}
+
+	return addr, length, true
+}
+
+// Insert sets the value of prefix, replacing the previous one.
+// The bits of the address after the prefix length are ignored.
+// It reports false when prefix is invalid.
+func (t *Trie[V]) Insert(prefix netip.Prefix, value V) bool {
+	addr, length, ok := normalize(prefix)
+	if !ok {
+		return false
+	}
+
+	n, _ := t.root(addr)
+	k := keyOf(addr).masked(length)
+	for {
+		current := *n
+		if current == nil {
+			*n = &node[V]{key: k, bits: length, set: true, value: value}
+			t.size++
+			return true
+		}
+
+		common := k.common(current.key, min(length, current.bits))
+		if common == current.bits && common == length {
+			if !current.set {
+				t.size++
+			}
+
+			current.set, current.value = true, value
+			return true
+		}
+
+		if common == current.bits {
+			n = &current.children[k.bit(common)]
+			continue
+		}
+
+		// the new prefix and the node diverge, or the new prefix contains the node
+		split := &node[V]{key: k.masked(common), bits: common}
+		split.children[current.key.bit(common)] = current
+		if common == length {
+			split.set, split.value = true, value
+		} else {
+			split.children[k.bit(common)] = &node[V]{key: k, bits: length, set: true, value: value}
+		}
+
+		*n = split
+		t.size++
+		return true
+	}
+}
+
+// Lookup returns the longest prefix containing addr and its value
+func (t *Trie[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	addr = addr.Unmap()
+	var value V
+	if !addr.IsValid() {
+		return netip.Prefix{}, value, false
+	}
+
+	root, length := t.root(addr)
+	k := keyOf(addr)
+	var best *node[V]
+	for n := *root; n != nil; {
+		if k.common(n.key, n.bits) != n.bits {
+			break
+		}
+
+		if n.set {
+			best = n
+		}
+
+		if n.bits == length {
+			break
+		}
+
+		n = n.children[k.bit(n.bits)]
+	}
+
+	if best == nil {
+		return netip.Prefix{}, value, false
+	}
+
+	prefix, _ := addr.Prefix(int(best.bits))
+	return prefix, best.value, true
+}
+
+// Get returns the value of exactly prefix
+func (t *Trie[V]) Get(prefix netip.Prefix) (V, bool) {
+	var value V
+	addr, length, ok := normalize(prefix)
+	if !ok {
+		return value, false
+	}
+
+	root, _ := t.root(addr)
+	k := keyOf(addr).masked(length)
+	for n := *root; n != nil && n.bits <= length; n = n.children[k.bit(n.bits)] {
+		if k.common(n.key, n.bits) != n.bits {
+			break
+		}
+
+		if n.bits == length {
+			return n.value, n.set
+		}
+	}
+
+	return value, false
+}
+
+// Len returns the number of prefixes with a value
+func (t *Trie[V]) Len() int {
+	return t.size
+}
+
+// Walk calls f with every prefix and its value, the IPv4 prefixes first, a prefix before the prefixes it contains,
+// until f returns false
+func (t *Trie[V]) Walk(f func(prefix netip.Prefix, value V) bool) {
+	for family, root := range t.roots {
+		if !walk(root, family == 0, f) {
+			return
+		}
+	}
+}
+
+func walk[V any](n *node[V], is4 bool, f func(prefix netip.Prefix, value V) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	if n.set {
+		var addr netip.Addr
+		if is4 {
+			addr = netip.AddrFrom4([4]byte(binary.BigEndian.AppendUint32(nil, uint32(n.key.hi>>32))))
+		} else {
+			var a [16]byte
+			binary.BigEndian.PutUint64(a[:8], n.key.hi)
+			binary.BigEndian.PutUint64(a[8:], n.key.lo)
+			addr = netip.AddrFrom16(a)
+		}
+
+		if !f(netip.PrefixFrom(addr, int(n.bits)), n.value) {
+			return false
+		}
+	}
+
+	return walk(n.children[0], is4, f) && walk(n.children[1], is4, f)
+}
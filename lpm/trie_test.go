@@ -0,0 +1,151 @@
+package lpm
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+)
+
+func TestTrie(t *testing.T) {
+	trie := &Trie[string]{}
+	for _, s := range []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.3/32", "10.128.0.0/9", "2001:db8::/32", "2001:db8:1::/48", "::/0"} {
+		if !trie.Insert(netip.MustParsePrefix(s), s) {
+			t.Fatalf("%s not inserted", s)
+		}
+	}
+
+	if trie.Insert(netip.Prefix{}, "invalid") {
+		t.Error("invalid prefix inserted")
+	}
+
+	// replaced, not counted twice
+	trie.Insert(netip.MustParsePrefix("10.1.0.0/16"), "10.1.0.0/16")
+	if trie.Len() != 9 {
+		t.Errorf("%d prefixes, want 9", trie.Len())
+	}
+
+	for addr, want := range map[string]string{
+		"10.1.2.3":           "10.1.2.3/32",
+		"10.1.2.4":           "10.1.2.0/24",
+		"10.1.3.1":           "10.1.0.0/16",
+		"10.2.0.1":           "10.0.0.0/8",
+		"10.200.0.1":         "10.128.0.0/9",
+		"192.0.2.1":          "0.0.0.0/0",
+		"::ffff:10.1.2.3":    "10.1.2.3/32",
+		"2001:db8:1:2::1":    "2001:db8:1::/48",
+		"2001:db8:2::1":      "2001:db8::/32",
+		"2001:db9::1":        "::/0",
+		"fe80::1%eth0":       "::/0",
+		"2001:db8:1:ffff::1": "2001:db8:1::/48",
+	} {
+		prefix, value, found := trie.Lookup(netip.MustParseAddr(addr))
+		if !found || value != want {
+			t.Errorf("%s: got %v %q want %q", addr, found, value, want)
+		}
+
+		if prefix.String() != want {
+			t.Errorf("%s: got prefix %s want %s", addr, prefix, want)
+		}
+	}
+
+	if _, _, found := trie.Lookup(netip.Addr{}); found {
+		t.Error("invalid address found")
+	}
+
+	if value, found := trie.Get(netip.MustParsePrefix("::ffff:10.1.0.0/112")); !found || value != "10.1.0.0/16" {
+		t.Errorf("got %v %q", found, value)
+	}
+
+	if _, found := trie.Get(netip.MustParsePrefix("10.1.0.0/15")); found {
+		t.Error("10.1.0.0/15 found")
+	}
+
+	var walked []string
+	trie.Walk(func(prefix netip.Prefix, value string) bool {
+		if prefix.String() != value {
+			t.Errorf("walked %s with %s", prefix, value)
+		}
+
+		walked = append(walked, value)
+		return true
+	})
+
+	if len(walked) != 9 || walked[0] != "0.0.0.0/0" || walked[6] != "::/0" {
+		t.Errorf("walked %v", walked)
+	}
+}
+
+// TestTrieRandom checks the lookups against a linear scan of the prefixes
+func TestTrieRandom(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	trie := &Trie[netip.Prefix]{}
+	var prefixes []netip.Prefix
+	randomAddr := func(ipv6 bool) netip.Addr {
+		if ipv6 {
+			var a [16]byte
+			a[0], a[1] = 0x20, 0x01
+			a[2], a[3] = byte(random.IntN(4)), byte(random.IntN(256))
+			return netip.AddrFrom16(a)
+		}
+
+		return netip.AddrFrom4([4]byte{10, byte(random.IntN(4)), byte(random.IntN(256)), byte(random.IntN(256))})
+	}
+
+	for range 2000 {
+		ipv6 := random.IntN(2) == 0
+		addr := randomAddr(ipv6)
+		prefix := netip.PrefixFrom(addr, 8+random.IntN(addr.BitLen()-7)).Masked()
+		prefixes = append(prefixes, prefix)
+		trie.Insert(prefix, prefix)
+	}
+
+	for range 10000 {
+		addr := randomAddr(random.IntN(2) == 0)
+		var want netip.Prefix
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) && (!want.IsValid() || prefix.Bits() > want.Bits()) {
+				want = prefix
+			}
+		}
+
+		prefix, value, found := trie.Lookup(addr)
+		if found != want.IsValid() || value != want || prefix != want {
+			t.Fatalf("%s: got %v %s %s want %s", addr, found, prefix, value, want)
+		}
+	}
+}
+
+func TestLookupAllocations(t *testing.T) {
+	table := &Table{}
+	trie := &Trie[Info]{}
+	trie.Insert(netip.MustParsePrefix("192.0.2.0/24"), Info{ASN: 64500})
+	trie.Insert(netip.MustParsePrefix("2001:db8::/32"), Info{ASN: 64501})
+	table.Store(trie)
+	v4, v6 := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")
+	if allocations := testing.AllocsPerRun(100, func() {
+		table.Lookup(v4)
+		table.Lookup(v6)
+	}); allocations != 0 {
+		t.Errorf("%v allocations per lookup", allocations)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	random := rand.New(rand.NewPCG(1, 2))
+	trie := &Trie[Info]{}
+	for range 100000 {
+		addr := netip.AddrFrom4([4]byte{byte(random.IntN(224)), byte(random.IntN(256)), byte(random.IntN(256)), 0})
+		trie.Insert(netip.PrefixFrom(addr, 16+random.IntN(9)).Masked(), Info{ASN: random.Uint32()})
+	}
+
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom4([4]byte{byte(random.IntN(224)), byte(random.IntN(256)), byte(random.IntN(256)), byte(random.IntN(256))})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Lookup(addrs[i%len(addrs)])
+	}
+}
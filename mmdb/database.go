@@ -0,0 +1,175 @@
+package mmdb
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DatabaseConfig the configuration of a Database
+type DatabaseConfig struct {
+	// Path the MaxMind DB file.
+	// Required.
+	Path string
+	// Interval how often the file is checked for changes.
+	// Default : 1m
+	Interval time.Duration
+	// Language the language of the city names.
+	// Default : en
+	Language string
+	// CacheSize the number of decoded records cached, the least recently looked up ones are decoded again.
+	// Default : 4096
+	CacheSize int
+	// OnReload is called after every reload of the file, with the error when the previous Reader was kept.
+	// Default : nil
+	OnReload func(path string, err error)
+}
+
+// generation a Reader of the file and the Geo of its recently looked up records, replaced when the file changes.
+// The Geo are cached by record offset in recent until it holds half of the cache size,
+// recent then replaces old and the Geo looked up in neither are decoded again.
+type generation struct {
+	reader *Reader
+	lock   sync.RWMutex
+	recent map[uint]Geo
+	old    map[uint]Geo
+}
+
+// Database a MaxMind DB file, reopened when it changes.
+// The lookups of a Reader opened before the change finish on it, its memory is released once unused.
+type Database struct {
+	config  DatabaseConfig
+	current atomic.Pointer[generation]
+	reloads atomic.Uint64
+	errors  atomic.Uint64
+	lock    sync.Mutex
+	// attempted the file last opened, successfully or not
+	attempted os.FileInfo
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+var ErrNoPath = errors.New("mmdb: no database path")
+
+// NewDatabase opens config.Path and watches it for changes
+func NewDatabase(config DatabaseConfig) (*Database, error) {
+	if config.Path == "" {
+		return nil, ErrNoPath
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+
+	if config.Language == "" {
+		config.Language = "en"
+	}
+
+	if config.CacheSize <= 0 {
+		config.CacheSize = 4096
+	}
+
+	d := &Database{
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+
+	go d.watch()
+	return d, nil
+}
+
+// Reader returns the current Reader
+func (d *Database) Reader() *Reader {
+	return d.current.Load().reader
+}
+
+// Reloads returns the number of times the file was reopened after it changed
+func (d *Database) Reloads() uint64 {
+	return d.reloads.Load()
+}
+
+// Errors returns the number of times the changed file could not be opened
+func (d *Database) Errors() uint64 {
+	return d.errors.Load()
+}
+
+// Reload reopens the file, the current Reader is kept when it fails
+func (d *Database) Reload() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.reload()
+}
+
+func (d *Database) reload() error {
+	info, err := os.Stat(d.config.Path)
+	if err != nil {
+		return err
+	}
+
+	d.attempted = info
+	reader, err := Open(d.config.Path)
+	if err != nil {
+		return err
+	}
+
+	d.current.Store(&generation{reader: reader, recent: make(map[uint]Geo)})
+	return nil
+}
+
+// changed reports whether the file was replaced or modified since it was last opened.
+// A file that failed to open is not retried until it changes again.
+func (d *Database) changed() bool {
+	info, err := os.Stat(d.config.Path)
+	if err != nil {
+		// missing while it is replaced, checked again at the next interval
+		return false
+	}
+
+	return !os.SameFile(info, d.attempted) || !info.ModTime().Equal(d.attempted.ModTime()) || info.Size() != d.attempted.Size()
+}
+
+func (d *Database) watch() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		d.lock.Lock()
+		if !d.changed() {
+			d.lock.Unlock()
+			continue
+		}
+
+		err := d.reload()
+		if err != nil {
+			d.errors.Add(1)
+		} else {
+			d.reloads.Add(1)
+		}
+
+		d.lock.Unlock()
+		if d.config.OnReload != nil {
+			d.config.OnReload(d.config.Path, err)
+		}
+	}
+}
+
+// Close stops watching the file.
+// The memory of the Readers is released once they are unused.
+func (d *Database) Close() {
+	d.stopOnce.Do(func() { close(d.stop) })
+	<-d.done
+}
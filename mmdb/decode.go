@@ -0,0 +1,246 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// data types of the data section
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+
+	// maxDepth the deepest nesting of maps and arrays decoded
+	maxDepth = 64
+)
+
+// uintSizes the largest size of the unsigned integer types
+var uintSizes = [...]uint{typeUint16: 2, typeUint32: 4, typeUint64: 8}
+
+// decoder decodes the values of a data section, the offsets are relative to its start
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) errorf(offset uint, format string, args ...any) error {
+	return fmt.Errorf("mmdb: invalid data at offset %d: %s", offset, fmt.Sprintf(format, args...))
+}
+
+// control decodes the control byte and the size of the value at offset,
+// it returns the type, the size and the offset of the payload
+func (d *decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, d.errorf(offset, "out of bounds")
+	}
+
+	b := d.data[offset]
+	offset++
+	kind := int(b >> 5)
+	if kind == typeExtended {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, d.errorf(offset, "out of bounds")
+		}
+
+		kind = 7 + int(d.data[offset])
+		offset++
+		if kind <= typeMap || kind > typeFloat {
+			return 0, 0, 0, d.errorf(offset, "unknown extended type %d", kind)
+		}
+	}
+
+	size := uint(b & 0x1F)
+	if kind == typePointer || size < 29 {
+		return kind, size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, 0, d.errorf(offset, "out of bounds")
+	}
+
+	extension := uint(0)
+	for _, c := range d.data[offset : offset+n] {
+		extension = extension<<8 | uint(c)
+	}
+
+	switch n {
+	case 1:
+		size = 29 + extension
+	case 2:
+		size = 285 + extension
+	default:
+		size = 65821 + extension
+	}
+
+	return kind, size, offset + n, nil
+}
+
+// pointer decodes the pointer whose control byte had size, it returns the offset pointed to and the offset after the pointer
+func (d *decoder) pointer(size, offset uint) (uint, uint, error) {
+	n := (size>>3)&3 + 1
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, d.errorf(offset, "out of bounds")
+	}
+
+	value := uint(0)
+	if n < 4 {
+		value = size & 7
+	}
+
+	for _, c := range d.data[offset : offset+n] {
+		value = value<<8 | uint(c)
+	}
+
+	switch n {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+
+	return value, offset + n, nil
+}
+
+// decode returns the value at offset and the offset of the next value
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d *decoder) decodeDepth(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, d.errorf(offset, "nested too deep")
+	}
+
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kind == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// a pointer never points to a pointer
+		if kind, _, _, err := d.control(target); err != nil || kind == typePointer {
+			return nil, 0, d.errorf(target, "pointer to a pointer")
+		}
+
+		value, _, err := d.decodeDepth(target, depth+1)
+		return value, next, err
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			var key, value any
+			if key, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, d.errorf(offset, "map key of type %T", key)
+			}
+
+			if value, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+
+			m[name] = value
+		}
+
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			var value any
+			if value, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+
+			a = append(a, value)
+		}
+
+		return a, offset, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, d.errorf(offset, "boolean of size %d", size)
+		}
+
+		return size == 1, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, d.errorf(offset, "value of %d bytes out of bounds", size)
+	}
+
+	payload := d.data[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case typeString:
+		return string(payload), next, nil
+	case typeBytes:
+		return append([]byte(nil), payload...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, d.errorf(offset, "double of size %d", size)
+		}
+
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, d.errorf(offset, "float of size %d", size)
+		}
+
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > uintSizes[kind] {
+			return nil, 0, d.errorf(offset, "unsigned integer of size %d", size)
+		}
+
+		value := uint64(0)
+		for _, c := range payload {
+			value = value<<8 | uint64(c)
+		}
+
+		return value, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, d.errorf(offset, "int32 of size %d", size)
+		}
+
+		value := uint32(0)
+		for _, c := range payload {
+			value = value<<8 | uint32(c)
+		}
+
+		return int64(int32(value)), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, d.errorf(offset, "uint128 of size %d", size)
+		}
+
+		return new(big.Int).SetBytes(payload), next, nil
+	}
+
+	return nil, 0, d.errorf(offset, "unexpected type %d", kind)
+}
@@ -0,0 +1,146 @@
+package mmdb
+
+import (
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"sync/atomic"
+)
+
+// Geo the location and the autonomous system of an address, the fields unknown to the database are empty
+type Geo struct {
+	// Country the ISO 3166-1 code of the country, or of the registered country when unknown
+	Country string
+	// City the name of the city in the language of the Database
+	City         string
+	ASN          uint32
+	Organization string
+}
+
+// GeoOf returns the Geo of a record of the GeoIP2 and GeoLite2 country, city and ASN databases
+func GeoOf(record any, language string) Geo {
+	m, _ := record.(map[string]any)
+	field := func(value any, path ...string) any {
+		for _, key := range path {
+			object, _ := value.(map[string]any)
+			value = object[key]
+		}
+
+		return value
+	}
+
+	var geo Geo
+	geo.Country, _ = field(m, "country", "iso_code").(string)
+	if geo.Country == "" {
+		geo.Country, _ = field(m, "registered_country", "iso_code").(string)
+	}
+
+	geo.City, _ = field(m, "city", "names", language).(string)
+	geo.ASN = uint32(uintOf(m["autonomous_system_number"]))
+	geo.Organization, _ = m["autonomous_system_organization"].(string)
+	return geo
+}
+
+// Lookup returns the Geo of addr in the current Reader.
+// The Geo of the recently looked up records are cached until the file changes.
+func (d *Database) Lookup(addr netip.Addr) (Geo, bool, error) {
+	g := d.current.Load()
+	offset, _, found, err := g.reader.LookupOffset(addr)
+	if err != nil || !found {
+		return Geo{}, false, err
+	}
+
+	g.lock.RLock()
+	geo, cached := g.recent[offset]
+	g.lock.RUnlock()
+	if cached {
+		return geo, true, nil
+	}
+
+	g.lock.RLock()
+	geo, cached = g.old[offset]
+	g.lock.RUnlock()
+	if !cached {
+		record, err := g.reader.Decode(offset)
+		if err != nil {
+			return Geo{}, false, err
+		}
+
+		geo = GeoOf(record, d.config.Language)
+	}
+
+	g.cache(offset, geo, d.config.CacheSize)
+	return geo, true, nil
+}
+
+// cache keeps the Geo of the record at offset in recent, bounding the cached Geo to size
+func (g *generation) cache(offset uint, geo Geo, size int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.recent) >= max(size/2, 1) {
+		g.old = g.recent
+		g.recent = make(map[uint]Geo, len(g.old))
+	}
+
+	g.recent[offset] = geo
+}
+
+// Enricher sets the country, the city and the autonomous system of the source and destination of flows
+// from MaxMind databases. Its databases are reloaded under Enrich, which any number of workers may call.
+type Enricher struct {
+	// Databases the databases the addresses are looked up in, in order, a city and an ASN database for instance.
+	// A field is set by the first database knowing it.
+	// Required.
+	Databases []*Database
+	// Overwrite replaces the AS numbers set by the exporter and the fields set by an earlier stage.
+	// Default : false, only the zero AS numbers and the empty fields are set
+	Overwrite bool
+
+	errors atomic.Uint64
+}
+
+// Errors returns the number of lookups that failed on an invalid database
+func (e *Enricher) Errors() uint64 {
+	return e.errors.Load()
+}
+
+// Enrich sets the AS numbers of r and the Src and Dst of its Annotations from the Geo of its source and destination addresses
+func (e *Enricher) Enrich(r *flowrecord.FlowRecord) {
+	set := func(field *string, value string) {
+		if value != "" && (*field == "" || e.Overwrite) {
+			*field = value
+		}
+	}
+
+	for _, d := range e.Databases {
+		for _, side := range [...]struct {
+			addr     netip.Addr
+			as       *uint32
+			endpoint func(a *flowrecord.Annotations) *flowrecord.Endpoint
+		}{
+			{r.SrcAddr, &r.SrcAS, func(a *flowrecord.Annotations) *flowrecord.Endpoint { return &a.Src }},
+			{r.DstAddr, &r.DstAS, func(a *flowrecord.Annotations) *flowrecord.Endpoint { return &a.Dst }},
+		} {
+			geo, found, err := d.Lookup(side.addr)
+			if err != nil {
+				e.errors.Add(1)
+			}
+
+			if !found {
+				continue
+			}
+
+			if geo.ASN != 0 && (*side.as == 0 || e.Overwrite) {
+				*side.as = geo.ASN
+			}
+
+			if geo.Country == "" && geo.City == "" && geo.Organization == "" {
+				continue
+			}
+
+			endpoint := side.endpoint(r.Annotate())
+			set(&endpoint.Country, geo.Country)
+			set(&endpoint.City, geo.City)
+			set(&endpoint.ASOrg, geo.Organization)
+		}
+	}
+}
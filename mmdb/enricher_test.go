@@ -0,0 +1,185 @@
+package mmdb
+
+import (
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeDatabase replaces the file at path as the database updaters do, writing a new file and renaming it
+func writeDatabase(t *testing.T, path string, data []byte) {
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func asnDatabase(asn uint32, organization string) []byte {
+	return buildDatabase(6, 28, []testNetwork{
+		{"81.2.69.0/24", map[string]any{"autonomous_system_number": asn, "autonomous_system_organization": organization}},
+		{"2001:db8::/32", map[string]any{"autonomous_system_number": uint32(64501), "autonomous_system_organization": "Example DE"}},
+	}, 0)
+}
+
+func TestDatabaseReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	writeDatabase(t, path, asnDatabase(64500, "Example"))
+	reloaded := make(chan error, 10)
+	d, err := NewDatabase(DatabaseConfig{
+		Path:     path,
+		Interval: 5 * time.Millisecond,
+		OnReload: func(_ string, err error) { reloaded <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	addr := netip.MustParseAddr("81.2.69.1")
+	if geo, found, err := d.Lookup(addr); err != nil || !found || geo.ASN != 64500 || geo.Organization != "Example" {
+		t.Fatalf("got %v %+v %v", found, geo, err)
+	}
+
+	old := d.Reader()
+	writeDatabase(t, path, asnDatabase(64510, "Renamed"))
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reloaded")
+	}
+
+	if geo, _, _ := d.Lookup(addr); geo.ASN != 64510 || geo.Organization != "Renamed" || d.Reloads() != 1 {
+		t.Errorf("got %+v after %d reloads", geo, d.Reloads())
+	}
+
+	// a lookup started before the reload finishes on the previous file
+	if record, _, err := old.Lookup(addr); err != nil || GeoOf(record, "en").ASN != 64500 {
+		t.Errorf("got %v %v on the previous reader", record, err)
+	}
+
+	writeDatabase(t, path, []byte("not a database"))
+	select {
+	case err := <-reloaded:
+		if err == nil {
+			t.Fatal("invalid database loaded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reloaded")
+	}
+
+	if geo, _, _ := d.Lookup(addr); geo.ASN != 64510 || d.Errors() == 0 {
+		t.Errorf("got %+v after %d errors", geo, d.Errors())
+	}
+
+	if _, err := NewDatabase(DatabaseConfig{}); err != ErrNoPath {
+		t.Errorf("expected ErrNoPath got %v", err)
+	}
+
+	if _, err := NewDatabase(DatabaseConfig{Path: filepath.Join(t.TempDir(), "missing.mmdb")}); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file got %v", err)
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	dir := t.TempDir()
+	var databases []*Database
+	for name, data := range map[string][]byte{
+		"city.mmdb": buildDatabase(6, 24, slices.Clone(testCities), 0),
+		"asn.mmdb":  asnDatabase(64500, "Example"),
+	} {
+		path := filepath.Join(dir, name)
+		writeDatabase(t, path, data)
+		d, err := NewDatabase(DatabaseConfig{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		databases = append(databases, d)
+	}
+
+	// the city database knows the countries and the cities, the ASN database the autonomous systems
+	enricher := &Enricher{Databases: databases}
+	records := []flowrecord.FlowRecord{
+		{SrcAddr: netip.MustParseAddr("81.2.69.170"), DstAddr: netip.MustParseAddr("10.0.0.1"), SrcAS: 65000},
+		{SrcAddr: netip.MustParseAddr("10.0.0.1"), DstAddr: netip.MustParseAddr("81.2.69.1")},
+	}
+
+	for i := range records {
+		enricher.Enrich(&records[i])
+	}
+
+	if r := records[0]; r.Annotations.Src.Country != "GB" || r.Annotations.Src.City != "Kraków \"Old Town\"" ||
+		r.Annotations.Src.ASOrg != "Example" || r.SrcAS != 65000 || r.Annotations.Dst.Country != "" || r.DstAS != 0 {
+		t.Errorf("unexpected record %+v %+v", r, r.Annotations)
+	}
+
+	if r := records[1]; r.Annotations.Dst.Country != "GB" || r.Annotations.Dst.City != "London" || r.DstAS != 64500 ||
+		r.Annotations.Src.Country != "" {
+		t.Errorf("unexpected record %+v %+v", r, r.Annotations)
+	}
+
+	// the addresses unknown to the databases are not annotated
+	unknown := flowrecord.FlowRecord{SrcAddr: netip.MustParseAddr("10.0.0.1"), DstAddr: netip.MustParseAddr("10.0.0.2")}
+	enricher.Enrich(&unknown)
+	if unknown.Annotations != nil {
+		t.Errorf("unexpected annotations %+v", unknown.Annotations)
+	}
+
+	enricher.Overwrite = true
+	r := flowrecord.FlowRecord{
+		SrcAddr:     netip.MustParseAddr("2001:db8:1::1"),
+		DstAddr:     netip.MustParseAddr("::ffff:81.2.69.1"),
+		SrcAS:       1,
+		Annotations: &flowrecord.Annotations{Src: flowrecord.Endpoint{Country: "XX"}},
+	}
+	enricher.Enrich(&r)
+	if src := r.Annotations.Src; src.Country != "FR" || src.City != "" || src.ASOrg != "Example DE" || r.SrcAS != 64501 ||
+		r.Annotations.Dst.City != "London" {
+		t.Errorf("unexpected record %+v %+v", r, r.Annotations)
+	}
+
+	if enricher.Errors() != 0 {
+		t.Errorf("%d errors", enricher.Errors())
+	}
+}
+
+func TestDatabaseCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, buildDatabase(6, 24, slices.Clone(testCities), 0))
+	d, err := NewDatabase(DatabaseConfig{Path: path, CacheSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for range 3 {
+		for addr, city := range map[string]string{
+			"81.2.69.1":     "London",
+			"81.2.69.170":   "Kraków \"Old Town\"",
+			"2001:db8::1":   "Berlin",
+			"2001:db8:1::1": "",
+		} {
+			if geo, found, err := d.Lookup(netip.MustParseAddr(addr)); err != nil || !found || geo.City != city {
+				t.Fatalf("%s: got %v %+v %v", addr, found, geo, err)
+			}
+		}
+	}
+
+	// the records looked up are cached, but no more than the CacheSize
+	g := d.current.Load()
+	if len(g.recent) == 0 || len(g.recent)+len(g.old) > 2 {
+		t.Errorf("%d recent and %d old cached records", len(g.recent), len(g.old))
+	}
+}
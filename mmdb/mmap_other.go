@@ -0,0 +1,18 @@
+//go:build !unix
+
+package mmdb
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads file in memory where mapping it is not supported
+func mmap(file *os.File) ([]byte, func([]byte) error, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, nil, nil
+}
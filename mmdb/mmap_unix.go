@@ -0,0 +1,33 @@
+//go:build unix
+
+package mmdb
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmap maps file in memory read only
+func mmap(file *os.File) ([]byte, func([]byte) error, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return nil, nil, ErrNoMetadata
+	}
+
+	if int64(int(size)) != size {
+		return nil, nil, errors.New("mmdb: file too large to be mapped")
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, syscall.Munmap, nil
+}
@@ -0,0 +1,285 @@
+// Package mmdb reads MaxMind DB files, the GeoIP2 and GeoLite2 country, city and ASN databases among others,
+// and enriches flows with the country, the city and the autonomous system of their addresses.
+//
+// The files are memory-mapped on Unix and read in memory elsewhere, a Database reopens its file when it changes.
+//
+//	city, err := mmdb.NewDatabase(mmdb.DatabaseConfig{Path: "GeoLite2-City.mmdb"})
+//	asn, err := mmdb.NewDatabase(mmdb.DatabaseConfig{Path: "GeoLite2-ASN.mmdb"})
+//	geo := &mmdb.Enricher{Databases: []*mmdb.Database{city, asn}}
+//	handler := &flowrecord.Enricher{Enrich: geo.Enrich, Handler: sink}
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// metadataMarker precedes the metadata section at the end of the file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// metadataMaxSize the metadata section is searched in the last 128KiB of the file
+const metadataMaxSize = 128 << 10
+
+var (
+	ErrNoMetadata      = errors.New("mmdb: metadata section not found")
+	ErrIPv6InIPv4      = errors.New("mmdb: IPv6 address looked up in an IPv4 database")
+	ErrInvalidDatabase = errors.New("mmdb: invalid search tree")
+)
+
+// Metadata the description of a database
+type Metadata struct {
+	NodeCount                uint
+	RecordSize               uint
+	IPVersion                uint
+	DatabaseType             string
+	Languages                []string
+	BinaryFormatMajorVersion uint
+	BinaryFormatMinorVersion uint
+	BuildEpoch               uint64
+	Description              map[string]string
+}
+
+// Reader looks addresses up in a MaxMind DB.
+// It is safe for concurrent use.
+type Reader struct {
+	Metadata Metadata
+	tree     []byte
+	decoder  decoder
+	// nodeSize the size of a node of the search tree in bytes
+	nodeSize uint
+	// ipv4Start the node IPv4 addresses are looked up from in an IPv6 database and its depth
+	ipv4Start uint
+	ipv4Depth int
+	mapping   *mapping
+}
+
+// mapping the memory holding a database
+type mapping struct {
+	data  []byte
+	once  sync.Once
+	unmap func([]byte) error
+	err   error
+}
+
+func (m *mapping) close() error {
+	m.once.Do(func() {
+		if m.unmap != nil {
+			m.err = m.unmap(m.data)
+		}
+	})
+
+	return m.err
+}
+
+// Open memory-maps a MaxMind DB file.
+// The file must be replaced by renaming a new file over it, never rewritten in place.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, unmap, err := mmap(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mapping{data: data, unmap: unmap}
+	r, err := newReader(data, m)
+	if err != nil {
+		m.close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// the memory is released once the Reader is unreachable, unless closed before
+	runtime.AddCleanup(r, func(m *mapping) { m.close() }, m)
+	return r, nil
+}
+
+// FromBytes returns a Reader of the MaxMind DB in data, which must not be modified afterwards
+func FromBytes(data []byte) (*Reader, error) {
+	return newReader(data, &mapping{data: data})
+}
+
+func newReader(data []byte, m *mapping) (*Reader, error) {
+	start := max(0, len(data)-metadataMaxSize)
+	index := bytes.LastIndex(data[start:], metadataMarker)
+	if index < 0 {
+		return nil, ErrNoMetadata
+	}
+
+	metadataStart := uint(start + index + len(metadataMarker))
+	metadata, err := decodeMetadata(data[metadataStart:])
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.BinaryFormatMajorVersion != 2 {
+		return nil, fmt.Errorf("mmdb: unsupported binary format version %d", metadata.BinaryFormatMajorVersion)
+	}
+
+	switch metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", metadata.RecordSize)
+	}
+
+	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("mmdb: unsupported IP version %d", metadata.IPVersion)
+	}
+
+	r := &Reader{Metadata: metadata, nodeSize: metadata.RecordSize / 4, mapping: m}
+	treeSize := metadata.NodeCount * r.nodeSize
+	// the search tree, 16 zero bytes, the data section and the metadata
+	if treeSize+16 > uint(start+index) {
+		return nil, ErrInvalidDatabase
+	}
+
+	r.tree = data[:treeSize]
+	r.decoder = decoder{data: data[treeSize+16 : uint(start+index)]}
+	if metadata.IPVersion == 6 {
+		for r.ipv4Depth < 96 && r.ipv4Start < metadata.NodeCount {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+			r.ipv4Depth++
+		}
+	}
+
+	return r, nil
+}
+
+func decodeMetadata(data []byte) (Metadata, error) {
+	d := decoder{data: data}
+	value, _, err := d.decode(0)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	m, ok := value.(map[string]any)
+	if !ok {
+		return Metadata{}, fmt.Errorf("mmdb: metadata of type %T", value)
+	}
+
+	metadata := Metadata{
+		NodeCount:                uint(uintOf(m["node_count"])),
+		RecordSize:               uint(uintOf(m["record_size"])),
+		IPVersion:                uint(uintOf(m["ip_version"])),
+		BinaryFormatMajorVersion: uint(uintOf(m["binary_format_major_version"])),
+		BinaryFormatMinorVersion: uint(uintOf(m["binary_format_minor_version"])),
+		BuildEpoch:               uintOf(m["build_epoch"]),
+	}
+
+	metadata.DatabaseType, _ = m["database_type"].(string)
+	if languages, ok := m["languages"].([]any); ok {
+		for _, language := range languages {
+			if s, ok := language.(string); ok {
+				metadata.Languages = append(metadata.Languages, s)
+			}
+		}
+	}
+
+	if description, ok := m["description"].(map[string]any); ok {
+		metadata.Description = make(map[string]string, len(description))
+		for language, text := range description {
+			metadata.Description[language], _ = text.(string)
+		}
+	}
+
+	return metadata, nil
+}
+
+func uintOf(value any) uint64 {
+	v, _ := value.(uint64)
+	return v
+}
+
+// Close releases the memory of the database, the Reader must not be used afterwards
+func (r *Reader) Close() error {
+	return r.mapping.close()
+}
+
+// record returns the left or the right record of a node
+func (r *Reader) record(node uint, right int) uint {
+	b := r.tree[node*r.nodeSize : (node+1)*r.nodeSize]
+	switch r.Metadata.RecordSize {
+	case 24:
+		b = b[3*right:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if right == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+
+	return uint(binary.BigEndian.Uint32(b[4*right:]))
+}
+
+// LookupOffset returns the offset of the record of addr in the data section and the network of the record.
+// It reports false when the database has no record for addr, the network is then the one without record.
+// Addresses sharing a record have the same offset, it can be used as a cache key.
+func (r *Reader) LookupOffset(addr netip.Addr) (uint, netip.Prefix, bool, error) {
+	// the cleanup of an unreachable Reader unmaps the tree being walked
+	defer runtime.KeepAlive(r)
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return 0, netip.Prefix{}, false, nil
+	}
+
+	node, depth, length := uint(0), 0, 128
+	if addr.Is4() {
+		node, length = r.ipv4Start, 32
+	} else if r.Metadata.IPVersion == 4 {
+		return 0, netip.Prefix{}, false, ErrIPv6InIPv4
+	}
+
+	a := addr.As16()
+	bits := a[16-length/8:]
+	nodeCount := r.Metadata.NodeCount
+	for ; depth < length && node < nodeCount; depth++ {
+		node = r.record(node, int(bits[depth/8]>>(7-depth%8))&1)
+	}
+
+	prefix, _ := addr.Prefix(depth)
+	switch {
+	case node == nodeCount:
+		return 0, prefix, false, nil
+	case node < nodeCount:
+		return 0, netip.Prefix{}, false, ErrInvalidDatabase
+	}
+
+	offset := node - nodeCount - 16
+	if offset >= uint(len(r.decoder.data)) {
+		return 0, netip.Prefix{}, false, ErrInvalidDatabase
+	}
+
+	return offset, prefix, true, nil
+}
+
+// Lookup returns the record of addr, decoded as the maps, arrays, strings, numbers, booleans and bytes
+// of the data section, nil when the database has no record for addr, and the network of the record.
+// The unsigned integers are uint64, except uint128 which are *big.Int, and the signed ones are int64.
+func (r *Reader) Lookup(addr netip.Addr) (any, netip.Prefix, error) {
+	offset, prefix, found, err := r.LookupOffset(addr)
+	if err != nil || !found {
+		return nil, prefix, err
+	}
+
+	value, err := r.Decode(offset)
+	runtime.KeepAlive(r)
+	return value, prefix, err
+}
+
+// Decode returns the value at offset in the data section, as returned by LookupOffset
+func (r *Reader) Decode(offset uint) (any, error) {
+	value, _, err := r.decoder.decode(offset)
+	runtime.KeepAlive(r)
+	return value, err
+}
@@ -0,0 +1,406 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"github.com/go-test/deep"
+	"maps"
+	"math"
+	"math/big"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testWriter encodes values of the data section, the map keys are written once and then pointed to
+type testWriter struct {
+	data []byte
+	keys map[string]uint
+}
+
+func (w *testWriter) control(kind int, size int) {
+	first := byte(0)
+	if kind < 8 {
+		first = byte(kind) << 5
+	}
+
+	var extension []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		extension = []byte{byte(size - 29)}
+	case size < 65821:
+		first |= 30
+		extension = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		first |= 31
+		size -= 65821
+		extension = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+
+	w.data = append(w.data, first)
+	if kind >= 8 {
+		w.data = append(w.data, byte(kind-7))
+	}
+
+	w.data = append(w.data, extension...)
+}
+
+func (w *testWriter) pointer(offset uint) {
+	switch {
+	case offset < 2048:
+		w.data = append(w.data, typePointer<<5|byte(offset>>8), byte(offset))
+	case offset < 526336:
+		offset -= 2048
+		w.data = append(w.data, typePointer<<5|1<<3|byte(offset>>16), byte(offset>>8), byte(offset))
+	default:
+		w.data = append(w.data, typePointer<<5|3<<3)
+		w.data = binary.BigEndian.AppendUint32(w.data, uint32(offset))
+	}
+}
+
+func (w *testWriter) uint(kind int, v uint64) {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+
+	w.control(kind, len(b))
+	w.data = append(w.data, b...)
+}
+
+// encode appends v and returns its offset
+func (w *testWriter) encode(v any) uint {
+	offset := uint(len(w.data))
+	switch v := v.(type) {
+	case string:
+		w.control(typeString, len(v))
+		w.data = append(w.data, v...)
+	case []byte:
+		w.control(typeBytes, len(v))
+		w.data = append(w.data, v...)
+	case float64:
+		w.control(typeDouble, 8)
+		w.data = binary.BigEndian.AppendUint64(w.data, math.Float64bits(v))
+	case float32:
+		w.control(typeFloat, 4)
+		w.data = binary.BigEndian.AppendUint32(w.data, math.Float32bits(v))
+	case uint16:
+		w.uint(typeUint16, uint64(v))
+	case uint32:
+		w.uint(typeUint32, uint64(v))
+	case uint64:
+		w.uint(typeUint64, v)
+	case int32:
+		w.control(typeInt32, 4)
+		w.data = binary.BigEndian.AppendUint32(w.data, uint32(v))
+	case *big.Int:
+		w.control(typeUint128, len(v.Bytes()))
+		w.data = append(w.data, v.Bytes()...)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+
+		w.control(typeBool, size)
+	case []any:
+		w.control(typeArray, len(v))
+		for _, item := range v {
+			w.encode(item)
+		}
+	case map[string]any:
+		w.control(typeMap, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if offset, found := w.keys[key]; found {
+				w.pointer(offset)
+			} else {
+				w.keys[key] = w.encode(key)
+			}
+
+			w.encode(v[key])
+		}
+	default:
+		panic(v)
+	}
+
+	return offset
+}
+
+// testNode a node of the search tree, a child is a *testNode, the offset of a record or nil
+type testNode struct {
+	children [2]any
+}
+
+// testNetwork a network of a test database and its record
+type testNetwork struct {
+	prefix string
+	record map[string]any
+}
+
+// buildDatabase returns a MaxMind DB of networks, the IPv4 networks of an IPv6 database are under ::/96
+func buildDatabase(ipVersion, recordSize int, networks []testNetwork, padding int) []byte {
+	w := &testWriter{keys: make(map[string]uint)}
+	if padding > 0 {
+		// pushes the records and the keys after the short pointers and sizes
+		w.encode(strings.Repeat("x", padding))
+	}
+
+	root := &testNode{}
+	slices.SortStableFunc(networks, func(a, b testNetwork) int {
+		return netip.MustParsePrefix(a.prefix).Bits() - netip.MustParsePrefix(b.prefix).Bits()
+	})
+
+	for _, network := range networks {
+		prefix := netip.MustParsePrefix(network.prefix)
+		offset := w.encode(network.record)
+		a := prefix.Addr().As16()
+		bits := prefix.Bits()
+		if prefix.Addr().Is4() {
+			a = [16]byte{}
+			a4 := prefix.Addr().As4()
+			if ipVersion == 6 {
+				copy(a[12:], a4[:])
+				bits += 96
+			} else {
+				copy(a[:], a4[:])
+			}
+		}
+
+		n := root
+		for depth := range bits {
+			bit := int(a[depth/8]>>(7-depth%8)) & 1
+			if depth == bits-1 {
+				n.children[bit] = offset
+				break
+			}
+
+			switch child := n.children[bit].(type) {
+			case *testNode:
+				n = child
+			case uint:
+				next := &testNode{children: [2]any{child, child}}
+				n.children[bit], n = next, next
+			default:
+				next := &testNode{}
+				n.children[bit], n = next, next
+			}
+		}
+	}
+
+	// the nodes numbered breadth first
+	nodes := []*testNode{root}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if node, ok := child.(*testNode); ok {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+
+	index := make(map[*testNode]int, len(nodes))
+	for i, node := range nodes {
+		index[node] = i
+	}
+
+	var tree []byte
+	for _, node := range nodes {
+		var records [2]uint32
+		for i, child := range node.children {
+			switch child := child.(type) {
+			case *testNode:
+				records[i] = uint32(index[child])
+			case uint:
+				records[i] = uint32(len(nodes) + 16 + int(child))
+			default:
+				records[i] = uint32(len(nodes))
+			}
+		}
+
+		switch recordSize {
+		case 24:
+			for _, record := range records {
+				tree = append(tree, byte(record>>16), byte(record>>8), byte(record))
+			}
+		case 28:
+			tree = append(tree, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]),
+				byte(records[0]>>20)&0xF0|byte(records[1]>>24)&0x0F,
+				byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, records[0])
+			tree = binary.BigEndian.AppendUint32(tree, records[1])
+		}
+	}
+
+	metadata := &testWriter{keys: make(map[string]uint)}
+	metadata.encode(map[string]any{
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(ipVersion),
+		"database_type":               "Test-City",
+		"languages":                   []any{"en", "fr"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"description":                 map[string]any{"en": "Test database"},
+	})
+
+	file := append(tree, make([]byte, 16)...)
+	file = append(file, w.data...)
+	file = append(file, metadataMarker...)
+	return append(file, metadata.data...)
+}
+
+func cityRecord(country, city string) map[string]any {
+	return map[string]any{
+		"country": map[string]any{"iso_code": country, "geoname_id": uint32(2635167)},
+		"city":    map[string]any{"names": map[string]any{"en": city, "fr": city + " (fr)"}},
+		"location": map[string]any{
+			"latitude":        51.5142,
+			"longitude":       -0.0931,
+			"accuracy_radius": uint16(100),
+		},
+	}
+}
+
+var testCities = []testNetwork{
+	{"81.2.69.0/24", cityRecord("GB", "London")},
+	{"81.2.69.160/27", cityRecord("GB", "Kraków \"Old Town\"")},
+	{"2001:db8::/32", cityRecord("DE", "Berlin")},
+	{"2001:db8:1::/48", map[string]any{"registered_country": map[string]any{"iso_code": "FR"}}},
+}
+
+func TestReader(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, padding := range []int{0, 70000} {
+			r, err := FromBytes(buildDatabase(6, recordSize, slices.Clone(testCities), padding))
+			if err != nil {
+				t.Fatalf("record size %d: %v", recordSize, err)
+			}
+
+			if r.Metadata.RecordSize != uint(recordSize) || r.Metadata.IPVersion != 6 || r.Metadata.DatabaseType != "Test-City" ||
+				r.Metadata.BuildEpoch != 1700000000 || !slices.Equal(r.Metadata.Languages, []string{"en", "fr"}) ||
+				r.Metadata.Description["en"] != "Test database" {
+				t.Errorf("unexpected metadata %+v", r.Metadata)
+			}
+
+			for addr, want := range map[string]struct {
+				prefix string
+				geo    Geo
+			}{
+				"81.2.69.1":          {"81.2.69.0/25", Geo{Country: "GB", City: "London"}},
+				"81.2.69.200":        {"81.2.69.192/26", Geo{Country: "GB", City: "London"}},
+				"81.2.69.170":        {"81.2.69.160/27", Geo{Country: "GB", City: "Kraków \"Old Town\""}},
+				"::ffff:81.2.69.171": {"81.2.69.160/27", Geo{Country: "GB", City: "Kraków \"Old Town\""}},
+				"2001:db8:2::1":      {"2001:db8:2::/47", Geo{Country: "DE", City: "Berlin"}},
+				"2001:db8:1::1":      {"2001:db8:1::/48", Geo{Country: "FR"}},
+			} {
+				record, prefix, err := r.Lookup(netip.MustParseAddr(addr))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if geo := GeoOf(record, "en"); prefix.String() != want.prefix || geo != want.geo {
+					t.Errorf("record size %d, %s: got %s %+v want %s %+v", recordSize, addr, prefix, geo, want.prefix, want.geo)
+				}
+			}
+
+			for addr, want := range map[string]string{"81.2.70.1": "81.2.70.0/23", "2001:db9::1": "2001:db9::/32", "10.0.0.1": "0.0.0.0/2"} {
+				record, prefix, err := r.Lookup(netip.MustParseAddr(addr))
+				if err != nil || record != nil || prefix.String() != want {
+					t.Errorf("%s: got %v %s %v want no record in %s", addr, record, prefix, err, want)
+				}
+			}
+		}
+	}
+}
+
+func TestReaderIPv4(t *testing.T) {
+	r, err := FromBytes(buildDatabase(4, 24, []testNetwork{{"192.0.2.0/24", map[string]any{"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example"}}}, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, prefix, err := r.Lookup(netip.MustParseAddr("192.0.2.1"))
+	if err != nil || prefix.String() != "192.0.2.0/24" || GeoOf(record, "en") != (Geo{ASN: 64500, Organization: "Example"}) {
+		t.Errorf("got %v %s %v", record, prefix, err)
+	}
+
+	if _, _, err := r.Lookup(netip.MustParseAddr("2001:db8::1")); err != ErrIPv6InIPv4 {
+		t.Errorf("expected ErrIPv6InIPv4 got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	record := map[string]any{
+		"string":  "ünïcode",
+		"long":    strings.Repeat("long", 100),
+		"bytes":   []byte{1, 2, 3},
+		"double":  3.14,
+		"float":   float32(1.5),
+		"uint16":  uint16(65535),
+		"uint32":  uint32(1 << 31),
+		"uint64":  uint64(1 << 63),
+		"uint128": new(big.Int).Lsh(big.NewInt(1), 100),
+		"int32":   int32(-42),
+		"true":    true,
+		"false":   false,
+		"array":   []any{uint32(1), "two", map[string]any{"string": "nested key pointer"}},
+		"empty":   map[string]any{},
+	}
+
+	r, err := FromBytes(buildDatabase(6, 24, []testNetwork{{"::/1", record}}, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := r.Lookup(netip.MustParseAddr("::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"string":  "ünïcode",
+		"long":    strings.Repeat("long", 100),
+		"bytes":   []byte{1, 2, 3},
+		"double":  3.14,
+		"float":   float32(1.5),
+		"uint16":  uint64(65535),
+		"uint32":  uint64(1 << 31),
+		"uint64":  uint64(1 << 63),
+		"uint128": new(big.Int).Lsh(big.NewInt(1), 100),
+		"int32":   int64(-42),
+		"true":    true,
+		"false":   false,
+		"array":   []any{uint64(1), "two", map[string]any{"string": "nested key pointer"}},
+		"empty":   map[string]any{},
+	}
+
+	if diff := deep.Equal(got, any(want)); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	data := buildDatabase(6, 24, slices.Clone(testCities), 0)
+	if _, err := FromBytes(data[:100]); err != ErrNoMetadata {
+		t.Errorf("expected ErrNoMetadata got %v", err)
+	}
+
+	index := strings.LastIndex(string(data), string(metadataMarker))
+	if _, err := FromBytes(data[index:]); err != ErrInvalidDatabase {
+		t.Errorf("expected ErrInvalidDatabase got %v", err)
+	}
+
+	d := decoder{data: []byte{typeMap<<5 | 1, typePointer << 5, 0}}
+	if _, _, err := d.decode(0); err == nil {
+		t.Error("expected a pointer to a pointer to fail")
+	}
+
+	d = decoder{data: []byte{typeString<<5 | 10, 'a'}}
+	if _, _, err := d.decode(0); err == nil || !strings.Contains(err.Error(), "out of bounds") {
+		t.Errorf("expected out of bounds got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/wwicak/go-utils/aggregator"
+	"github.com/wwicak/go-utils/flowrecord"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const timeFormat = "2006-01-02 15:04:05.000"
+
+// printer prints flows and reports in an output format
+type printer interface {
+	printFlow(r *flowrecord.FlowRecord)
+	printReport(fields aggregator.Field, entries []aggregator.Entry, first, last time.Time)
+	flush()
+}
+
+func newPrinter(format string, w io.Writer, utc bool) (printer, error) {
+	location := time.Local
+	if utc {
+		location = time.UTC
+	}
+
+	out := bufio.NewWriter(w)
+	switch format {
+	case "line", "long":
+		return &textPrinter{out: out, long: format == "long", location: location}, nil
+	case "csv":
+		return &csvPrinter{out: out, w: csv.NewWriter(out), location: location}, nil
+	case "json":
+		return &jsonPrinter{out: out, encoder: json.NewEncoder(out), location: location}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func protoName(proto uint8) string {
+	switch proto {
+	case 1:
+		return "ICMP"
+	case 6:
+		return "TCP"
+	case 17:
+		return "UDP"
+	}
+
+	return strconv.Itoa(int(proto))
+}
+
+// tcpFlags the TCP flags as UAPRSF, a dot for the flags not set
+func tcpFlags(flags uint8) string {
+	const names = "UAPRSF"
+	b := []byte("......")
+	for i := range names {
+		if flags&(0x20>>i) != 0 {
+			b[i] = names[i]
+		}
+	}
+
+	return string(b)
+}
+
+func endpoint(addr netip.Addr, port uint16) string {
+	return netip.AddrPortFrom(addr, port).String()
+}
+
+// keyColumns the names and values of the grouped fields of a key
+func keyColumns(fields aggregator.Field, k *aggregator.Key) (names, values []string) {
+	add := func(field aggregator.Field, name string, value func() string) {
+		if fields&field != 0 {
+			names = append(names, name)
+			values = append(values, value())
+		}
+	}
+
+	add(aggregator.Exporter, "exporter", k.Exporter.String)
+	add(aggregator.SrcAddr, "src_addr", k.SrcAddr.String)
+	add(aggregator.DstAddr, "dst_addr", k.DstAddr.String)
+	add(aggregator.SrcPort, "src_port", func() string { return strconv.Itoa(int(k.SrcPort)) })
+	add(aggregator.DstPort, "dst_port", func() string { return strconv.Itoa(int(k.DstPort)) })
+	add(aggregator.Proto, "proto", func() string { return protoName(k.Proto) })
+	add(aggregator.ToS, "tos", func() string { return strconv.Itoa(int(k.ToS)) })
+	add(aggregator.SrcAS, "src_as", func() string { return strconv.FormatUint(uint64(k.SrcAS), 10) })
+	add(aggregator.DstAS, "dst_as", func() string { return strconv.FormatUint(uint64(k.DstAS), 10) })
+	add(aggregator.InIf, "in_if", func() string { return strconv.FormatUint(uint64(k.InIf), 10) })
+	add(aggregator.OutIf, "out_if", func() string { return strconv.FormatUint(uint64(k.OutIf), 10) })
+	return names, values
+}
+
+// textPrinter prints aligned columns like nfdump
+type textPrinter struct {
+	out      *bufio.Writer
+	long     bool
+	location *time.Location
+	header   bool
+}
+
+func (p *textPrinter) printFlow(r *flowrecord.FlowRecord) {
+	if !p.header {
+		p.header = true
+		fmt.Fprintf(p.out, "%-23s %9s %-5s %21s    %-21s %8s %10s", "Date first seen", "Duration", "Proto", "Src IP Addr:Port", "Dst IP Addr:Port", "Packets", "Bytes")
+		if p.long {
+			fmt.Fprintf(p.out, " %-6s %3s %5s %5s %6s %6s %4s %4s %-15s %-15s %5s", "Flags", "Tos", "In", "Out", "SrcAS", "DstAS", "SMk", "DMk", "Next Hop", "Exporter", "Rate")
+		}
+		fmt.Fprintln(p.out)
+	}
+
+	fmt.Fprintf(p.out, "%-23s %9.3f %-5s %21s -> %-21s %8d %10d",
+		r.Start.In(p.location).Format(timeFormat), r.Duration().Seconds(), protoName(r.Proto),
+		endpoint(r.SrcAddr, r.SrcPort), endpoint(r.DstAddr, r.DstPort), r.ScaledPackets(), r.ScaledBytes())
+	if p.long {
+		fmt.Fprintf(p.out, " %-6s %3d %5d %5d %6d %6d %4d %4d %-15s %-15s %5d",
+			tcpFlags(r.TCPFlags), r.ToS, r.InIf, r.OutIf, r.SrcAS, r.DstAS, r.SrcMask, r.DstMask, r.NextHop, r.Exporter, r.Rate())
+	}
+	fmt.Fprintln(p.out)
+}
+
+func (p *textPrinter) printReport(fields aggregator.Field, entries []aggregator.Entry, first, last time.Time) {
+	if !first.IsZero() {
+		fmt.Fprintf(p.out, "Top %d by %s, %s - %s\n", len(entries), fields, first.In(p.location).Format(timeFormat), last.In(p.location).Format(timeFormat))
+	}
+
+	tw := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	names, _ := keyColumns(fields, &aggregator.Key{})
+	fmt.Fprintf(tw, "%s\tflows\tpackets\tbytes\t\n", strings.Join(names, "\t"))
+	for i := range entries {
+		_, values := keyColumns(fields, &entries[i].Key)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", strings.Join(values, "\t"), entries[i].Flows, entries[i].Packets, entries[i].Bytes)
+	}
+
+	tw.Flush()
+}
+
+func (p *textPrinter) flush() {
+	p.out.Flush()
+}
+
+// csvPrinter prints a CSV header followed by a row per flow or entry
+type csvPrinter struct {
+	out      *bufio.Writer
+	w        *csv.Writer
+	location *time.Location
+	header   bool
+}
+
+var csvColumns = []string{"start", "end", "duration", "exporter", "proto", "src_addr", "src_port", "dst_addr", "dst_port",
+	"packets", "bytes", "tcp_flags", "tos", "in_if", "out_if", "src_as", "dst_as", "src_mask", "dst_mask", "next_hop", "sampling_rate"}
+
+func (p *csvPrinter) printFlow(r *flowrecord.FlowRecord) {
+	if !p.header {
+		p.header = true
+		p.w.Write(csvColumns)
+	}
+
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	p.w.Write([]string{
+		r.Start.In(p.location).Format(time.RFC3339Nano), r.End.In(p.location).Format(time.RFC3339Nano),
+		strconv.FormatFloat(r.Duration().Seconds(), 'f', 3, 64), r.Exporter.String(), strconv.Itoa(int(r.Proto)),
+		r.SrcAddr.String(), u(uint64(r.SrcPort)), r.DstAddr.String(), u(uint64(r.DstPort)),
+		u(r.ScaledPackets()), u(r.ScaledBytes()), u(uint64(r.TCPFlags)), u(uint64(r.ToS)), u(uint64(r.InIf)), u(uint64(r.OutIf)),
+		u(uint64(r.SrcAS)), u(uint64(r.DstAS)), u(uint64(r.SrcMask)), u(uint64(r.DstMask)), r.NextHop.String(), u(r.Rate()),
+	})
+}
+
+func (p *csvPrinter) printReport(fields aggregator.Field, entries []aggregator.Entry, _, _ time.Time) {
+	names, _ := keyColumns(fields, &aggregator.Key{})
+	p.w.Write(append(names, "flows", "packets", "bytes"))
+	for i := range entries {
+		_, values := keyColumns(fields, &entries[i].Key)
+		e := &entries[i]
+		p.w.Write(append(values, strconv.FormatUint(e.Flows, 10), strconv.FormatUint(e.Packets, 10), strconv.FormatUint(e.Bytes, 10)))
+	}
+}
+
+func (p *csvPrinter) flush() {
+	p.w.Flush()
+	p.out.Flush()
+}
+
+// jsonPrinter prints a JSON object per line
+type jsonPrinter struct {
+	out      *bufio.Writer
+	encoder  *json.Encoder
+	location *time.Location
+}
+
+type jsonFlow struct {
+	Start        time.Time  `json:"start"`
+	End          time.Time  `json:"end"`
+	Exporter     netip.Addr `json:"exporter"`
+	Proto        uint8      `json:"proto"`
+	SrcAddr      netip.Addr `json:"src_addr"`
+	SrcPort      uint16     `json:"src_port"`
+	DstAddr      netip.Addr `json:"dst_addr"`
+	DstPort      uint16     `json:"dst_port"`
+	Packets      uint64     `json:"packets"`
+	Bytes        uint64     `json:"bytes"`
+	TCPFlags     uint8      `json:"tcp_flags"`
+	ToS          uint8      `json:"tos"`
+	InIf         uint32     `json:"in_if"`
+	OutIf        uint32     `json:"out_if"`
+	SrcAS        uint32     `json:"src_as"`
+	DstAS        uint32     `json:"dst_as"`
+	SrcMask      uint8      `json:"src_mask"`
+	DstMask      uint8      `json:"dst_mask"`
+	NextHop      netip.Addr `json:"next_hop"`
+	SamplingRate uint64     `json:"sampling_rate"`
+}
+
+func (p *jsonPrinter) printFlow(r *flowrecord.FlowRecord) {
+	p.encoder.Encode(jsonFlow{
+		Start: r.Start.In(p.location), End: r.End.In(p.location), Exporter: r.Exporter, Proto: r.Proto,
+		SrcAddr: r.SrcAddr, SrcPort: r.SrcPort, DstAddr: r.DstAddr, DstPort: r.DstPort,
+		Packets: r.ScaledPackets(), Bytes: r.ScaledBytes(), TCPFlags: r.TCPFlags, ToS: r.ToS, InIf: r.InIf, OutIf: r.OutIf,
+		SrcAS: r.SrcAS, DstAS: r.DstAS, SrcMask: r.SrcMask, DstMask: r.DstMask, NextHop: r.NextHop, SamplingRate: r.Rate(),
+	})
+}
+
+func (p *jsonPrinter) printReport(fields aggregator.Field, entries []aggregator.Entry, first, last time.Time) {
+	for i := range entries {
+		names, values := keyColumns(fields, &entries[i].Key)
+		object := make(map[string]any, len(names)+5)
+		for j, name := range names {
+			object[name] = values[j]
+		}
+
+		object["flows"] = entries[i].Flows
+		object["packets"] = entries[i].Packets
+		object["bytes"] = entries[i].Bytes
+		object["first"] = first.In(p.location)
+		object["last"] = last.In(p.location)
+		p.encoder.Encode(object)
+	}
+}
+
+func (p *jsonPrinter) flush() {
+	p.out.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord() *flowrecord.FlowRecord {
+	start := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	return &flowrecord.FlowRecord{
+		Exporter:     netip.MustParseAddr("192.0.2.1"),
+		SrcAddr:      netip.MustParseAddr("10.0.0.1"),
+		DstAddr:      netip.MustParseAddr("10.0.0.2"),
+		NextHop:      netip.MustParseAddr("10.0.0.254"),
+		SrcPort:      443,
+		DstPort:      51000,
+		Proto:        6,
+		TCPFlags:     0x12,
+		ToS:          8,
+		SrcMask:      24,
+		DstMask:      16,
+		Bytes:        1500,
+		Packets:      10,
+		SamplingRate: 10,
+		InIf:         1,
+		OutIf:        2,
+		SrcAS:        64500,
+		DstAS:        64501,
+		Start:        start,
+		End:          start.Add(9 * time.Second),
+	}
+}
+
+func TestPrintFlow(t *testing.T) {
+	tests := []struct {
+		format string
+		// expected the lines printed, the text formats compared with their columns separated by a single space
+		expected []string
+	}{
+		{"line", []string{
+			"Date first seen Duration Proto Src IP Addr:Port Dst IP Addr:Port Packets Bytes",
+			"2023-11-14 22:13:20.000 9.000 TCP 10.0.0.1:443 -> 10.0.0.2:51000 100 15000",
+		}},
+		{"long", []string{
+			"Date first seen Duration Proto Src IP Addr:Port Dst IP Addr:Port Packets Bytes Flags Tos In Out SrcAS DstAS SMk DMk Next Hop Exporter Rate",
+			"2023-11-14 22:13:20.000 9.000 TCP 10.0.0.1:443 -> 10.0.0.2:51000 100 15000 .A..S. 8 1 2 64500 64501 24 16 10.0.0.254 192.0.2.1 10",
+		}},
+		{"csv", []string{
+			strings.Join(csvColumns, ","),
+			"2023-11-14T22:13:20Z,2023-11-14T22:13:29Z,9.000,192.0.2.1,6,10.0.0.1,443,10.0.0.2,51000,100,15000,18,8,1,2,64500,64501,24,16,10.0.0.254,10",
+		}},
+		{"json", []string{
+			`{"start":"2023-11-14T22:13:20Z","end":"2023-11-14T22:13:29Z","exporter":"192.0.2.1","proto":6,"src_addr":"10.0.0.1","src_port":443,"dst_addr":"10.0.0.2","dst_port":51000,"packets":100,"bytes":15000,"tcp_flags":18,"tos":8,"in_if":1,"out_if":2,"src_as":64500,"dst_as":64501,"src_mask":24,"dst_mask":16,"next_hop":"10.0.0.254","sampling_rate":10}`,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var b bytes.Buffer
+			p, err := newPrinter(test.format, &b, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.printFlow(testRecord())
+			p.flush()
+			lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+			if test.format == "line" || test.format == "long" {
+				for i, line := range lines {
+					lines[i] = strings.Join(strings.Fields(line), " ")
+				}
+			}
+
+			if !slices.Equal(lines, test.expected) {
+				t.Errorf("Got\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(test.expected, "\n"))
+			}
+		})
+	}
+
+	if _, err := newPrinter("xml", &bytes.Buffer{}, true); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,175 @@
+// nfview prints the NetFlow v5 flows received or read from a pcap capture.
+// The arguments form a flowfilter expression selecting the flows printed.
+//
+//	nfview -listen :2055 -format long proto tcp and port 443
+//	nfview -read export.pcap -aggregate srcaddr,dstport -sort bytes -n 20 src net 10.0.0.0/8
+//
+// The bytes and packets are corrected for the sampling rate of the exporter.
+// Flows are printed as they arrive unless -aggregate or -sort asks for a report,
+// printed at the end of the capture, on interrupt or every -interval.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/aggregator"
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/pcap"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+type options struct {
+	listen    string
+	read      string
+	format    string
+	utc       bool
+	exporters string
+	aggregate string
+	srcMask   int
+	dstMask   int
+	sort      string
+	top       int
+	interval  time.Duration
+}
+
+// parseACL parses a comma separated list of CIDRs, nil when empty
+func parseACL(s string) (*acl.ACL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	return acl.New(strings.Split(s, ","), nil)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "nfview:", err)
+	os.Exit(2)
+}
+
+func main() {
+	o := &options{}
+	flag.StringVar(&o.listen, "listen", ":2055", "the UDP address listened at")
+	flag.StringVar(&o.read, "read", "", "read the flows from a pcap or pcapng capture instead of listening")
+	flag.StringVar(&o.format, "format", "line", "the output format : line, long, csv or json")
+	flag.BoolVar(&o.utc, "utc", false, "print the times in UTC instead of the local time")
+	flag.StringVar(&o.exporters, "exporter", "", "comma separated CIDRs of the exporters printed")
+	flag.StringVar(&o.aggregate, "aggregate", "", "aggregate the flows by comma separated fields : "+(aggregator.FiveTuple|aggregator.Exporter|aggregator.ToS|aggregator.SrcAS|aggregator.DstAS|aggregator.InIf|aggregator.OutIf).String())
+	flag.IntVar(&o.srcMask, "srcmask", 32, "the prefix length, 1 to 32, the source addresses are aggregated by")
+	flag.IntVar(&o.dstMask, "dstmask", 32, "the prefix length, 1 to 32, the destination addresses are aggregated by")
+	flag.StringVar(&o.sort, "sort", "", "report the top flows sorted by bytes, packets or flows")
+	flag.IntVar(&o.top, "n", 10, "the number of flows of a report, 0 for all")
+	flag.DurationVar(&o.interval, "interval", 0, "print and reset the report every interval while listening")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [filter expression]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	filter, err := flowfilter.Parse(strings.Join(flag.Args(), " "))
+	if err != nil {
+		var syntaxError *flowfilter.SyntaxError
+		if errors.As(err, &syntaxError) {
+			fmt.Fprintln(os.Stderr, syntaxError.Caret())
+		}
+
+		fail(err)
+	}
+
+	exporters, err := parseACL(o.exporters)
+	if err != nil {
+		fail(err)
+	}
+
+	out, err := newPrinter(o.format, os.Stdout, o.utc)
+	if err != nil {
+		fail(err)
+	}
+
+	var r *report
+	if o.aggregate != "" || o.sort != "" {
+		if r, err = newReport(o); err != nil {
+			fail(err)
+		}
+	}
+
+	var lock sync.Mutex
+	var records []flowrecord.FlowRecord
+	collector := flowcollector.Collector{
+		ACL:    exporters,
+		Filter: filter,
+		// a single worker prints the flows in the order they are received
+		Workers: 1,
+		NetFlow5Handler: flowcollector.NetFlow5HandlerFunc(func(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+			lock.Lock()
+			defer lock.Unlock()
+			records = flowrecord.AppendNetFlow5(records[:0], acl.AddrOf(remote), header, flows)
+			for i := range records {
+				record := &records[i]
+				if r != nil {
+					r.add(record)
+				} else {
+					out.printFlow(record)
+				}
+			}
+
+			if r == nil {
+				out.flush()
+			}
+		}),
+	}
+
+	if o.read != "" {
+		reader, err := pcap.Open(o.read)
+		if err != nil {
+			fail(err)
+		}
+
+		collector.Source = reader
+	} else {
+		conn, err := net.ListenPacket("udp", o.listen)
+		if err != nil {
+			fail(err)
+		}
+
+		collector.Conn = conn
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		collector.Stop()
+	}()
+
+	if r != nil && o.interval > 0 && o.read == "" {
+		go func() {
+			for range time.Tick(o.interval) {
+				lock.Lock()
+				r.print(out)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	collector.Start()
+	lock.Lock()
+	defer lock.Unlock()
+	if r != nil {
+		r.print(out)
+	}
+
+	out.flush()
+	if collector.Errors() > 0 || collector.Unknown() > 0 {
+		fmt.Fprintf(os.Stderr, "nfview: %d datagrams failed to decode, %d were not NetFlow v1, v5 or v7\n", collector.Errors(), collector.Unknown())
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/wwicak/go-utils/aggregator"
+	"github.com/wwicak/go-utils/flowrecord"
+	"slices"
+	"time"
+)
+
+// report the flows summed by key, printed sorted
+type report struct {
+	fields  aggregator.Field
+	srcMask aggregator.Mask
+	dstMask aggregator.Mask
+	sort    string
+	top     int
+	entries map[aggregator.Key]*aggregator.Entry
+	first   time.Time
+	last    time.Time
+}
+
+func newReport(o *options) (*report, error) {
+	if o.srcMask < 1 || o.srcMask > 32 {
+		return nil, fmt.Errorf("invalid source mask %d, not between 1 and 32", o.srcMask)
+	}
+
+	if o.dstMask < 1 || o.dstMask > 32 {
+		return nil, fmt.Errorf("invalid destination mask %d, not between 1 and 32", o.dstMask)
+	}
+
+	r := &report{
+		fields:  aggregator.FiveTuple,
+		srcMask: aggregator.Mask{IPv4: uint8(o.srcMask)},
+		dstMask: aggregator.Mask{IPv4: uint8(o.dstMask)},
+		sort:    o.sort,
+		top:     o.top,
+		entries: make(map[aggregator.Key]*aggregator.Entry),
+	}
+
+	if o.aggregate != "" {
+		fields, err := aggregator.ParseFields(o.aggregate)
+		if err != nil {
+			return nil, err
+		}
+
+		r.fields = fields
+	}
+
+	switch r.sort {
+	case "":
+		r.sort = "bytes"
+	case "bytes", "packets", "flows":
+	default:
+		return nil, fmt.Errorf("unknown sort %q", r.sort)
+	}
+
+	return r, nil
+}
+
+func (r *report) add(record *flowrecord.FlowRecord) {
+	key := aggregator.KeyOf(record, r.fields, r.srcMask, r.dstMask)
+	e, found := r.entries[key]
+	if !found {
+		e = &aggregator.Entry{Key: key}
+		r.entries[key] = e
+	}
+
+	e.Bytes += record.ScaledBytes()
+	e.Packets += record.ScaledPackets()
+	e.Flows++
+	if r.first.IsZero() || record.Start.Before(r.first) {
+		r.first = record.Start
+	}
+
+	if record.End.After(r.last) {
+		r.last = record.End
+	}
+}
+
+// print prints the top entries and starts over
+func (r *report) print(p printer) {
+	entries := make([]aggregator.Entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, *e)
+	}
+
+	slices.SortFunc(entries, func(x, y aggregator.Entry) int {
+		switch r.sort {
+		case "packets":
+			return cmp.Compare(y.Packets, x.Packets)
+		case "flows":
+			return cmp.Compare(y.Flows, x.Flows)
+		}
+
+		return cmp.Compare(y.Bytes, x.Bytes)
+	})
+
+	if r.top > 0 && len(entries) > r.top {
+		entries = entries[:r.top]
+	}
+
+	p.printReport(r.fields, entries, r.first, r.last)
+	p.flush()
+	clear(r.entries)
+	r.first, r.last = time.Time{}, time.Time{}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	// the /24 networks add up to 3000, 2000 and 300 bytes, 1, 20 and 300 packets, 1, 2 and 3 flows
+	flows := []struct {
+		src     string
+		bytes   uint64
+		packets uint64
+	}{
+		{"10.0.3.1", 100, 100},
+		{"10.0.1.1", 3000, 1},
+		{"10.0.2.1", 1000, 10},
+		{"10.0.3.2", 100, 100},
+		{"10.0.2.2", 1000, 10},
+		{"10.0.3.3", 100, 100},
+	}
+
+	tests := []struct {
+		sort     string
+		top      int
+		expected []string
+	}{
+		{"", 0, []string{"10.0.1.0,1,1,3000", "10.0.2.0,2,20,2000", "10.0.3.0,3,300,300"}},
+		{"bytes", 2, []string{"10.0.1.0,1,1,3000", "10.0.2.0,2,20,2000"}},
+		{"packets", 0, []string{"10.0.3.0,3,300,300", "10.0.2.0,2,20,2000", "10.0.1.0,1,1,3000"}},
+		{"flows", 1, []string{"10.0.3.0,3,300,300"}},
+	}
+
+	for _, test := range tests {
+		r, err := newReport(&options{aggregate: "srcaddr", srcMask: 24, dstMask: 32, sort: test.sort, top: test.top})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, f := range flows {
+			record := testRecord()
+			record.SrcAddr = netip.MustParseAddr(f.src)
+			record.Bytes, record.Packets, record.SamplingRate = f.bytes, f.packets, 1
+			r.add(record)
+		}
+
+		var b bytes.Buffer
+		p, _ := newPrinter("csv", &b, true)
+		r.print(p)
+		expected := append([]string{"src_addr,flows,packets,bytes"}, test.expected...)
+		if lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"); !slices.Equal(lines, expected) {
+			t.Errorf("sort %q top %d : Got %q expected %q", test.sort, test.top, lines, expected)
+		}
+
+		// the report starts over once printed
+		b.Reset()
+		r.print(p)
+		if b.String() != "src_addr,flows,packets,bytes\n" {
+			t.Errorf("sort %q top %d : Got %q after printing", test.sort, test.top, b.String())
+		}
+	}
+}
+
+func TestReportOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		o    options
+	}{
+		{"srcmask 0", options{srcMask: 0, dstMask: 32}},
+		{"srcmask 33", options{srcMask: 33, dstMask: 32}},
+		{"dstmask -1", options{srcMask: 32, dstMask: -1}},
+		{"dstmask 64", options{srcMask: 32, dstMask: 64}},
+		{"sort", options{srcMask: 32, dstMask: 32, sort: "duration"}},
+		{"aggregate", options{srcMask: 32, dstMask: 32, aggregate: "color"}},
+	}
+
+	for _, test := range tests {
+		if _, err := newReport(&test.o); err == nil {
+			t.Errorf("%s : expected an error", test.name)
+		}
+	}
+
+	if _, err := newReport(&options{srcMask: 1, dstMask: 32}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package netflow5
+
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+)
+
+var (
+	ErrTooShort     = errors.New("netflow5: data is too short")
+	ErrVersion      = errors.New("netflow5: unexpected version")
+	ErrTooManyFlows = errors.New("netflow5: too many flows")
+)
+
+// Validate checks that data holds a NetFlow v5 packet:
+// the version is 5, the flow count is at most MaxFlows and every flow is present.
+func Validate(data []byte) error {
+	return validate(data, 5, HeaderSize, FlowSize, MaxFlows)
+}
+
+// Version returns the version of a NetFlow packet
+func Version(data []byte) (uint16, error) {
+	if len(data) < 2 {
+		return 0, ErrTooShort
+	}
+
+	return binary.BigEndian.Uint16(data[0:2]), nil
+}
+
+func validate(data []byte, version uint16, headerSize, flowSize, maxFlows int) error {
+	if len(data) < headerSize {
+		return ErrTooShort
+	}
+
+	if binary.BigEndian.Uint16(data[0:2]) != version {
+		return ErrVersion
+	}
+
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if count > maxFlows {
+		return ErrTooManyFlows
+	}
+
+	if len(data) < headerSize+count*flowSize {
+		return ErrTooShort
+	}
+
+	return nil
+}
+
+// Decode decodes a NetFlow v5 packet into a new *NetFlow5
+func Decode(data []byte) (*NetFlow5, error) {
+	f := &NetFlow5{}
+	if err := f.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Decode decodes a NetFlow v5 packet into f.
+// Only the flows announced by the header are decoded.
+func (f *NetFlow5) Decode(data []byte) error {
+	if err := Validate(data); err != nil {
+		return err
+	}
+
+	f.Header.decode(data[:HeaderSize])
+	data = data[HeaderSize:]
+	for i := range f.FlowArray() {
+		f.Flows[i].decode(data[i*FlowSize : (i+1)*FlowSize])
+	}
+
+	return nil
+}
+
+// Cast returns data as a *NetFlow5 without copying.
+// The packet is validated first, the capacity of data must be at least MaxPacketSize.
+// The *NetFlow5 aliases data and is only valid as long as data is not modified.
+func Cast(data []byte) (*NetFlow5, error) {
+	if err := Validate(data); err != nil {
+		return nil, err
+	}
+
+	if cap(data) < MaxPacketSize {
+		return nil, ErrTooShort
+	}
+
+	return (*NetFlow5)(unsafe.Pointer(unsafe.SliceData(data))), nil
+}
+
+// decode decodes the header from network order bytes
+func (h *Header) decode(data []byte) {
+	h.nVersion = hton16(binary.BigEndian.Uint16(data[0:2]))
+	h.nLength = hton16(binary.BigEndian.Uint16(data[2:4]))
+	h.nSysUptime = hton32(binary.BigEndian.Uint32(data[4:8]))
+	h.nUnixSecs = hton32(binary.BigEndian.Uint32(data[8:12]))
+	h.nUnixNsecs = hton32(binary.BigEndian.Uint32(data[12:16]))
+	h.nFlowSequence = hton32(binary.BigEndian.Uint32(data[16:20]))
+	h.EngineType = data[20]
+	h.EngineID = data[21]
+	h.nSamplingInterval = hton16(binary.BigEndian.Uint16(data[22:24]))
+}
+
+// decode decodes the flow from network order bytes
+func (flow *Flow) decode(data []byte) {
+	copy(flow.SrcAddr[:], data[0:4])
+	copy(flow.DstAddr[:], data[4:8])
+	copy(flow.NextAddr[:], data[8:12])
+	flow.nInput = hton16(binary.BigEndian.Uint16(data[12:14]))
+	flow.nOutput = hton16(binary.BigEndian.Uint16(data[14:16]))
+	flow.nDPkts = hton32(binary.BigEndian.Uint32(data[16:20]))
+	flow.nDOctets = hton32(binary.BigEndian.Uint32(data[20:24]))
+	flow.nFirst = hton32(binary.BigEndian.Uint32(data[24:28]))
+	flow.nLast = hton32(binary.BigEndian.Uint32(data[28:32]))
+	flow.nSrcPort = hton16(binary.BigEndian.Uint16(data[32:34]))
+	flow.nDstPort = hton16(binary.BigEndian.Uint16(data[34:36]))
+	flow.pad1 = data[36]
+	flow.TCPFlags = data[37]
+	flow.Proto = data[38]
+	flow.Tos = data[39]
+	flow.nSrcAs = hton16(binary.BigEndian.Uint16(data[40:42]))
+	flow.nDstAs = hton16(binary.BigEndian.Uint16(data[42:44]))
+	flow.SrcMask = data[44]
+	flow.DstMask = data[45]
+	copy(flow.pad2[:], data[46:48])
+}
@@ -0,0 +1,121 @@
+package netflow5
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func testPacket(count int) []byte {
+	data := make([]byte, HeaderSize+count*FlowSize)
+	binary.BigEndian.PutUint16(data[0:2], 5)
+	binary.BigEndian.PutUint16(data[2:4], uint16(count))
+	binary.BigEndian.PutUint32(data[4:8], 360000)
+	binary.BigEndian.PutUint32(data[8:12], 1700000000)
+	binary.BigEndian.PutUint32(data[12:16], 500)
+	binary.BigEndian.PutUint32(data[16:20], 42)
+	data[20] = 1
+	data[21] = 2
+	binary.BigEndian.PutUint16(data[22:24], 0x4064)
+	for i := 0; i < count; i++ {
+		flow := data[HeaderSize+i*FlowSize:]
+		copy(flow[0:4], []byte{10, 0, 0, byte(i + 1)})
+		copy(flow[4:8], []byte{192, 0, 2, 1})
+		copy(flow[8:12], []byte{198, 51, 100, 1})
+		binary.BigEndian.PutUint16(flow[12:14], 3)
+		binary.BigEndian.PutUint16(flow[14:16], 4)
+		binary.BigEndian.PutUint32(flow[16:20], 10)
+		binary.BigEndian.PutUint32(flow[20:24], 1500)
+		binary.BigEndian.PutUint32(flow[24:28], 350000)
+		binary.BigEndian.PutUint32(flow[28:32], 359000)
+		binary.BigEndian.PutUint16(flow[32:34], 51000)
+		binary.BigEndian.PutUint16(flow[34:36], 443)
+		flow[37] = 0x1b
+		flow[38] = 6
+		flow[39] = 0x20
+		binary.BigEndian.PutUint16(flow[40:42], 64500)
+		binary.BigEndian.PutUint16(flow[42:44], 64501)
+		flow[44] = 24
+		flow[45] = 16
+	}
+
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	f, err := Decode(testPacket(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &f.Header
+	if h.Version() != 5 || h.Length() != 2 || h.SysUptime() != 360000 || h.UnixSecs() != 1700000000 ||
+		h.UnixNsecs() != 500 || h.FlowSequence() != 42 || h.EngineType != 1 || h.EngineID != 2 ||
+		h.SamplingInterval() != 0x4064 {
+		t.Errorf("Header decoded incorrectly %+v", h)
+	}
+
+	flows := f.FlowArray()
+	if len(flows) != 2 {
+		t.Fatalf("Got %d flows expected 2", len(flows))
+	}
+
+	flow := &flows[1]
+	if !flow.SrcIP().Equal(net.IPv4(10, 0, 0, 2)) || !flow.DstIP().Equal(net.IPv4(192, 0, 2, 1)) ||
+		!flow.NextIP().Equal(net.IPv4(198, 51, 100, 1)) {
+		t.Errorf("Addresses decoded incorrectly %s %s %s", flow.SrcIP(), flow.DstIP(), flow.NextIP())
+	}
+
+	if flow.Input() != 3 || flow.Output() != 4 || flow.DPkts() != 10 || flow.DOctets() != 1500 ||
+		flow.First() != 350000 || flow.Last() != 359000 || flow.SrcPort() != 51000 || flow.DstPort() != 443 ||
+		flow.TCPFlags != 0x1b || flow.Proto != 6 || flow.Tos != 0x20 || flow.SrcAs() != 64500 ||
+		flow.DstAs() != 64501 || flow.SrcMask != 24 || flow.DstMask != 16 {
+		t.Errorf("Flow decoded incorrectly %+v", flow)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tooMany := testPacket(1)
+	binary.BigEndian.PutUint16(tooMany[2:4], 200)
+	wrongVersion := testPacket(1)
+	binary.BigEndian.PutUint16(wrongVersion[0:2], 9)
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrTooShort},
+		{"short header", testPacket(0)[:20], ErrTooShort},
+		{"truncated flow", testPacket(3)[:HeaderSize+2*FlowSize+10], ErrTooShort},
+		{"too many flows", tooMany, ErrTooManyFlows},
+		{"wrong version", wrongVersion, ErrVersion},
+	}
+
+	for _, test := range tests {
+		if _, err := Decode(test.data); err != test.err {
+			t.Errorf("%s: got %v expected %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestCast(t *testing.T) {
+	data := make([]byte, MaxPacketSize)
+	n := copy(data, testPacket(3))
+	f, err := Cast(data[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decode(data[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *f != *decoded {
+		t.Errorf("Cast and Decode differ")
+	}
+
+	if _, err := Cast(testPacket(3)); err != ErrTooShort {
+		t.Errorf("Cast of a small buffer: got %v expected %v", err, ErrTooShort)
+	}
+}
@@ -0,0 +1,115 @@
+package netflow5
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// MarshalBinary encodes the header and the flows announced by the header into a new []byte
+func (f *NetFlow5) MarshalBinary() ([]byte, error) {
+	return f.AppendBinary(make([]byte, 0, HeaderSize+int(f.Header.Length())*FlowSize))
+}
+
+// AppendBinary appends the encoded header and the flows announced by the header to b
+func (f *NetFlow5) AppendBinary(b []byte) ([]byte, error) {
+	if f.Header.Length() > MaxFlows {
+		return nil, ErrTooManyFlows
+	}
+
+	b = f.Header.appendBinary(b)
+	for i := range f.FlowArray() {
+		b = f.Flows[i].appendBinary(b)
+	}
+
+	return b, nil
+}
+
+// SetVersion sets the NetFlow export format version number.
+func (h *Header) SetVersion(v uint16) { h.nVersion = hton16(v) }
+
+// SetLength sets the number of flows exported in this packet.
+func (h *Header) SetLength(v uint16) { h.nLength = hton16(v) }
+
+// SetSamplingInterval sets the raw sampling mode and interval.
+func (h *Header) SetSamplingInterval(v uint16) { h.nSamplingInterval = hton16(v) }
+
+// SetSysUptime sets the time in milliseconds since the export device booted.
+func (h *Header) SetSysUptime(v uint32) { h.nSysUptime = hton32(v) }
+
+// SetUnixSecs sets the count of seconds since 0000 UTC 1970.
+func (h *Header) SetUnixSecs(v uint32) { h.nUnixSecs = hton32(v) }
+
+// SetUnixNsecs sets the residual nanoseconds since 0000 UTC 1970.
+func (h *Header) SetUnixNsecs(v uint32) { h.nUnixNsecs = hton32(v) }
+
+// SetFlowSequence sets the sequence counter of total flows seen.
+func (h *Header) SetFlowSequence(v uint32) { h.nFlowSequence = hton32(v) }
+
+func (h *Header) appendBinary(b []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, h.Version())
+	b = binary.BigEndian.AppendUint16(b, h.Length())
+	b = binary.BigEndian.AppendUint32(b, h.SysUptime())
+	b = binary.BigEndian.AppendUint32(b, h.UnixSecs())
+	b = binary.BigEndian.AppendUint32(b, h.UnixNsecs())
+	b = binary.BigEndian.AppendUint32(b, h.FlowSequence())
+	b = append(b, h.EngineType, h.EngineID)
+	return binary.BigEndian.AppendUint16(b, h.SamplingInterval())
+}
+
+// SetSrcIP sets the source IPv4 address of the flow.
+func (flow *Flow) SetSrcIP(ip net.IP) { copy(flow.SrcAddr[:], ip.To4()) }
+
+// SetDstIP sets the destination IPv4 address of the flow.
+func (flow *Flow) SetDstIP(ip net.IP) { copy(flow.DstAddr[:], ip.To4()) }
+
+// SetNextIP sets the next hop IPv4 address of the flow.
+func (flow *Flow) SetNextIP(ip net.IP) { copy(flow.NextAddr[:], ip.To4()) }
+
+// SetDPkts sets the number of packets in the flow.
+func (flow *Flow) SetDPkts(v uint32) { flow.nDPkts = hton32(v) }
+
+// SetDOctets sets the total number of Layer 3 bytes in the packets of the flow.
+func (flow *Flow) SetDOctets(v uint32) { flow.nDOctets = hton32(v) }
+
+// SetFirst sets the system uptime at start of flow.
+func (flow *Flow) SetFirst(v uint32) { flow.nFirst = hton32(v) }
+
+// SetLast sets the system uptime at the time the last packet of the flow was received.
+func (flow *Flow) SetLast(v uint32) { flow.nLast = hton32(v) }
+
+// SetSrcPort sets the TCP/UDP source port number or equivalent.
+func (flow *Flow) SetSrcPort(v uint16) { flow.nSrcPort = hton16(v) }
+
+// SetDstPort sets the TCP/UDP destination port number or equivalent.
+func (flow *Flow) SetDstPort(v uint16) { flow.nDstPort = hton16(v) }
+
+// SetSrcAs sets the autonomous system number of the source.
+func (flow *Flow) SetSrcAs(v uint16) { flow.nSrcAs = hton16(v) }
+
+// SetDstAs sets the autonomous system number of the destination.
+func (flow *Flow) SetDstAs(v uint16) { flow.nDstAs = hton16(v) }
+
+// SetInput sets the SNMP index of input interface.
+func (flow *Flow) SetInput(v uint16) { flow.nInput = hton16(v) }
+
+// SetOutput sets the SNMP index of output interface.
+func (flow *Flow) SetOutput(v uint16) { flow.nOutput = hton16(v) }
+
+func (flow *Flow) appendBinary(b []byte) []byte {
+	b = append(b, flow.SrcAddr[:]...)
+	b = append(b, flow.DstAddr[:]...)
+	b = append(b, flow.NextAddr[:]...)
+	b = binary.BigEndian.AppendUint16(b, flow.Input())
+	b = binary.BigEndian.AppendUint16(b, flow.Output())
+	b = binary.BigEndian.AppendUint32(b, flow.DPkts())
+	b = binary.BigEndian.AppendUint32(b, flow.DOctets())
+	b = binary.BigEndian.AppendUint32(b, flow.First())
+	b = binary.BigEndian.AppendUint32(b, flow.Last())
+	b = binary.BigEndian.AppendUint16(b, flow.SrcPort())
+	b = binary.BigEndian.AppendUint16(b, flow.DstPort())
+	b = append(b, flow.pad1, flow.TCPFlags, flow.Proto, flow.Tos)
+	b = binary.BigEndian.AppendUint16(b, flow.SrcAs())
+	b = binary.BigEndian.AppendUint16(b, flow.DstAs())
+	b = append(b, flow.SrcMask, flow.DstMask)
+	return append(b, flow.pad2[:]...)
+}
@@ -0,0 +1,137 @@
+package netflow5
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Exporter batches flows into NetFlow v5 packets of at most MaxFlows flows
+// and writes them to Writer.
+// It is safe for concurrent use.
+type Exporter struct {
+	// Writer where the packets are written, usually a connected UDP socket.
+	// Required.
+	Writer io.Writer
+	// Clock returns the current time.
+	// Default : time.Now
+	Clock func() time.Time
+	// BootTime the time the exporter booted, SysUptime is computed from it.
+	// Default : the time the first flow is added
+	BootTime time.Time
+	// EngineType type of flow-switching engine
+	EngineType uint8
+	// EngineID slot number of the flow-switching engine
+	EngineID uint8
+	// SamplingInterval the raw sampling mode and interval
+	SamplingInterval uint16
+	lock             sync.Mutex
+	packet           NetFlow5
+	sequence         uint32
+	buffer           []byte
+}
+
+// DialExporter create an *Exporter sending packets to the UDP address addr
+func DialExporter(addr string) (*Exporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{Writer: conn}, nil
+}
+
+func (e *Exporter) setDefaults() {
+	if e.Writer == nil {
+		panic(errors.New("No writer defined"))
+	}
+
+	if e.Clock == nil {
+		e.Clock = time.Now
+	}
+
+	if e.BootTime.IsZero() {
+		e.BootTime = e.Clock()
+	}
+}
+
+// Uptime returns t as milliseconds since BootTime, the unit of Flow.First and Flow.Last
+func (e *Exporter) Uptime(t time.Time) uint32 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.setDefaults()
+	return e.uptime(t)
+}
+
+func (e *Exporter) uptime(t time.Time) uint32 {
+	return uint32(t.Sub(e.BootTime).Milliseconds())
+}
+
+// Add adds flows to the current packet, full packets are written immediately
+func (e *Exporter) Add(flows ...Flow) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.setDefaults()
+	for _, flow := range flows {
+		n := e.packet.Header.Length()
+		e.packet.Flows[n] = flow
+		e.packet.Header.SetLength(n + 1)
+		if n+1 == MaxFlows {
+			if err := e.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Flush writes the current packet if it holds any flows
+func (e *Exporter) Flush() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.setDefaults()
+	return e.flush()
+}
+
+func (e *Exporter) flush() error {
+	h := &e.packet.Header
+	n := h.Length()
+	if n == 0 {
+		return nil
+	}
+
+	now := e.Clock()
+	h.SetVersion(5)
+	h.SetSysUptime(e.uptime(now))
+	h.SetUnixSecs(uint32(now.Unix()))
+	h.SetUnixNsecs(uint32(now.Nanosecond()))
+	h.SetFlowSequence(e.sequence)
+	h.EngineType = e.EngineType
+	h.EngineID = e.EngineID
+	h.SetSamplingInterval(e.SamplingInterval)
+	e.sequence += uint32(n)
+	buffer, err := e.packet.AppendBinary(e.buffer[:0])
+	h.SetLength(0)
+	if err != nil {
+		return err
+	}
+
+	e.buffer = buffer
+	_, err = e.Writer.Write(buffer)
+	return err
+}
+
+// Close flushes the current packet and closes Writer if it is an io.Closer
+func (e *Exporter) Close() error {
+	err := e.Flush()
+	if closer, ok := e.Writer.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
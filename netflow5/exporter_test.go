@@ -0,0 +1,91 @@
+package netflow5
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type packetWriter [][]byte
+
+func (w *packetWriter) Write(b []byte) (int, error) {
+	*w = append(*w, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestExporter(t *testing.T) {
+	boot := time.Unix(1700000000, 0)
+	now := boot.Add(90 * time.Second)
+	writer := &packetWriter{}
+	e := &Exporter{
+		Writer:   writer,
+		Clock:    func() time.Time { return now },
+		BootTime: boot,
+		EngineID: 7,
+	}
+
+	for i := 0; i < 65; i++ {
+		flow := Flow{}
+		flow.SetSrcIP(net.IPv4(10, 0, 0, byte(i)))
+		flow.SetDPkts(uint32(i))
+		flow.SetFirst(e.Uptime(boot.Add(30 * time.Second)))
+		if err := e.Add(flow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*writer) != 3 {
+		t.Fatalf("Got %d packets expected 3", len(*writer))
+	}
+
+	expected := []struct {
+		length, sequence, uptime uint32
+	}{
+		{30, 0, 90000},
+		{30, 30, 90000},
+		{5, 60, 90500},
+	}
+
+	i := 0
+	for p, packet := range *writer {
+		f, err := Decode(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := &f.Header
+		if uint32(h.Length()) != expected[p].length || h.FlowSequence() != expected[p].sequence ||
+			h.SysUptime() != expected[p].uptime || h.EngineID != 7 || h.UnixSecs() != uint32(now.Unix()) {
+			t.Errorf("packet %d: unexpected header %+v", p, h)
+		}
+
+		for _, flow := range f.FlowArray() {
+			if flow.DPkts() != uint32(i) || flow.SrcAddr[3] != byte(i) || flow.First() != 30000 {
+				t.Errorf("flow %d: unexpected flow %+v", i, flow)
+			}
+			i++
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	data := testPacket(4)
+	f, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(encoded) != string(data) {
+		t.Errorf("Marshal does not match the decoded packet")
+	}
+}
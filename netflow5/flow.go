@@ -1,6 +1,9 @@
 package netflow5
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 // Flow in memory layout of a netflow5 flow
 type Flow struct {
@@ -69,3 +72,28 @@ func (flow *Flow) Input() uint16 { return ntoh16(flow.nInput) }
 
 // Output returns SNMP index of output interface
 func (flow *Flow) Output() uint16 { return ntoh16(flow.nOutput) }
+
+// StartTime returns the absolute time of the start of the flow.
+func (flow *Flow) StartTime(h *Header) time.Time { return h.UptimeToTime(flow.First()) }
+
+// EndTime returns the absolute time the last packet of the flow was received.
+func (flow *Flow) EndTime(h *Header) time.Time { return h.UptimeToTime(flow.Last()) }
+
+// Duration returns the time between the first and the last packet of the flow.
+func (flow *Flow) Duration() time.Duration {
+	return time.Duration(flow.Last()-flow.First()) * time.Millisecond
+}
+
+// ScaledDPkts returns the number of packets in the flow corrected by the sampling rate.
+func (flow *Flow) ScaledDPkts(h *Header) uint64 { return scale(flow.DPkts(), h.SamplingRate()) }
+
+// ScaledDOctets returns the number of bytes in the flow corrected by the sampling rate.
+func (flow *Flow) ScaledDOctets(h *Header) uint64 { return scale(flow.DOctets(), h.SamplingRate()) }
+
+func scale(v uint32, rate uint16) uint64 {
+	if rate <= 1 {
+		return uint64(v)
+	}
+
+	return uint64(v) * uint64(rate)
+}
@@ -1,5 +1,7 @@
 package netflow5
 
+import "time"
+
 // Header in memory layout of a netflow header
 type Header struct {
 	nVersion      uint16
@@ -35,3 +37,28 @@ func (h *Header) UnixNsecs() uint32 { return ntoh32(h.nUnixNsecs) }
 
 // FlowSequence Sequence counter of total flows seen
 func (h *Header) FlowSequence() uint32 { return ntoh32(h.nFlowSequence) }
+
+// Sampling modes held in the first two bits of the sampling interval
+const (
+	SamplingModeNone uint8 = iota
+	SamplingModeDeterministic
+	SamplingModeRandom
+)
+
+// SamplingMode the sampling mode held in the first two bits of the sampling interval
+func (h *Header) SamplingMode() uint8 { return uint8(h.SamplingInterval() >> 14) }
+
+// SamplingRate the sampling interval without the sampling mode, 0 when not sampled
+func (h *Header) SamplingRate() uint16 { return h.SamplingInterval() & 0x3FFF }
+
+// Time the export time of the packet from UnixSecs and UnixNsecs
+func (h *Header) Time() time.Time {
+	return time.Unix(int64(h.UnixSecs()), int64(h.UnixNsecs()))
+}
+
+// UptimeToTime converts a time in milliseconds of device uptime into an absolute time.
+// The uptime is assumed to be within 24.8 days of SysUptime, before or after it,
+// handling the wraparound after 49.7 days.
+func (h *Header) UptimeToTime(uptime uint32) time.Time {
+	return h.Time().Add(-time.Duration(int32(h.SysUptime()-uptime)) * time.Millisecond)
+}
@@ -1,11 +1,28 @@
 package netflow5
 
+const (
+	// HeaderSize size in bytes of a NetFlow v5 header
+	HeaderSize = 24
+	// FlowSize size in bytes of a NetFlow v5 flow record
+	FlowSize = 48
+	// MaxFlows maximum number of flows in a NetFlow v5 packet
+	MaxFlows = 30
+	// MaxPacketSize size in bytes of a NetFlow v5 packet holding MaxFlows flows
+	MaxPacketSize = HeaderSize + MaxFlows*FlowSize
+)
+
 // NetFlow5 Represents the in memory layout of a NetFlow v5 packet
 type NetFlow5 struct {
 	Header Header
-	Flows  [30]Flow
+	Flows  [MaxFlows]Flow
 }
 
+// FlowArray returns the flows of the packet as announced by the header, at most MaxFlows.
 func (f *NetFlow5) FlowArray() []Flow {
-	return f.Flows[:f.Header.Length()]
+	n := f.Header.Length()
+	if n > MaxFlows {
+		n = MaxFlows
+	}
+
+	return f.Flows[:n]
 }
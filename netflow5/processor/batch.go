@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/netflow5"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+)
+
+// Batch the flows of a packet delivered to a BatchHandler.
+// The batch is only valid until HandleBatch returns unless it is retained.
+// Retain keeps the batch valid until the matching Release,
+// the storage of the batch is returned to its pool on the last Release.
+type Batch struct {
+	// Header the header of the packet
+	Header *netflow5.Header
+	// Flows the flows of the packet
+	Flows []netflow5.Flow
+	// NetFlow7 the NetFlow v7 packet holding the router shortcuts, nil for other versions
+	NetFlow7 *netflow5.NetFlow7
+	refs     atomic.Int32
+	data     *netflow5.NetFlow5
+	data7    *netflow5.NetFlow7
+	// aliased the flows point into the packet buffer which is reused once HandleBatch returns
+	aliased bool
+	// detach copies the aliased flows once, whatever the number of goroutines retaining the batch
+	detach sync.Once
+}
+
+var batchPool = sync.Pool{
+	New: func() any { return &Batch{} },
+}
+
+// BatchHandler the handler for the flows of a packet that may be retained past the call
+type BatchHandler interface {
+	HandleBatch(batch *Batch)
+}
+
+// The BatchHandlerFunc type is an adapter to allow the use of
+// ordinary functions as BatchHandlers.
+type BatchHandlerFunc func(batch *Batch)
+
+// HandleBatch calls f(batch)
+func (f BatchHandlerFunc) HandleBatch(batch *Batch) {
+	f(batch)
+}
+
+// newBatch returns a batch holding a single reference
+func newBatch() *Batch {
+	b := batchPool.Get().(*Batch)
+	b.refs.Store(1)
+	return b
+}
+
+// setNetFlow5 sets the flows of the batch from a packet owned by the batch
+func (b *Batch) setNetFlow5(data *netflow5.NetFlow5) {
+	b.data = data
+	b.Header = &data.Header
+	b.Flows = data.FlowArray()
+}
+
+// setNetFlow7 sets the flows of the batch from a v7 packet owned by the batch
+func (b *Batch) setNetFlow7(data *netflow5.NetFlow7) {
+	b.data7 = data
+	b.NetFlow7 = data
+	b.Header = &data.Header
+	b.Flows = data.FlowArray()
+}
+
+// filter keeps the flows matching f, along with their router shortcuts for v7,
+// and returns the number of flows dropped
+func (b *Batch) filter(exporter netip.Addr, f *flowfilter.Filter) int {
+	n := 0
+	for i := range b.Flows {
+		if !f.MatchNetFlow5(exporter, b.Header, &b.Flows[i]) {
+			continue
+		}
+
+		if n != i {
+			b.Flows[n] = b.Flows[i]
+			if b.NetFlow7 != nil {
+				b.NetFlow7.RouterSc[n] = b.NetFlow7.RouterSc[i]
+			}
+		}
+		n++
+	}
+
+	dropped := len(b.Flows) - n
+	if dropped > 0 {
+		b.Flows = b.Flows[:n]
+		b.Header.SetLength(uint16(n))
+	}
+
+	return dropped
+}
+
+// Retain keeps the batch valid until the matching call to Release.
+// Retain must be called before HandleBatch returns or while holding a reference, it is safe for concurrent use.
+// Batches of an Unsafe processor are copied into pooled storage on the first Retain,
+// the Header and Flows read before still point into the packet buffer and must be read again.
+// Such a batch must be retained before its Header or Flows are read by other goroutines.
+func (b *Batch) Retain() {
+	b.detach.Do(func() {
+		if !b.aliased {
+			return
+		}
+
+		data := netFlow5Pool.Get().(*netflow5.NetFlow5)
+		*data = netflow5.NetFlow5{Header: *b.Header}
+		copy(data.Flows[:], b.Flows)
+		b.setNetFlow5(data)
+		b.aliased = false
+	})
+
+	b.refs.Add(1)
+}
+
+// Release drops a reference to the batch.
+// The batch and its flows must no longer be used after its last reference is released.
+func (b *Batch) Release() {
+	refs := b.refs.Add(-1)
+	if refs > 0 {
+		return
+	}
+
+	if refs < 0 {
+		panic("processor: Batch released more than retained")
+	}
+
+	if b.data != nil {
+		netFlow5Pool.Put(b.data)
+	}
+
+	if b.data7 != nil {
+		netFlow7Pool.Put(b.data7)
+	}
+
+	*b = Batch{}
+	batchPool.Put(b)
+}
@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/packetsource"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func batchTestPacket(seq int) []byte {
+	data := netflow5.NetFlow5{}
+	count := 1 + seq%netflow5.MaxFlows
+	data.Header.SetVersion(5)
+	data.Header.SetLength(uint16(count))
+	data.Header.SetFlowSequence(uint32(seq))
+	for i := 0; i < count; i++ {
+		data.Flows[i].SetSrcIP(net.IPv4(10, byte(seq>>8), byte(seq), byte(i)))
+		data.Flows[i].SetDOctets(uint32(seq*100 + i))
+	}
+
+	packet, _ := data.MarshalBinary()
+	return packet
+}
+
+// checkBatch verifies the flows of a batch still hold the values of the packet they were decoded from
+func checkBatch(t *testing.T, b *Batch) {
+	seq := int(b.Header.FlowSequence())
+	if len(b.Flows) != 1+seq%netflow5.MaxFlows {
+		t.Errorf("packet %d : expected %d flows got %d", seq, 1+seq%netflow5.MaxFlows, len(b.Flows))
+		return
+	}
+
+	for i := range b.Flows {
+		flow := &b.Flows[i]
+		if !flow.SrcIP().Equal(net.IPv4(10, byte(seq>>8), byte(seq), byte(i))) || flow.DOctets() != uint32(seq*100+i) {
+			t.Errorf("packet %d : flow %d corrupted src %s octets %d", seq, i, flow.SrcIP(), flow.DOctets())
+			return
+		}
+	}
+}
+
+func TestBatchRetain(t *testing.T) {
+	for _, unsafe := range []bool{false, true} {
+		const packets = 300
+		feed := packetsource.NewFeed(4)
+		retained := make(chan *Batch, packets)
+		p := &Processor{
+			Source:            feed,
+			Workers:           4,
+			Backlog:           4,
+			ByteArrayPoolSize: 4,
+			PacketSize:        netflow5.MaxPacketSize,
+			Unsafe:            unsafe,
+			BatchHandler: BatchHandlerFunc(func(b *Batch) {
+				b.Retain()
+				retained <- b
+			}),
+		}
+
+		done := make(chan struct{})
+		go func() {
+			p.Start()
+			close(done)
+		}()
+
+		remote := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2055}
+		var batches []*Batch
+		for seq := 0; seq < packets; seq++ {
+			if err := feed.Send(remote, batchTestPacket(seq)); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case b := <-retained:
+				batches = append(batches, b)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("unsafe %v : packet %d not handled", unsafe, seq)
+			}
+		}
+
+		feed.End()
+		<-done
+		if len(batches) != packets {
+			t.Errorf("unsafe %v : %d packets of %d received", unsafe, len(batches), packets)
+		}
+
+		// the workers reused the packet buffers many times over while the batches were held
+		for _, b := range batches {
+			checkBatch(t, b)
+			b.Release()
+		}
+	}
+}
+
+func TestBatchConcurrentRetain(t *testing.T) {
+	for _, unsafe := range []bool{false, true} {
+		buffer := batchTestPacket(29)
+		b, err := decodeBatch(buffer, unsafe)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the handler hands the batch to goroutines retaining it at once
+		const retainers = 8
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < retainers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				b.Retain()
+			}()
+		}
+
+		close(start)
+		wg.Wait()
+		if b.aliased || b.refs.Load() != retainers+1 {
+			t.Errorf("unsafe %v : aliased %v with %d references", unsafe, b.aliased, b.refs.Load())
+		}
+
+		// HandleBatch returned, the packet buffer is reused
+		clear(buffer)
+		wg.Add(retainers)
+		for i := 0; i < retainers; i++ {
+			go func() {
+				defer wg.Done()
+				checkBatch(t, b)
+				b.Release()
+			}()
+		}
+
+		wg.Wait()
+		b.Release()
+	}
+}
+
+func TestBatchRelease(t *testing.T) {
+	b, err := decodeBatch(batchTestPacket(3), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Retain()
+	b.Release()
+	checkBatch(t, b)
+	b.Release()
+	defer func() {
+		if recover() == nil {
+			t.Error("releasing a released batch must panic")
+		}
+	}()
+
+	// a batch holding no reference, never put in the pool
+	b = &Batch{}
+	b.Release()
+}
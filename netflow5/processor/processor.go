@@ -2,13 +2,17 @@ package processor
 
 import (
 	"errors"
-	"github.com/wwicak/go-utils/bytearraypool"
-	"github.com/wwicak/go-utils/bytesdispatcher"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/collector"
+	"github.com/wwicak/go-utils/flowfilter"
 	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/packetsource"
+	"github.com/wwicak/go-utils/pcap"
+	"github.com/wwicak/go-utils/relay"
 	"net"
-	"runtime"
-	"strings"
-	"unsafe"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // FlowHandler the handler for a netflow 5 flow
@@ -27,6 +31,9 @@ func (f FlowHandlerFunc) HandleFlow(header *netflow5.Header, i int, flow *netflo
 	f(header, i, flow)
 }
 
+// FlowsHandler the handler for the flows of a netflow 5 packet.
+// The header and flows point into pooled storage and must not be used after HandleFlows returns,
+// use a BatchHandler to keep them longer.
 type FlowsHandler interface {
 	HandleFlows(header *netflow5.Header, flows []netflow5.Flow)
 }
@@ -45,14 +52,30 @@ func FlowToFlowsHandler(h FlowHandler) FlowsHandler {
 	})
 }
 
-// Processor the processor for netflow 5 flows
+// NetFlow7Handler an optional interface of a FlowsHandler.
+// When implemented NetFlow v7 packets are passed to HandleNetFlow7 instead of HandleFlows
+// giving access to the router shortcut of the flows.
+type NetFlow7Handler interface {
+	HandleNetFlow7(packet *netflow5.NetFlow7)
+}
+
+// Processor the processor for netflow 5 flows.
+// NetFlow v1 and v7 packets are also accepted, header.Version() tells them apart.
 type Processor struct {
 	// Conn a net.PacketConn.
 	// Default : UDPConn listining at 127.0.0.1:2055.
 	Conn net.PacketConn
-	// Handler a FlowHandler function to handle the netflow5 flows
-	// Required.
+	// Source where the packets are read from, taking precedence over Conn.
+	// A pcap.Reader replays a capture, Start returns once it is exhausted.
+	// Default : Conn
+	Source packetsource.PacketSource
+	// Handler a FlowHandler function to handle the netflow5 flows.
+	// The flows are only valid until HandleFlows returns.
+	// Required unless BatchHandler or Relay is set.
 	Handler FlowsHandler
+	// BatchHandler handles the flows as batches that can be retained past the call, taking precedence over Handler.
+	// Default : nil
+	BatchHandler BatchHandler
 	// Workers the number of worker to work on the queue
 	// Default : The number of runtime.GOMAXPROCS
 	Workers int
@@ -65,113 +88,194 @@ type Processor struct {
 	// ByteArrayPoolSize the number byte arrays to have avialable in the pool.
 	// Default : The same size of the backlog
 	ByteArrayPoolSize int
-	byteArrayPool     *bytearraypool.ByteArrayPool
-	stopChan          chan struct{}
-	dispatcher        *bytesdispatcher.Dispatcher
+	// Affinity when true packets from the same exporter are always handled by the same worker
+	// preserving their order.
+	// Default : false
+	Affinity bool
+	// AffinityKey computes the key used to select the worker when Affinity is set.
+	// Default : a hash of the remote IP address
+	AffinityKey func(remote net.Addr, packet []byte) uint64
+	// ACL the access list the remote address of the exporter is checked against.
+	// Default : nil, every exporter is accepted
+	ACL *acl.ACL
+	// Unsafe when true packets are validated and cast in place instead of being decoded.
+	// Requires a PacketSize of at least netflow5.MaxPacketSize.
+	// Default : false
+	Unsafe bool
+	// Relay forwards every accepted packet unchanged to downstream collectors.
+	// Default : nil, no forwarding
+	Relay *relay.Relay
+	// Recorder records every accepted packet to pcap files.
+	// Default : nil, no recording
+	Recorder *pcap.Recorder
+	// Tracker records the sequence gaps and health of every exporter.
+	// Packets are observed in the receiving goroutine so their order is kept.
+	// Default : nil, no tracking
+	Tracker *netflow5.Tracker
+	// Filter drops the flows not matching before the handlers run, the header count is updated,
+	// the packets left without flows are not handled.
+	// Default : nil, every flow is handled
+	Filter    *flowfilter.Filter
+	collector collector.Collector[*Batch]
+	filtered  atomic.Uint64
 }
 
 func (p *Processor) setDefaults() {
-	if p.Handler == nil {
+	if p.Handler == nil && p.BatchHandler == nil && p.Relay == nil {
 		panic(errors.New("No handler defined"))
 	}
 
-	if p.Workers <= 0 {
-		p.Workers = runtime.GOMAXPROCS(0)
+	// the default packet size fits any packet
+	if p.Unsafe && p.PacketSize > 0 && p.PacketSize < netflow5.MaxPacketSize {
+		panic(errors.New("PacketSize too small for Unsafe"))
 	}
 
-	if p.PacketSize <= 0 {
-		p.PacketSize = 2048
+	p.collector.Config = collector.Config{
+		Address:           "127.0.0.1:2055",
+		Conn:              p.Conn,
+		Source:            p.Source,
+		Workers:           p.Workers,
+		Backlog:           p.Backlog,
+		PacketSize:        p.PacketSize,
+		ByteArrayPoolSize: p.ByteArrayPoolSize,
+		Affinity:          p.Affinity,
+		AffinityKey:       p.AffinityKey,
+		ACL:               p.ACL,
+		Relay:             p.Relay,
+		Recorder:          p.Recorder,
 	}
 
-	if p.Backlog <= 0 {
-		p.Backlog = 100
+	if p.Tracker != nil {
+		p.collector.Observe = p.observe
 	}
 
-	if p.ByteArrayPoolSize <= 0 {
-		p.ByteArrayPoolSize = p.Backlog
+	if p.Handler != nil || p.BatchHandler != nil {
+		unsafe := p.Unsafe
+		p.collector.Decoder = collector.DecoderFunc[*Batch](func(_ net.Addr, buffer []byte) (*Batch, error) {
+			return decodeBatch(buffer, unsafe)
+		})
+		p.collector.Sink = sinkForNetFlow5Handler(p.Handler, p.BatchHandler, p.Filter, &p.filtered)
 	}
+}
 
-	p.byteArrayPool = bytearraypool.NewByteArrayPool(p.ByteArrayPoolSize, p.PacketSize)
+var netFlow5Pool = sync.Pool{
+	New: func() any { return &netflow5.NetFlow5{} },
+}
 
-	if p.Conn == nil {
-		conn, err := net.ListenPacket("udp", "127.0.0.1:2055")
-		if err != nil {
-			panic(err)
-		}
+var netFlow7Pool = sync.Pool{
+	New: func() any { return &netflow5.NetFlow7{} },
+}
 
-		p.Conn = conn
+// decodeBatch decodes a NetFlow v1, v5 or v7 packet into a batch.
+// With unsafe v5 packets are cast in place and the batch aliases the buffer.
+func decodeBatch(buffer []byte, unsafe bool) (*Batch, error) {
+	version, err := netflow5.Version(buffer)
+	if err != nil {
+		return nil, err
 	}
 
-	if p.stopChan == nil {
-		p.stopChan = make(chan struct{}, 1)
+	switch version {
+	case 5:
+		if unsafe {
+			data, err := netflow5.Cast(buffer)
+			if err != nil {
+				return nil, err
+			}
+
+			b := newBatch()
+			b.Header = &data.Header
+			b.Flows = data.FlowArray()
+			b.aliased = true
+			return b, nil
+		}
+
+		data := netFlow5Pool.Get().(*netflow5.NetFlow5)
+		if err := data.Decode(buffer); err != nil {
+			netFlow5Pool.Put(data)
+			return nil, err
+		}
+
+		b := newBatch()
+		b.setNetFlow5(data)
+		return b, nil
+	case 1:
+		data := netFlow5Pool.Get().(*netflow5.NetFlow5)
+		if err := data.DecodeV1(buffer); err != nil {
+			netFlow5Pool.Put(data)
+			return nil, err
+		}
+
+		b := newBatch()
+		b.setNetFlow5(data)
+		return b, nil
+	case 7:
+		data := netFlow7Pool.Get().(*netflow5.NetFlow7)
+		if err := data.Decode(buffer); err != nil {
+			netFlow7Pool.Put(data)
+			return nil, err
+		}
+
+		b := newBatch()
+		b.setNetFlow7(data)
+		return b, nil
 	}
 
-	p.dispatcher = bytesdispatcher.NewDispatcher(p.Workers, p.Backlog, bytesHandlerForNetFlow5Handler(p.Handler), p.byteArrayPool)
+	return nil, netflow5.ErrVersion
 }
 
-func bytesHandlerForNetFlow5Handler(h FlowsHandler) bytesdispatcher.BytesHandler {
-	return bytesdispatcher.BytesHandlerFunc(
-		func(buffer []byte) {
-			var data *netflow5.NetFlow5
-			data = (*netflow5.NetFlow5)(unsafe.Pointer(&buffer[0]))
-			header := &data.Header
-			if header.Version() == 5 {
-				h.HandleFlows(header, data.FlowArray())
+func sinkForNetFlow5Handler(h FlowsHandler, bh BatchHandler, filter *flowfilter.Filter, filtered *atomic.Uint64) collector.Sink[*Batch] {
+	return collector.SinkFunc[*Batch](
+		func(remote net.Addr, b *Batch) {
+			defer b.Release()
+			if filter != nil {
+				filtered.Add(uint64(b.filter(acl.AddrOf(remote), filter)))
+				if len(b.Flows) == 0 {
+					return
+				}
+			}
+
+			if bh != nil {
+				bh.HandleBatch(b)
+				return
 			}
+
+			if h7, ok := h.(NetFlow7Handler); ok && b.NetFlow7 != nil {
+				h7.HandleNetFlow7(b.NetFlow7)
+				return
+			}
+
+			h.HandleFlows(b.Header, b.Flows)
 		},
 	)
 }
 
+// observe tracks the sequence of an accepted packet
+func (p *Processor) observe(remote net.Addr, packet []byte) {
+	p.Tracker.ObservePacket(acl.AddrOf(remote), packet, time.Now())
+}
+
+// Rejected returns the number of packets dropped by the access lists
+func (p *Processor) Rejected() uint64 {
+	return p.collector.Rejected()
+}
+
+// Filtered returns the number of flows dropped by the filter
+func (p *Processor) Filtered() uint64 {
+	return p.filtered.Load()
+}
+
 // Stop stops the processor.
 func (p *Processor) Stop() {
-	c := p.stopChan
-	p.stopChan = nil
-	c <- struct{}{}
-	p.Conn.Close()
+	p.collector.Stop()
 }
 
 // StopAndWait stops the processor and wait for the dispatcher to cleanup
 func (p *Processor) StopAndWait() {
-	p.Stop()
-	p.dispatcher.Wait()
-}
-
-func (p *Processor) isCloseError(err error) bool {
-	if p.stopChan != nil {
-		return false
-	}
-
-	str := err.Error()
-	return strings.Contains(str, "use of closed network connection")
+	p.collector.StopAndWait()
 }
 
 // Start starts the processor.
 func (p *Processor) Start() {
 	p.setDefaults()
-	dispatcher := p.dispatcher
-	dispatcher.Run()
-	stopChan := p.stopChan
-
-LOOP:
-	for {
-		buffer := p.byteArrayPool.Get()
-		rlen, remote, err := p.Conn.ReadFrom(buffer)
-		if err != nil {
-			if p.isCloseError(err) {
-				break
-			}
-
-			panic(err)
-		}
-		_, _ = rlen, remote
-		dispatcher.SubmitJob(buffer)
-		select {
-		case <-stopChan:
-			break LOOP
-		default:
-			continue
-		}
-	}
-
-	dispatcher.Stop()
+	p.collector.Start()
 }
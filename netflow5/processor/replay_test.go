@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/netflow5"
+	"github.com/wwicak/go-utils/pcap"
+	"sync"
+	"testing"
+)
+
+// rawPcap builds a pcap capture of IPv4 UDP datagrams sent from 192.0.2.1:50000 to 198.51.100.1:2055
+func rawPcap(payloads ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 0xa1b2c3d4)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint32(b, 65535)
+	b = binary.LittleEndian.AppendUint32(b, pcap.LinkTypeRaw)
+	for i, payload := range payloads {
+		ip := make([]byte, 28, 28+len(payload))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(28+len(payload)))
+		ip[9] = 17
+		copy(ip[12:16], []byte{192, 0, 2, 1})
+		copy(ip[16:20], []byte{198, 51, 100, 1})
+		binary.BigEndian.PutUint16(ip[20:22], 50000)
+		binary.BigEndian.PutUint16(ip[22:24], 2055)
+		binary.BigEndian.PutUint16(ip[24:26], uint16(8+len(payload)))
+		ip = append(ip, payload...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(1700000000+i))
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(ip)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(ip)))
+		b = append(b, ip...)
+	}
+
+	return b
+}
+
+func TestReplay(t *testing.T) {
+	var payloads [][]byte
+	for seq := 0; seq < 50; seq++ {
+		payloads = append(payloads, batchTestPacket(seq))
+	}
+
+	reader, err := pcap.NewReader(bytes.NewReader(rawPcap(payloads...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	flows := 0
+	tracker := netflow5.NewTracker()
+	p := &Processor{
+		Source:  reader,
+		Tracker: tracker,
+		Handler: FlowsHandlerFunc(func(header *netflow5.Header, f []netflow5.Flow) {
+			lock.Lock()
+			flows += len(f)
+			lock.Unlock()
+		}),
+	}
+
+	// Start returns once the capture is replayed and handled
+	p.Start()
+	expected := 0
+	for seq := 0; seq < 50; seq++ {
+		expected += 1 + seq%netflow5.MaxFlows
+	}
+
+	if flows != expected {
+		t.Errorf("expected %d flows got %d", expected, flows)
+	}
+
+	exporters := tracker.Exporters()
+	if len(exporters) != 1 || exporters[0].Exporter.String() != "192.0.2.1" || exporters[0].Packets != 50 || exporters[0].LostFlows != 0 {
+		t.Errorf("unexpected exporters %+v", exporters)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, unsafe := range []bool{false, true} {
+		var payloads [][]byte
+		for seq := 0; seq < 10; seq++ {
+			payloads = append(payloads, batchTestPacket(seq))
+		}
+
+		reader, err := pcap.NewReader(bytes.NewReader(rawPcap(payloads...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		flows, packets := 0, 0
+		p := &Processor{
+			Source:  reader,
+			Unsafe:  unsafe,
+			Workers: 1,
+			Filter:  flowfilter.MustParse("bytes < 500 and agent 192.0.2.1"),
+			Handler: FlowsHandlerFunc(func(header *netflow5.Header, f []netflow5.Flow) {
+				packets++
+				flows += len(f)
+				if int(header.Length()) != len(f) {
+					t.Errorf("header count %d for %d flows", header.Length(), len(f))
+				}
+
+				for i := range f {
+					if f[i].DOctets() >= 500 {
+						t.Errorf("flow of %d bytes not filtered", f[i].DOctets())
+					}
+				}
+			}),
+		}
+
+		p.Start()
+		// the packet seq holds the flows of seq*100 to seq*100+seq bytes
+		if packets != 5 || flows != 15 || p.Filtered() != 55-15 {
+			t.Errorf("unsafe %v : %d packets %d flows %d filtered, want 5, 15 and 40", unsafe, packets, flows, p.Filtered())
+		}
+	}
+}
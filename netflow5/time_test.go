@@ -0,0 +1,72 @@
+package netflow5
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlowTimes(t *testing.T) {
+	f, err := Decode(testPacket(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &f.Header
+	flow := &f.Flows[0]
+	exported := time.Unix(1700000000, 500)
+	if !h.Time().Equal(exported) {
+		t.Errorf("Time: got %s expected %s", h.Time(), exported)
+	}
+
+	if got := flow.StartTime(h); !got.Equal(exported.Add(-10 * time.Second)) {
+		t.Errorf("StartTime: got %s", got)
+	}
+
+	if got := flow.EndTime(h); !got.Equal(exported.Add(-time.Second)) {
+		t.Errorf("EndTime: got %s", got)
+	}
+
+	if flow.Duration() != 9*time.Second {
+		t.Errorf("Duration: got %s", flow.Duration())
+	}
+
+	// The device uptime wrapped after the start of the flow
+	h.SetSysUptime(1000)
+	flow.SetFirst(0xFFFFFFFF - 999)
+	flow.SetLast(500)
+	if got := flow.StartTime(h); !got.Equal(exported.Add(-2 * time.Second)) {
+		t.Errorf("StartTime after wraparound: got %s", got)
+	}
+
+	if flow.Duration() != 1500*time.Millisecond {
+		t.Errorf("Duration after wraparound: got %s", flow.Duration())
+	}
+
+	// The flow ended after the device uptime of the header
+	flow.SetLast(1500)
+	if got := flow.EndTime(h); !got.Equal(exported.Add(500 * time.Millisecond)) {
+		t.Errorf("EndTime after SysUptime: got %s", got)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	f, err := Decode(testPacket(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &f.Header
+	flow := &f.Flows[0]
+	if h.SamplingMode() != SamplingModeDeterministic || h.SamplingRate() != 100 {
+		t.Errorf("Got mode %d rate %d", h.SamplingMode(), h.SamplingRate())
+	}
+
+	if flow.ScaledDPkts(h) != 1000 || flow.ScaledDOctets(h) != 150000 {
+		t.Errorf("Got %d packets %d bytes", flow.ScaledDPkts(h), flow.ScaledDOctets(h))
+	}
+
+	h.SetSamplingInterval(0)
+	if flow.ScaledDPkts(h) != 10 {
+		t.Errorf("Unsampled flow scaled to %d packets", flow.ScaledDPkts(h))
+	}
+}
@@ -0,0 +1,309 @@
+package netflow5
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ExporterKey identifies a flow export process: an exporter and its flow-switching engine
+type ExporterKey struct {
+	Exporter   netip.Addr
+	EngineType uint8
+	EngineID   uint8
+}
+
+// ExporterStats the health of an export process as seen by a Tracker
+type ExporterStats struct {
+	ExporterKey
+	// Version the NetFlow version of the last packet
+	Version uint16
+	// FirstSeen the receive time of the first packet
+	FirstSeen time.Time
+	// LastSeen the receive time of the last packet
+	LastSeen time.Time
+	// Packets the number of packets received
+	Packets uint64
+	// Flows the number of flows received
+	Flows uint64
+	// LostFlows the number of flows missing from the sequence, less the ones received late
+	LostFlows uint64
+	// OutOfOrder the number of packets received with a sequence behind the expected one
+	OutOfOrder uint64
+	// Restarts the number of times the exporter was detected restarting
+	Restarts uint64
+	// LastRestart the receive time of the packet the last restart was detected on
+	LastRestart time.Time
+	// PacketRate the packets per second measured over the last complete rate interval
+	PacketRate float64
+	// SamplingInterval the sampling interval of the last packet
+	SamplingInterval uint16
+	// ClockSkew the receive time minus the export time of the last packet.
+	// Positive when the exporter clock is behind ours.
+	ClockSkew time.Duration
+	// SysUptime the uptime of the last packet
+	SysUptime uint32
+	// NextSequence the flow sequence expected in the next packet
+	NextSequence uint32
+}
+
+// LossRatio the ratio of flows lost over flows sent
+func (s *ExporterStats) LossRatio() float64 {
+	total := s.Flows + s.LostFlows
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.LostFlows) / float64(total)
+}
+
+// Stale reports whether nothing was received from the exporter for longer than maxAge
+func (s *ExporterStats) Stale(now time.Time, maxAge time.Duration) bool {
+	return now.Sub(s.LastSeen) > maxAge
+}
+
+type exporterState struct {
+	ExporterStats
+	rateStart   time.Time
+	ratePackets uint64
+}
+
+// Tracker tracks the sequence numbers and health of NetFlow exporters.
+// Packets must be observed in the order they were received for the loss accounting to be accurate.
+type Tracker struct {
+	// RateInterval the interval the packet rate is measured over
+	// Default : 1 minute
+	RateInterval time.Duration
+	// MaxReorder the number of flows a sequence may go backward before it is considered reset
+	// Default : 1000
+	MaxReorder uint32
+	// RestartTolerance how far the uptime may go backward or drift from the receive time before it is taken
+	// for a restart rather than a late packet or the 49.7 days wraparound.
+	// Default : 1 minute
+	RestartTolerance time.Duration
+	lock             sync.RWMutex
+	exporters        map[ExporterKey]*exporterState
+}
+
+// NewTracker creates a Tracker with the default settings
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// ObservePacket records a raw NetFlow v1, v5 or v7 packet received at the given time from the exporter
+func (t *Tracker) ObservePacket(exporter netip.Addr, data []byte, received time.Time) error {
+	version, err := Version(data)
+	if err != nil {
+		return err
+	}
+
+	var header Header
+	switch version {
+	case 1:
+		if len(data) < HeaderSizeV1 {
+			return ErrTooShort
+		}
+		header.nVersion = hton16(version)
+		header.nLength = hton16(binary.BigEndian.Uint16(data[2:4]))
+		header.nSysUptime = hton32(binary.BigEndian.Uint32(data[4:8]))
+		header.nUnixSecs = hton32(binary.BigEndian.Uint32(data[8:12]))
+		header.nUnixNsecs = hton32(binary.BigEndian.Uint32(data[12:16]))
+	case 5, 7:
+		if len(data) < HeaderSize {
+			return ErrTooShort
+		}
+		header.decode(data[:HeaderSize])
+		if version == 7 {
+			header.EngineType = 0
+			header.EngineID = 0
+			header.nSamplingInterval = 0
+		}
+	default:
+		return ErrVersion
+	}
+
+	t.Observe(exporter, &header, received)
+	return nil
+}
+
+// Observe records a packet header received at the given time from the exporter
+func (t *Tracker) Observe(exporter netip.Addr, h *Header, received time.Time) {
+	key := ExporterKey{Exporter: exporter.Unmap(), EngineType: h.EngineType, EngineID: h.EngineID}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.exporters == nil {
+		t.exporters = make(map[ExporterKey]*exporterState)
+	}
+
+	flows := uint32(h.Length())
+	sequence := h.FlowSequence()
+	late := false
+	s, found := t.exporters[key]
+	if !found {
+		s = &exporterState{
+			ExporterStats: ExporterStats{ExporterKey: key, FirstSeen: received},
+			rateStart:     received,
+		}
+		t.exporters[key] = s
+	} else if t.restarted(s, h, received) {
+		s.Restarts++
+		s.LastRestart = received
+	} else if h.Version() != 1 {
+		// NetFlow v1 has no flow sequence
+		switch gap := sequence - s.NextSequence; {
+		case gap == 0:
+		case gap < 1<<31:
+			s.LostFlows += uint64(gap)
+		case -gap <= t.maxReorder():
+			// the flows of a late packet were counted lost when the sequence skipped them
+			s.OutOfOrder++
+			s.LostFlows -= min(s.LostFlows, uint64(flows))
+			late = true
+		default:
+			// the sequence was reset without the exporter restarting
+			s.Restarts++
+			s.LastRestart = received
+		}
+	}
+
+	s.Version = h.Version()
+	s.Packets++
+	s.Flows += uint64(h.Length())
+	if !late {
+		// keep expecting the sequence after the latest packet
+		s.NextSequence = sequence + flows
+		s.SysUptime = h.SysUptime()
+	}
+
+	s.SamplingInterval = h.SamplingInterval()
+	s.ClockSkew = received.Sub(h.Time())
+	if received.After(s.LastSeen) {
+		s.LastSeen = received
+	}
+
+	s.ratePackets++
+	if elapsed := received.Sub(s.rateStart); elapsed >= t.rateInterval() {
+		s.PacketRate = float64(s.ratePackets) / elapsed.Seconds()
+		s.rateStart = received
+		s.ratePackets = 0
+	}
+}
+
+// restarted detects a restart of the exporter from its uptime going backward.
+// A wraparound of the uptime is told apart by it matching the time elapsed since the last packet.
+func (t *Tracker) restarted(s *exporterState, h *Header, received time.Time) bool {
+	uptime := h.SysUptime()
+	if uptime >= s.SysUptime {
+		return false
+	}
+
+	// a late packet
+	if time.Duration(s.SysUptime-uptime)*time.Millisecond <= t.restartTolerance() {
+		return false
+	}
+
+	byUptime := time.Duration(uptime-s.SysUptime) * time.Millisecond
+	drift := byUptime - received.Sub(s.LastSeen)
+	if drift < 0 {
+		drift = -drift
+	}
+
+	return drift > t.restartTolerance()
+}
+
+func (t *Tracker) rateInterval() time.Duration {
+	if t.RateInterval <= 0 {
+		return time.Minute
+	}
+
+	return t.RateInterval
+}
+
+func (t *Tracker) maxReorder() uint32 {
+	if t.MaxReorder == 0 {
+		return 1000
+	}
+
+	return t.MaxReorder
+}
+
+func (t *Tracker) restartTolerance() time.Duration {
+	if t.RestartTolerance <= 0 {
+		return time.Minute
+	}
+
+	return t.RestartTolerance
+}
+
+// Get returns the stats of an export process
+func (t *Tracker) Get(key ExporterKey) (ExporterStats, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	s, found := t.exporters[key]
+	if !found {
+		return ExporterStats{}, false
+	}
+
+	return s.ExporterStats, true
+}
+
+// Exporters returns the stats of every export process ordered by exporter, engine type and engine id
+func (t *Tracker) Exporters() []ExporterStats {
+	t.lock.RLock()
+	stats := make([]ExporterStats, 0, len(t.exporters))
+	for _, s := range t.exporters {
+		stats = append(stats, s.ExporterStats)
+	}
+	t.lock.RUnlock()
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i].ExporterKey, stats[j].ExporterKey
+		if c := a.Exporter.Compare(b.Exporter); c != 0 {
+			return c < 0
+		}
+
+		if a.EngineType != b.EngineType {
+			return a.EngineType < b.EngineType
+		}
+
+		return a.EngineID < b.EngineID
+	})
+
+	return stats
+}
+
+// Lossy returns the stats of the export processes that lost flows
+func (t *Tracker) Lossy() []ExporterStats {
+	stats := t.Exporters()
+	lossy := stats[:0]
+	for _, s := range stats {
+		if s.LostFlows > 0 {
+			lossy = append(lossy, s)
+		}
+	}
+
+	return lossy
+}
+
+// Expire forgets the export processes not seen for longer than maxAge and returns how many were removed
+func (t *Tracker) Expire(now time.Time, maxAge time.Duration) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	removed := 0
+	for key, s := range t.exporters {
+		if s.Stale(now, maxAge) {
+			delete(t.exporters, key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Len the number of export processes tracked
+func (t *Tracker) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.exporters)
+}
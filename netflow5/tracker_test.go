@@ -0,0 +1,128 @@
+package netflow5
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func trackerHeader(engineID uint8, uptime, seq uint32, flows uint16, exported time.Time) *Header {
+	h := &Header{EngineID: engineID}
+	h.SetVersion(5)
+	h.SetLength(flows)
+	h.SetSysUptime(uptime)
+	h.SetUnixSecs(uint32(exported.Unix()))
+	h.SetFlowSequence(seq)
+	h.SetSamplingInterval(0x4064)
+	return h
+}
+
+func TestTracker(t *testing.T) {
+	exporter := netip.MustParseAddr("192.0.2.1")
+	start := time.Unix(1700000000, 0)
+	tracker := &Tracker{RateInterval: 10 * time.Second}
+	key := ExporterKey{Exporter: exporter, EngineID: 1}
+
+	// 30 flows per second, the exporter clock is 2 seconds behind
+	for i := 0; i < 10; i++ {
+		received := start.Add(time.Duration(i) * time.Second)
+		tracker.Observe(exporter, trackerHeader(1, 100000+uint32(i)*1000, uint32(i)*30, 30, received.Add(-2*time.Second)), received)
+	}
+
+	// 60 flows lost
+	received := start.Add(12 * time.Second)
+	tracker.Observe(exporter, trackerHeader(1, 112000, 360, 30, received), received)
+	// a late packet, half of the gap is recovered
+	tracker.Observe(exporter, trackerHeader(1, 111000, 330, 30, received), received)
+
+	s, found := tracker.Get(key)
+	if !found {
+		t.Fatal("exporter not tracked")
+	}
+
+	if s.Packets != 12 || s.Flows != 360 || s.LostFlows != 30 || s.OutOfOrder != 1 || s.Restarts != 0 {
+		t.Errorf("unexpected counters %+v", s)
+	}
+
+	if s.LossRatio() != 30.0/390 {
+		t.Errorf("expected a loss ratio of 30/390 got %f", s.LossRatio())
+	}
+
+	if s.NextSequence != 390 {
+		t.Errorf("expected next sequence 390 got %d", s.NextSequence)
+	}
+
+	if s.ClockSkew != 0 {
+		t.Errorf("expected no clock skew got %s", s.ClockSkew)
+	}
+
+	if s.PacketRate != 11.0/12 {
+		t.Errorf("expected a rate of 11/12 packets per second got %f", s.PacketRate)
+	}
+
+	if s.SamplingInterval != 0x4064 || s.LastSeen != received || s.FirstSeen != start {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	// the exporter restarts
+	received = received.Add(time.Minute)
+	tracker.Observe(exporter, trackerHeader(1, 5000, 0, 10, received), received)
+	s, _ = tracker.Get(key)
+	if s.Restarts != 1 || s.LostFlows != 30 || s.NextSequence != 10 || s.LastRestart != received {
+		t.Errorf("restart not detected %+v", s)
+	}
+
+	// a second engine of the same exporter is tracked apart
+	tracker.Observe(exporter, trackerHeader(2, 5000, 1000, 10, received), received)
+	if tracker.Len() != 2 {
+		t.Fatalf("expected 2 export processes got %d", tracker.Len())
+	}
+
+	if lossy := tracker.Lossy(); len(lossy) != 1 || lossy[0].ExporterKey != key {
+		t.Errorf("unexpected lossy exporters %+v", lossy)
+	}
+
+	if removed := tracker.Expire(received.Add(time.Hour), time.Minute); removed != 2 || tracker.Len() != 0 {
+		t.Errorf("expected 2 expired exporters got %d", removed)
+	}
+}
+
+func TestTrackerUptimeWraparound(t *testing.T) {
+	exporter := netip.MustParseAddr("192.0.2.1")
+	received := time.Unix(1700000000, 0)
+	tracker := NewTracker()
+	tracker.Observe(exporter, trackerHeader(0, 0xFFFFFC18, 0, 30, received), received)
+	received = received.Add(2 * time.Second)
+	tracker.Observe(exporter, trackerHeader(0, 1000, 30, 30, received), received)
+	s, _ := tracker.Get(ExporterKey{Exporter: exporter})
+	if s.Restarts != 0 || s.LostFlows != 0 {
+		t.Errorf("wraparound taken for a restart %+v", s)
+	}
+}
+
+func TestTrackerObservePacket(t *testing.T) {
+	exporter := netip.MustParseAddr("::ffff:192.0.2.1")
+	tracker := NewTracker()
+	received := time.Unix(1700000010, 0)
+	if err := tracker.ObservePacket(exporter, testPacket(2), received); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracker.ObservePacket(exporter, []byte{0, 9}, received); err != ErrVersion {
+		t.Errorf("expected ErrVersion got %v", err)
+	}
+
+	stats := tracker.Exporters()
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 export process got %d", len(stats))
+	}
+
+	s := stats[0]
+	if s.Exporter != netip.MustParseAddr("192.0.2.1") || s.EngineType != 1 || s.EngineID != 2 {
+		t.Errorf("unexpected key %+v", s.ExporterKey)
+	}
+
+	if s.NextSequence != 44 || s.Version != 5 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
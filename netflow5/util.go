@@ -1,19 +1,34 @@
 package netflow5
 
-import "unsafe"
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// The n prefixed fields of Header and Flow hold the bytes as they are on the wire.
+// ntoh reads those bytes in network order, hton stores a value as network order bytes,
+// both work regardless of the byte order of the host.
 
 func ntoh16(n uint16) uint16 {
-	buff := (*[2]byte)(unsafe.Pointer(&n))
-	return (uint16(buff[0]) << 8) | uint16(buff[1])
+	return binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&n))[:])
 }
 
 func ntoh32(n uint32) uint32 {
-	buff := (*[4]byte)(unsafe.Pointer(&n))
-	return (uint32(buff[0]) << 24) | (uint32(buff[1]) << 16) | (uint32(buff[2]) << 8) | uint32(buff[3])
+	return binary.BigEndian.Uint32((*[4]byte)(unsafe.Pointer(&n))[:])
 }
 
 func ntoh64(n uint64) uint64 {
-	buff := (*[8]byte)(unsafe.Pointer(&n))
-	return (uint64(buff[0]) << 56) | (uint64(buff[1]) << 48) | (uint64(buff[2]) << 40) | (uint64(buff[3]) << 32) |
-		(uint64(buff[4]) << 24) | (uint64(buff[5]) << 16) | (uint64(buff[6]) << 8) | uint64(buff[7])
+	return binary.BigEndian.Uint64((*[8]byte)(unsafe.Pointer(&n))[:])
+}
+
+func hton16(v uint16) uint16 {
+	var n uint16
+	binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&n))[:], v)
+	return n
+}
+
+func hton32(v uint32) uint32 {
+	var n uint32
+	binary.BigEndian.PutUint32((*[4]byte)(unsafe.Pointer(&n))[:], v)
+	return n
 }
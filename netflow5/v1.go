@@ -0,0 +1,67 @@
+package netflow5
+
+import "encoding/binary"
+
+const (
+	// HeaderSizeV1 size in bytes of a NetFlow v1 header
+	HeaderSizeV1 = 16
+	// FlowSizeV1 size in bytes of a NetFlow v1 flow record
+	FlowSizeV1 = 48
+	// MaxFlowsV1 maximum number of flows in a NetFlow v1 packet
+	MaxFlowsV1 = 24
+)
+
+// ValidateV1 checks that data holds a NetFlow v1 packet
+func ValidateV1(data []byte) error {
+	return validate(data, 1, HeaderSizeV1, FlowSizeV1, MaxFlowsV1)
+}
+
+// DecodeV1 decodes a NetFlow v1 packet into a new *NetFlow5.
+// v1 has no flow sequence, engine, AS numbers or masks, they are left to zero.
+func DecodeV1(data []byte) (*NetFlow5, error) {
+	f := &NetFlow5{}
+	if err := f.DecodeV1(data); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// DecodeV1 decodes a NetFlow v1 packet into f, see DecodeV1.
+func (f *NetFlow5) DecodeV1(data []byte) error {
+	if err := ValidateV1(data); err != nil {
+		return err
+	}
+
+	f.Header = Header{}
+	f.Header.nVersion = hton16(binary.BigEndian.Uint16(data[0:2]))
+	f.Header.nLength = hton16(binary.BigEndian.Uint16(data[2:4]))
+	f.Header.nSysUptime = hton32(binary.BigEndian.Uint32(data[4:8]))
+	f.Header.nUnixSecs = hton32(binary.BigEndian.Uint32(data[8:12]))
+	f.Header.nUnixNsecs = hton32(binary.BigEndian.Uint32(data[12:16]))
+	data = data[HeaderSizeV1:]
+	for i := range f.FlowArray() {
+		f.Flows[i].decodeV1(data[i*FlowSizeV1 : (i+1)*FlowSizeV1])
+	}
+
+	return nil
+}
+
+// decodeV1 decodes a v1 flow, only the protocol, ToS and TCP flags differ from v5
+func (flow *Flow) decodeV1(data []byte) {
+	*flow = Flow{}
+	copy(flow.SrcAddr[:], data[0:4])
+	copy(flow.DstAddr[:], data[4:8])
+	copy(flow.NextAddr[:], data[8:12])
+	flow.nInput = hton16(binary.BigEndian.Uint16(data[12:14]))
+	flow.nOutput = hton16(binary.BigEndian.Uint16(data[14:16]))
+	flow.nDPkts = hton32(binary.BigEndian.Uint32(data[16:20]))
+	flow.nDOctets = hton32(binary.BigEndian.Uint32(data[20:24]))
+	flow.nFirst = hton32(binary.BigEndian.Uint32(data[24:28]))
+	flow.nLast = hton32(binary.BigEndian.Uint32(data[28:32]))
+	flow.nSrcPort = hton16(binary.BigEndian.Uint16(data[32:34]))
+	flow.nDstPort = hton16(binary.BigEndian.Uint16(data[34:36]))
+	flow.Proto = data[38]
+	flow.Tos = data[39]
+	flow.TCPFlags = data[40]
+}
@@ -0,0 +1,63 @@
+package netflow5
+
+import "net"
+
+const (
+	// FlowSizeV7 size in bytes of a NetFlow v7 flow record
+	FlowSizeV7 = 52
+	// MaxFlowsV7 maximum number of flows in a NetFlow v7 packet
+	MaxFlowsV7 = 27
+)
+
+// NetFlow7 a decoded NetFlow v7 packet.
+// The first 48 bytes of a v7 flow have the v5 layout, the v7 flags are available with Flow.V7Flags.
+type NetFlow7 struct {
+	NetFlow5
+	// RouterSc the IP address of the router shortcut of each flow
+	RouterSc [MaxFlows][4]byte
+}
+
+// ValidateV7 checks that data holds a NetFlow v7 packet
+func ValidateV7(data []byte) error {
+	return validate(data, 7, HeaderSize, FlowSizeV7, MaxFlowsV7)
+}
+
+// DecodeV7 decodes a NetFlow v7 packet into a new *NetFlow7
+func DecodeV7(data []byte) (*NetFlow7, error) {
+	f := &NetFlow7{}
+	if err := f.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Decode decodes a NetFlow v7 packet into f.
+// The v7 header has no engine or sampling interval, they are left to zero.
+func (f *NetFlow7) Decode(data []byte) error {
+	if err := ValidateV7(data); err != nil {
+		return err
+	}
+
+	f.Header.decode(data[:HeaderSize])
+	f.Header.EngineType = 0
+	f.Header.EngineID = 0
+	f.Header.nSamplingInterval = 0
+	data = data[HeaderSize:]
+	for i := range f.FlowArray() {
+		flow := data[i*FlowSizeV7 : (i+1)*FlowSizeV7]
+		f.Flows[i].decode(flow[:FlowSize])
+		copy(f.RouterSc[i][:], flow[FlowSize:FlowSizeV7])
+	}
+
+	return nil
+}
+
+// RouterScIP returns the router shortcut IP address of the flow i.
+func (f *NetFlow7) RouterScIP(i int) net.IP { return net.IP(f.RouterSc[i][:]) }
+
+// V7Flags returns the two flags fields of a NetFlow v7 flow, indicating among other things which fields are invalid.
+// They are always zero for the other versions.
+func (flow *Flow) V7Flags() (uint8, uint16) {
+	return flow.pad1, uint16(flow.pad2[0])<<8 | uint16(flow.pad2[1])
+}
@@ -0,0 +1,96 @@
+package netflow5
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func testPacketV1(count int) []byte {
+	data := make([]byte, HeaderSizeV1+count*FlowSizeV1)
+	binary.BigEndian.PutUint16(data[0:2], 1)
+	binary.BigEndian.PutUint16(data[2:4], uint16(count))
+	binary.BigEndian.PutUint32(data[4:8], 360000)
+	binary.BigEndian.PutUint32(data[8:12], 1700000000)
+	for i := 0; i < count; i++ {
+		flow := data[HeaderSizeV1+i*FlowSizeV1:]
+		copy(flow[0:4], []byte{10, 0, 0, byte(i + 1)})
+		binary.BigEndian.PutUint32(flow[16:20], 10)
+		binary.BigEndian.PutUint16(flow[34:36], 53)
+		flow[38] = 17
+		flow[39] = 0x10
+		flow[40] = 0x02
+	}
+
+	return data
+}
+
+func testPacketV7(count int) []byte {
+	v5 := testPacket(count)
+	data := append([]byte(nil), v5[:HeaderSize]...)
+	binary.BigEndian.PutUint16(data[0:2], 7)
+	for i := 0; i < count; i++ {
+		data = append(data, v5[HeaderSize+i*FlowSize:HeaderSize+(i+1)*FlowSize]...)
+		flow := data[HeaderSize+i*FlowSizeV7:]
+		flow[36] = 0x01
+		flow[47] = 0x02
+		data = append(data, 172, 16, 0, byte(i))
+	}
+
+	return data
+}
+
+func TestDecodeV1(t *testing.T) {
+	f, err := DecodeV1(testPacketV1(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &f.Header
+	if h.Version() != 1 || h.Length() != 2 || h.SysUptime() != 360000 || h.FlowSequence() != 0 {
+		t.Errorf("Header decoded incorrectly %+v", h)
+	}
+
+	flow := &f.FlowArray()[1]
+	if !flow.SrcIP().Equal(net.IPv4(10, 0, 0, 2)) || flow.DPkts() != 10 || flow.DstPort() != 53 ||
+		flow.Proto != 17 || flow.Tos != 0x10 || flow.TCPFlags != 0x02 {
+		t.Errorf("Flow decoded incorrectly %+v", flow)
+	}
+
+	if _, err := DecodeV1(testPacketV1(25)); err != ErrTooManyFlows {
+		t.Errorf("Got %v expected %v", err, ErrTooManyFlows)
+	}
+
+	if _, err := DecodeV1(testPacket(1)); err != ErrVersion {
+		t.Errorf("Got %v expected %v", err, ErrVersion)
+	}
+}
+
+func TestDecodeV7(t *testing.T) {
+	f, err := DecodeV7(testPacketV7(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &f.Header
+	if h.Version() != 7 || h.Length() != 3 || h.FlowSequence() != 42 || h.SamplingInterval() != 0 || h.EngineID != 0 {
+		t.Errorf("Header decoded incorrectly %+v", h)
+	}
+
+	flow := &f.FlowArray()[2]
+	if !flow.SrcIP().Equal(net.IPv4(10, 0, 0, 3)) || flow.DstPort() != 443 || flow.SrcAs() != 64500 || flow.DstMask != 16 {
+		t.Errorf("Flow decoded incorrectly %+v", flow)
+	}
+
+	if flags1, flags2 := flow.V7Flags(); flags1 != 1 || flags2 != 2 {
+		t.Errorf("Got flags %d %d", flags1, flags2)
+	}
+
+	if !f.RouterScIP(2).Equal(net.IPv4(172, 16, 0, 2)) {
+		t.Errorf("Got router_sc %s", f.RouterScIP(2))
+	}
+
+	if _, err := DecodeV7(testPacketV7(3)[:HeaderSize+2*FlowSizeV7+FlowSize]); err != ErrTooShort {
+		t.Errorf("Got %v expected %v", err, ErrTooShort)
+	}
+}
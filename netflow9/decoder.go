@@ -0,0 +1,285 @@
+package netflow9
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wwicak/go-utils/infoelement"
+)
+
+// ScopeElements the elements of the NetFlow v9 options scope field types
+var ScopeElements = map[uint16]infoelement.Element{
+	1: {ID: 1, Name: "scopeSystem", Type: infoelement.OctetArray},
+	2: {ID: 2, Name: "scopeInterface", Type: infoelement.Unsigned32},
+	3: {ID: 3, Name: "scopeLineCard", Type: infoelement.Unsigned32},
+	4: {ID: 4, Name: "scopeCache", Type: infoelement.OctetArray},
+	5: {ID: 5, Name: "scopeTemplate", Type: infoelement.OctetArray},
+}
+
+// Record a data record decoded with its template
+type Record struct {
+	TemplateID uint16
+	// Options true for a record of an options template
+	Options bool
+	// Scope the scope fields of an options record
+	Scope  []infoelement.Field
+	Fields []infoelement.Field
+}
+
+// Get returns the first field with the element name
+func (r *Record) Get(name string) (*infoelement.Field, bool) {
+	for i := range r.Fields {
+		if r.Fields[i].Element.Name == name {
+			return &r.Fields[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Packet a decoded NetFlow v9 packet
+type Packet struct {
+	Header Header
+	// Templates the templates received in the packet
+	Templates []*Template
+	// Records the data records of the packet,
+	// followed by the buffered records of previous packets whose template was received in this packet.
+	Records []Record
+	// Pending the number of data FlowSets buffered waiting for their template
+	Pending int
+}
+
+type pendingFlowSet struct {
+	data     []byte
+	received time.Time
+}
+
+// Decoder decodes NetFlow v9 packets keeping the templates of each exporter.
+// It is safe for concurrent use.
+type Decoder struct {
+	// Registry the information elements used to name and decode the fields.
+	// Default : infoelement.Default
+	Registry *infoelement.Registry
+	// Templates the template cache.
+	// Default : templates expiring after 30 minutes
+	Templates *TemplateCache
+	// PendingTTL how long data FlowSets are buffered waiting for their template.
+	// Default : 1 minute
+	PendingTTL time.Duration
+	// MaxPending the maximum number of data FlowSets buffered per template.
+	// Default : 64
+	MaxPending int
+	// MaxPendingTemplates the maximum number of templates data FlowSets are buffered for,
+	// the FlowSets of other templates are dropped until the buffered ones are decoded or expire.
+	// Default : 1024
+	MaxPendingTemplates int
+	// Clock returns the current time.
+	// Default : time.Now
+	Clock       func() time.Time
+	lock        sync.Mutex
+	pending     map[TemplateKey][]pendingFlowSet
+	lastExpire  time.Time
+	dropped     atomic.Uint64
+	initialized sync.Once
+}
+
+// NewDecoder create a *Decoder with the defaults
+func NewDecoder() *Decoder {
+	d := &Decoder{}
+	d.initialized.Do(d.setDefaults)
+	return d
+}
+
+func (d *Decoder) setDefaults() {
+	if d.Registry == nil {
+		d.Registry = infoelement.Default
+	}
+
+	if d.Templates == nil {
+		d.Templates = NewTemplateCache(30 * time.Minute)
+	}
+
+	if d.PendingTTL <= 0 {
+		d.PendingTTL = time.Minute
+	}
+
+	if d.MaxPending <= 0 {
+		d.MaxPending = 64
+	}
+
+	if d.MaxPendingTemplates <= 0 {
+		d.MaxPendingTemplates = 1024
+	}
+
+	if d.Clock == nil {
+		d.Clock = time.Now
+	}
+
+	d.pending = make(map[TemplateKey][]pendingFlowSet)
+}
+
+// Dropped returns the number of data FlowSets dropped because their template never arrived,
+// or because too many templates had FlowSets buffered
+func (d *Decoder) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Decode decodes a packet received from exporter
+func (d *Decoder) Decode(exporter netip.Addr, data []byte) (*Packet, error) {
+	d.initialized.Do(d.setDefaults)
+	p := &Packet{}
+	flowSets, err := p.Header.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.Clock()
+	d.expire(now)
+	key := TemplateKey{Exporter: exporter, SourceID: p.Header.SourceID}
+	// Anything shorter than a FlowSet header is padding
+	for len(flowSets) >= 4 {
+		fh := FlowSetHeader{}
+		var body []byte
+		body, flowSets, err = fh.Parse(flowSets)
+		if err != nil {
+			return nil, err
+		}
+
+		var templates []*Template
+		switch {
+		case fh.ID == TemplateFlowSetID:
+			templates, err = ParseTemplates(body)
+		case fh.ID == OptionsTemplateFlowSetID:
+			templates, err = ParseOptionsTemplates(body)
+		case fh.ID >= MinDataFlowSetID:
+			key.TemplateID = fh.ID
+			t, ok := d.Templates.Get(key, now)
+			if !ok {
+				var buffered bool
+				if t, buffered = d.addPending(key, body, now); buffered {
+					p.Pending++
+				}
+
+				if t == nil {
+					continue
+				}
+			}
+
+			p.Records = d.decodeRecords(p.Records, t, body)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range templates {
+			key.TemplateID = t.ID
+			d.Templates.Set(key, t, now)
+			p.Templates = append(p.Templates, t)
+		}
+
+		for _, t := range templates {
+			key.TemplateID = t.ID
+			for _, pending := range d.takePending(key) {
+				p.Records = d.decodeRecords(p.Records, t, pending.data)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// decodeRecords decodes the records of a data FlowSet body
+func (d *Decoder) decodeRecords(records []Record, t *Template, data []byte) []Record {
+	if t.RecordLength == 0 {
+		return records
+	}
+
+	// Anything shorter than a record is padding
+	for len(data) >= t.RecordLength {
+		r := Record{TemplateID: t.ID, Options: t.Options}
+		if t.Options {
+			r.Scope = make([]infoelement.Field, len(t.ScopeFields))
+			for i, spec := range t.ScopeFields {
+				e, ok := ScopeElements[spec.Type]
+				if !ok {
+					e = infoelement.Element{ID: spec.Type, Name: "scope" + d.Registry.Get(0, spec.Type).Name, Type: infoelement.OctetArray}
+				}
+				r.Scope[i] = infoelement.Field{Element: e, Value: e.Type.Decode(data[:spec.Length])}
+				data = data[spec.Length:]
+			}
+		}
+
+		r.Fields = make([]infoelement.Field, len(t.Fields))
+		for i, spec := range t.Fields {
+			e := d.Registry.Get(0, spec.Type)
+			r.Fields[i] = infoelement.Field{Element: e, Value: e.Type.Decode(data[:spec.Length])}
+			data = data[spec.Length:]
+		}
+
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// addPending buffers a data FlowSet waiting for its template, it returns false when it was dropped.
+// The template is checked again under the lock taken by takePending, a template received by another worker
+// since it was first looked up is returned instead so that the FlowSet is not buffered after it was drained.
+func (d *Decoder) addPending(key TemplateKey, body []byte, now time.Time) (*Template, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if t, ok := d.Templates.Get(key, now); ok {
+		return t, false
+	}
+
+	pending, found := d.pending[key]
+	if !found && len(d.pending) >= d.MaxPendingTemplates {
+		d.dropped.Add(1)
+		return nil, false
+	}
+
+	if len(pending) >= d.MaxPending {
+		pending = pending[1:]
+		d.dropped.Add(1)
+	}
+
+	d.pending[key] = append(pending, pendingFlowSet{data: append([]byte(nil), body...), received: now})
+	return nil, true
+}
+
+func (d *Decoder) takePending(key TemplateKey) []pendingFlowSet {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	pending := d.pending[key]
+	delete(d.pending, key)
+	return pending
+}
+
+// expire drops the expired pending FlowSets and templates at most once a second
+func (d *Decoder) expire(now time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if now.Sub(d.lastExpire) < time.Second {
+		return
+	}
+
+	d.lastExpire = now
+	for key, pending := range d.pending {
+		i := 0
+		for i < len(pending) && now.Sub(pending[i].received) > d.PendingTTL {
+			i++
+		}
+
+		d.dropped.Add(uint64(i))
+		if i == len(pending) {
+			delete(d.pending, key)
+		} else {
+			d.pending[key] = pending[i:]
+		}
+	}
+
+	d.Templates.Expire(now)
+}
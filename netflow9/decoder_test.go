@@ -0,0 +1,276 @@
+package netflow9
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+func packet(sourceID uint32, flowSets ...[]byte) []byte {
+	data := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint16(data[0:2], 9)
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(flowSets)))
+	binary.BigEndian.PutUint32(data[4:8], 1000)
+	binary.BigEndian.PutUint32(data[8:12], 1700000000)
+	binary.BigEndian.PutUint32(data[12:16], 1)
+	binary.BigEndian.PutUint32(data[16:20], sourceID)
+	for _, flowSet := range flowSets {
+		data = append(data, flowSet...)
+	}
+
+	return data
+}
+
+func flowSet(id uint16, body ...uint16) []byte {
+	data := binary.BigEndian.AppendUint16(nil, id)
+	data = binary.BigEndian.AppendUint16(data, uint16(4+2*len(body)))
+	for _, v := range body {
+		data = binary.BigEndian.AppendUint16(data, v)
+	}
+
+	return data
+}
+
+// templateFlowSet template 256: sourceIPv4Address, destinationIPv4Address, protocolIdentifier, octetDeltaCount(4)
+var templateFlowSet = flowSet(TemplateFlowSetID, 256, 4, 8, 4, 12, 4, 4, 1, 1, 4)
+
+func dataFlowSet() []byte {
+	body := []byte{
+		10, 0, 0, 1, 192, 0, 2, 1, 6, 0, 0, 0x05, 0xdc,
+		10, 0, 0, 2, 192, 0, 2, 2, 17, 0, 0, 0, 0x40,
+		0, 0, // padding
+	}
+	data := binary.BigEndian.AppendUint16(nil, 256)
+	data = binary.BigEndian.AppendUint16(data, uint16(4+len(body)))
+	return append(data, body...)
+}
+
+func checkRecords(t *testing.T, records []Record) {
+	t.Helper()
+	if len(records) != 2 {
+		t.Fatalf("Got %d records expected 2", len(records))
+	}
+
+	src, _ := records[0].Get("sourceIPv4Address")
+	if addr, _ := src.Addr(); addr != netip.MustParseAddr("10.0.0.1") {
+		t.Errorf("sourceIPv4Address: got %v", src.Value)
+	}
+
+	octets, _ := records[0].Get("octetDeltaCount")
+	if v, _ := octets.Uint(); v != 1500 {
+		t.Errorf("octetDeltaCount: got %v", octets.Value)
+	}
+
+	proto, _ := records[1].Get("protocolIdentifier")
+	if v, _ := proto.Uint(); v != 17 {
+		t.Errorf("protocolIdentifier: got %v", proto.Value)
+	}
+}
+
+func TestDecodeTemplateAndData(t *testing.T) {
+	d := NewDecoder()
+	exporter := netip.MustParseAddr("192.0.2.10")
+	p, err := d.Decode(exporter, packet(1, templateFlowSet, dataFlowSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Templates) != 1 || p.Templates[0].RecordLength != 13 {
+		t.Errorf("Got templates %+v", p.Templates)
+	}
+
+	checkRecords(t, p.Records)
+
+	// Templates are not shared between source ids or exporters
+	for _, test := range []struct {
+		exporter netip.Addr
+		sourceID uint32
+	}{
+		{exporter, 2},
+		{netip.MustParseAddr("192.0.2.11"), 1},
+	} {
+		p, err = d.Decode(test.exporter, packet(test.sourceID, dataFlowSet()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(p.Records) != 0 || p.Pending != 1 {
+			t.Errorf("%s/%d: got %d records %d pending", test.exporter, test.sourceID, len(p.Records), p.Pending)
+		}
+	}
+}
+
+func TestDecodePending(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := &Decoder{Clock: func() time.Time { return now }}
+	exporter := netip.MustParseAddr("192.0.2.10")
+	p, err := d.Decode(exporter, packet(1, dataFlowSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Records) != 0 || p.Pending != 1 {
+		t.Fatalf("Got %d records %d pending", len(p.Records), p.Pending)
+	}
+
+	now = now.Add(10 * time.Second)
+	p, err = d.Decode(exporter, packet(1, templateFlowSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRecords(t, p.Records)
+
+	// Buffered FlowSets expire
+	if _, err = d.Decode(exporter, packet(3, dataFlowSet())); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err = d.Decode(exporter, packet(4, dataFlowSet())); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Dropped() != 1 {
+		t.Errorf("Dropped: got %d expected 1", d.Dropped())
+	}
+
+	// Templates expire
+	now = now.Add(time.Hour)
+	p, err = d.Decode(exporter, packet(1, dataFlowSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Records) != 0 || p.Pending != 1 {
+		t.Errorf("Expired template: got %d records %d pending", len(p.Records), p.Pending)
+	}
+}
+
+func TestDecodeConcurrentTemplate(t *testing.T) {
+	exporter := netip.MustParseAddr("192.0.2.10")
+	for i := 0; i < 1000; i++ {
+		d := NewDecoder()
+		var wg sync.WaitGroup
+		records := make([]int, 2)
+		for j, data := range [][]byte{packet(1, templateFlowSet), packet(1, dataFlowSet())} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p, err := d.Decode(exporter, data)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				records[j] = len(p.Records)
+			}()
+		}
+
+		wg.Wait()
+		// the data FlowSet is decoded with the template whichever worker gets it first
+		if records[0]+records[1] != 2 || len(d.pending) != 0 {
+			t.Fatalf("iteration %d: got %v records %d pending templates", i, records, len(d.pending))
+		}
+	}
+}
+
+func TestAddPendingAfterTemplate(t *testing.T) {
+	d := NewDecoder()
+	exporter := netip.MustParseAddr("192.0.2.10")
+	now := time.Now()
+	key := TemplateKey{Exporter: exporter, SourceID: 1, TemplateID: 256}
+	if _, ok := d.Templates.Get(key, now); ok {
+		t.Fatal("unexpected template")
+	}
+
+	// another worker decodes the template between the lookup of a data FlowSet and its buffering
+	if _, err := d.Decode(exporter, packet(1, templateFlowSet)); err != nil {
+		t.Fatal(err)
+	}
+
+	template, buffered := d.addPending(key, dataFlowSet()[4:], now)
+	if template == nil || buffered || len(d.pending) != 0 {
+		t.Errorf("got template %v buffered %v with %d pending templates", template, buffered, len(d.pending))
+	}
+}
+
+func TestDecodeMaxPendingTemplates(t *testing.T) {
+	d := &Decoder{MaxPendingTemplates: 2}
+	exporter := netip.MustParseAddr("192.0.2.10")
+	// data FlowSets of random template ids do not grow the buffer past 2 templates
+	for id := uint16(300); id < 310; id++ {
+		p, err := d.Decode(exporter, packet(1, flowSet(id, 1, 2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := 1
+		if id >= 302 {
+			want = 0
+		}
+
+		if p.Pending != want {
+			t.Errorf("template %d: got %d pending expected %d", id, p.Pending, want)
+		}
+	}
+
+	if len(d.pending) != 2 || d.Dropped() != 8 {
+		t.Errorf("Got %d pending templates %d dropped", len(d.pending), d.Dropped())
+	}
+
+	// the templates already pending keep buffering
+	if p, err := d.Decode(exporter, packet(1, flowSet(300, 1, 2))); err != nil || p.Pending != 1 {
+		t.Errorf("Got %v pending %v", p, err)
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	d := NewDecoder()
+	exporter := netip.MustParseAddr("192.0.2.10")
+	// options template 257: scope interface(4), samplingInterval(4), samplingAlgorithm(1)
+	options := flowSet(OptionsTemplateFlowSetID, 257, 4, 8, 2, 4, 34, 4, 35, 1, 0)
+	body := []byte{0, 0, 0, 3, 0, 0, 0x03, 0xe8, 2, 0, 0, 0}
+	data := binary.BigEndian.AppendUint16(nil, 257)
+	data = binary.BigEndian.AppendUint16(data, uint16(4+len(body)))
+	data = append(data, body...)
+	p, err := d.Decode(exporter, packet(1, options, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Records) != 1 {
+		t.Fatalf("Got %d records expected 1", len(p.Records))
+	}
+
+	r := p.Records[0]
+	if !r.Options || len(r.Scope) != 1 || r.Scope[0].Element.Name != "scopeInterface" || r.Scope[0].Value != uint64(3) {
+		t.Errorf("Got scope %+v", r.Scope)
+	}
+
+	interval, _ := r.Get("samplingInterval")
+	if v, _ := interval.Uint(); v != 1000 {
+		t.Errorf("samplingInterval: got %v", interval.Value)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	d := NewDecoder()
+	exporter := netip.MustParseAddr("192.0.2.10")
+	if _, err := d.Decode(exporter, packet(1)[:10]); err != ErrTooShort {
+		t.Errorf("Got %v expected %v", err, ErrTooShort)
+	}
+
+	truncated := packet(1, templateFlowSet)
+	if _, err := d.Decode(exporter, truncated[:len(truncated)-4]); err != ErrOutOfBounds {
+		t.Errorf("Got %v expected %v", err, ErrOutOfBounds)
+	}
+
+	v5 := packet(1)
+	v5[1] = 5
+	if _, err := d.Decode(exporter, v5); err != ErrVersion {
+		t.Errorf("Got %v expected %v", err, ErrVersion)
+	}
+}
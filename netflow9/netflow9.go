@@ -0,0 +1,84 @@
+package netflow9
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	// HeaderSize size in bytes of a NetFlow v9 header
+	HeaderSize = 20
+	// TemplateFlowSetID the FlowSet id of template FlowSets
+	TemplateFlowSetID = 0
+	// OptionsTemplateFlowSetID the FlowSet id of options template FlowSets
+	OptionsTemplateFlowSetID = 1
+	// MinDataFlowSetID the lowest FlowSet id of data FlowSets
+	MinDataFlowSetID = 256
+)
+
+var (
+	ErrTooShort    = errors.New("netflow9: data is too short")
+	ErrVersion     = errors.New("netflow9: not a version 9 packet")
+	ErrOutOfBounds = errors.New("netflow9: out of bounds")
+)
+
+// Header a NetFlow v9 packet header
+type Header struct {
+	Version uint16
+	// Count total number of records in the packet, templates included
+	Count uint16
+	// SysUptime time in milliseconds since the export device booted
+	SysUptime uint32
+	// UnixSecs seconds since 0000 UTC 1970 at which the packet leaves the exporter
+	UnixSecs       uint32
+	SequenceNumber uint32
+	// SourceID identifies the exporter observation domain
+	SourceID uint32
+}
+
+// Parse parses the header and returns the FlowSets that follow it
+func (h *Header) Parse(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize {
+		return nil, ErrTooShort
+	}
+
+	h.Version = binary.BigEndian.Uint16(data[0:2])
+	if h.Version != 9 {
+		return nil, ErrVersion
+	}
+
+	h.Count = binary.BigEndian.Uint16(data[2:4])
+	h.SysUptime = binary.BigEndian.Uint32(data[4:8])
+	h.UnixSecs = binary.BigEndian.Uint32(data[8:12])
+	h.SequenceNumber = binary.BigEndian.Uint32(data[12:16])
+	h.SourceID = binary.BigEndian.Uint32(data[16:20])
+	return data[HeaderSize:], nil
+}
+
+// Time the export time of the packet
+func (h *Header) Time() time.Time {
+	return time.Unix(int64(h.UnixSecs), 0)
+}
+
+// FlowSetHeader the header of a FlowSet
+type FlowSetHeader struct {
+	ID uint16
+	// Length of the FlowSet in bytes, header and padding included
+	Length uint16
+}
+
+// Parse parses the FlowSet header and returns its body and the data following the FlowSet
+func (fh *FlowSetHeader) Parse(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, ErrTooShort
+	}
+
+	fh.ID = binary.BigEndian.Uint16(data[0:2])
+	fh.Length = binary.BigEndian.Uint16(data[2:4])
+	if fh.Length < 4 || int(fh.Length) > len(data) {
+		return nil, nil, ErrOutOfBounds
+	}
+
+	return data[4:fh.Length], data[fh.Length:], nil
+}
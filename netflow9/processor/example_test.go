@@ -0,0 +1,56 @@
+package processor_test
+
+import (
+	"fmt"
+	"github.com/wwicak/go-utils/netflow9"
+	"github.com/wwicak/go-utils/netflow9/processor"
+	"net"
+	"os"
+	"os/signal"
+)
+
+func HandleNetFlowV9(exporter net.Addr, packet *netflow9.Packet) {
+	for i, record := range packet.Records {
+		src, _ := record.Get("sourceIPv4Address")
+		dst, _ := record.Get("destinationIPv4Address")
+		if src != nil && dst != nil {
+			fmt.Printf("%s %02d) src : %v dst : %v\n", exporter, i, src.Value, dst.Value)
+		}
+	}
+}
+
+func ExampleProcessor_Start() {
+	processor := processor.Processor{
+		Handler: processor.PacketHandlerFunc(HandleNetFlowV9),
+	}
+
+	processor.Start()
+}
+
+func ExampleProcessor_Start_conn() {
+	conn, err := net.ListenPacket("udp", "127.0.0.2:2055")
+	if err != nil {
+		panic(err)
+	}
+
+	processor := processor.Processor{
+		Handler: processor.PacketHandlerFunc(HandleNetFlowV9),
+		Conn:    conn,
+	}
+
+	processor.Start()
+}
+
+func ExampleProcessor_Stop() {
+	processor := processor.Processor{
+		Handler: processor.PacketHandlerFunc(HandleNetFlowV9),
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		processor.Stop()
+	}()
+
+	processor.Start()
+}
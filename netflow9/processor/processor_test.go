@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"encoding/binary"
+	"github.com/wwicak/go-utils/netflow9"
+	"github.com/wwicak/go-utils/packetsource"
+	"net"
+	"testing"
+)
+
+// testPacket a NetFlow v9 packet of source id 1 holding a FlowSet of the given id and body
+func testPacket(flowSetID uint16, body []byte) []byte {
+	data := make([]byte, netflow9.HeaderSize)
+	binary.BigEndian.PutUint16(data[0:2], 9)
+	binary.BigEndian.PutUint16(data[2:4], 1)
+	binary.BigEndian.PutUint32(data[16:20], 1)
+	data = binary.BigEndian.AppendUint16(data, flowSetID)
+	data = binary.BigEndian.AppendUint16(data, uint16(4+len(body)))
+	return append(data, body...)
+}
+
+func TestProcessor(t *testing.T) {
+	exporter := &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 2055}
+	feed := packetsource.NewFeed(12)
+	// template 256: octetDeltaCount(4), then the data packets the exporter decodes with it
+	feed.Send(exporter, testPacket(netflow9.TemplateFlowSetID, []byte{1, 0, 0, 1, 0, 1, 0, 4}))
+	for i := 0; i < 10; i++ {
+		feed.Send(exporter, testPacket(256, []byte{0, 0, 0, byte(i)}))
+	}
+
+	// a jumbo packet of 1000 records is not truncated
+	feed.Send(exporter, testPacket(256, make([]byte, 4000)))
+	feed.End()
+	octets := []uint64{}
+	p := &Processor{
+		Source:   feed,
+		Workers:  2,
+		Affinity: true,
+		Handler: PacketHandlerFunc(func(exporter net.Addr, packet *netflow9.Packet) {
+			for _, r := range packet.Records {
+				field, _ := r.Get("octetDeltaCount")
+				v, _ := field.Uint()
+				octets = append(octets, v)
+			}
+		}),
+	}
+
+	// Start returns once the feed is exhausted
+	p.Start()
+	if len(octets) != 1010 {
+		t.Fatalf("Got %d records expected 1010", len(octets))
+	}
+
+	for i, v := range octets[:10] {
+		if v != uint64(i) {
+			t.Errorf("record %d: got %d, packets handled out of order", i, v)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package netflow9
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// FieldSpec the type and length of a template field
+type FieldSpec struct {
+	Type   uint16
+	Length uint16
+}
+
+// Template describes the layout of the data records of a template id
+type Template struct {
+	ID uint16
+	// Options true for an options template
+	Options bool
+	// ScopeFields the scope fields of an options template
+	ScopeFields []FieldSpec
+	Fields      []FieldSpec
+	// RecordLength the length in bytes of a data record
+	RecordLength int
+}
+
+func parseFieldSpecs(data []byte, count int) ([]FieldSpec, []byte, int, error) {
+	if len(data) < count*4 {
+		return nil, nil, 0, ErrTooShort
+	}
+
+	fields := make([]FieldSpec, count)
+	length := 0
+	for i := range fields {
+		fields[i].Type = binary.BigEndian.Uint16(data[0:2])
+		fields[i].Length = binary.BigEndian.Uint16(data[2:4])
+		length += int(fields[i].Length)
+		data = data[4:]
+	}
+
+	return fields, data, length, nil
+}
+
+// ParseTemplates parses the body of a template FlowSet
+func ParseTemplates(data []byte) ([]*Template, error) {
+	templates := []*Template{}
+	// Anything shorter than a template header is padding
+	for len(data) >= 4 {
+		t := &Template{ID: binary.BigEndian.Uint16(data[0:2])}
+		count := int(binary.BigEndian.Uint16(data[2:4]))
+		var err error
+		t.Fields, data, t.RecordLength, err = parseFieldSpecs(data[4:], count)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// ParseOptionsTemplates parses the body of an options template FlowSet
+func ParseOptionsTemplates(data []byte) ([]*Template, error) {
+	templates := []*Template{}
+	// Anything shorter than an options template header is padding
+	for len(data) >= 6 {
+		t := &Template{ID: binary.BigEndian.Uint16(data[0:2]), Options: true}
+		scopeLength := int(binary.BigEndian.Uint16(data[2:4]))
+		optionLength := int(binary.BigEndian.Uint16(data[4:6]))
+		if scopeLength%4 != 0 || optionLength%4 != 0 {
+			return nil, ErrOutOfBounds
+		}
+
+		var scopeRecordLength, recordLength int
+		var err error
+		t.ScopeFields, data, scopeRecordLength, err = parseFieldSpecs(data[6:], scopeLength/4)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Fields, data, recordLength, err = parseFieldSpecs(data, optionLength/4)
+		if err != nil {
+			return nil, err
+		}
+
+		t.RecordLength = scopeRecordLength + recordLength
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// TemplateKey identifies a template of an exporter
+type TemplateKey struct {
+	Exporter   netip.Addr
+	SourceID   uint32
+	TemplateID uint16
+}
+
+type templateEntry struct {
+	template *Template
+	expires  time.Time
+}
+
+// TemplateCache caches templates per exporter and source id until they expire.
+// It is safe for concurrent use.
+type TemplateCache struct {
+	// TTL how long a template is kept after it was last received
+	TTL       time.Duration
+	lock      sync.RWMutex
+	templates map[TemplateKey]templateEntry
+}
+
+// NewTemplateCache create a *TemplateCache
+func NewTemplateCache(ttl time.Duration) *TemplateCache {
+	return &TemplateCache{
+		TTL:       ttl,
+		templates: make(map[TemplateKey]templateEntry),
+	}
+}
+
+// Set adds or refreshes a template
+func (c *TemplateCache) Set(key TemplateKey, t *Template, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.templates[key] = templateEntry{template: t, expires: now.Add(c.TTL)}
+}
+
+// Get returns an unexpired template
+func (c *TemplateCache) Get(key TemplateKey, now time.Time) (*Template, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	entry, ok := c.templates[key]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.template, true
+}
+
+// Delete removes a template
+func (c *TemplateCache) Delete(key TemplateKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.templates, key)
+}
+
+// Expire removes the expired templates
+func (c *TemplateCache) Expire(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, entry := range c.templates {
+		if now.After(entry.expires) {
+			delete(c.templates, key)
+		}
+	}
+}
+
+// Len returns the number of cached templates
+func (c *TemplateCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.templates)
+}
@@ -0,0 +1,83 @@
+package packetsource
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+type packet struct {
+	data   []byte
+	remote net.Addr
+}
+
+// Feed a PacketSource fed from memory, to test or drive a processor without a socket.
+// It is safe for concurrent use.
+type Feed struct {
+	packets   chan packet
+	closed    chan struct{}
+	endOnce   sync.Once
+	closeOnce sync.Once
+}
+
+// NewFeed returns a Feed buffering up to backlog packets
+func NewFeed(backlog int) *Feed {
+	return &Feed{
+		packets: make(chan packet, backlog),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Send queues a packet received from remote, blocking while the feed is full.
+// Send must not be called after End.
+func (f *Feed) Send(remote net.Addr, data []byte) error {
+	select {
+	case <-f.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	select {
+	case f.packets <- packet{data: data, remote: remote}:
+		return nil
+	case <-f.closed:
+		return net.ErrClosed
+	}
+}
+
+// End marks the end of the feed, ReadFrom returns io.EOF once the queued packets are read
+func (f *Feed) End() {
+	f.endOnce.Do(func() {
+		close(f.packets)
+	})
+}
+
+// ReadFrom reads the next packet into b returning its size and the address it came from.
+// The packet is truncated to the size of b.
+func (f *Feed) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-f.closed:
+		return 0, nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case p, ok := <-f.packets:
+		if !ok {
+			return 0, nil, io.EOF
+		}
+
+		return copy(b, p.data), p.remote, nil
+	case <-f.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// Close closes the feed, a pending or later read returns net.ErrClosed
+func (f *Feed) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.closed)
+	})
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package packetsource
+
+import (
+	"net"
+)
+
+// PacketSource a source of packets read by the processors.
+// ReadFrom returns io.EOF when the source is exhausted and net.ErrClosed once the source is closed.
+// A net.PacketConn is a PacketSource.
+type PacketSource interface {
+	// ReadFrom reads a packet into b returning its size and the address it came from
+	ReadFrom(b []byte) (n int, addr net.Addr, err error)
+	// Close closes the source unblocking ReadFrom
+	Close() error
+}
+
+// ListenUDP returns a PacketSource reading the UDP datagrams received at address
+func ListenUDP(address string) (PacketSource, error) {
+	return net.ListenPacket("udp", address)
+}
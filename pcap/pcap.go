@@ -0,0 +1,195 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Link types of the captured packets
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLoop     = 108
+	LinkTypeLinuxSLL = 113
+	LinkTypeIPv4     = 228
+	LinkTypeIPv6     = 229
+	LinkTypeSLL2     = 276
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	blockTypeSHB      = 0x0a0d0d0a
+	byteOrderMagic    = 0x1a2b3c4d
+)
+
+var (
+	ErrFormat      = errors.New("pcap: not a pcap or pcapng file")
+	ErrTruncated   = errors.New("pcap: truncated file")
+	ErrUnsupported = errors.New("pcap: unsupported link type")
+)
+
+// Packet a UDP datagram extracted from a capture
+type Packet struct {
+	// Timestamp the capture time of the datagram
+	Timestamp time.Time
+	// Src the source address of the datagram
+	Src netip.AddrPort
+	// Dst the destination address of the datagram
+	Dst netip.AddrPort
+	// Payload the UDP payload, only valid until the next read
+	Payload []byte
+}
+
+// UDPAddr the source address of the datagram as a net.Addr
+func (p *Packet) UDPAddr() *net.UDPAddr {
+	return net.UDPAddrFromAddrPort(p.Src)
+}
+
+// decapsulate extracts the UDP datagram of a captured frame, returns false when there is none
+func decapsulate(linkType uint32, order binary.ByteOrder, frame []byte, p *Packet) bool {
+	var etherType uint16
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(frame) < 14 {
+			return false
+		}
+		etherType = binary.BigEndian.Uint16(frame[12:14])
+		frame = frame[14:]
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(frame) < 4 {
+				return false
+			}
+			etherType = binary.BigEndian.Uint16(frame[2:4])
+			frame = frame[4:]
+		}
+	case LinkTypeNull, LinkTypeLoop:
+		// the address family in the byte order of the capturing host for null, network order for loop
+		if len(frame) < 4 {
+			return false
+		}
+		family := order.Uint32(frame[0:4])
+		if linkType == LinkTypeLoop {
+			family = binary.BigEndian.Uint32(frame[0:4])
+		}
+		frame = frame[4:]
+		switch family {
+		case 2:
+			etherType = 0x0800
+		case 10, 24, 28, 30:
+			etherType = 0x86dd
+		default:
+			return false
+		}
+	case LinkTypeLinuxSLL:
+		if len(frame) < 16 {
+			return false
+		}
+		etherType = binary.BigEndian.Uint16(frame[14:16])
+		frame = frame[16:]
+	case LinkTypeSLL2:
+		if len(frame) < 20 {
+			return false
+		}
+		etherType = binary.BigEndian.Uint16(frame[0:2])
+		frame = frame[20:]
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		if len(frame) < 1 {
+			return false
+		}
+		switch frame[0] >> 4 {
+		case 4:
+			etherType = 0x0800
+		case 6:
+			etherType = 0x86dd
+		}
+	default:
+		return false
+	}
+
+	switch etherType {
+	case 0x0800:
+		return decapsulateIPv4(frame, p)
+	case 0x86dd:
+		return decapsulateIPv6(frame, p)
+	}
+
+	return false
+}
+
+func decapsulateIPv4(data []byte, p *Packet) bool {
+	if len(data) < 20 || data[0]>>4 != 4 || data[9] != 17 {
+		return false
+	}
+
+	// fragments can not be reassembled
+	if binary.BigEndian.Uint16(data[6:8])&0x3FFF != 0 {
+		return false
+	}
+
+	ihl := int(data[0]&0xF) * 4
+	total := int(binary.BigEndian.Uint16(data[2:4]))
+	if ihl < 20 || total < ihl || len(data) < ihl {
+		return false
+	}
+
+	// drop the ethernet padding
+	if total < len(data) {
+		data = data[:total]
+	}
+
+	src := netip.AddrFrom4([4]byte(data[12:16]))
+	dst := netip.AddrFrom4([4]byte(data[16:20]))
+	return decapsulateUDP(data[ihl:], src, dst, p)
+}
+
+func decapsulateIPv6(data []byte, p *Packet) bool {
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return false
+	}
+
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	src := netip.AddrFrom16([16]byte(data[8:24]))
+	dst := netip.AddrFrom16([16]byte(data[24:40]))
+	next := data[6]
+	data = data[40:]
+	if length < len(data) {
+		data = data[:length]
+	}
+
+	for {
+		switch next {
+		case 17:
+			return decapsulateUDP(data, src, dst, p)
+		case 0, 43, 60:
+			if len(data) < 8 || len(data) < (int(data[1])+1)*8 {
+				return false
+			}
+			next, data = data[0], data[(int(data[1])+1)*8:]
+		default:
+			// fragments and other protocols
+			return false
+		}
+	}
+}
+
+func decapsulateUDP(data []byte, src, dst netip.Addr, p *Packet) bool {
+	if len(data) < 8 {
+		return false
+	}
+
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	if length < 8 || length > len(data) {
+		// truncated by the snap length
+		return false
+	}
+
+	p.Src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(data[0:2]))
+	p.Dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:4]))
+	p.Payload = data[8:length]
+	return true
+}
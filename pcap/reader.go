@@ -0,0 +1,410 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxBlockSize the largest record or block accepted, guarding against corrupted lengths
+const maxBlockSize = 1 << 20
+
+// iface a pcapng interface
+type iface struct {
+	linkType uint32
+	// resolution the if_tsresol option
+	resolution uint8
+}
+
+// Reader reads the UDP datagrams of a pcap or pcapng capture.
+// A Reader is a packetsource.PacketSource replaying the capture to a processor.
+type Reader struct {
+	// Speed the replay speed multiplier of the original pacing, 2 replays twice as fast.
+	// Default : 0, as fast as possible
+	Speed float64
+	// Ports the destination ports of the datagrams read.
+	// Default : empty, every datagram is read
+	Ports      []uint16
+	r          *bufio.Reader
+	closer     io.Closer
+	ng         bool
+	order      binary.ByteOrder
+	linkType   uint32
+	nano       bool
+	interfaces []iface
+	buffer     []byte
+	packet     Packet
+	skipped    atomic.Uint64
+	closeOnce  sync.Once
+	closed     chan struct{}
+	first      time.Time
+	start      time.Time
+	clock      func() time.Time
+}
+
+// NewReader returns a Reader of the pcap or pcapng capture read from r
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{
+		r:      bufio.NewReaderSize(r, 1<<16),
+		closed: make(chan struct{}),
+		clock:  time.Now,
+	}
+
+	magic, err := reader.r.Peek(4)
+	if err != nil {
+		return nil, ErrFormat
+	}
+
+	switch {
+	case binary.BigEndian.Uint32(magic) == blockTypeSHB:
+		reader.ng = true
+		return reader, nil
+	case binary.LittleEndian.Uint32(magic) == magicMicroseconds || binary.LittleEndian.Uint32(magic) == magicNanoseconds:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic) == magicMicroseconds || binary.BigEndian.Uint32(magic) == magicNanoseconds:
+		reader.order = binary.BigEndian
+	default:
+		return nil, ErrFormat
+	}
+
+	var header [24]byte
+	if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+		return nil, ErrTruncated
+	}
+
+	reader.nano = reader.order.Uint32(header[0:4]) == magicNanoseconds
+	reader.linkType = reader.order.Uint32(header[20:24]) & 0x0FFFFFFF
+	return reader, nil
+}
+
+// Open returns a Reader of the pcap or pcapng file at path
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	reader.closer = file
+	return reader, nil
+}
+
+// Skipped the number of frames skipped for not holding a complete UDP datagram or not matching Ports
+func (r *Reader) Skipped() uint64 {
+	return r.skipped.Load()
+}
+
+// Close closes the reader, a pending or later read returns net.ErrClosed
+func (r *Reader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		if r.closer != nil {
+			err = r.closer.Close()
+		}
+	})
+
+	return err
+}
+
+func (r *Reader) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadFrom reads the payload of the next datagram into b returning its source address.
+// The payload is truncated to the size of b.
+func (r *Reader) ReadFrom(b []byte) (int, net.Addr, error) {
+	p, err := r.ReadPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return copy(b, p.Payload), p.UDPAddr(), nil
+}
+
+// ReadPacket reads the next datagram, waiting for its time when Speed is set.
+// The packet is only valid until the next read, io.EOF is returned at the end of the capture.
+func (r *Reader) ReadPacket() (*Packet, error) {
+	for {
+		if r.isClosed() {
+			return nil, net.ErrClosed
+		}
+
+		frame, linkType, timestamp, err := r.next()
+		if err != nil {
+			if r.isClosed() {
+				return nil, net.ErrClosed
+			}
+
+			return nil, err
+		}
+
+		if frame == nil {
+			continue
+		}
+
+		if !decapsulate(linkType, r.order, frame, &r.packet) {
+			r.skipped.Add(1)
+			continue
+		}
+
+		if len(r.Ports) > 0 && !slices.Contains(r.Ports, r.packet.Dst.Port()) {
+			r.skipped.Add(1)
+			continue
+		}
+
+		r.packet.Timestamp = timestamp
+		if !r.wait(timestamp) {
+			return nil, net.ErrClosed
+		}
+
+		return &r.packet, nil
+	}
+}
+
+// wait sleeps until the time the packet is due at the replay speed, returns false when closed meanwhile
+func (r *Reader) wait(timestamp time.Time) bool {
+	if r.Speed <= 0 {
+		return true
+	}
+
+	if r.first.IsZero() {
+		r.first = timestamp
+		r.start = r.clock()
+		return true
+	}
+
+	due := r.start.Add(time.Duration(float64(timestamp.Sub(r.first)) / r.Speed))
+	delay := due.Sub(r.clock())
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.closed:
+		return false
+	}
+}
+
+// read reads n bytes into the internal buffer
+func (r *Reader) read(n int) ([]byte, error) {
+	if cap(r.buffer) < n {
+		r.buffer = make([]byte, n)
+	}
+
+	b := r.buffer[:n]
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+
+		return nil, ErrTruncated
+	}
+
+	return b, nil
+}
+
+// next returns the next captured frame, a nil frame for blocks holding none
+func (r *Reader) next() ([]byte, uint32, time.Time, error) {
+	if r.ng {
+		return r.nextBlock()
+	}
+
+	header, err := r.read(16)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	sec := r.order.Uint32(header[0:4])
+	frac := r.order.Uint32(header[4:8])
+	length := int(r.order.Uint32(header[8:12]))
+	if length > maxBlockSize {
+		return nil, 0, time.Time{}, ErrFormat
+	}
+
+	if !r.nano {
+		frac *= 1000
+	}
+
+	timestamp := time.Unix(int64(sec), int64(frac))
+	frame, err := r.read(length)
+	if err == io.EOF {
+		err = ErrTruncated
+	}
+
+	return frame, r.linkType, timestamp, err
+}
+
+// nextBlock reads the next pcapng block
+func (r *Reader) nextBlock() ([]byte, uint32, time.Time, error) {
+	b, err := r.read(8)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	// the internal buffer is reused by the next read
+	header := [8]byte(b)
+	blockType := binary.BigEndian.Uint32(header[0:4])
+	if blockType == blockTypeSHB {
+		return nil, 0, time.Time{}, r.sectionHeader(header)
+	}
+
+	if r.order == nil {
+		return nil, 0, time.Time{}, ErrFormat
+	}
+
+	blockType = r.order.Uint32(header[0:4])
+	length := int(r.order.Uint32(header[4:8]))
+	if length < 12 || length%4 != 0 || length > maxBlockSize {
+		return nil, 0, time.Time{}, ErrFormat
+	}
+
+	body, err := r.read(length - 8)
+	if err == io.EOF {
+		err = ErrTruncated
+	}
+
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	// drop the trailing block length
+	body = body[:len(body)-4]
+	switch blockType {
+	case 1:
+		// interface description
+		if len(body) < 8 {
+			return nil, 0, time.Time{}, ErrFormat
+		}
+		i := iface{linkType: uint32(r.order.Uint16(body[0:2])), resolution: 6}
+		r.options(body[8:], func(code uint16, value []byte) {
+			if code == 9 && len(value) >= 1 {
+				i.resolution = value[0]
+			}
+		})
+		r.interfaces = append(r.interfaces, i)
+	case 6:
+		// enhanced packet
+		if len(body) < 20 {
+			return nil, 0, time.Time{}, ErrFormat
+		}
+		id := int(r.order.Uint32(body[0:4]))
+		if id >= len(r.interfaces) {
+			return nil, 0, time.Time{}, ErrFormat
+		}
+		units := uint64(r.order.Uint32(body[4:8]))<<32 | uint64(r.order.Uint32(body[8:12]))
+		captured := int(r.order.Uint32(body[12:16]))
+		if len(body) < 20+captured {
+			return nil, 0, time.Time{}, ErrFormat
+		}
+		i := r.interfaces[id]
+		return body[20 : 20+captured], i.linkType, timestampOf(units, i.resolution), nil
+	case 3:
+		// simple packet, captured on the first interface without timestamp
+		if len(body) < 4 || len(r.interfaces) == 0 {
+			return nil, 0, time.Time{}, ErrFormat
+		}
+		captured := len(body) - 4
+		if original := int(r.order.Uint32(body[0:4])); original < captured {
+			captured = original
+		}
+		return body[4 : 4+captured], r.interfaces[0].linkType, time.Time{}, nil
+	}
+
+	return nil, 0, time.Time{}, nil
+}
+
+// sectionHeader reads a pcapng section header block starting a new section
+func (r *Reader) sectionHeader(header [8]byte) error {
+	bom, err := r.read(4)
+	if err != nil {
+		return ErrTruncated
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(bom) == byteOrderMagic:
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(bom) == byteOrderMagic:
+		r.order = binary.BigEndian
+	default:
+		return ErrFormat
+	}
+
+	length := int(r.order.Uint32(header[4:8]))
+	if length < 28 || length%4 != 0 || length > maxBlockSize {
+		return ErrFormat
+	}
+
+	if _, err := r.read(length - 12); err != nil {
+		return ErrTruncated
+	}
+
+	r.interfaces = r.interfaces[:0]
+	return nil
+}
+
+// options iterates over the options of a pcapng block
+func (r *Reader) options(data []byte, f func(code uint16, value []byte)) {
+	for len(data) >= 4 {
+		code := r.order.Uint16(data[0:2])
+		length := int(r.order.Uint16(data[2:4]))
+		if code == 0 || len(data) < 4+length {
+			return
+		}
+
+		f(code, data[4:4+length])
+		data = data[4+(length+3)&^3:]
+	}
+}
+
+// timestampOf converts a pcapng timestamp in units of the if_tsresol resolution
+func timestampOf(units uint64, resolution uint8) time.Time {
+	exponent := uint(resolution & 0x7F)
+	if resolution&0x80 != 0 {
+		// negative power of 2
+		if exponent == 0 {
+			return time.Unix(int64(units), 0)
+		}
+		if exponent >= 64 {
+			return time.Unix(0, 0)
+		}
+		hi, lo := bits.Mul64(units, uint64(time.Second))
+		return time.Unix(0, int64(hi<<(64-exponent)|lo>>exponent))
+	}
+
+	// negative power of 10
+	scale := uint64(1)
+	for i := uint(0); i < exponent && i < 19; i++ {
+		scale *= 10
+	}
+
+	frac := units % scale
+	if scale <= uint64(time.Second) {
+		frac *= uint64(time.Second) / scale
+	} else {
+		frac /= scale / uint64(time.Second)
+	}
+
+	return time.Unix(int64(units/scale), int64(frac))
+}
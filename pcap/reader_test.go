@@ -0,0 +1,296 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// udpFrame builds an ethernet frame, optionally tagged, holding an IPv4 UDP datagram
+func udpFrame(vlan uint16, src, dst netip.AddrPort, payload []byte) []byte {
+	frame := make([]byte, 12)
+	if vlan != 0 {
+		frame = binary.BigEndian.AppendUint16(frame, 0x8100)
+		frame = binary.BigEndian.AppendUint16(frame, vlan)
+	}
+
+	frame = binary.BigEndian.AppendUint16(frame, 0x0800)
+	return append(frame, ipv4UDP(src, dst, payload)...)
+}
+
+func ipv4UDP(src, dst netip.AddrPort, payload []byte) []byte {
+	ip := make([]byte, 28, 28+len(payload))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(28+len(payload)))
+	ip[8] = 64
+	ip[9] = 17
+	copy(ip[12:16], src.Addr().AsSlice())
+	copy(ip[16:20], dst.Addr().AsSlice())
+	binary.BigEndian.PutUint16(ip[20:22], src.Port())
+	binary.BigEndian.PutUint16(ip[22:24], dst.Port())
+	binary.BigEndian.PutUint16(ip[24:26], uint16(8+len(payload)))
+	return append(ip, payload...)
+}
+
+type record struct {
+	timestamp time.Time
+	frame     []byte
+}
+
+func classicPcap(order binary.AppendByteOrder, nano bool, linkType uint32, records []record) []byte {
+	magic := uint32(magicMicroseconds)
+	if nano {
+		magic = magicNanoseconds
+	}
+
+	b := order.AppendUint32(nil, magic)
+	b = order.AppendUint16(b, 2)
+	b = order.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = order.AppendUint32(b, 65535)
+	b = order.AppendUint32(b, linkType)
+	for _, r := range records {
+		frac := r.timestamp.Nanosecond()
+		if !nano {
+			frac /= 1000
+		}
+		b = order.AppendUint32(b, uint32(r.timestamp.Unix()))
+		b = order.AppendUint32(b, uint32(frac))
+		b = order.AppendUint32(b, uint32(len(r.frame)))
+		b = order.AppendUint32(b, uint32(len(r.frame)))
+		b = append(b, r.frame...)
+	}
+
+	return b
+}
+
+func block(order binary.AppendByteOrder, blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	b := order.AppendUint32(nil, blockType)
+	b = order.AppendUint32(b, uint32(12+len(body)))
+	b = append(b, body...)
+	return order.AppendUint32(b, uint32(12+len(body)))
+}
+
+func pcapng(order binary.AppendByteOrder, resolution uint8, records []record) []byte {
+	shb := order.AppendUint32(nil, byteOrderMagic)
+	shb = order.AppendUint16(shb, 1)
+	shb = order.AppendUint16(shb, 0)
+	shb = order.AppendUint64(shb, 0xFFFFFFFFFFFFFFFF)
+	b := block(order, blockTypeSHB, shb)
+	idb := order.AppendUint16(nil, LinkTypeEthernet)
+	idb = order.AppendUint16(idb, 0)
+	idb = order.AppendUint32(idb, 65535)
+	// if_tsresol option then end of options
+	idb = order.AppendUint16(idb, 9)
+	idb = order.AppendUint16(idb, 1)
+	idb = append(idb, resolution, 0, 0, 0)
+	idb = order.AppendUint32(idb, 0)
+	b = append(b, block(order, 1, idb)...)
+	for _, r := range records {
+		units := uint64(r.timestamp.UnixNano())
+		if resolution == 6 {
+			units /= 1000
+		}
+		epb := order.AppendUint32(nil, 0)
+		epb = order.AppendUint32(epb, uint32(units>>32))
+		epb = order.AppendUint32(epb, uint32(units))
+		epb = order.AppendUint32(epb, uint32(len(r.frame)))
+		epb = order.AppendUint32(epb, uint32(len(r.frame)))
+		epb = append(epb, r.frame...)
+		b = append(b, block(order, 6, epb)...)
+	}
+
+	// a name resolution block is skipped
+	return append(b, block(order, 4, make([]byte, 4))...)
+}
+
+var (
+	exporter  = netip.MustParseAddrPort("192.0.2.1:50000")
+	collector = netip.MustParseAddrPort("198.51.100.1:2055")
+	start     = time.Unix(1700000000, 123456000)
+)
+
+func testRecords() []record {
+	tcp := udpFrame(0, exporter, collector, []byte("tcp"))
+	tcp[14+9] = 6
+	return []record{
+		{start, udpFrame(0, exporter, collector, []byte("first"))},
+		{start.Add(time.Second), tcp},
+		{start.Add(2 * time.Second), udpFrame(100, exporter, netip.AddrPortFrom(collector.Addr(), 6343), []byte("sflow"))},
+		{start.Add(3 * time.Second), udpFrame(0, exporter, collector, []byte("last"))},
+	}
+}
+
+func readAll(t *testing.T, r *Reader) []Packet {
+	var packets []Packet
+	for {
+		p, err := r.ReadPacket()
+		if err == io.EOF {
+			return packets
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet := *p
+		packet.Payload = append([]byte(nil), p.Payload...)
+		packets = append(packets, packet)
+	}
+}
+
+func TestReader(t *testing.T) {
+	captures := map[string][]byte{
+		"pcap little endian":   classicPcap(binary.LittleEndian, false, LinkTypeEthernet, testRecords()),
+		"pcap big endian nano": classicPcap(binary.BigEndian, true, LinkTypeEthernet, testRecords()),
+		"pcapng little endian": pcapng(binary.LittleEndian, 6, testRecords()),
+		"pcapng big endian":    pcapng(binary.BigEndian, 9, testRecords()),
+	}
+
+	for name, capture := range captures {
+		r, err := NewReader(bytes.NewReader(capture))
+		if err != nil {
+			t.Fatalf("%s : %s", name, err)
+		}
+
+		packets := readAll(t, r)
+		if len(packets) != 3 || r.Skipped() != 1 {
+			t.Fatalf("%s : expected 3 packets and 1 skipped got %d and %d", name, len(packets), r.Skipped())
+		}
+
+		if string(packets[0].Payload) != "first" || string(packets[1].Payload) != "sflow" || string(packets[2].Payload) != "last" {
+			t.Errorf("%s : unexpected payloads %q %q %q", name, packets[0].Payload, packets[1].Payload, packets[2].Payload)
+		}
+
+		if packets[0].Src != exporter || packets[0].Dst != collector || packets[1].Dst.Port() != 6343 {
+			t.Errorf("%s : unexpected addresses %s %s", name, packets[0].Src, packets[0].Dst)
+		}
+
+		if !packets[0].Timestamp.Equal(start) || !packets[2].Timestamp.Equal(start.Add(3*time.Second)) {
+			t.Errorf("%s : unexpected timestamps %s %s", name, packets[0].Timestamp, packets[2].Timestamp)
+		}
+	}
+}
+
+func TestReaderPorts(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(pcapng(binary.LittleEndian, 6, testRecords())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Ports = []uint16{6343}
+	buffer := make([]byte, 2048)
+	n, addr, err := r.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buffer[:n]) != "sflow" || addr.String() != exporter.String() {
+		t.Errorf("unexpected datagram %q from %s", buffer[:n], addr)
+	}
+
+	if _, _, err := r.ReadFrom(buffer); err != io.EOF {
+		t.Errorf("expected io.EOF got %v", err)
+	}
+}
+
+func TestReaderLinkTypes(t *testing.T) {
+	raw := ipv4UDP(exporter, collector, []byte("raw"))
+	null := append(binary.LittleEndian.AppendUint32(nil, 2), raw...)
+	sll := make([]byte, 16)
+	binary.BigEndian.PutUint16(sll[14:16], 0x0800)
+	sll = append(sll, raw...)
+	tests := []struct {
+		linkType uint32
+		frame    []byte
+	}{
+		{LinkTypeRaw, raw},
+		{LinkTypeNull, null},
+		{LinkTypeLinuxSLL, sll},
+	}
+
+	for _, test := range tests {
+		r, err := NewReader(bytes.NewReader(classicPcap(binary.LittleEndian, false, test.linkType, []record{{start, test.frame}})))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packets := readAll(t, r)
+		if len(packets) != 1 || string(packets[0].Payload) != "raw" {
+			t.Errorf("link type %d : unexpected packets %v", test.linkType, packets)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture"))); err != ErrFormat {
+		t.Errorf("expected ErrFormat got %v", err)
+	}
+
+	capture := classicPcap(binary.LittleEndian, false, LinkTypeEthernet, testRecords())
+	r, err := NewReader(bytes.NewReader(capture[:len(capture)-2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for err == nil {
+		_, err = r.ReadPacket()
+	}
+
+	if err != ErrTruncated {
+		t.Errorf("expected ErrTruncated got %v", err)
+	}
+
+	r.Close()
+	if _, err := r.ReadPacket(); err != net.ErrClosed {
+		t.Errorf("expected net.ErrClosed got %v", err)
+	}
+}
+
+func TestReaderSpeed(t *testing.T) {
+	records := []record{
+		{start, udpFrame(0, exporter, collector, []byte("1"))},
+		{start.Add(time.Second), udpFrame(0, exporter, collector, []byte("2"))},
+	}
+
+	r, err := NewReader(bytes.NewReader(classicPcap(binary.LittleEndian, false, LinkTypeEthernet, records)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Speed = 10
+	began := time.Now()
+	if packets := readAll(t, r); len(packets) != 2 {
+		t.Fatalf("expected 2 packets got %d", len(packets))
+	}
+
+	if elapsed := time.Since(began); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected a replay of 100ms got %s", elapsed)
+	}
+}
+
+func TestTimestampOf(t *testing.T) {
+	tests := []struct {
+		units      uint64
+		resolution uint8
+		expected   time.Time
+	}{
+		{1700000000123456, 6, time.Unix(1700000000, 123456000)},
+		{1700000000123456789, 9, time.Unix(1700000000, 123456789)},
+		{1700000000<<10 | 512, 0x80 | 10, time.Unix(1700000000, 500000000)},
+	}
+
+	for i, test := range tests {
+		if got := timestampOf(test.units, test.resolution); !got.Equal(test.expected) {
+			t.Errorf("Test %d) expected %s got %s", i, test.expected, got)
+		}
+	}
+}
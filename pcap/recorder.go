@@ -0,0 +1,267 @@
+package pcap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/wwicak/go-utils/acl"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RecorderConfig the configuration of a Recorder
+type RecorderConfig struct {
+	// Dir the directory the capture files are written to, created when missing.
+	// Required.
+	Dir string
+	// Prefix the prefix of the capture file names, followed by the UTC time the file was opened.
+	// Default : datagrams
+	Prefix string
+	// Collector the destination address written in the synthesized headers,
+	// usually the address the processor listens at.
+	// Default : the unspecified address, port 0
+	Collector netip.AddrPort
+	// ACL the exporters recorded.
+	// Default : nil, every exporter is recorded
+	ACL *acl.ACL
+	// MaxSize the size a capture file is rotated at.
+	// Default : 64MiB
+	MaxSize int64
+	// MaxAge the age a capture file is rotated at.
+	// Default : 0, files are only rotated by size
+	MaxAge time.Duration
+	// Backlog how many datagrams can wait to be written before being dropped.
+	// Default : 1024
+	Backlog int
+}
+
+type datagram struct {
+	timestamp time.Time
+	remote    netip.AddrPort
+	buffer    *[]byte
+}
+
+// Recorder writes the datagrams received by a processor to rotating pcap files.
+// Recording never blocks, datagrams are dropped when the writer falls behind.
+// It is safe for concurrent use.
+type Recorder struct {
+	config     RecorderConfig
+	records    chan datagram
+	bufferPool sync.Pool
+	recorded   atomic.Uint64
+	dropped    atomic.Uint64
+	errors     atomic.Uint64
+	closeOnce  sync.Once
+	mutex      sync.RWMutex
+	closed     bool
+	done       chan struct{}
+	file       *os.File
+	bw         *bufio.Writer
+	writer     *Writer
+	opened     time.Time
+	files      []string
+	clock      func() time.Time
+}
+
+var ErrNoDir = errors.New("pcap: no directory to record to")
+
+// NewRecorder create a *Recorder writing to config.Dir
+func NewRecorder(config RecorderConfig) (*Recorder, error) {
+	if config.Dir == "" {
+		return nil, ErrNoDir
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if config.Prefix == "" {
+		config.Prefix = "datagrams"
+	}
+
+	if config.MaxSize <= 0 {
+		config.MaxSize = 64 << 20
+	}
+
+	if config.Backlog <= 0 {
+		config.Backlog = 1024
+	}
+
+	r := &Recorder{
+		config:  config,
+		records: make(chan datagram, config.Backlog),
+		done:    make(chan struct{}),
+		clock:   time.Now,
+	}
+
+	go r.run()
+	return r, nil
+}
+
+// Record queues the datagram received from remote to be written with the current time.
+// The packet is copied, it can be reused as soon as Record returns.
+func (r *Recorder) Record(remote net.Addr, packet []byte) {
+	source := addrPortOf(remote)
+	if !r.config.ACL.Allowed(source.Addr()) {
+		return
+	}
+
+	bufferPtr, _ := r.bufferPool.Get().(*[]byte)
+	if bufferPtr == nil || cap(*bufferPtr) < len(packet) {
+		buffer := make([]byte, len(packet))
+		bufferPtr = &buffer
+	}
+
+	*bufferPtr = append((*bufferPtr)[:0], packet...)
+	rec := datagram{timestamp: r.clock(), remote: source, buffer: bufferPtr}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.closed {
+		r.bufferPool.Put(bufferPtr)
+		r.dropped.Add(1)
+		return
+	}
+
+	select {
+	case r.records <- rec:
+	default:
+		r.bufferPool.Put(bufferPtr)
+		r.dropped.Add(1)
+	}
+}
+
+// addrPortOf returns the address and port of a remote address
+func addrPortOf(remote net.Addr) netip.AddrPort {
+	if udpAddr, ok := remote.(*net.UDPAddr); ok {
+		addrPort := udpAddr.AddrPort()
+		return netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port())
+	}
+
+	return netip.AddrPortFrom(acl.AddrOf(remote), 0)
+}
+
+// Recorded returns the number of datagrams written
+func (r *Recorder) Recorded() uint64 {
+	return r.recorded.Load()
+}
+
+// Dropped returns the number of datagrams dropped for the writer falling behind
+func (r *Recorder) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Errors returns the number of datagrams lost to write errors
+func (r *Recorder) Errors() uint64 {
+	return r.errors.Load()
+}
+
+// Files returns the paths of the capture files written so far, the current one last
+func (r *Recorder) Files() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]string(nil), r.files...)
+}
+
+// Close writes the queued datagrams and closes the current capture file
+func (r *Recorder) Close() error {
+	r.closeOnce.Do(func() {
+		r.mutex.Lock()
+		r.closed = true
+		close(r.records)
+		r.mutex.Unlock()
+	})
+
+	<-r.done
+	return nil
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	defer r.closeFile()
+	for rec := range r.records {
+		if err := r.write(rec); err != nil {
+			r.errors.Add(1)
+		} else {
+			r.recorded.Add(1)
+		}
+
+		r.bufferPool.Put(rec.buffer)
+		// make the datagrams visible once the queue is drained
+		if len(r.records) == 0 && r.bw != nil {
+			r.bw.Flush()
+		}
+	}
+}
+
+// write writes a datagram, rotating the capture file when due
+func (r *Recorder) write(rec datagram) error {
+	if r.writer != nil && (r.writer.Size() >= r.config.MaxSize ||
+		(r.config.MaxAge > 0 && rec.timestamp.Sub(r.opened) >= r.config.MaxAge)) {
+		r.closeFile()
+	}
+
+	if r.writer == nil {
+		if err := r.openFile(rec.timestamp); err != nil {
+			return err
+		}
+	}
+
+	dst := r.config.Collector
+	if !dst.IsValid() {
+		if rec.remote.Addr().Is4() {
+			dst = netip.AddrPortFrom(netip.IPv4Unspecified(), 0)
+		} else {
+			dst = netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
+		}
+	}
+
+	return r.writer.WriteDatagram(rec.timestamp, rec.remote, dst, *rec.buffer)
+}
+
+func (r *Recorder) openFile(now time.Time) error {
+	name := fmt.Sprintf("%s-%s", r.config.Prefix, now.UTC().Format("20060102T150405.000000000"))
+	path := filepath.Join(r.config.Dir, name+".pcap")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	// files opened within the resolution of the clock are numbered
+	for i := 1; errors.Is(err, fs.ErrExist) && i < 1000; i++ {
+		path = filepath.Join(r.config.Dir, fmt.Sprintf("%s-%d.pcap", name, i))
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriterSize(file, 1<<16)
+	writer, err := NewWriter(bw)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file, r.bw, r.writer, r.opened = file, bw, writer, now
+	r.mutex.Lock()
+	r.files = append(r.files, path)
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *Recorder) closeFile() {
+	if r.file == nil {
+		return
+	}
+
+	if err := r.bw.Flush(); err != nil {
+		r.errors.Add(1)
+	}
+
+	r.file.Close()
+	r.file, r.bw, r.writer = nil, nil, nil
+}
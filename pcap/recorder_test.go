@@ -0,0 +1,209 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/wwicak/go-utils/acl"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst netip.AddrPort
+	}{
+		{"ipv4", netip.MustParseAddrPort("192.0.2.1:50000"), netip.MustParseAddrPort("198.51.100.1:2055")},
+		{"ipv6", netip.MustParseAddrPort("[2001:db8::1]:50000"), netip.MustParseAddrPort("[2001:db8::2]:6343")},
+		{"mapped", netip.MustParseAddrPort("[::ffff:192.0.2.1]:50000"), netip.MustParseAddrPort("198.51.100.1:2055")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w, err := NewWriter(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			timestamp := time.Unix(1700000000, 123456789)
+			payloads := [][]byte{[]byte("first"), []byte("second datagram")}
+			for _, payload := range payloads {
+				if err := w.WriteDatagram(timestamp, test.src, test.dst, payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if w.Size() != int64(b.Len()) {
+				t.Errorf("Size() = %d, want %d", w.Size(), b.Len())
+			}
+
+			if snaplen := binary.LittleEndian.Uint32(b.Bytes()[16:20]); snaplen < 14+40+8+maxPayload {
+				t.Errorf("snaplen %d is shorter than the largest frame", snaplen)
+			}
+
+			frame := b.Bytes()[24+16:]
+			if !validChecksums(frame) {
+				t.Error("invalid checksums")
+			}
+
+			r, err := NewReader(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			packets := readAll(t, r)
+			if len(packets) != len(payloads) {
+				t.Fatalf("read %d packets, want %d", len(packets), len(payloads))
+			}
+
+			for i, p := range packets {
+				if !p.Timestamp.Equal(timestamp) {
+					t.Errorf("Timestamp = %v, want %v", p.Timestamp, timestamp)
+				}
+
+				if p.Src.Addr() != test.src.Addr().Unmap() || p.Src.Port() != test.src.Port() || p.Dst != test.dst {
+					t.Errorf("addresses = %v -> %v, want %v -> %v", p.Src, p.Dst, test.src, test.dst)
+				}
+
+				if !bytes.Equal(p.Payload, payloads[i]) {
+					t.Errorf("Payload = %q, want %q", p.Payload, payloads[i])
+				}
+			}
+		})
+	}
+}
+
+// validChecksums verifies the IP and UDP checksums of an ethernet frame
+func validChecksums(frame []byte) bool {
+	var pseudo uint32
+	var udp []byte
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case 0x0800:
+		ip := frame[14:34]
+		if fold(sum(ip, 0)) != 0xFFFF {
+			return false
+		}
+		udp = frame[34:]
+		pseudo = sum(ip[12:20], 17)
+	case 0x86dd:
+		ip := frame[14:54]
+		udp = frame[54:]
+		pseudo = sum(ip[8:40], 17)
+	}
+
+	udp = udp[:binary.BigEndian.Uint16(udp[4:6])]
+	return fold(sum(udp, pseudo+uint32(len(udp)))) == 0xFFFF
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	allowed, err := acl.New([]string{"192.0.2.0/24"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := netip.MustParseAddrPort("198.51.100.1:2055")
+	r, err := NewRecorder(RecorderConfig{Dir: dir, Collector: collector, ACL: allowed, MaxSize: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	other := &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 50000}
+	packet := make([]byte, 100)
+	for i := 0; i < 5; i++ {
+		packet[0] = byte(i)
+		r.Record(exporter, packet)
+		r.Record(other, packet)
+		// the packet can be reused once recorded
+		packet[0] = 0xFF
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Recorded()+r.Dropped() != 5 {
+		t.Errorf("Recorded() + Dropped() = %d, want 5", r.Recorded()+r.Dropped())
+	}
+
+	// 24 bytes of header and 158 bytes per datagram rotate after every datagram
+	files := r.Files()
+	if uint64(len(files)) != r.Recorded() {
+		t.Fatalf("%d files, want %d", len(files), r.Recorded())
+	}
+
+	var read []byte
+	for _, path := range files {
+		reader, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, p := range readAll(t, reader) {
+			if p.UDPAddr().String() != exporter.String() || p.Dst != collector {
+				t.Errorf("addresses = %v -> %v, want %v -> %v", p.UDPAddr(), p.Dst, exporter, collector)
+			}
+			read = append(read, p.Payload[0])
+		}
+		reader.Close()
+	}
+
+	for i, b := range read {
+		if i > 0 && b <= read[i-1] {
+			t.Errorf("datagrams out of order or corrupted: %v", read)
+		}
+	}
+
+	// recording after close drops
+	r.Record(exporter, packet)
+	if r.Dropped() == 0 {
+		t.Error("Record after Close not dropped")
+	}
+}
+
+func TestRecorderMaxAge(t *testing.T) {
+	r, err := NewRecorder(RecorderConfig{Dir: t.TempDir(), MaxAge: time.Minute, Backlog: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	r.clock = func() time.Time { return now }
+	exporter := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000}
+	for i := 0; i < 4; i++ {
+		r.Record(exporter, []byte{byte(i)})
+		now = now.Add(40 * time.Second)
+	}
+
+	r.Close()
+	if len(r.Files()) != 2 {
+		t.Errorf("%d files, want 2", len(r.Files()))
+	}
+}
+
+func TestRecorderDrops(t *testing.T) {
+	r, err := NewRecorder(RecorderConfig{Dir: t.TempDir(), Backlog: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	for i := 0; i < 1000; i++ {
+		r.Record(exporter, make([]byte, 1000))
+	}
+
+	r.Close()
+	if r.Recorded()+r.Dropped() != 1000 || r.Dropped() == 0 {
+		t.Errorf("Recorded() = %d, Dropped() = %d", r.Recorded(), r.Dropped())
+	}
+}
+
+func TestRecorderNoDir(t *testing.T) {
+	if _, err := NewRecorder(RecorderConfig{}); err != ErrNoDir {
+		t.Errorf("err = %v, want %v", err, ErrNoDir)
+	}
+}
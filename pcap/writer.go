@@ -0,0 +1,141 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// maxPayload the largest UDP payload that fits an IPv4 datagram
+const maxPayload = 65535 - 20 - 8
+
+// snapLen the snapshot length of the captures, larger than the largest frame written, an IPv6 one
+const snapLen = 262144
+
+var (
+	// the locally administered MAC addresses of the synthesized frames
+	srcMac = [6]byte{0x02, 0, 0, 0, 0, 0x01}
+	dstMac = [6]byte{0x02, 0, 0, 0, 0, 0x02}
+)
+
+// Writer writes UDP datagrams to a pcap capture with nanosecond timestamps,
+// synthesizing the Ethernet, IP and UDP headers.
+type Writer struct {
+	w      io.Writer
+	size   int64
+	buffer []byte
+}
+
+// NewWriter returns a Writer writing to w, the pcap header is written immediately
+func NewWriter(w io.Writer) (*Writer, error) {
+	writer := &Writer{w: w}
+	header := binary.LittleEndian.AppendUint32(nil, magicNanoseconds)
+	header = binary.LittleEndian.AppendUint16(header, 2)
+	header = binary.LittleEndian.AppendUint16(header, 4)
+	header = append(header, make([]byte, 8)...)
+	header = binary.LittleEndian.AppendUint32(header, snapLen)
+	header = binary.LittleEndian.AppendUint32(header, LinkTypeEthernet)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	writer.size = int64(len(header))
+	return writer, nil
+}
+
+// Size the number of bytes written
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+// WriteDatagram writes a datagram sent from src to dst at timestamp.
+// Both addresses must be of the same family, IPv4 mapped IPv6 addresses are written as IPv4.
+// The payload is truncated to the largest datagram.
+func (w *Writer) WriteDatagram(timestamp time.Time, src, dst netip.AddrPort, payload []byte) error {
+	if len(payload) > maxPayload {
+		payload = payload[:maxPayload]
+	}
+
+	srcAddr, dstAddr := src.Addr().Unmap(), dst.Addr().Unmap()
+	if srcAddr.Is4() != dstAddr.Is4() {
+		// keep the source, the family of the destination is lost
+		if srcAddr.Is4() {
+			dstAddr = netip.IPv4Unspecified()
+		} else {
+			dstAddr = netip.IPv6Unspecified()
+		}
+	}
+
+	frame := w.buffer[:0]
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(timestamp.Unix()))
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(timestamp.Nanosecond()))
+	// the lengths are set once the frame is built
+	frame = append(frame, make([]byte, 8)...)
+	frame = append(frame, dstMac[:]...)
+	frame = append(frame, srcMac[:]...)
+	udpLength := 8 + len(payload)
+	var pseudo uint32
+	if srcAddr.Is4() {
+		frame = binary.BigEndian.AppendUint16(frame, 0x0800)
+		ip := len(frame)
+		frame = append(frame, 0x45, 0)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(20+udpLength))
+		frame = append(frame, 0, 0, 0x40, 0, 64, 17, 0, 0)
+		frame = append(frame, srcAddr.AsSlice()...)
+		frame = append(frame, dstAddr.AsSlice()...)
+		binary.BigEndian.PutUint16(frame[ip+10:ip+12], ^fold(sum(frame[ip:ip+20], 0)))
+		pseudo = sum(frame[ip+12:ip+20], 17+uint32(udpLength))
+	} else {
+		frame = binary.BigEndian.AppendUint16(frame, 0x86dd)
+		ip := len(frame)
+		frame = append(frame, 0x60, 0, 0, 0)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(udpLength))
+		frame = append(frame, 17, 64)
+		frame = append(frame, srcAddr.AsSlice()...)
+		frame = append(frame, dstAddr.AsSlice()...)
+		pseudo = sum(frame[ip+8:ip+40], 17+uint32(udpLength))
+	}
+
+	udp := len(frame)
+	frame = binary.BigEndian.AppendUint16(frame, src.Port())
+	frame = binary.BigEndian.AppendUint16(frame, dst.Port())
+	frame = binary.BigEndian.AppendUint16(frame, uint16(udpLength))
+	frame = append(frame, 0, 0)
+	frame = append(frame, payload...)
+	checksum := ^fold(sum(frame[udp:], pseudo))
+	if checksum == 0 {
+		checksum = 0xFFFF
+	}
+
+	binary.BigEndian.PutUint16(frame[udp+6:udp+8], checksum)
+	binary.LittleEndian.PutUint32(frame[8:12], uint32(len(frame)-16))
+	binary.LittleEndian.PutUint32(frame[12:16], uint32(len(frame)-16))
+	w.buffer = frame
+	n, err := w.w.Write(frame)
+	w.size += int64(n)
+	return err
+}
+
+// sum adds data as 16 bits big endian words to the one's complement sum
+func sum(data []byte, s uint32) uint32 {
+	for len(data) >= 2 {
+		s += uint32(binary.BigEndian.Uint16(data))
+		data = data[2:]
+	}
+
+	if len(data) == 1 {
+		s += uint32(data[0]) << 8
+	}
+
+	return s
+}
+
+// fold folds a one's complement sum into 16 bits
+func fold(s uint32) uint16 {
+	for s > 0xFFFF {
+		s = s>>16 + s&0xFFFF
+	}
+
+	return uint16(s)
+}
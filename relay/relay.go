@@ -0,0 +1,212 @@
+package relay
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/wwicak/go-utils/acl"
+	"golang.org/x/net/ipv4"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+)
+
+// Destination a downstream collector the datagrams are forwarded to
+type Destination struct {
+	// Addr the address of the downstream collector.
+	// Required.
+	Addr *net.UDPAddr
+	// ACL the exporters forwarded to this destination.
+	// Default : nil, every exporter is forwarded
+	ACL *acl.ACL
+	// SampleRate forward one datagram out of SampleRate.
+	// Default : every datagram is forwarded
+	SampleRate uint64
+	// Spoof when true the datagram is sent with the address of the exporter as source.
+	// Requires a raw socket, falls back to plain forwarding when not available.
+	// Default : false
+	Spoof bool
+}
+
+type destination struct {
+	Destination
+	seen      atomic.Uint64
+	forwarded atomic.Uint64
+	errors    atomic.Uint64
+}
+
+// Stats the counters of a destination
+type Stats struct {
+	Addr      *net.UDPAddr
+	Forwarded uint64
+	Errors    uint64
+}
+
+// Relay forwards datagrams unchanged to a set of destinations.
+// It is safe for concurrent use.
+type Relay struct {
+	destinations []destination
+	conn         net.PacketConn
+	rawConn      *ipv4.RawConn
+	bufferPool   sync.Pool
+}
+
+var (
+	ErrNoDestinations = errors.New("relay: no destinations")
+	ErrNoAddr         = errors.New("relay: destination without address")
+)
+
+// New create a *Relay for the destinations.
+// A raw socket is opened when a destination requires spoofing, if it cannot be opened
+// the destination falls back to plain forwarding; see Spoofing.
+func New(destinations ...Destination) (*Relay, error) {
+	if len(destinations) == 0 {
+		return nil, ErrNoDestinations
+	}
+
+	for _, d := range destinations {
+		if d.Addr == nil {
+			return nil, ErrNoAddr
+		}
+	}
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Relay{
+		destinations: make([]destination, len(destinations)),
+		conn:         conn,
+	}
+
+	spoof := false
+	for i, d := range destinations {
+		r.destinations[i].Destination = d
+		spoof = spoof || d.Spoof
+	}
+
+	if spoof {
+		r.rawConn = openRawConn()
+	}
+
+	return r, nil
+}
+
+func openRawConn() *ipv4.RawConn {
+	conn, err := net.ListenPacket("ip4:udp", "0.0.0.0")
+	if err != nil {
+		return nil
+	}
+
+	rawConn, err := ipv4.NewRawConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil
+	}
+
+	return rawConn
+}
+
+// Spoofing reports whether the raw socket needed for spoofing is available
+func (r *Relay) Spoofing() bool {
+	return r.rawConn != nil
+}
+
+// Forward sends the datagram received from remote to every matching destination
+func (r *Relay) Forward(remote net.Addr, packet []byte) {
+	source := acl.AddrOf(remote)
+	for i := range r.destinations {
+		d := &r.destinations[i]
+		if !d.ACL.Allowed(source) {
+			continue
+		}
+
+		if d.SampleRate > 1 && (d.seen.Add(1)-1)%d.SampleRate != 0 {
+			continue
+		}
+
+		var err error
+		if d.Spoof && r.rawConn != nil && source.Is4() && d.Addr.IP.To4() != nil {
+			err = r.spoof(remote, source, d.Addr, packet)
+		} else {
+			_, err = r.conn.WriteTo(packet, d.Addr)
+		}
+
+		if err != nil {
+			d.errors.Add(1)
+		} else {
+			d.forwarded.Add(1)
+		}
+	}
+}
+
+// spoof sends the datagram with a synthesized IPv4 and UDP header using the exporter as the source
+func (r *Relay) spoof(remote net.Addr, source netip.Addr, dst *net.UDPAddr, packet []byte) error {
+	srcPort := 0
+	if udpAddr, ok := remote.(*net.UDPAddr); ok {
+		srcPort = udpAddr.Port
+	}
+
+	size := 8 + len(packet)
+	bufferPtr, _ := r.bufferPool.Get().(*[]byte)
+	if bufferPtr == nil || cap(*bufferPtr) < size {
+		buffer := make([]byte, size)
+		bufferPtr = &buffer
+	}
+	defer r.bufferPool.Put(bufferPtr)
+
+	payload := (*bufferPtr)[:size]
+	binary.BigEndian.PutUint16(payload[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(payload[2:4], uint16(dst.Port))
+	binary.BigEndian.PutUint16(payload[4:6], uint16(size))
+	// A zero checksum means no checksum for UDP over IPv4
+	binary.BigEndian.PutUint16(payload[6:8], 0)
+	copy(payload[8:], packet)
+	src := source.As4()
+	header := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen,
+		TotalLen: ipv4.HeaderLen + size,
+		TTL:      64,
+		Protocol: 17,
+		Src:      net.IP(src[:]),
+		Dst:      dst.IP.To4(),
+	}
+
+	return r.rawConn.WriteTo(header, payload, nil)
+}
+
+// Forwarded returns the total number of datagrams forwarded
+func (r *Relay) Forwarded() uint64 {
+	var total uint64
+	for i := range r.destinations {
+		total += r.destinations[i].forwarded.Load()
+	}
+
+	return total
+}
+
+// Stats returns the counters of every destination
+func (r *Relay) Stats() []Stats {
+	stats := make([]Stats, len(r.destinations))
+	for i := range r.destinations {
+		d := &r.destinations[i]
+		stats[i] = Stats{
+			Addr:      d.Addr,
+			Forwarded: d.forwarded.Load(),
+			Errors:    d.errors.Load(),
+		}
+	}
+
+	return stats
+}
+
+// Close closes the sockets of the relay
+func (r *Relay) Close() error {
+	if r.rawConn != nil {
+		r.rawConn.Close()
+	}
+
+	return r.conn.Close()
+}
@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"github.com/wwicak/go-utils/acl"
+	"net"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func received(conn net.PacketConn) []string {
+	packets := []string{}
+	buffer := make([]byte, 2048)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return packets
+		}
+
+		packets = append(packets, string(buffer[:n]))
+	}
+}
+
+func TestForward(t *testing.T) {
+	all := listen(t)
+	filtered := listen(t)
+	sampled := listen(t)
+	allowed, err := acl.New([]string{"192.0.2.0/24"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(
+		Destination{Addr: all.LocalAddr().(*net.UDPAddr)},
+		Destination{Addr: filtered.LocalAddr().(*net.UDPAddr), ACL: allowed},
+		Destination{Addr: sampled.LocalAddr().(*net.UDPAddr), SampleRate: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	exporter1 := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 6343}
+	exporter2 := &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 6343}
+	r.Forward(exporter1, []byte("one"))
+	r.Forward(exporter2, []byte("two"))
+	r.Forward(exporter1, []byte("three"))
+	r.Forward(exporter2, []byte("four"))
+
+	if got := received(all); len(got) != 4 || got[0] != "one" || got[3] != "four" {
+		t.Errorf("all: got %v", got)
+	}
+
+	if got := received(filtered); len(got) != 2 || got[0] != "one" || got[1] != "three" {
+		t.Errorf("filtered: got %v", got)
+	}
+
+	if got := received(sampled); len(got) != 2 || got[0] != "one" || got[1] != "three" {
+		t.Errorf("sampled: got %v", got)
+	}
+
+	if r.Forwarded() != 8 {
+		t.Errorf("Forwarded: got %d expected 8", r.Forwarded())
+	}
+}
+
+func TestNoDestinations(t *testing.T) {
+	if _, err := New(); err != ErrNoDestinations {
+		t.Errorf("expected ErrNoDestinations got %v", err)
+	}
+
+	if _, err := New(Destination{Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2055}}, Destination{Spoof: true}); err != ErrNoAddr {
+		t.Errorf("expected ErrNoAddr got %v", err)
+	}
+}
@@ -1,66 +1,151 @@
+// tcp_view shows the top talkers of the sFlow or NetFlow v5 datagrams received, refreshed as they arrive.
+// The arguments form a flowfilter expression selecting the flows shown.
+//
+//	tcp_view -protocol netflow5 -listen :2055 -window 1m proto tcp and port 443
+//
+// With -json every completed window is written as a JSON line instead of a table.
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/flowrecord"
+	"github.com/wwicak/go-utils/netflow5"
 	"github.com/wwicak/go-utils/sflow"
-	"github.com/wwicak/go-utils/sflow/processor"
 	"net"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 )
 
-func HandleSamples(header *sflow.Header, samples []sflow.Sample) {
-	fmt.Printf("Got some\n")
-	fmt.Printf("Got %d samples\n", len(samples))
-	for _, s := range samples {
-		flowRecords := []sflow.Flow{}
-		counterRecords := []sflow.Counter{}
-		switch v := s.(type) {
-		default:
-			continue
-		case *sflow.FlowSample:
-			flowRecords = v.Records
-		case *sflow.FlowSampleExpanded:
-			flowRecords = v.Records
-		case *sflow.CounterSamples:
-			counterRecords = v.Records
-		}
+type options struct {
+	protocol string
+	listen   string
+	agents   string
+	window   time.Duration
+	refresh  time.Duration
+	top      int
+	sort     string
+	json     bool
+}
+
+// parseACL parses a comma separated list of CIDRs, nil when empty
+func parseACL(s string) (*acl.ACL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	return acl.New(strings.Split(s, ","), nil)
+}
+
+func parseOptions() (*options, *flowfilter.Filter, error) {
+	o := &options{}
+	flag.StringVar(&o.protocol, "protocol", "sflow", "the protocol received, sflow or netflow5")
+	flag.StringVar(&o.listen, "listen", "", "the UDP address listened at (default :6343 for sflow, :2055 for netflow5)")
+	flag.StringVar(&o.agents, "agent", "", "comma separated CIDRs of the agents shown")
+	flag.DurationVar(&o.window, "window", time.Minute, "the window the talkers are summed over")
+	flag.DurationVar(&o.refresh, "refresh", 2*time.Second, "the refresh interval, a divisor of the window")
+	flag.IntVar(&o.top, "top", 10, "the number of rows of each table")
+	flag.StringVar(&o.sort, "sort", "bytes", "the rows are sorted by bytes or packets")
+	flag.BoolVar(&o.json, "json", false, "write the windows as JSON lines instead of tables")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [filter expression]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-		if flowRecords != nil {
-			for i, flow := range flowRecords {
-				var ip4 *sflow.SampledIPV4
-				switch v := flow.(type) {
-				case *sflow.SampledIPV4:
-					ip4 = v
-				case *sflow.SampledHeader:
-					ip4 = v.SampledIPv4()
-					if ip4 != nil && (ip4.Protocol != 6 && ip4.Protocol != 17) {
-						ip4 = nil
-					}
-				}
-				if ip4 != nil {
-					fmt.Printf("%02d) src : %s dst : %s, (%d, %d)\n", i, net.IP(ip4.SrcIP[:]).String(), net.IP(ip4.SrcIP[:]).String(), ip4.SrcPort, ip4.DstPort)
-				}
-			}
+	if o.protocol != "sflow" && o.protocol != "netflow5" {
+		return nil, nil, fmt.Errorf("unknown protocol %q", o.protocol)
+	}
+
+	if o.listen == "" {
+		o.listen = ":6343"
+		if o.protocol == "netflow5" {
+			o.listen = ":2055"
 		}
-		if counterRecords != nil {
-			for i, counter := range counterRecords {
-				fmt.Printf("%d) %d\n", i, counter.CounterType())
-			}
+	}
+
+	if o.sort != "bytes" && o.sort != "packets" {
+		return nil, nil, fmt.Errorf("unknown sort %q", o.sort)
+	}
+
+	if o.refresh <= 0 || o.window%o.refresh != 0 {
+		return nil, nil, errors.New("the refresh interval must divide the window")
+	}
+
+	f, err := flowfilter.Parse(strings.Join(flag.Args(), " "))
+	if err != nil {
+		var syntaxError *flowfilter.SyntaxError
+		if errors.As(err, &syntaxError) {
+			fmt.Fprintln(os.Stderr, syntaxError.Caret())
 		}
+
+		return nil, nil, err
 	}
+
+	return o, f, nil
 }
 
 func main() {
-	processor := processor.Processor{
-		Handler: processor.SamplesHandlerFunc(HandleSamples),
+	o, f, err := parseOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	agents, err := parseACL(o.agents)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	v, err := newViewer(o, f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+
+	conn, err := net.ListenPacket("udp", o.listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	collector := flowcollector.Collector{
+		Conn:     conn,
+		ACL:      agents,
+		Affinity: true,
+	}
+
+	if o.protocol == "sflow" {
+		collector.SFlowHandler = flowcollector.SFlowHandlerFunc(func(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+			v.addRecords(acl.AddrOf(remote), func(records []flowrecord.FlowRecord, exporter netip.Addr) []flowrecord.FlowRecord {
+				return flowrecord.AppendSFlow(records, exporter, header, samples, time.Now())
+			})
+		})
+	} else {
+		collector.NetFlow5Handler = flowcollector.NetFlow5HandlerFunc(func(remote net.Addr, header *netflow5.Header, flows []netflow5.Flow) {
+			v.addRecords(acl.AddrOf(remote), func(records []flowrecord.FlowRecord, exporter netip.Addr) []flowrecord.FlowRecord {
+				return flowrecord.AppendNetFlow5(records, exporter, header, flows)
+			})
+		})
+	}
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
 		<-c
-		processor.Stop()
+		collector.Stop()
 	}()
 
-	processor.Start()
+	done := make(chan struct{})
+	go v.run(done)
+	collector.Start()
+	close(done)
 }
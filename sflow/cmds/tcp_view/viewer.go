@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"github.com/wwicak/go-utils/aggregator"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/flowrecord"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// maxKeys bounds the keys counted by each view for every refresh interval
+const maxKeys = 10000
+
+// view a table of top talkers grouped by some fields
+type view struct {
+	name       string
+	fields     aggregator.Field
+	aggregator *aggregator.Aggregator
+	latest     atomic.Pointer[aggregator.Window]
+}
+
+// agentStats the traffic of an agent since the start
+type agentStats struct {
+	Agent     netip.Addr `json:"agent"`
+	Datagrams uint64     `json:"datagrams"`
+	Records   uint64     `json:"records"`
+	Bytes     uint64     `json:"bytes"`
+	Packets   uint64     `json:"packets"`
+	LastSeen  time.Time  `json:"last_seen"`
+}
+
+type viewer struct {
+	options *options
+	filter  *flowfilter.Filter
+	views   []*view
+	lock    sync.Mutex
+	agents  map[netip.Addr]*agentStats
+	records []flowrecord.FlowRecord
+	output  *bufio.Writer
+	encoder *json.Encoder
+	// outputLock serializes the JSON lines written by the views
+	outputLock sync.Mutex
+}
+
+func newViewer(o *options, f *flowfilter.Filter) (*viewer, error) {
+	v := &viewer{
+		options: o,
+		filter:  f,
+		agents:  make(map[netip.Addr]*agentStats),
+		output:  bufio.NewWriter(os.Stdout),
+		views: []*view{
+			{name: "conversations", fields: aggregator.SrcAddr | aggregator.DstAddr | aggregator.Proto},
+			{name: "hosts", fields: aggregator.SrcAddr},
+			{name: "ports", fields: aggregator.Proto | aggregator.DstPort},
+		},
+	}
+
+	v.encoder = json.NewEncoder(v.output)
+	for _, vw := range v.views {
+		a, err := aggregator.New(aggregator.Config{
+			Fields:  vw.fields,
+			Window:  o.window,
+			Slide:   o.refresh,
+			MaxKeys: maxKeys,
+			Handler: aggregator.WindowHandlerFunc(func(w *aggregator.Window) {
+				v.sort(w)
+				if o.json {
+					v.writeJSON(vw.name, w)
+					return
+				}
+
+				vw.latest.Store(w)
+			}),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		vw.aggregator = a
+	}
+
+	return v, nil
+}
+
+// addRecords counts the records of a datagram of exporter appended by appendRecords
+func (v *viewer) addRecords(exporter netip.Addr, appendRecords func([]flowrecord.FlowRecord, netip.Addr) []flowrecord.FlowRecord) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	agent, found := v.agents[exporter]
+	if !found {
+		agent = &agentStats{Agent: exporter}
+		v.agents[exporter] = agent
+	}
+
+	agent.Datagrams++
+	agent.LastSeen = time.Now()
+	records := appendRecords(v.records[:0], exporter)
+	matched := records[:0]
+	for i := range records {
+		r := &records[i]
+		agent.Records++
+		agent.Bytes += r.ScaledBytes()
+		agent.Packets += r.ScaledPackets()
+		if !v.filter.Match(r) {
+			continue
+		}
+
+		// the records are placed at their arrival so the flows exported late are still shown
+		r.Start, r.End = time.Time{}, time.Time{}
+		matched = append(matched, *r)
+	}
+
+	for _, vw := range v.views {
+		vw.aggregator.AddRecords(matched)
+	}
+
+	v.records = records
+}
+
+// sort sorts the entries of a window by the sort option and keeps the top ones
+func (v *viewer) sort(w *aggregator.Window) {
+	if v.options.sort == "packets" {
+		slices.SortStableFunc(w.Entries, func(x, y aggregator.Entry) int {
+			return cmp.Compare(y.Packets, x.Packets)
+		})
+	}
+
+	if len(w.Entries) > v.options.top {
+		w.Entries = w.Entries[:v.options.top]
+	}
+}
+
+// run advances the views every refresh interval and shows them until done
+func (v *viewer) run(done <-chan struct{}) {
+	ticker := time.NewTicker(v.options.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			for _, vw := range v.views {
+				vw.aggregator.Advance(now)
+			}
+
+			if v.options.json {
+				v.writeAgentsJSON()
+			} else {
+				v.render(now)
+			}
+		}
+	}
+}
+
+// agentsSnapshot a copy of the agent stats sorted by address
+func (v *viewer) agentsSnapshot() []agentStats {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	agents := make([]agentStats, 0, len(v.agents))
+	for _, agent := range v.agents {
+		agents = append(agents, *agent)
+	}
+
+	slices.SortFunc(agents, func(x, y agentStats) int {
+		return x.Agent.Compare(y.Agent)
+	})
+
+	return agents
+}
+
+// render clears the terminal and draws the tables
+func (v *viewer) render(now time.Time) {
+	out := v.output
+	fmt.Fprint(out, "\033[H\033[2J")
+	fmt.Fprintf(out, "%s on %s, top %d by %s over %s, %s\n", v.options.protocol, v.options.listen, v.options.top, v.options.sort, v.options.window, now.Format(time.TimeOnly))
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, vw := range v.views {
+		fmt.Fprintf(out, "\n%s\n", vw.name)
+		w := vw.latest.Load()
+		switch vw.name {
+		case "conversations":
+			fmt.Fprintln(tw, "src\tdst\tproto\tbytes\tpackets\tbps\t")
+		case "hosts":
+			fmt.Fprintln(tw, "src\tbytes\tpackets\tbps\t")
+		case "ports":
+			fmt.Fprintln(tw, "proto\tport\tbytes\tpackets\tbps\t")
+		}
+
+		if w != nil {
+			seconds := w.End.Sub(w.Start).Seconds()
+			for _, e := range w.Entries {
+				counters := fmt.Sprintf("%s\t%s\t%s\t", humanize(e.Bytes), humanize(e.Packets), humanize(uint64(float64(e.Bytes*8)/seconds)))
+				switch vw.name {
+				case "conversations":
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.SrcAddr, e.DstAddr, protoName(e.Proto), counters)
+				case "hosts":
+					fmt.Fprintf(tw, "%s\t%s\n", e.SrcAddr, counters)
+				case "ports":
+					fmt.Fprintf(tw, "%s\t%d\t%s\n", protoName(e.Proto), e.DstPort, counters)
+				}
+			}
+		}
+
+		tw.Flush()
+	}
+
+	fmt.Fprintf(out, "\nagents\n")
+	fmt.Fprintln(tw, "agent\tdatagrams\trecords\tbytes\tpackets\tlast seen\t")
+	for _, agent := range v.agentsSnapshot() {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t\n", agent.Agent, agent.Datagrams, agent.Records, humanize(agent.Bytes), humanize(agent.Packets), agent.LastSeen.Format(time.TimeOnly))
+	}
+
+	tw.Flush()
+	out.Flush()
+}
+
+// jsonEntry an entry of a window, the fields the view is not grouped by are omitted
+type jsonEntry struct {
+	Src     string `json:"src,omitempty"`
+	Dst     string `json:"dst,omitempty"`
+	Proto   uint8  `json:"proto,omitempty"`
+	Port    uint16 `json:"port,omitempty"`
+	Bytes   uint64 `json:"bytes"`
+	Packets uint64 `json:"packets"`
+	Flows   uint64 `json:"flows"`
+}
+
+type jsonWindow struct {
+	View    string      `json:"view"`
+	Start   time.Time   `json:"start"`
+	End     time.Time   `json:"end"`
+	Records uint64      `json:"records"`
+	Entries []jsonEntry `json:"entries"`
+}
+
+type jsonAgents struct {
+	View   string       `json:"view"`
+	Time   time.Time    `json:"time"`
+	Agents []agentStats `json:"agents"`
+}
+
+func (v *viewer) writeJSON(name string, w *aggregator.Window) {
+	jw := jsonWindow{View: name, Start: w.Start, End: w.End, Records: w.Records, Entries: make([]jsonEntry, 0, len(w.Entries))}
+	for _, e := range w.Entries {
+		je := jsonEntry{Proto: e.Proto, Port: e.DstPort, Bytes: e.Bytes, Packets: e.Packets, Flows: e.Flows}
+		if e.SrcAddr.IsValid() {
+			je.Src = e.SrcAddr.String()
+		}
+		if e.DstAddr.IsValid() {
+			je.Dst = e.DstAddr.String()
+		}
+		jw.Entries = append(jw.Entries, je)
+	}
+
+	v.outputLock.Lock()
+	defer v.outputLock.Unlock()
+	v.encoder.Encode(jw)
+	v.output.Flush()
+}
+
+func (v *viewer) writeAgentsJSON() {
+	agents := jsonAgents{View: "agents", Time: time.Now(), Agents: v.agentsSnapshot()}
+	v.outputLock.Lock()
+	defer v.outputLock.Unlock()
+	v.encoder.Encode(agents)
+	v.output.Flush()
+}
+
+// humanize formats a count with a metric suffix
+func humanize(n uint64) string {
+	const units = "kMGTPE"
+	if n < 1000 {
+		return fmt.Sprintf("%d", n)
+	}
+
+	value := float64(n)
+	i := -1
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+
+	return fmt.Sprintf("%.1f%c", value, units[i])
+}
+
+func protoName(proto uint8) string {
+	switch proto {
+	case 1:
+		return "icmp"
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	case 58:
+		return "icmp6"
+	case 132:
+		return "sctp"
+	}
+
+	return fmt.Sprintf("%d", proto)
+}
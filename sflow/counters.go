@@ -160,3 +160,24 @@ func (p *Processor) Parse(data []byte) error {
 	p.FreeMemory = binary.BigEndian.Uint64(data[20:28])
 	return nil
 }
+
+// PortName the name of the interface of the data source, its ifName
+type PortName struct {
+	Name string
+}
+
+func (*PortName) CounterType() uint32 {
+	return PortNameType
+}
+
+func (p *PortName) Parse(data []byte) error {
+	if len(data) < 4 {
+		return ErrTooShort
+	}
+	length := binary.BigEndian.Uint32(data[0:4])
+	if uint32(len(data[4:])) < length {
+		return ErrOutOfBounds
+	}
+	p.Name = string(data[4 : 4+length])
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package metrics exposes the sFlow counter samples as Prometheus metrics.
+//
+// The Exporter keeps the latest interface, ethernet, VLAN and processor counters of every
+// agent and data source and renders them in the Prometheus text exposition format.
+//
+//	exporter := metrics.NewExporter(metrics.Config{})
+//	http.Handle("/metrics", exporter)
+//	collector := flowcollector.Collector{SFlowHandler: exporter}
+package metrics
+
+import (
+	"cmp"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/ifinventory"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Config the configuration of an Exporter
+type Config struct {
+	// Namespace the prefix of the metric names.
+	// Default : sflow
+	Namespace string
+	// Expiry the time after which the counters of a data source that stopped sending are removed.
+	// Default : 5m
+	Expiry time.Duration
+	// Interfaces names the interfaces in an if_info metric, with the name, description and role labels.
+	// Default : nil, no if_info metric
+	Interfaces *ifinventory.Inventory
+}
+
+// sourceKey a data source of an agent
+type sourceKey struct {
+	agent netip.Addr
+	// kind the data source type, 0 for an ifIndex
+	kind  uint32
+	index uint32
+}
+
+// source the latest counters of a data source
+type source struct {
+	key       sourceKey
+	ifCounter *sflow.IfCounter
+	ethernet  *sflow.EthernetCounter
+	vlan      *sflow.VlanCounters
+	processor *sflow.Processor
+	updated   time.Time
+}
+
+// Exporter an http.Handler serving the latest counters of the sFlow agents as Prometheus metrics.
+// It is safe for concurrent use and implements the sFlow handlers of the flowcollector and of the processor.
+type Exporter struct {
+	config  Config
+	lock    sync.Mutex
+	sources map[sourceKey]*source
+	clock   func() time.Time
+}
+
+// NewExporter returns an Exporter without counters
+func NewExporter(config Config) *Exporter {
+	if config.Namespace == "" {
+		config.Namespace = "sflow"
+	}
+
+	if config.Expiry <= 0 {
+		config.Expiry = 5 * time.Minute
+	}
+
+	return &Exporter{
+		config:  config,
+		sources: make(map[sourceKey]*source),
+		clock:   time.Now,
+	}
+}
+
+// HandleSFlow keeps the counters of a sFlow datagram received from remote.
+// The agent is the agent address of the datagram when it is IPv4, remote otherwise.
+func (e *Exporter) HandleSFlow(remote net.Addr, header *sflow.Header, samples []sflow.Sample) {
+	agent := acl.AddrOf(remote)
+	if header.AddressType == 1 {
+		agent = netip.AddrFrom4(header.AgentAddress)
+	}
+
+	e.Update(agent, samples)
+}
+
+// HandleSamples keeps the counters of a sFlow datagram as a processor SamplesHandler.
+// The datagrams without an IPv4 agent address are ignored.
+func (e *Exporter) HandleSamples(header *sflow.Header, samples []sflow.Sample) {
+	if header.AddressType != 1 {
+		return
+	}
+
+	e.Update(netip.AddrFrom4(header.AgentAddress), samples)
+}
+
+// Update keeps the counters of the counter samples of agent, the other samples are ignored
+func (e *Exporter) Update(agent netip.Addr, samples []sflow.Sample) {
+	now := e.clock()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, sample := range samples {
+		var key sourceKey
+		var records []sflow.Counter
+		switch v := sample.(type) {
+		case *sflow.CounterSamples:
+			key = sourceKey{agent: agent, kind: v.SourceId >> 24, index: v.SourceId & 0xFFFFFF}
+			records = v.Records
+		case *sflow.CountersSampleExpanded:
+			key = sourceKey{agent: agent, kind: v.SourceId.Type, index: v.SourceId.Index}
+			records = v.Records
+		default:
+			continue
+		}
+
+		s, found := e.sources[key]
+		if !found {
+			s = &source{key: key}
+			e.sources[key] = s
+		}
+
+		s.updated = now
+		for _, record := range records {
+			switch v := record.(type) {
+			case *sflow.IfCounter:
+				c := *v
+				s.ifCounter = &c
+			case *sflow.EthernetCounter:
+				c := *v
+				s.ethernet = &c
+			case *sflow.VlanCounters:
+				c := *v
+				s.vlan = &c
+			case *sflow.Processor:
+				c := *v
+				s.processor = &c
+			}
+		}
+	}
+}
+
+// Expire removes the counters of the data sources silent for longer than the expiry
+func (e *Exporter) Expire() {
+	deadline := e.clock().Add(-e.config.Expiry)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for key, s := range e.sources {
+		if s.updated.Before(deadline) {
+			delete(e.sources, key)
+		}
+	}
+}
+
+// snapshot copies the sources sorted by agent and data source
+func (e *Exporter) snapshot() []source {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	sources := make([]source, 0, len(e.sources))
+	for _, s := range e.sources {
+		sources = append(sources, *s)
+	}
+
+	slices.SortFunc(sources, func(x, y source) int {
+		if c := x.key.agent.Compare(y.key.agent); c != 0 {
+			return c
+		}
+
+		if c := cmp.Compare(x.key.kind, y.key.kind); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(x.key.index, y.key.index)
+	})
+	return sources
+}
+
+// ServeHTTP expires the silent data sources and writes the metrics of the others
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Expire()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(e.render(e.snapshot()))
+}
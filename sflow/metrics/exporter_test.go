@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"github.com/wwicak/go-utils/flowcollector"
+	"github.com/wwicak/go-utils/ifinventory"
+	"github.com/wwicak/go-utils/sflow"
+	"github.com/wwicak/go-utils/sflow/processor"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	_ flowcollector.SFlowHandler = (*Exporter)(nil)
+	_ processor.SamplesHandler   = (*Exporter)(nil)
+)
+
+func testSamples() []sflow.Sample {
+	return []sflow.Sample{
+		&sflow.CounterSamples{
+			SourceId: 3,
+			Records: []sflow.Counter{
+				&sflow.IfCounter{Index: 3, Type: 6, Speed: 1e9, Direction: 1, Status: 3, InOctets: 1 << 40, OutUcastPkts: 42},
+				&sflow.EthernetCounter{FCSErrors: 7},
+			},
+		},
+		&sflow.CountersSampleExpanded{
+			SourceId: sflow.DataSourceExpanded{Type: 0, Index: 3},
+			Records:  []sflow.Counter{&sflow.VlanCounters{VLANID: 100, Octets: 1500}},
+		},
+		&sflow.CounterSamples{
+			SourceId: 2<<24 | 1,
+			Records:  []sflow.Counter{&sflow.Processor{CPU_5s: 2500, CPU_1m: 0xFFFFFFFF, CPU_5m: 10000, TotalMemory: 1 << 30, FreeMemory: 1 << 29}},
+		},
+		&sflow.FlowSample{},
+	}
+}
+
+func scrape(t *testing.T, e *Exporter) string {
+	server := httptest.NewServer(e)
+	defer server.Close()
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestExporter(t *testing.T) {
+	e := NewExporter(Config{})
+	now := time.Unix(1700000000, 0)
+	e.clock = func() time.Time { return now }
+	header := &sflow.Header{AddressType: 1, AgentAddress: [4]byte{192, 0, 2, 1}}
+	e.HandleSFlow(&net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 6343}, header, testSamples())
+
+	body := scrape(t, e)
+	for _, line := range []string{
+		"# HELP sflow_if_in_octets_total The octets received on the interface.",
+		"# TYPE sflow_if_in_octets_total counter",
+		`sflow_if_in_octets_total{agent="192.0.2.1",ifIndex="3",type="6",direction="full-duplex"} 1099511627776`,
+		`sflow_if_out_unicast_packets_total{agent="192.0.2.1",ifIndex="3",type="6",direction="full-duplex"} 42`,
+		`sflow_if_speed_bps{agent="192.0.2.1",ifIndex="3",type="6",direction="full-duplex"} 1e+09`,
+		`sflow_if_oper_up{agent="192.0.2.1",ifIndex="3",type="6",direction="full-duplex"} 1`,
+		`sflow_ethernet_fcs_errors_total{agent="192.0.2.1",ifIndex="3"} 7`,
+		`sflow_vlan_octets_total{agent="192.0.2.1",ifIndex="3",vlan="100"} 1500`,
+		`sflow_processor_cpu_ratio{agent="192.0.2.1",source_type="2",source_index="1",interval="5s"} 0.25`,
+		`sflow_processor_cpu_ratio{agent="192.0.2.1",source_type="2",source_index="1",interval="5m"} 1`,
+		`sflow_processor_memory_free_bytes{agent="192.0.2.1",source_type="2",source_index="1"} 5.36870912e+08`,
+		`sflow_counters_last_update_timestamp_seconds{agent="192.0.2.1",ifIndex="3"} 1.7e+09`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+
+	if strings.Contains(body, `interval="1m"`) {
+		t.Error("unknown CPU utilization exported")
+	}
+
+	// every family is written once, its samples together
+	seen := map[string]bool{}
+	for _, line := range strings.Split(body, "\n") {
+		if name, found := strings.CutPrefix(line, "# TYPE "); found {
+			name = strings.Fields(name)[0]
+			if seen[name] {
+				t.Errorf("family %s written twice", name)
+			}
+			seen[name] = true
+		}
+	}
+
+	// a second agent, then the first goes silent
+	now = now.Add(4 * time.Minute)
+	e.HandleSamples(&sflow.Header{AddressType: 1, AgentAddress: [4]byte{192, 0, 2, 2}}, testSamples())
+	if body := scrape(t, e); !strings.Contains(body, `agent="192.0.2.1"`) || !strings.Contains(body, `agent="192.0.2.2"`) {
+		t.Errorf("expected both agents\n%s", body)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if body := scrape(t, e); strings.Contains(body, `agent="192.0.2.1"`) || !strings.Contains(body, `agent="192.0.2.2"`) {
+		t.Errorf("expected the first agent expired\n%s", body)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if body := scrape(t, e); body != "" {
+		t.Errorf("expected no metrics\n%s", body)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	text := &text{namespace: "test", index: make(map[string]*family)}
+	text.counter("escaped_total", "Escaped labels.", []label{{"name", "a\"b\\c\nd"}}, 1)
+	if got, want := string(text.bytes()), "# HELP test_escaped_total Escaped labels.\n# TYPE test_escaped_total counter\ntest_escaped_total{name=\"a\\\"b\\\\c\\nd\"} 1\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestInterfaceInfo(t *testing.T) {
+	inventory := &ifinventory.Inventory{}
+	agent := netip.MustParseAddr("192.0.2.1")
+	inventory.Store(map[ifinventory.Key]ifinventory.Interface{{Exporter: agent, Index: 3}: {Description: "Transit: ACME", Role: "transit"}})
+	e := NewExporter(Config{Interfaces: inventory})
+	samples := testSamples()
+	samples[0].(*sflow.CounterSamples).Records = append(samples[0].(*sflow.CounterSamples).Records, &sflow.PortName{Name: "xe-0/0/3"})
+	inventory.Update(agent, samples)
+	e.Update(agent, samples)
+	body := scrape(t, e)
+	if line := `sflow_if_info{agent="192.0.2.1",ifIndex="3",name="xe-0/0/3",description="Transit: ACME",role="transit"} 1`; !strings.Contains(body, line+"\n") {
+		t.Errorf("missing %s\n%s", line, body)
+	}
+
+	if strings.Count(body, "sflow_if_info{") != 1 {
+		t.Errorf("expected a single if_info\n%s", body)
+	}
+
+	samples[0].(*sflow.CounterSamples).Records[len(samples[0].(*sflow.CounterSamples).Records)-1] = &sflow.PortName{Name: "xe-\xff/0/3"}
+	inventory.Update(agent, samples)
+	if body := scrape(t, e); !strings.Contains(body, "name=\"xe-\uFFFD/0/3\"") || !utf8.ValidString(body) {
+		t.Errorf("expected the invalid UTF-8 replaced\n%s", body)
+	}
+}
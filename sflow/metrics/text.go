@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"github.com/wwicak/go-utils/sflow"
+	"strconv"
+	"strings"
+)
+
+// family the samples of a metric, written together
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+// text builds the Prometheus text exposition of the metrics, the families in the order they are first added
+type text struct {
+	namespace string
+	families  []*family
+	index     map[string]*family
+}
+
+// label a label name and value
+type label struct {
+	name  string
+	value string
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// add adds a sample of the metric namespace_name, value is already formatted
+func (t *text) add(name, kind, help string, labels []label, value string) {
+	name = t.namespace + "_" + name
+	f, found := t.index[name]
+	if !found {
+		f = &family{name: name, help: help, kind: kind}
+		t.families = append(t.families, f)
+		t.index[name] = f
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			b.WriteString(l.name)
+			b.WriteString(`="`)
+			labelEscaper.WriteString(&b, strings.ToValidUTF8(l.value, "\uFFFD"))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(value)
+	f.samples = append(f.samples, b.String())
+}
+
+func (t *text) counter(name, help string, labels []label, value uint64) {
+	t.add(name, "counter", help, labels, strconv.FormatUint(value, 10))
+}
+
+func (t *text) gauge(name, help string, labels []label, value float64) {
+	t.add(name, "gauge", help, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (t *text) bytes() []byte {
+	var b []byte
+	for _, f := range t.families {
+		b = append(b, "# HELP "...)
+		b = append(b, f.name...)
+		b = append(b, ' ')
+		b = append(b, f.help...)
+		b = append(b, "\n# TYPE "...)
+		b = append(b, f.name...)
+		b = append(b, ' ')
+		b = append(b, f.kind...)
+		b = append(b, '\n')
+		for _, sample := range f.samples {
+			b = append(b, sample...)
+			b = append(b, '\n')
+		}
+	}
+
+	return b
+}
+
+// ifDirections the names of the sFlow ifDirection values
+var ifDirections = []string{"unknown", "full-duplex", "half-duplex", "in", "out"}
+
+// sourceLabels the labels identifying the data source of an agent
+func sourceLabels(key sourceKey) []label {
+	labels := []label{{"agent", key.agent.String()}}
+	if key.kind == 0 {
+		return append(labels, label{"ifIndex", strconv.FormatUint(uint64(key.index), 10)})
+	}
+
+	return append(labels,
+		label{"source_type", strconv.FormatUint(uint64(key.kind), 10)},
+		label{"source_index", strconv.FormatUint(uint64(key.index), 10)})
+}
+
+// with returns a copy of labels followed by more
+func with(labels []label, more ...label) []label {
+	return append(labels[:len(labels):len(labels)], more...)
+}
+
+func bool64(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// render the Prometheus text exposition of the counters of sources
+func (e *Exporter) render(sources []source) []byte {
+	t := &text{namespace: e.config.Namespace, index: make(map[string]*family)}
+	for i := range sources {
+		s := &sources[i]
+		labels := sourceLabels(s.key)
+		t.gauge("counters_last_update_timestamp_seconds", "The time the last counter sample of the data source was received.",
+			labels, float64(s.updated.UnixNano())/1e9)
+		if c := s.ifCounter; c != nil {
+			renderIfCounter(t, s.key, c)
+		}
+
+		if s.key.kind == 0 && e.config.Interfaces != nil {
+			if i, found := e.config.Interfaces.Lookup(s.key.agent, s.key.index); found {
+				t.gauge("if_info", "The name, description and role of the interface, always 1.",
+					with(labels, label{"name", i.Name}, label{"description", i.Description}, label{"role", i.Role}), 1)
+			}
+		}
+
+		if c := s.ethernet; c != nil {
+			renderEthernetCounter(t, labels, c)
+		}
+
+		if c := s.vlan; c != nil {
+			renderVlanCounters(t, labels, c)
+		}
+
+		if c := s.processor; c != nil {
+			renderProcessor(t, labels, c)
+		}
+	}
+
+	return t.bytes()
+}
+
+func renderIfCounter(t *text, key sourceKey, c *sflow.IfCounter) {
+	direction := strconv.FormatUint(uint64(c.Direction), 10)
+	if int(c.Direction) < len(ifDirections) {
+		direction = ifDirections[c.Direction]
+	}
+
+	labels := []label{
+		{"agent", key.agent.String()},
+		{"ifIndex", strconv.FormatUint(uint64(c.Index), 10)},
+		{"type", strconv.FormatUint(uint64(c.Type), 10)},
+		{"direction", direction},
+	}
+
+	t.gauge("if_speed_bps", "The speed of the interface in bits per second.", labels, float64(c.Speed))
+	t.gauge("if_admin_up", "Whether the interface is administratively up.", labels, bool64(c.Status&1 != 0))
+	t.gauge("if_oper_up", "Whether the interface is operationally up.", labels, bool64(c.Status&2 != 0))
+	t.gauge("if_promiscuous", "Whether the interface is in promiscuous mode.", labels, bool64(c.PromiscuousMode == 1))
+	t.counter("if_in_octets_total", "The octets received on the interface.", labels, c.InOctets)
+	t.counter("if_in_unicast_packets_total", "The unicast packets received on the interface.", labels, uint64(c.InUcastPkts))
+	t.counter("if_in_multicast_packets_total", "The multicast packets received on the interface.", labels, uint64(c.InMulticastPkts))
+	t.counter("if_in_broadcast_packets_total", "The broadcast packets received on the interface.", labels, uint64(c.InBroadcastPkts))
+	t.counter("if_in_discards_total", "The inbound packets discarded.", labels, uint64(c.InDiscards))
+	t.counter("if_in_errors_total", "The inbound packets with errors.", labels, uint64(c.InErrors))
+	t.counter("if_in_unknown_protos_total", "The inbound packets of an unknown protocol.", labels, uint64(c.InUnknownProtos))
+	t.counter("if_out_octets_total", "The octets sent on the interface.", labels, c.OutOctets)
+	t.counter("if_out_unicast_packets_total", "The unicast packets sent on the interface.", labels, uint64(c.OutUcastPkts))
+	t.counter("if_out_multicast_packets_total", "The multicast packets sent on the interface.", labels, uint64(c.OutMulticastPkts))
+	t.counter("if_out_broadcast_packets_total", "The broadcast packets sent on the interface.", labels, uint64(c.OutBroadcastPkts))
+	t.counter("if_out_discards_total", "The outbound packets discarded.", labels, uint64(c.OutDiscards))
+	t.counter("if_out_errors_total", "The outbound packets with errors.", labels, uint64(c.OutErrors))
+}
+
+func renderEthernetCounter(t *text, labels []label, c *sflow.EthernetCounter) {
+	counters := []struct {
+		name  string
+		help  string
+		value uint32
+	}{
+		{"alignment_errors", "The frames received that are not an integral number of octets.", c.AlignmentErrors},
+		{"fcs_errors", "The frames received failing the frame check sequence.", c.FCSErrors},
+		{"single_collision_frames", "The frames sent after a single collision.", c.SingleCollisionFrames},
+		{"multiple_collision_frames", "The frames sent after more than one collision.", c.MultipleCollisionFrames},
+		{"sqe_test_errors", "The SQE test errors.", c.SQETestErrors},
+		{"deferred_transmissions", "The frames whose first transmission was delayed by a busy medium.", c.DeferredTransmissions},
+		{"late_collisions", "The collisions detected late in a transmission.", c.LateCollisions},
+		{"excessive_collisions", "The frames not sent because of excessive collisions.", c.ExcessiveCollisions},
+		{"internal_mac_transmit_errors", "The frames not sent because of an internal MAC error.", c.InternalMacTransmitErrors},
+		{"carrier_sense_errors", "The times the carrier sense was lost while sending.", c.CarrierSenseErrors},
+		{"frame_too_longs", "The frames received exceeding the maximum frame size.", c.FrameTooLongs},
+		{"internal_mac_receive_errors", "The frames not received because of an internal MAC error.", c.InternalMacReceiveErrors},
+		{"symbol_errors", "The symbol errors.", c.SymbolErrors},
+	}
+
+	for _, counter := range counters {
+		t.counter("ethernet_"+counter.name+"_total", counter.help, labels, uint64(counter.value))
+	}
+}
+
+func renderVlanCounters(t *text, labels []label, c *sflow.VlanCounters) {
+	labels = with(labels, label{"vlan", strconv.FormatUint(uint64(c.VLANID), 10)})
+	t.counter("vlan_octets_total", "The octets of the VLAN.", labels, c.Octets)
+	t.counter("vlan_unicast_packets_total", "The unicast packets of the VLAN.", labels, uint64(c.UcastPkts))
+	t.counter("vlan_multicast_packets_total", "The multicast packets of the VLAN.", labels, uint64(c.MulticastPkts))
+	t.counter("vlan_broadcast_packets_total", "The broadcast packets of the VLAN.", labels, uint64(c.BroadcastPkts))
+	t.counter("vlan_discards_total", "The packets of the VLAN discarded.", labels, uint64(c.Discards))
+}
+
+func renderProcessor(t *text, labels []label, c *sflow.Processor) {
+	// the utilizations are in hundredths of a percent, -1 when unknown
+	for _, cpu := range []struct {
+		interval string
+		value    uint32
+	}{{"5s", c.CPU_5s}, {"1m", c.CPU_1m}, {"5m", c.CPU_5m}} {
+		if cpu.value == 0xFFFFFFFF {
+			continue
+		}
+
+		t.gauge("processor_cpu_ratio", "The average CPU utilization over the interval, between 0 and 1.",
+			with(labels, label{"interval", cpu.interval}), float64(cpu.value)/10000)
+	}
+
+	t.gauge("processor_memory_total_bytes", "The total memory.", labels, float64(c.TotalMemory))
+	t.gauge("processor_memory_free_bytes", "The free memory.", labels, float64(c.FreeMemory))
+}
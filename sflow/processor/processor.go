@@ -2,12 +2,17 @@ package processor
 
 import (
 	"errors"
-	"github.com/wwicak/go-utils/bytearraypool"
-	"github.com/wwicak/go-utils/bytesdispatcher"
+	"github.com/wwicak/go-utils/acl"
+	"github.com/wwicak/go-utils/collector"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/packetsource"
+	"github.com/wwicak/go-utils/pcap"
+	"github.com/wwicak/go-utils/relay"
 	"github.com/wwicak/go-utils/sflow"
 	"net"
-	"runtime"
-	"strings"
+	"net/netip"
+	"slices"
+	"sync/atomic"
 )
 
 type SamplesHandler interface {
@@ -24,8 +29,12 @@ type Processor struct {
 	// Conn a net.PacketConn.
 	// Default : UDPConn listining at 127.0.0.1:6343.
 	Conn net.PacketConn
+	// Source where the packets are read from, taking precedence over Conn.
+	// A pcap.Reader replays a capture, Start returns once it is exhausted.
+	// Default : Conn
+	Source packetsource.PacketSource
 	// Handler a FlowHandler function to handle the netflow5 flows
-	// Required.
+	// Required unless Relay is set.
 	Handler SamplesHandler
 	// Workers the number of worker to work on the queue
 	// Default : The number of runtime.GOMAXPROCS
@@ -39,118 +48,155 @@ type Processor struct {
 	// ByteArrayPoolSize the number byte arrays to have avialable in the pool.
 	// Default : The same size of the backlog
 	ByteArrayPoolSize int
-	byteArrayPool     *bytearraypool.ByteArrayPool
-	stopChan          chan struct{}
-	dispatcher        *bytesdispatcher.Dispatcher
+	// Affinity when true packets from the same exporter are always handled by the same worker
+	// preserving their order.
+	// Default : false
+	Affinity bool
+	// AffinityKey computes the key used to select the worker when Affinity is set.
+	// Default : a hash of the remote IP address
+	AffinityKey func(remote net.Addr, packet []byte) uint64
+	// ACL the access list the remote address of the exporter is checked against.
+	// Default : nil, every exporter is accepted
+	ACL *acl.ACL
+	// AgentACL the access list the in-band agent address is checked against.
+	// Default : nil, every agent is accepted
+	AgentACL *acl.ACL
+	// SubAgentIDs the sub agent ids accepted.
+	// Default : empty, every sub agent is accepted
+	SubAgentIDs []uint32
+	// RequireAgentMatch when true the agent address must be the remote address of the exporter.
+	// Default : false
+	RequireAgentMatch bool
+	// Relay forwards every accepted packet unchanged to downstream collectors.
+	// Default : nil, no forwarding
+	Relay *relay.Relay
+	// Recorder records every accepted packet to pcap files.
+	// Default : nil, no recording
+	Recorder *pcap.Recorder
+	// Filter drops the flow samples not matching before the handler runs,
+	// the datagrams left without samples are not handled.
+	// Default : nil, every sample is handled
+	Filter    *flowfilter.Filter
+	collector collector.Collector[*datagram]
+	filtered  atomic.Uint64
+}
+
+// datagram a decoded sFlow datagram
+type datagram struct {
+	header  sflow.Header
+	samples []sflow.Sample
 }
 
 func (p *Processor) setDefaults() {
-	if p.Handler == nil {
+	if p.Handler == nil && p.Relay == nil {
 		panic(errors.New("No handler defined"))
 	}
 
-	if p.Workers <= 0 {
-		p.Workers = runtime.GOMAXPROCS(0)
+	p.collector.Config = collector.Config{
+		Address:           "127.0.0.1:6343",
+		Conn:              p.Conn,
+		Source:            p.Source,
+		Workers:           p.Workers,
+		Backlog:           p.Backlog,
+		PacketSize:        p.PacketSize,
+		ByteArrayPoolSize: p.ByteArrayPoolSize,
+		Affinity:          p.Affinity,
+		AffinityKey:       p.AffinityKey,
+		ACL:               p.ACL,
+		Accept:            p.accept,
+		Relay:             p.Relay,
+		Recorder:          p.Recorder,
 	}
 
-	if p.PacketSize <= 0 {
-		p.PacketSize = 2048
+	if p.Handler != nil {
+		p.collector.Decoder = collector.DecoderFunc[*datagram](decode)
+		p.collector.Sink = sinkForSamplesHandler(p.Handler, p.Filter, &p.filtered)
 	}
+}
 
-	if p.Backlog <= 0 {
-		p.Backlog = 100
+// decode decodes the header and samples of a datagram
+func decode(_ net.Addr, buffer []byte) (*datagram, error) {
+	d := &datagram{}
+	next, err := d.header.Parse(buffer)
+	if err != nil {
+		return nil, err
 	}
 
-	if p.ByteArrayPoolSize <= 0 {
-		p.ByteArrayPoolSize = p.Backlog
+	d.samples, err = d.header.ParseSamples(next)
+	if err != nil {
+		return nil, err
 	}
 
-	p.byteArrayPool = bytearraypool.NewByteArrayPool(p.ByteArrayPoolSize, p.PacketSize)
+	return d, nil
+}
 
-	if p.Conn == nil {
-		conn, err := net.ListenPacket("udp", "127.0.0.1:6343")
-		if err != nil {
-			panic(err)
-		}
+func sinkForSamplesHandler(h SamplesHandler, filter *flowfilter.Filter, filtered *atomic.Uint64) collector.Sink[*datagram] {
+	return collector.SinkFunc[*datagram](
+		func(remote net.Addr, d *datagram) {
+			if filter != nil {
+				n := len(d.samples)
+				d.samples = filter.FilterSFlow(acl.AddrOf(remote), &d.header, d.samples)
+				filtered.Add(uint64(n - len(d.samples)))
+				if len(d.samples) == 0 {
+					return
+				}
+			}
+
+			h.HandleSamples(&d.header, d.samples)
+		},
+	)
+}
 
-		p.Conn = conn
+// accept checks the agent of a packet accepted by the exporter access list
+func (p *Processor) accept(remote net.Addr, packet []byte) bool {
+	if p.AgentACL == nil && len(p.SubAgentIDs) == 0 && !p.RequireAgentMatch {
+		return true
 	}
 
-	if p.stopChan == nil {
-		p.stopChan = make(chan struct{}, 1)
+	head := sflow.Header{}
+	if _, err := head.Parse(packet); err != nil {
+		return false
+	}
+
+	// Only IPv4 agent addresses are decoded
+	if head.AddressType != 1 {
+		return false
 	}
 
-	p.dispatcher = bytesdispatcher.NewDispatcher(p.Workers, p.Backlog, bytesHandlerForSamplesHandler(p.Handler), p.byteArrayPool)
+	agent := netip.AddrFrom4(head.AgentAddress)
+	if !p.AgentACL.Allowed(agent) {
+		return false
+	}
+
+	if len(p.SubAgentIDs) > 0 && !slices.Contains(p.SubAgentIDs, head.SubAgentID) {
+		return false
+	}
+
+	return !p.RequireAgentMatch || agent == acl.AddrOf(remote)
 }
 
-func bytesHandlerForSamplesHandler(h SamplesHandler) bytesdispatcher.BytesHandler {
-	return bytesdispatcher.BytesHandlerFunc(
-		func(buffer []byte) {
-			head := sflow.Header{}
-			next, err := head.Parse(buffer)
-			if err != nil {
-				return
-			}
-			samples, err := head.ParseSamples(next)
-			if err != nil {
-				return
-			}
-			h.HandleSamples(&head, samples)
+// Rejected returns the number of packets dropped by the access lists
+func (p *Processor) Rejected() uint64 {
+	return p.collector.Rejected()
+}
 
-		},
-	)
+// Filtered returns the number of samples dropped by the filter
+func (p *Processor) Filtered() uint64 {
+	return p.filtered.Load()
 }
 
 // Stop stops the processor.
 func (p *Processor) Stop() {
-	c := p.stopChan
-	p.stopChan = nil
-	c <- struct{}{}
-	p.Conn.Close()
+	p.collector.Stop()
 }
 
 // StopAndWait stops the processor and wait for the dispatcher to cleanup
 func (p *Processor) StopAndWait() {
-	p.Stop()
-	p.dispatcher.Wait()
-}
-
-func (p *Processor) isCloseError(err error) bool {
-	if p.stopChan != nil {
-		return false
-	}
-
-	str := err.Error()
-	return strings.Contains(str, "use of closed network connection")
+	p.collector.StopAndWait()
 }
 
 // Start starts the processor.
 func (p *Processor) Start() {
 	p.setDefaults()
-	dispatcher := p.dispatcher
-	dispatcher.Run()
-	stopChan := p.stopChan
-
-LOOP:
-	for {
-		buffer := p.byteArrayPool.Get()
-		rlen, remote, err := p.Conn.ReadFrom(buffer)
-		if err != nil {
-			if p.isCloseError(err) {
-				break
-			}
-
-			panic(err)
-		}
-		_, _ = rlen, remote
-		dispatcher.SubmitJob(buffer)
-		select {
-		case <-stopChan:
-			break LOOP
-		default:
-			continue
-		}
-	}
-
-	dispatcher.Stop()
+	p.collector.Start()
 }
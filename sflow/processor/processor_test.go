@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"encoding/hex"
+	"github.com/wwicak/go-utils/flowfilter"
+	"github.com/wwicak/go-utils/packetsource"
+	"github.com/wwicak/go-utils/sflow"
+	"net"
+	"testing"
+)
+
+// sflowPacket a datagram of agent 10.0.0.253 holding 8 samples
+const sflowPacket = "00000005000000010a0000fd000000000020036611a086300000000800000002000000a8000219a1000000070000000200000001000000580000000700000006000000003b9aca0000000001000000030000000014809050002359ac0000064a00005dd6000000000000000000000000000000012e67a1890024e2e700341d4f01d6a75600000000000000000000000000000002000000340000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001000000840007ab6800000002000007d058b4258000000e7d000000020000000300000001000000010000005c000000010000004e000000040000004c8ee6cef957743e5b354b3a7208004500003c000040004006258f0a0000960a0000980050cc91323bdb526c0698c3a01216a0c6200000020405b40402080a3ed981073ed9780e01030307000000000002000000a8000219fe0000001800000002000000010000005800000018000000060000000005f5e10000000001000000030000001b4a3a4bbf0b7154bc0021d7730020a9f80000000000000001000000000000001be8ed06a30b95b84e0002552700000042000000000000000000000000000000020000003400000000000000010000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000010000008c0007ab6900000002000007d058b42e1400000e7e000000020000000100000001000000010000006400000001000000580000000400000054f229017058253e5b354b3a72080045000046fa7c400040062b090a0000960a000097c1ec2bcb12ca960a47a6705e8018002e187300000101080a3ed981e93ed971d36765742073657373696f6e2e74696d650d0a000000010000008c0001e99100000001000007d014ac2e7a000004e5000000020000000100000001000000010000006400000001000000580000000400000054f229017058253e5b354b3a72080045000046fa7c400040062b090a0000960a000097c1ec2bcb12ca960a47a6705e8018002e187300000101080a3ed981e93ed971d36765742073657373696f6e2e74696d650d0a00000001000000b80006693200000014000003e81a265962000001760000001600000014000000010000000100000090000000010000041400000004000000800040101840190026bb527a5e0800450004025b120000401104910a0000460a0103023b5cacbc03eeeaacdae81d9001bf87f0a2ddda96f01ff701fa157785f459cc82c96f226297b2a63a60e3ebe40f271acffc3961cbb919960c2af6804a2696abe8ae9f47ba043c684a3a7738c6ce567b3fb293aa3c745e013073a0ef5835e900000001000000b80001420300000003000007d00babed440000064d0000000200000003000000010000000100000090000000010000015e00000004000000808ee6cef957743e5b354b3a7208004500014cf73e400040062d400a0000960a0000980050cd086c7076fe9f850c28801800361d5200000101080a3ed981e93ed978ca485454502f312e3120323030204f4b0d0a446174653a204672692c203235204a616e20323031332032323a32343a303720474d540d0a5365727665723a2000000001000000b800058b5300000018000003e8174be44a0000016a0000001700000018000000010000000100000090000000010000045a00000004000000800013c4559181004010184019080045000448c0cc0000ff119771d177232240af2a1e01f401f404340000000000000000000074103d54000c75e2a8277d1c099628cfa2df7d4e6627dd4229c75e539ad1055f15a580660589a47a7b3eee5afce4a8978d46509eda6956359a25ad62c53ed8b0b780c31c25bdca403add0e2cc5d9"
+
+func TestProcessorAgentMatch(t *testing.T) {
+	data, err := hex.DecodeString(sflowPacket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed := packetsource.NewFeed(2)
+	feed.Send(&net.UDPAddr{IP: net.ParseIP("10.0.0.253"), Port: 6343}, data)
+	feed.Send(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6343}, data)
+	feed.End()
+	handled := 0
+	p := &Processor{
+		Source:            feed,
+		RequireAgentMatch: true,
+		Handler: SamplesHandlerFunc(func(header *sflow.Header, samples []sflow.Sample) {
+			handled++
+			if len(samples) != 8 {
+				t.Errorf("%d samples, want 8", len(samples))
+			}
+		}),
+	}
+
+	// Start returns once the feed is exhausted
+	p.Start()
+	if handled != 1 || p.Rejected() != 1 {
+		t.Errorf("handled %d rejected %d, want 1 and 1", handled, p.Rejected())
+	}
+}
+
+func TestProcessorFilter(t *testing.T) {
+	data, err := hex.DecodeString(sflowPacket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed := packetsource.NewFeed(2)
+	feed.Send(&net.UDPAddr{IP: net.ParseIP("10.0.0.253"), Port: 6343}, data)
+	feed.Send(&net.UDPAddr{IP: net.ParseIP("10.0.0.253"), Port: 6343}, data)
+	feed.End()
+	handled := 0
+	p := &Processor{
+		Source:  feed,
+		Workers: 1,
+		Filter:  flowfilter.MustParse("src port 80"),
+		Handler: SamplesHandlerFunc(func(header *sflow.Header, samples []sflow.Sample) {
+			handled++
+			flows := 0
+			for _, sample := range samples {
+				if _, ok := sample.(*sflow.FlowSample); ok {
+					flows++
+				}
+			}
+
+			if flows != 2 {
+				t.Errorf("%d flow samples, want 2", flows)
+			}
+		}),
+	}
+
+	p.Start()
+	if handled != 2 {
+		t.Errorf("handled %d, want 2", handled)
+	}
+}
@@ -111,7 +111,7 @@ func (si *SampledIPV6) Parse(data []byte) error {
 	si.Length = binary.BigEndian.Uint32(data[0:4])
 	si.Protocol = binary.BigEndian.Uint32(data[4:8])
 	copy(si.SrcIP[:], data[8:24])
-	copy(si.DstIP[:], data[12:40])
+	copy(si.DstIP[:], data[24:40])
 	si.SrcPort = binary.BigEndian.Uint32(data[40:44])
 	si.DstPort = binary.BigEndian.Uint32(data[44:48])
 	si.TCPFlags = binary.BigEndian.Uint32(data[48:52])
@@ -120,5 +120,5 @@ func (si *SampledIPV6) Parse(data []byte) error {
 }
 
 func (u *SampledIPV6) FlowType() uint32 {
-	return SampledIPV4Type
+	return SampledIPV6Type
 }
@@ -0,0 +1,46 @@
+package sflow
+
+import (
+	"encoding/hex"
+	"github.com/go-test/deep"
+	"testing"
+)
+
+func TestParseSampledIPV6(t *testing.T) {
+	// a sampled_ipv6 record of a TCP segment from [2001:db8::1]:443 to [2001:db8::2]:51000
+	record_hex := "000005dc00000006" +
+		"20010db8000000000000000000000001" +
+		"20010db8000000000000000000000002" +
+		"000001bb0000c738000000180000000a"
+	raw_bytes, err := hex.DecodeString(record_hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sampledIPv6 := &SampledIPV6{}
+	if err := sampledIPv6.Parse(raw_bytes); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(
+		sampledIPv6,
+		&SampledIPV6{
+			Length:   1500,
+			Protocol: 6,
+			SrcIP:    [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1},
+			DstIP:    [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 2},
+			SrcPort:  443,
+			DstPort:  51000,
+			TCPFlags: 0x18,
+			ToS:      10,
+		}); diff != nil {
+		t.Error(diff)
+	}
+
+	if sampledIPv6.FlowType() != SampledIPV6Type {
+		t.Errorf("flow type %d, expected %d", sampledIPv6.FlowType(), SampledIPV6Type)
+	}
+
+	if err := sampledIPv6.Parse(raw_bytes[:55]); err != ErrTooShort {
+		t.Errorf("expected ErrTooShort got %v", err)
+	}
+}
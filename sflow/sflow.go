@@ -45,6 +45,7 @@ const (
 
 const (
 	ProcessorType = 1001
+	PortNameType  = 1005
 )
 
 type Sample interface {
@@ -237,6 +238,8 @@ func (df *DataFormat) ParseCounter(data []byte) (Counter, []byte, error) {
 		counter = &VlanCounters{}
 	case ProcessorType:
 		counter = &Processor{}
+	case PortNameType:
+		counter = &PortName{}
 	}
 
 	if counter == nil {
@@ -274,3 +274,30 @@ func CheckUint64(t *testing.T, name string, got, expected uint64) {
 		t.Errorf("%s: Got %d expected %d", name, got, expected)
 	}
 }
+
+func TestPortName(t *testing.T) {
+	// a port name record: format 1005, length, then the XDR string "ge-0/0/10" padded to 4 bytes
+	raw_bytes, err := hex.DecodeString("000003ed000000100000000967652d302f302f3130000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	df := DataFormat{}
+	next, err := df.Parse(raw_bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, rest, err := df.ParseCounter(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := deep.Equal(counter, Counter(&PortName{Name: "ge-0/0/10"})); diff != nil || len(rest) != 0 {
+		t.Error(diff, len(rest))
+	}
+
+	if err := (&PortName{}).Parse([]byte{0, 0, 0, 9, 'g'}); err != ErrOutOfBounds {
+		t.Errorf("expected ErrOutOfBounds got %v", err)
+	}
+}